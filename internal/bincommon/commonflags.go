@@ -13,6 +13,7 @@ import (
 	"strings"
 
 	"fortio.org/dflag"
+	"fortio.org/fortio/pkg/fgrpc"
 	"fortio.org/fortio/pkg/fhttp"
 	"fortio.org/fortio/pkg/fnet"
 	"fortio.org/fortio/pkg/periodic"
@@ -54,6 +55,8 @@ var (
 	stdClientFlag       = flag.Bool("stdclient", false, "Использовать более медленный стандартный клиент net/http (медленнее, но поддерживает h2/h2c)")
 	http10Flag          = flag.Bool("http1.0", false, "Использовать HTTP/1.0 (вместо HTTP/1.1)")
 	h2Flag              = flag.Bool("h2", false, "Попытаться использовать HTTP/2.0 / h2 (вместо HTTP/1.1) как для TLS, так и для h2c")
+	h3Flag              = flag.Bool("h3", false, "Использовать HTTP/3 (QUIC) вместо HTTP/1.1 или h2, только для https://")
+	h2StreamsFlag       = flag.Int("h2-streams", 1, "Число потоков (горутин), разделяющих одно h2/h2c соединение быстрого клиента, т.е. одновременных стримов на соединение")
 	httpsInsecureFlag   = flag.Bool("k", false, "Не проверять сертификаты в HTTPS/TLS/gRPC соединениях")
 	httpsInsecureFlagL  = flag.Bool("https-insecure", false, "Длинная форма флага -k")
 	resolve             = flag.String("resolve", "", "Разрешить имя хоста в этот `IP`")
@@ -122,7 +125,25 @@ func SharedMain() {
 	// По умолчанию предполагается, что все IP получены в первом вызове и выполняется round-robin по ним.
 	// first просто берёт первый ответ, rr чередует каждый ответ.
 	dflag.Flag("dns-method", fnet.FlagResolveMethod)
+	// Задержки TCP и UDP echo серверов перед ответом, тот же синтаксис что и delay= HTTP echo сервера
+	// (фиксированные, вероятностные или распределения, например normal(20ms,5ms)).
+	dflag.Flag("tcp-echo-delay", fnet.TCPEchoDelay)
+	dflag.Flag("udp-echo-delay", fnet.UDPEchoDelay)
 	dflag.Flag("echo-server-default-params", fhttp.DefaultEchoServerParams)
+	// Файл маршрутов (JSON или YAML) echo сервера: ответы по шаблонам метода и пути, перечитывается при изменении.
+	dflag.Flag("echo-routes", fhttp.EchoRoutes)
+	dflag.Flag("echo-routes-check-interval", fhttp.MockRoutesCheckInterval)
+	// Расписания хаоса: фазы "длительность?параметры" через ;, например "60s;30s?status=503:30;30s?delay=2s",
+	// запускаются при установке флага (при старте или динамически), состояние в /debug/chaos.
+	dflag.Flag("echo-chaos", fhttp.EchoChaosSchedule)
+	dflag.Flag("grpc-ping-chaos", fgrpc.PingChaosSchedule)
+	// Число последних запросов к echo серверу, сохраняемых для /debug/requests (JSON) и /debug/requests/live.
+	dflag.Flag("echo-capture", fhttp.RequestCapture)
+	// Эмуляция ограничения частоты (token bucket) echo сервера: "rate[:burst[:key]]", key - global, ip или
+	// header.Имя (например ключ API), запросы сверх лимита получают 429 с Retry-After и RateLimit-* заголовками.
+	dflag.Flag("echo-ratelimit", fhttp.EchoRateLimit)
+	// Параметры внедрения сбоев по умолчанию для gRPC ping и health серверов (status, delay, reset, not-serving).
+	dflag.Flag("grpc-ping-default-faults", fgrpc.DefaultPingServerFaults)
 	dflag.FlagBool("proxy-all-headers", fhttp.Fetch2CopiesAllHeader)
 	dflag.Flag("server-idle-timeout", fhttp.ServerIdleTimeout)
 	// MaxDelay - максимальная задержка для ответов echoserver.
@@ -194,6 +215,8 @@ func SharedHTTPOptions() *fhttp.HTTPOptions {
 	httpOpts.URL = url
 	httpOpts.HTTP10 = *http10Flag
 	httpOpts.H2 = *h2Flag
+	httpOpts.H2MaxStreams = *h2StreamsFlag
+	httpOpts.H3 = *h3Flag
 	httpOpts.DisableFastClient = *stdClientFlag
 	httpOpts.DisableKeepAlive = !*keepAliveFlag
 	httpOpts.AllowHalfClose = *halfCloseFlag
@@ -35,6 +35,7 @@ import (
 	"fortio.org/fortio/internal/bincommon"
 	"fortio.org/fortio/internal/grol"
 	"fortio.org/fortio/internal/ui"
+	"fortio.org/fortio/pkg/dnsrunner"
 	"fortio.org/fortio/pkg/fgrpc"
 	"fortio.org/fortio/pkg/fhttp"
 	"fortio.org/fortio/pkg/fnet"
@@ -45,6 +46,7 @@ import (
 	"fortio.org/fortio/pkg/tcprunner"
 	"fortio.org/fortio/pkg/udprunner"
 	"fortio.org/fortio/pkg/version"
+	"fortio.org/fortio/pkg/wsrunner"
 	"fortio.org/fortio/pkg/log"
 	"fortio.org/safecast"
 	"fortio.org/scli"
@@ -52,7 +54,7 @@ import (
 
 // fortio's help/args message.
 func helpArgsString() string {
-	return fmt.Sprintf("target\n%s\n%s\n%s\n%s\n%s\n%s\n%s\n%s\n%s\n%s\n%s",
+	return fmt.Sprintf("target\n%s\n%s\n%s\n%s\n%s\n%s\n%s\n%s\n%s\n%s\n%s\n%s",
 		"where command is one of: load (load testing), server (starts ui, rest api,",
 		" http-echo, redirect, proxies, tcp-echo, udp-echo and grpc ping servers), ",
 		" tcp-echo (only the tcp-echo server), udp-echo (only udp-echo server),",
@@ -62,7 +64,8 @@ func helpArgsString() string {
 		" or script (interactive grol script mode or script file),",
 		" or version (prints the full version and build details).",
 		"where target is a URL (http load tests) or host:port (grpc health test),",
-		" or tcp://host:port (tcp load test), or udp://host:port (udp load test),",
+		" or tcp://host:port (tcp load test, tcps:// for tls), or udp://host:port (udp load test),",
+		" or dns://server[:port]/name?type=A&proto=udp|tcp|tls (dns load test),",
 		" or any URL for Kafka load test (requires -kafka-bootstrap and -kafka-topic flags).")
 }
 
@@ -91,12 +94,26 @@ var (
 		"http-echo server port. Can be in the form of host:port, ip:port, `port` or /unix/domain/path or \""+disabled+"\".")
 	tcpPortFlag = flag.String("tcp-port", "8078",
 		"tcp-echo server port. Can be in the form of host:port, ip:port, `port` or /unix/domain/path or \""+disabled+"\".")
+	tcpDiscardPortFlag = flag.String("tcp-discard-port", disabled,
+		"tcp discard server port (reads and ignores everything, for throughput tests). Can be in the form of host:port,"+
+			" ip:port, `port` or \""+disabled+"\".")
+	tcpsPortFlag = flag.String("tcps-port", disabled,
+		"TLS tcp-echo server port, requires -cert and -key. Can be in the form of host:port, ip:port, `port` or \""+
+			disabled+"\".")
 	udpPortFlag = flag.String("udp-port", "8078",
 		"udp-echo server port. Can be in the form of host:port, ip:port, `port` or \""+disabled+"\".")
 	udpAsyncFlag = flag.Bool("udp-async", false, "if true, udp echo server will use separate go routine to reply")
+	h3PortFlag   = flag.String("h3-port", disabled,
+		"HTTP/3 (QUIC) echo server udp port, requires -cert and -key. Can be in the form of host:port, ip:port, `port` or \""+
+			disabled+"\".")
 	grpcPortFlag = flag.String("grpc-port", fnet.DefaultGRPCPort,
 		"grpc server port. Can be in the form of host:port, ip:port or `port` or /unix/domain/path or \""+disabled+
 			"\" to not start the gRPC server.")
+	grpcMockPortFlag = flag.String("grpc-mock-port", disabled,
+		"gRPC mock server port, serving all the services of the -grpc-proto or -grpc-protoset descriptors."+
+			" Can be in the form of host:port, ip:port or `port` or /unix/domain/path or \""+disabled+"\".")
+	grpcMockConfigFlag = flag.String("grpc-mock-config", "",
+		"JSON `file` of the gRPC mock server responses, delays and error rates per method")
 	echoDbgPathFlag = flag.String("echo-debug-path", "/debug",
 		"http echo server `URI` for debug, empty turns off that part (more secure)")
 	jsonFlag = flag.String("json", "",
@@ -111,10 +128,30 @@ var (
 	dataDirFlag = flag.String("data-dir", ".", "`Directory` where JSON results are stored/read")
 	proxies     = make([]string, 0)
 	httpMulties = make([]string, 0)
+	grpcChecks  []string
 
 	allowInitialErrorsFlag = flag.Bool("allow-initial-errors", false, "Allow and don't abort on initial warmup errors")
+	streamModeFlag         = flag.String("stream", "", "HTTP streaming `mode`: sse or ndjson, to measure events timing")
 	abortOnFlag            = flag.Int("abort-on", 0,
 		"HTTP status code that if encountered aborts the run. e.g., 503 or -1 for socket errors.")
+	retryFlag = flag.Int("retry", 0,
+		"Maximum number of HTTP `attempts` per request, including the first one (0 or 1 for no retries)")
+	retryBackoffFlag    = flag.Duration("retry-backoff", 10*time.Millisecond, "Backoff before the first retry, doubled for each subsequent one")
+	retryMaxBackoffFlag = flag.Duration("retry-max-backoff", time.Second, "Maximum backoff between retries")
+	retryJitterFlag     = flag.Float64("retry-jitter", 0.5, "`Fraction` of each retry backoff randomly removed (0 none to 1 full jitter)")
+	retryOnFlag         = flag.String("retry-on", "",
+		"Comma separated HTTP status `codes` to retry, -1 for socket errors (default -1,429,502,503,504)")
+	retryAfterFlag = flag.Bool("retry-after", true, "Wait (at least) the Retry-After of the response before retrying")
+	hedgeFlag      = flag.Duration("hedge", 0,
+		"Send a second (hedged) HTTP request if the first one isn't done after this `delay` and take the first success")
+	connModeFlag = flag.String("conn-mode", "",
+		"Connection `mode` of the http and tcp runs: churn (new connection for each request, to measure connections/sec,"+
+			" not with -h3 nor the -h2 fast client)"+
+			" or hold (connections opened before the run and held, the requests being the keepalives)")
+	throughputFlag = flag.Bool("throughput", false,
+		"Report the bandwidth (Mbps) of each connection and in aggregate over time, for http and tcp runs")
+	throughputIntervalFlag = flag.Duration("throughput-interval", fnet.DefaultThroughputInterval,
+		"`Interval` of the -throughput bandwidth over time")
 	autoSaveFlag = flag.Bool("a", false, "Automatically save JSON result with filename based on labels & timestamp")
 	redirectFlag = flag.String("redirect-port", "8081", "Redirect all incoming traffic to https:// URL"+
 		" (need ingress to work properly). Can be in the form of host:port, ip:port, `port` or \""+disabled+"\" to disable the feature.")
@@ -138,7 +175,25 @@ var (
 	pingDelayFlag  = flag.Duration("grpc-ping-delay", 0, "gRPC ping delay in response")
 	streamsFlag    = flag.Int("s", 1, "Number of streams per gRPC connection")
 	grpcMethodFlag = flag.String("grpc-method", "",
-		"Fully-qualified gRPC method to call (Service/Method). Service must have reflection enabled.")
+		"Fully-qualified gRPC method to call (Service/Method). Uses reflection unless -grpc-proto or -grpc-protoset are set.")
+	grpcProtoFlag      = flag.String("grpc-proto", "", "Comma separated `list` of .proto files defining -grpc-method")
+	grpcImportPathFlag = flag.String("grpc-import-path", "", "Comma separated `list` of import paths for the -grpc-proto files")
+	grpcProtoSetFlag   = flag.String("grpc-protoset", "",
+		"Compiled FileDescriptorSet `file` (protoc --descriptor_set_out --include_imports) defining -grpc-method")
+	grpcStreamMessagesFlag = flag.Int("grpc-stream-messages", 0,
+		"Streaming -grpc-method: messages sent per stream (client and bidi streams, default "+
+			fmt.Sprint(fgrpc.DefaultStreamMessages)+" when -grpc-stream-duration isn't set either) or received"+
+			" before ending the stream (server streams, default 0 is until the server ends it)")
+	grpcStreamQPSFlag      = flag.Float64("grpc-stream-qps", 0, "Streaming -grpc-method: rate of messages sent within a stream, 0 for no wait")
+	grpcStreamDurationFlag = flag.Duration("grpc-stream-duration", 0, "Streaming -grpc-method: maximum lifetime of each stream")
+	grpcPayloadFeederFlag  = flag.String("grpc-payload-feeder", "",
+		"JSONL `file` providing the {feed.field} values of the -grpc-method payload template, one line per call")
+	grpcTimeoutFlag         = flag.Duration("grpc-timeout", 0, "gRPC load: deadline of each call (or stream), 0 for none")
+	grpcCaptureMetadataFlag = flag.String("grpc-capture-metadata", "",
+		"gRPC load: comma separated `list` of response header/trailer keys (ie a server id) whose values are tallied")
+	grpcLBFlag = flag.String("grpc-lb", "",
+		"gRPC load: client side load balancing `policy`, round_robin or pick_first, for a dns:///host:port destination"+
+			" or a comma separated list of addresses")
 
 	maxStreamsFlag = flag.Uint("grpc-max-streams", 0,
 		"MaxConcurrentStreams for the gRPC server. Default (0) is to leave the option unset.")
@@ -152,6 +207,24 @@ var (
 	mirrorOriginFlag = flag.Bool("multi-mirror-origin", true, "Mirror the request URL to the target for multi proxies (-M)")
 	multiSerialFlag  = flag.Bool("multi-serial-mode", false, "Multi server (-M) requests one at a time instead of parallel mode")
 	udpTimeoutFlag   = flag.Duration("udp-timeout", udprunner.UDPTimeOutDefaultValue, "Udp timeout")
+	udpStreamFlag    = flag.Bool("udp-stream", false,
+		"udp:// stream mode: send sequence numbered packets at the qps rate without waiting for each echo and"+
+			" report loss, duplicates, reordering and jitter (-udp-timeout is then the wait for the last packets)")
+	// tcp:// runner reply modes.
+	tcpModeFlag = flag.String("tcp-mode", tcprunner.TCPModeEcho,
+		"tcp:// runner reply `mode`: echo, send (no reply), delimiter, fixed, length (prefixed) or match")
+	tcpDelimiterFlag    = flag.String("tcp-delimiter", `\n`, "End of the replies in tcp delimiter mode, with Go `escapes`")
+	tcpReadSizeFlag     = flag.Int("tcp-read-size", 0, "Size in `bytes` of the replies in tcp fixed mode")
+	tcpLengthPrefixFlag = flag.Int("tcp-length-prefix", 4, "Size in `bytes` (1, 2, 4 or 8) of the big endian length before each reply in tcp length mode")
+	tcpExpectFlag       = flag.String("tcp-expect", "", "`Regexp` the tcp replies must match (read until it matches in match mode)")
+	tcpExpectBytesFlag  = flag.String("tcp-expect-bytes", "", "Exact tcp replies, with Go `escapes`, ie \\x00\\x01")
+	tcpMaxReplyFlag     = flag.Int("tcp-max-reply", tcprunner.DefaultMaxReplySize, "Maximum size in `bytes` of the tcp replies")
+	tcpTLSResumeFlag    = flag.Bool("tcp-tls-resume", false, "Resume the TLS sessions when reconnecting in tcps:// runs")
+	// dns:// runner flags.
+	dnsRandomSubdomainFlag = flag.Bool("dns-random-subdomain", false,
+		"dns:// runner: prefix each queried name with a random label, to bypass the resolver caches")
+	dnsNamesFlag = flag.String("dns-names", "",
+		"dns:// runner: `file` of names (one per line) to query in turn instead of the name of the url")
 
 	accessLogFileFlag = flag.String("access-log-file", "",
 		"file `path` to log all requests to. Maybe have performance impacts")
@@ -222,6 +295,13 @@ func FortioMainWithConfig(config *bincommon.FortioConfig) int {
 			httpMulties = append(httpMulties, value)
 			return nil
 		})
+	flag.Func("grpc-check",
+		"-grpc-method response assertion (can be repeated): path=value, path!=value, path~regexp or path (set),"+
+			" e.g. -grpc-check \"items[0].status=ACTIVE\", failures are counted as MISMATCH",
+		func(value string) error {
+			grpcChecks = append(grpcChecks, value)
+			return nil
+		})
 	flag.Func("kafka-consumer-metrics-url",
 		"Consumer service metrics URL with name, format: \"name url\" (can be repeated), "+
 			"e.g., -kafka-consumer-metrics-url \"service1 http://host1:8080/metrics\" "+
@@ -293,6 +373,10 @@ func FortioMainWithConfig(config *bincommon.FortioConfig) int {
 	case "tcp-echo":
 		isServer = serverArgCheck()
 		fnet.TCPEchoServer("tcp-echo", *tcpPortFlag)
+		startTCPSEcho()
+		if *tcpDiscardPortFlag != disabled {
+			fnet.TCPDiscardServer("tcp-discard", *tcpDiscardPortFlag)
+		}
 		startProxies()
 	case "udp-echo":
 		isServer = serverArgCheck()
@@ -309,12 +393,34 @@ func FortioMainWithConfig(config *bincommon.FortioConfig) int {
 		if *tcpPortFlag != disabled {
 			fnet.TCPEchoServer("tcp-echo", *tcpPortFlag)
 		}
+		startTCPSEcho()
+		if *tcpDiscardPortFlag != disabled {
+			fnet.TCPDiscardServer("tcp-discard", *tcpDiscardPortFlag)
+		}
 		if *udpPortFlag != disabled {
 			fnet.UDPEchoServer("udp-echo", *udpPortFlag, *udpAsyncFlag)
 		}
 		if *grpcPortFlag != disabled {
 			fgrpc.PingServer(*grpcPortFlag, *healthSvcFlag, safecast.MustConv[uint32](*maxStreamsFlag), tlsOptions)
 		}
+		if *grpcMockPortFlag != disabled {
+			_, err := fgrpc.MockServer(*grpcMockPortFlag, &fgrpc.MockServerOptions{
+				ProtoFiles:           fgrpc.SplitList(*grpcProtoFlag),
+				ProtoImportPaths:     fgrpc.SplitList(*grpcImportPathFlag),
+				ProtoSet:             *grpcProtoSetFlag,
+				Config:               *grpcMockConfigFlag,
+				MaxConcurrentStreams: safecast.MustConv[uint32](*maxStreamsFlag),
+				TLSOptions:           tlsOptions,
+			})
+			if err != nil {
+				log.Fatalf("Unable to start the gRPC mock server: %v", err)
+			}
+		}
+		if *h3PortFlag != disabled {
+			if _, addr := fhttp.ServeH3(*h3PortFlag, *echoDbgPathFlag, tlsOptions); addr == nil {
+				os.Exit(1) // error already logged
+			}
+		}
 		if *redirectFlag != disabled {
 			fhttp.RedirectToHTTPS(*redirectFlag)
 		}
@@ -372,6 +478,24 @@ func serverLoop(sync string) {
 	}
 }
 
+// startTCPSEcho starts the TLS tcp echo server when -tcps-port is set.
+func startTCPSEcho() {
+	if *tcpsPortFlag == disabled {
+		return
+	}
+	to := &bincommon.SharedHTTPOptions().TLSOptions
+	if !to.DoTLS() {
+		cli.ErrUsage("Error: -tcps-port requires -cert and -key")
+	}
+	cfg, err := to.TLSConfig()
+	if err != nil {
+		os.Exit(1) // error already logged
+	}
+	if fnet.TCPEchoServerTLS("tcps-echo", *tcpsPortFlag, cfg) == nil {
+		os.Exit(1) // error already logged
+	}
+}
+
 func startProxies() int {
 	ctx := context.Background()
 	numProxies := 0
@@ -522,16 +646,43 @@ func fortioLoad(justCurl bool, percList []float64) {
 			GrpcCompression:    *grpcCompression,
 			Profiler:           *profileFlag,
 			GrpcMethod:         *grpcMethodFlag,
+			StreamMessages:     *grpcStreamMessagesFlag,
+			StreamQPS:          *grpcStreamQPSFlag,
+			StreamDuration:     *grpcStreamDurationFlag,
+			ProtoFiles:         fgrpc.SplitList(*grpcProtoFlag),
+			ProtoImportPaths:   fgrpc.SplitList(*grpcImportPathFlag),
+			ProtoSet:           *grpcProtoSetFlag,
+			PayloadFeeder:      *grpcPayloadFeederFlag,
+			ResponseChecks:     grpcChecks,
+			CallTimeout:        *grpcTimeoutFlag,
+			CaptureMetadata:    fgrpc.SplitList(*grpcCaptureMetadataFlag),
+			LoadBalancing:      *grpcLBFlag,
 		}
 		o.TLSOptions = httpOpts.TLSOptions
 		res, err = fgrpc.RunGRPCTest(&o)
-	case strings.HasPrefix(url, tcprunner.TCPURLPrefix):
+	case strings.HasPrefix(url, tcprunner.TCPURLPrefix), strings.HasPrefix(url, tcprunner.TCPSURLPrefix):
 		o := tcprunner.RunnerOptions{
 			RunnerOptions: ro,
 		}
 		o.ReqTimeout = httpOpts.HTTPReqTimeOut
 		o.Destination = url
 		o.Payload = httpOpts.Payload
+		o.Mode = *tcpModeFlag
+		o.ReadSize = *tcpReadSizeFlag
+		o.LengthPrefix = *tcpLengthPrefixFlag
+		o.Expect = *tcpExpectFlag
+		o.MaxReplySize = *tcpMaxReplyFlag
+		o.TLSOptions = httpOpts.TLSOptions
+		o.SessionResumption = *tcpTLSResumeFlag
+		o.ConnMode = *connModeFlag
+		o.MeasureThroughput = *throughputFlag
+		o.ThroughputInterval = *throughputIntervalFlag
+		if o.Delimiter, err = tcprunner.ParseEscaped(*tcpDelimiterFlag); err != nil {
+			cli.ErrUsage("Invalid -tcp-delimiter: %v", err)
+		}
+		if o.ExpectBytes, err = tcprunner.ParseEscaped(*tcpExpectBytesFlag); err != nil {
+			cli.ErrUsage("Invalid -tcp-expect-bytes: %v", err)
+		}
 		res, err = tcprunner.RunTCPTest(&o)
 	case strings.HasPrefix(url, udprunner.UDPURLPrefix):
 		o := udprunner.RunnerOptions{
@@ -540,7 +691,33 @@ func fortioLoad(justCurl bool, percList []float64) {
 		o.ReqTimeout = *udpTimeoutFlag
 		o.Destination = url
 		o.Payload = httpOpts.Payload
+		o.Stream = *udpStreamFlag
 		res, err = udprunner.RunUDPTest(&o)
+	case strings.HasPrefix(url, dnsrunner.DNSURLPrefix):
+		o := dnsrunner.RunnerOptions{
+			RunnerOptions: ro,
+		}
+		o.ReqTimeout = httpOpts.HTTPReqTimeOut
+		o.Destination = url
+		o.TLSOptions = httpOpts.TLSOptions
+		o.RandomSubdomain = *dnsRandomSubdomainFlag
+		if *dnsNamesFlag != "" {
+			data, rerr := os.ReadFile(*dnsNamesFlag)
+			if rerr != nil {
+				cli.ErrUsage("Unable to read -dns-names %s: %v", *dnsNamesFlag, rerr)
+			}
+			o.Names = strings.Fields(string(data))
+		}
+		res, err = dnsrunner.RunDNSTest(&o)
+	case wsrunner.IsWebSocketURL(url):
+		o := wsrunner.RunnerOptions{
+			RunnerOptions: ro,
+		}
+		o.TLSOptions = httpOpts.TLSOptions
+		o.ReqTimeout = httpOpts.HTTPReqTimeOut
+		o.Destination = url
+		o.Payload = httpOpts.Payload
+		res, err = wsrunner.RunWSTest(&o)
 	case *kafkaBootstrapFlag != "" && *kafkaTopicFlag != "":
 		// Parse bootstrap servers
 		bootstrapServers := strings.Split(*kafkaBootstrapFlag, ",")
@@ -565,6 +742,21 @@ func fortioLoad(justCurl bool, percList []float64) {
 			Profiler:           *profileFlag,
 			AllowInitialErrors: *allowInitialErrorsFlag,
 			AbortOn:            *abortOnFlag,
+			StreamMode:         *streamModeFlag,
+			ConnMode:           *connModeFlag,
+			MeasureThroughput:  *throughputFlag,
+			ThroughputInterval: *throughputIntervalFlag,
+			Retry: fhttp.RetryOptions{
+				MaxAttempts:       *retryFlag,
+				Backoff:           *retryBackoffFlag,
+				MaxBackoff:        *retryMaxBackoffFlag,
+				Jitter:            *retryJitterFlag,
+				RespectRetryAfter: *retryAfterFlag,
+				HedgeDelay:        *hedgeFlag,
+			},
+		}
+		if o.Retry.RetryOn, err = fhttp.ParseRetryOn(*retryOnFlag); err != nil {
+			cli.ErrUsage("Invalid -retry-on: %v", err)
 		}
 		res, err = fhttp.RunHTTPTest(&o)
 	}
@@ -11,6 +11,7 @@ import (
 	"strings"
 
 	"fortio.org/fortio/pkg/fhttp"
+	"fortio.org/fortio/pkg/metrics"
 	"fortio.org/fortio/pkg/version"
 )
 
@@ -19,6 +20,10 @@ var (
 	debugPath = flag.String("debug-path", "/debug", "путь для debug url, пустое значение отключает эту часть")
 	certFlag  = flag.String("cert", "", "`Путь` к файлу сертификата для клиентского или серверного TLS")
 	keyFlag   = flag.String("key", "", "`Путь` к файлу ключа, соответствующего -cert")
+	routes    = flag.String("routes", "", "`Путь` к JSON или YAML файлу маршрутов echo сервера (перечитывается при изменении)")
+	capture   = flag.Int64("capture", 0, "`Число` последних запросов, сохраняемых для /debug/requests и /debug/requests/live, 0 отключает")
+	chaos     = flag.String("chaos", "", "Расписание хаоса: `фазы` \"длительность?параметры\" через ;, например \"60s;30s?status=503:30\"")
+	ratelimit = flag.String("ratelimit", "", "Лимит частоты запросов `rate[:burst[:key]]`, key: global, ip или header.Имя, например \"10:20:ip\"")
 )
 
 func main() {
@@ -27,8 +32,29 @@ func main() {
 		fmt.Println(version.Full())
 		os.Exit(0)
 	}
-	if _, addr := fhttp.ServeTLS(*port, *debugPath, &fhttp.TLSOptions{Cert: *certFlag, Key: *keyFlag}); addr == nil {
+	mux, addr := fhttp.ServeTLS(*port, *debugPath, &fhttp.TLSOptions{Cert: *certFlag, Key: *keyFlag})
+	if addr == nil {
 		os.Exit(1) // ошибка уже залогирована
 	}
+	if *debugPath != "" {
+		// метрики Prometheus сервера
+		mux.HandleFunc(strings.TrimSuffix(*debugPath, "/")+"/metrics", metrics.Handler)
+	}
+	if err := fhttp.EchoRoutes.Set(*routes); err != nil {
+		fmt.Fprintf(os.Stderr, "Ошибка загрузки маршрутов: %v\n", err)
+		os.Exit(1)
+	}
+	if err := fhttp.RequestCapture.SetV(*capture); err != nil {
+		fmt.Fprintf(os.Stderr, "Ошибка -capture: %v\n", err)
+		os.Exit(1)
+	}
+	if err := fhttp.EchoChaosSchedule.Set(*chaos); err != nil {
+		fmt.Fprintf(os.Stderr, "Ошибка расписания хаоса: %v\n", err)
+		os.Exit(1)
+	}
+	if err := fhttp.EchoRateLimit.Set(*ratelimit); err != nil {
+		fmt.Fprintf(os.Stderr, "Ошибка -ratelimit: %v\n", err)
+		os.Exit(1)
+	}
 	select {}
 }
@@ -12,12 +12,14 @@ import (
 	"path/filepath"
 	"strings"
 
+	"fortio.org/fortio/pkg/dnsrunner"
 	"fortio.org/fortio/pkg/fgrpc"
 	"fortio.org/fortio/pkg/fhttp"
 	"fortio.org/fortio/pkg/periodic"
 	"fortio.org/fortio/pkg/rapi"
 	"fortio.org/fortio/pkg/tcprunner"
 	"fortio.org/fortio/pkg/udprunner"
+	"fortio.org/fortio/pkg/wsrunner"
 	"fortio.org/fortio/pkg/log"
 	"grol.io/grol/eval"
 	"grol.io/grol/extensions"
@@ -44,7 +46,7 @@ func createFortioGrolFunctions(state *eval.State, scriptInit string) error {
 		Name:    "fortio.load",
 		MinArgs: 2,
 		MaxArgs: 2,
-		Help: "Запускает нагрузочный тест указанного типа (http, tcp, udp, grpc) с переданными параметрами map/json " +
+		Help: "Запускает нагрузочный тест указанного типа (http, tcp, udp, ws, dns, grpc) с переданными параметрами map/json " +
 			"(url, qps и т.д., добавьте \"save\":true для сохранения результата в файл)",
 		ArgTypes:  []object.Type{object.STRING, object.MAP},
 		Callback:  grolLoad,
@@ -114,6 +116,20 @@ func grolLoad(env any, _ string, args []object.Object) object.Object {
 		}
 		uro.Destination = ro.URL
 		res, err = udprunner.RunUDPTest(&uro)
+	case "ws":
+		wro := wsrunner.RunnerOptions{
+			RunnerOptions: ro.RunnerOptions,
+		}
+		wro.Destination = ro.URL
+		wro.TLSOptions = ro.TLSOptions
+		res, err = wsrunner.RunWSTest(&wro)
+	case "dns":
+		dro := dnsrunner.RunnerOptions{
+			RunnerOptions: ro.RunnerOptions,
+		}
+		dro.Destination = ro.URL
+		dro.TLSOptions = ro.TLSOptions
+		res, err = dnsrunner.RunDNSTest(&dro)
 	case "grpc":
 		gro := fgrpc.GRPCRunnerOptions{}
 		// повторно десериализуем так как grpc имеет уникальные опции.
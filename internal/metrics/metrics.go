@@ -7,6 +7,8 @@ import (
 	"runtime"
 	"strconv"
 
+	"fortio.org/fortio/pkg/fhttp"
+	smetrics "fortio.org/fortio/pkg/metrics"
 	"fortio.org/fortio/pkg/rapi"
 	"fortio.org/fortio/pkg/log"
 	"fortio.org/scli"
@@ -36,5 +38,14 @@ fortio_runs_total `)
 # TYPE fortio_goroutines gauge
 fortio_goroutines `)
 	_, _ = io.WriteString(w, strconv.FormatInt(int64(runtime.NumGoroutine()), 10))
+	_, _ = io.WriteString(w, `
+# HELP fortio_chaos_phase Текущая фаза расписания хаоса (начиная с 1, 0 если не запущено)
+# TYPE fortio_chaos_phase gauge`)
+	for _, c := range fhttp.ChaosSchedules() {
+		st := c.Status()
+		_, _ = io.WriteString(w, "\nfortio_chaos_phase{schedule=\""+st.Name+"\"} "+strconv.Itoa(st.Phase))
+	}
 	_, _ = io.WriteString(w, "\n")
+	// Метрики серверов (запросы, байты, соединения, задержки, внедрённые сбои).
+	_ = smetrics.Write(w)
 }
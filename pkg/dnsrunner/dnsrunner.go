@@ -0,0 +1,616 @@
+// Copyright 2026 Fortio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package dnsrunner is the DNS load runner: queries sent at the target QPS over UDP, TCP
+// or TLS (DoT) with the latency recorded per response code.
+// Package dnsrunner — DNS-раннер нагрузки: запросы с целевым QPS по UDP, TCP или TLS (DoT)
+// с записью задержки по коду ответа.
+package dnsrunner // import "fortio.org/fortio/pkg/dnsrunner"
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"fortio.org/fortio/pkg/fhttp"
+	"fortio.org/fortio/pkg/log"
+	"fortio.org/fortio/pkg/periodic"
+	"fortio.org/fortio/pkg/stats"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+type DNSResultMap map[string]int64
+
+var (
+	// DNSURLPrefix is the URL prefix for triggering DNS load.
+	// DNSURLPrefix — это URL-префикс для запуска DNS-нагрузки.
+	DNSURLPrefix = "dns://"
+	errTimeout   = errors.New("timeout")
+	errMismatch  = errors.New("reply not matching the query")
+)
+
+// Transports, values of the proto query parameter of the url.
+// Транспорты, значения параметра proto в url.
+const (
+	ProtoUDP = "udp"
+	ProtoTCP = "tcp"
+	ProtoTLS = "tls" // DNS over TLS (RFC 7858)
+)
+
+// Default server ports.
+// Порты сервера по умолчанию.
+const (
+	DefaultPort    = "53"
+	DefaultTLSPort = "853"
+)
+
+// Response codes, keys of RunnerResults.RetCodes and RCodeLatency (along with the errors),
+// the other codes are RCODE<n>.
+// Коды ответа, ключи RunnerResults.RetCodes и RCodeLatency (наряду с ошибками),
+// остальные коды — RCODE<n>.
+const (
+	RCodeNoError  = "NOERROR"
+	RCodeFormErr  = "FORMERR"
+	RCodeServFail = "SERVFAIL"
+	RCodeNXDomain = "NXDOMAIN"
+	RCodeNotImp   = "NOTIMP"
+	RCodeRefused  = "REFUSED"
+)
+
+// RCodeName returns the usual (dig) name of a response code.
+// RCodeName возвращает обычное (как в dig) имя кода ответа.
+func RCodeName(rc dnsmessage.RCode) string {
+	switch rc {
+	case dnsmessage.RCodeSuccess:
+		return RCodeNoError
+	case dnsmessage.RCodeFormatError:
+		return RCodeFormErr
+	case dnsmessage.RCodeServerFailure:
+		return RCodeServFail
+	case dnsmessage.RCodeNameError:
+		return RCodeNXDomain
+	case dnsmessage.RCodeNotImplemented:
+		return RCodeNotImp
+	case dnsmessage.RCodeRefused:
+		return RCodeRefused
+	default:
+		return fmt.Sprintf("RCODE%d", rc)
+	}
+}
+
+var queryTypes = map[string]dnsmessage.Type{
+	"A":     dnsmessage.TypeA,
+	"NS":    dnsmessage.TypeNS,
+	"CNAME": dnsmessage.TypeCNAME,
+	"SOA":   dnsmessage.TypeSOA,
+	"PTR":   dnsmessage.TypePTR,
+	"MX":    dnsmessage.TypeMX,
+	"TXT":   dnsmessage.TypeTXT,
+	"AAAA":  dnsmessage.TypeAAAA,
+	"SRV":   dnsmessage.TypeSRV,
+	"SVCB":  dnsmessage.TypeSVCB,
+	"HTTPS": dnsmessage.TypeHTTPS,
+	"ANY":   dnsmessage.TypeALL,
+}
+
+// ParseType returns the query type from its name (A, AAAA, MX...) or number (TYPE65 or 65),
+// A when empty.
+// ParseType возвращает тип запроса по имени (A, AAAA, MX...) или номеру (TYPE65 или 65),
+// A если пусто.
+func ParseType(s string) (dnsmessage.Type, error) {
+	if s == "" {
+		return dnsmessage.TypeA, nil
+	}
+	s = strings.ToUpper(s)
+	if t, ok := queryTypes[s]; ok {
+		return t, nil
+	}
+	n, err := strconv.ParseUint(strings.TrimPrefix(s, "TYPE"), 10, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid dns query type %q", s)
+	}
+	return dnsmessage.Type(n), nil
+}
+
+// DNSOptions are options to the DNSClient.
+// DNSOptions — это опции для DNSClient.
+type DNSOptions struct {
+	fhttp.TLSOptions // for DoT
+	// dns://server[:port]/name?type=A&proto=udp|tcp|tls
+	Destination string
+	ReqTimeout  time.Duration
+	// RandomSubdomain prefixes each queried name with a random label, to bypass the caches.
+	// RandomSubdomain добавляет к каждому запрашиваемому имени случайную метку, чтобы обойти кэши.
+	RandomSubdomain bool
+	// Names are queried in turn instead of the name of the Destination url.
+	// Names запрашиваются по очереди вместо имени из url Destination.
+	Names []string `json:",omitempty"`
+}
+
+// RunnerOptions includes the base RunnerOptions plus DNS specific
+// options.
+// RunnerOptions включает базовые RunnerOptions плюс специфичные для DNS опции.
+type RunnerOptions struct {
+	periodic.RunnerOptions
+	DNSOptions
+}
+
+// RunnerResults is the aggregated result of a DNS run.
+// Also is the internal type used per thread/goroutine.
+// RunnerResults — это агрегированный результат DNS-теста.
+// Также является внутренним типом, используемым для каждого потока/горутины.
+type RunnerResults struct {
+	periodic.RunnerResults
+	DNSOptions
+	Protocol  string
+	QueryType string
+	// Response codes and errors counts.
+	// Количество кодов ответа и ошибок.
+	RetCodes DNSResultMap
+	// Latency histograms by response code.
+	// Гистограммы задержки по коду ответа.
+	RCodeLatency map[string]*stats.HistogramData
+	// Replies with the TC (truncated) bit set.
+	// Ответы с установленным битом TC (усечён).
+	Truncated        int64
+	TruncatedPercent float64
+	SocketCount      int
+	BytesSent        int64
+	BytesReceived    int64
+	client           *DNSClient
+	aborter          *periodic.Aborter
+}
+
+// Run sends one query and waits for its reply. Main call being run at the target QPS.
+// NOERROR and NXDOMAIN are successes, other response codes and errors (timeouts...) are errors.
+// To be set as the Function in RunnerOptions.
+// Run отправляет один запрос и ждёт ответа. Основной вызов, выполняемый с целевым QPS.
+// NOERROR и NXDOMAIN — успех, остальные коды ответа и ошибки (таймауты...) — ошибки.
+// Должен быть установлен как Function в RunnerOptions.
+func (dnsstate *RunnerResults) Run(ctx context.Context, t periodic.ThreadID) (bool, string) {
+	log.Debugf("Calling in %d", t)
+	rcode, err := dnsstate.client.Query(ctx)
+	if err != nil {
+		errStr := err.Error()
+		dnsstate.RetCodes[errStr]++
+		return false, errStr
+	}
+	dnsstate.RetCodes[rcode]++
+	return rcode == RCodeNoError || rcode == RCodeNXDomain, rcode
+}
+
+// DNSClient is the client used for DNS load testing.
+// DNSClient — это клиент, используемый для нагрузочного тестирования DNS.
+type DNSClient struct {
+	server          string // host:port
+	proto           string
+	qtype           dnsmessage.Type
+	name            string // fully qualified
+	names           []string
+	randomSubdomain bool
+	tlsConfig       *tls.Config
+	conn            net.Conn
+	req             []byte
+	reply           []byte
+	connID          int
+	queryCount      int64
+	socketCount     int
+	bytesSent       int64
+	bytesReceived   int64
+	truncated       int64
+	reqTimeout      time.Duration
+	offset          time.Duration
+	resolution      float64
+	latency         map[string]*stats.Histogram
+}
+
+// fqdn adds the trailing dot to the name if missing.
+// fqdn добавляет завершающую точку к имени, если её нет.
+func fqdn(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
+
+// NewDNSClient creates and initialize and returns a client based on the DNSOptions.
+// NewDNSClient создаёт, инициализирует и возвращает клиент на основе DNSOptions.
+func NewDNSClient(o *DNSOptions, offset time.Duration, resolution float64) (*DNSClient, error) {
+	if !strings.HasPrefix(strings.ToLower(o.Destination), DNSURLPrefix) {
+		return nil, fmt.Errorf("invalid dns url %q", o.Destination)
+	}
+	u, err := url.Parse(o.Destination)
+	if err != nil {
+		return nil, err
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("missing dns server in %q", o.Destination)
+	}
+	q := u.Query()
+	c := DNSClient{
+		proto:           strings.ToLower(q.Get("proto")),
+		randomSubdomain: o.RandomSubdomain,
+		req:             make([]byte, 0, 512),
+		reply:           make([]byte, 64*1024),
+		reqTimeout:      o.ReqTimeout,
+		offset:          offset,
+		resolution:      resolution,
+		latency:         make(map[string]*stats.Histogram),
+	}
+	port := DefaultPort
+	switch c.proto {
+	case "":
+		c.proto = ProtoUDP
+	case ProtoUDP, ProtoTCP:
+	case ProtoTLS:
+		port = DefaultTLSPort
+		if c.tlsConfig, err = o.TLSOptions.TLSConfig(); err != nil {
+			return nil, err
+		}
+		c.tlsConfig.ServerName = u.Hostname()
+	default:
+		return nil, fmt.Errorf("invalid dns proto %q, should be %s, %s or %s", c.proto, ProtoUDP, ProtoTCP, ProtoTLS)
+	}
+	if u.Port() != "" {
+		port = u.Port()
+	}
+	c.server = net.JoinHostPort(u.Hostname(), port)
+	if c.qtype, err = ParseType(q.Get("type")); err != nil {
+		return nil, err
+	}
+	if name := strings.Trim(u.Path, "/"); name != "" {
+		c.name = fqdn(name)
+	}
+	for _, n := range o.Names {
+		if n = strings.TrimSpace(n); n != "" {
+			c.names = append(c.names, fqdn(n))
+		}
+	}
+	for _, n := range append([]string{c.name}, c.names...) {
+		if _, err = dnsmessage.NewName(n); n != "" && err != nil {
+			return nil, fmt.Errorf("invalid dns name %q: %w", n, err)
+		}
+	}
+	if c.name == "" && len(c.names) == 0 {
+		return nil, fmt.Errorf("missing name to query in %q", o.Destination)
+	}
+	if c.reqTimeout <= 0 {
+		log.Debugf("Request timeout not set, using default %v", fhttp.HTTPReqTimeOutDefaultValue)
+		c.reqTimeout = fhttp.HTTPReqTimeOutDefaultValue
+	}
+	return &c, nil
+}
+
+// nextName returns the name for the next query: from the list (starting at a per connection offset)
+// or the url, with a random label prepended in random subdomain mode.
+// nextName возвращает имя для следующего запроса: из списка (начиная со смещения соединения)
+// или из url, со случайной меткой в начале в режиме случайных поддоменов.
+func (c *DNSClient) nextName() string {
+	name := c.name
+	if len(c.names) > 0 {
+		name = c.names[(int64(c.connID)+c.queryCount)%int64(len(c.names))]
+	}
+	if !c.randomSubdomain {
+		return name
+	}
+	label := fmt.Sprintf("%012x", rand.Uint64()&0xffffffffffff) //nolint:gosec // not for security.
+	if name == "." {
+		return label + "."
+	}
+	return label + "." + name
+}
+
+func (c *DNSClient) connect(ctx context.Context) (net.Conn, error) {
+	c.socketCount++
+	dialer := &net.Dialer{Timeout: c.reqTimeout}
+	var conn net.Conn
+	var err error
+	switch c.proto {
+	case ProtoTLS:
+		tlsDialer := &tls.Dialer{NetDialer: dialer, Config: c.tlsConfig}
+		conn, err = tlsDialer.DialContext(ctx, "tcp", c.server)
+	default:
+		conn, err = dialer.DialContext(ctx, c.proto, c.server)
+	}
+	if err != nil {
+		log.Errf("[%d] Unable to connect to %v (%s): %v", c.connID, c.server, c.proto, err)
+		return nil, err
+	}
+	return conn, nil
+}
+
+// shortErr replaces timeouts by errTimeout, to not have the addresses in the result keys.
+// shortErr заменяет таймауты на errTimeout, чтобы в ключах результатов не было адресов.
+func shortErr(err error) error {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return errTimeout
+	}
+	return err
+}
+
+// Query sends the next query and returns the response code of the reply, recording its latency.
+// Query отправляет следующий запрос и возвращает код ответа, записывая его задержку.
+func (c *DNSClient) Query(ctx context.Context) (string, error) {
+	start := time.Now()
+	h, err := c.query(ctx)
+	if err != nil {
+		return "", err
+	}
+	rcode := RCodeName(h.RCode)
+	if h.Truncated {
+		c.truncated++
+	}
+	hist := c.latency[rcode]
+	if hist == nil {
+		hist = stats.NewHistogram(c.offset.Seconds(), c.resolution)
+		c.latency[rcode] = hist
+	}
+	hist.Record(time.Since(start).Seconds())
+	return rcode, nil
+}
+
+// query sends the next query and returns the header of its reply.
+// query отправляет следующий запрос и возвращает заголовок ответа.
+func (c *DNSClient) query(ctx context.Context) (dnsmessage.Header, error) {
+	c.queryCount++
+	name, err := dnsmessage.NewName(c.nextName())
+	if err != nil {
+		return dnsmessage.Header{}, err
+	}
+	msg := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: uint16(rand.Uint32()), RecursionDesired: true}, //nolint:gosec // 16 bits id.
+		Questions: []dnsmessage.Question{{Name: name, Type: c.qtype, Class: dnsmessage.ClassINET}},
+	}
+	if c.proto == ProtoUDP {
+		return c.exchangeUDP(ctx, &msg)
+	}
+	return c.exchangeStream(ctx, &msg)
+}
+
+// exchangeUDP sends the query in one datagram and waits for the matching reply, skipping the late
+// replies to the previous (timed out) queries.
+// exchangeUDP отправляет запрос одной датаграммой и ждёт соответствующий ответ, пропуская опоздавшие
+// ответы на предыдущие (по таймауту) запросы.
+func (c *DNSClient) exchangeUDP(ctx context.Context, msg *dnsmessage.Message) (dnsmessage.Header, error) {
+	if c.conn == nil {
+		conn, err := c.connect(ctx)
+		if conn == nil {
+			return dnsmessage.Header{}, err
+		}
+		c.conn = conn
+	}
+	req, err := msg.AppendPack(c.req[:0])
+	if err != nil {
+		return dnsmessage.Header{}, err
+	}
+	c.req = req
+	if err = c.conn.SetDeadline(time.Now().Add(c.reqTimeout)); err != nil {
+		return dnsmessage.Header{}, err
+	}
+	n, err := c.conn.Write(req)
+	c.bytesSent += int64(n)
+	if err != nil {
+		log.Errf("[%d] Unable to write to %v: %v", c.connID, c.server, err)
+		return dnsmessage.Header{}, err
+	}
+	for {
+		n, err = c.conn.Read(c.reply)
+		if err != nil {
+			return dnsmessage.Header{}, shortErr(err)
+		}
+		c.bytesReceived += int64(n)
+		h, err := checkReply(c.reply[:n], msg)
+		if errors.Is(err, errMismatch) {
+			log.LogVf("[%d] Skipping reply id %d not matching query %d", c.connID, h.ID, msg.Header.ID)
+			continue
+		}
+		return h, err
+	}
+}
+
+// exchangeStream sends the length prefixed query on the TCP or TLS connection and reads the reply,
+// reconnecting once when the reused connection got closed.
+// exchangeStream отправляет запрос с префиксом длины по TCP или TLS соединению и читает ответ,
+// переподключаясь один раз, если повторно используемое соединение было закрыто.
+func (c *DNSClient) exchangeStream(ctx context.Context, msg *dnsmessage.Message) (dnsmessage.Header, error) {
+	conn := c.conn
+	reuse := (conn != nil)
+	if !reuse {
+		var err error
+		conn, err = c.connect(ctx)
+		if conn == nil {
+			return dnsmessage.Header{}, err
+		}
+	}
+	c.conn = nil // because of error returns and single retry
+	req, err := msg.AppendPack(c.req[:2])
+	if err != nil {
+		_ = conn.Close()
+		return dnsmessage.Header{}, err
+	}
+	c.req = req
+	binary.BigEndian.PutUint16(req, uint16(len(req)-2)) //nolint:gosec // a query is small.
+	deadlineErr := conn.SetDeadline(time.Now().Add(c.reqTimeout))
+	n, err := conn.Write(req)
+	c.bytesSent += int64(n)
+	if err != nil || deadlineErr != nil {
+		_ = conn.Close()
+		if reuse {
+			// it's ok for the (idle) connection to die once, auto reconnect:
+			return c.exchangeStream(ctx, msg) // recurse once
+		}
+		log.Errf("[%d] Unable to write to %v: %v", c.connID, c.server, err)
+		return dnsmessage.Header{}, errors.Join(err, deadlineErr)
+	}
+	h, err := c.readStream(conn, msg)
+	if err != nil {
+		_ = conn.Close()
+		if reuse && errors.Is(err, io.EOF) {
+			// server closed the idle connection (before or while we were sending), reconnect once:
+			return c.exchangeStream(ctx, msg)
+		}
+		log.LogVf("[%d] Unable to read reply from %v: %v", c.connID, c.server, err)
+		return h, shortErr(err)
+	}
+	c.conn = conn
+	return h, nil
+}
+
+func (c *DNSClient) readStream(conn net.Conn, msg *dnsmessage.Message) (dnsmessage.Header, error) {
+	if _, err := io.ReadFull(conn, c.reply[:2]); err != nil {
+		return dnsmessage.Header{}, err
+	}
+	size := int(binary.BigEndian.Uint16(c.reply))
+	if _, err := io.ReadFull(conn, c.reply[:size]); err != nil {
+		return dnsmessage.Header{}, err
+	}
+	c.bytesReceived += int64(2 + size)
+	return checkReply(c.reply[:size], msg)
+}
+
+// checkReply parses the reply header and checks it answers the query.
+// checkReply разбирает заголовок ответа и проверяет, что он отвечает на запрос.
+func checkReply(reply []byte, query *dnsmessage.Message) (dnsmessage.Header, error) {
+	var p dnsmessage.Parser
+	h, err := p.Start(reply)
+	if err != nil {
+		return h, err
+	}
+	if !h.Response || h.ID != query.Header.ID {
+		return h, errMismatch
+	}
+	q, err := p.Question()
+	if errors.Is(err, dnsmessage.ErrSectionDone) {
+		// some servers don't repeat the question, ie in FORMERR replies.
+		return h, nil
+	}
+	if err != nil {
+		return h, err
+	}
+	expected := query.Questions[0]
+	if q.Type != expected.Type || !strings.EqualFold(q.Name.String(), expected.Name.String()) {
+		return h, errMismatch
+	}
+	return h, nil
+}
+
+// Close closes the connection and returns the total number of sockets used for the run.
+// Close закрывает соединение и возвращает общее количество сокетов, использованных за тест.
+func (c *DNSClient) Close() int {
+	log.Debugf("Closing %p: %s socket count %d", c, c.server, c.socketCount)
+	if c.conn != nil {
+		if err := c.conn.Close(); err != nil {
+			log.Warnf("Error closing dns client's connection: %v", err)
+		}
+		c.conn = nil
+	}
+	return c.socketCount
+}
+
+// RunDNSTest runs a DNS test and returns the aggregated stats.
+// RunDNSTest запускает DNS-тест и возвращает агрегированную статистику.
+func RunDNSTest(o *RunnerOptions) (*RunnerResults, error) {
+	o.RunType = "DNS"
+	log.Infof("Starting dns test for %s with %d threads at %.1f qps", o.Destination, o.NumThreads, o.QPS)
+	r := periodic.NewPeriodicRunner(&o.RunnerOptions)
+	defer r.Options().Abort()
+	numThreads := r.Options().NumThreads
+	out := r.Options().Out // Important as the default value is set from nil to stdout inside NewPeriodicRunner
+	total := RunnerResults{
+		DNSOptions:   o.DNSOptions,
+		aborter:      r.Options().Stop,
+		RetCodes:     make(DNSResultMap),
+		RCodeLatency: make(map[string]*stats.HistogramData),
+	}
+	dnsstate := make([]RunnerResults, numThreads)
+	ctx := context.Background()
+	for i := range numThreads {
+		r.Options().Runners[i] = &dnsstate[i]
+		client, err := NewDNSClient(&o.DNSOptions, r.Options().Offset, r.Options().Resolution)
+		if client == nil {
+			return nil, fmt.Errorf("unable to create client %d for %s: %w", i, o.Destination, err)
+		}
+		client.connID = i
+		dnsstate[i].client = client
+		if o.Exactly <= 0 {
+			h, err := client.query(ctx) // warmup, not recorded
+			if i == 0 && log.LogVerbose() {
+				log.LogVf("first query to %s: err %v, rcode %v", o.Destination, err, h.RCode)
+			}
+		}
+		dnsstate[i].aborter = total.aborter
+		dnsstate[i].RetCodes = make(DNSResultMap)
+		total.Protocol = client.proto
+		total.QueryType = strings.TrimPrefix(client.qtype.String(), "Type")
+	}
+	total.RunnerResults = r.Run()
+	latency := make(map[string]*stats.Histogram)
+	keys := []string{}
+	for i := range numThreads {
+		client := dnsstate[i].client
+		total.SocketCount += client.Close()
+		total.BytesReceived += client.bytesReceived
+		total.BytesSent += client.bytesSent
+		total.Truncated += client.truncated
+		for k, h := range client.latency {
+			if latency[k] == nil {
+				latency[k] = stats.NewHistogram(r.Options().Offset.Seconds(), r.Options().Resolution)
+			}
+			latency[k].Transfer(h)
+		}
+		for k := range dnsstate[i].RetCodes {
+			if _, exists := total.RetCodes[k]; !exists {
+				keys = append(keys, k)
+			}
+			total.RetCodes[k] += dnsstate[i].RetCodes[k]
+		}
+	}
+	// Cleanup state:
+	r.Options().ReleaseRunners()
+	totalCount := float64(total.DurationHistogram.Count)
+	if totalCount > 0 {
+		total.TruncatedPercent = 100. * float64(total.Truncated) / totalCount
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		h := latency[k]
+		if h == nil {
+			continue // errors
+		}
+		total.RCodeLatency[k] = h.Export().CalcPercentiles(r.Options().Percentiles)
+		if log.Log(log.Info) {
+			total.RCodeLatency[k].Print(out, k+" latency histogram (s)")
+		} else if log.Log(log.Warning) {
+			h.Counter.Print(out, k+" latency (s)")
+		}
+	}
+	_, _ = fmt.Fprintf(out, "Sockets used: %d (for perfect no error run, would be %d)\n", total.SocketCount, r.Options().NumThreads)
+	_, _ = fmt.Fprintf(out, "Total Bytes sent: %d, received: %d\n", total.BytesSent, total.BytesReceived)
+	_, _ = fmt.Fprintf(out, "Truncated replies: %d (%.2f %%)\n", total.Truncated, total.TruncatedPercent)
+	for _, k := range keys {
+		_, _ = fmt.Fprintf(out, "dns %s : %d (%.1f %%)\n", k, total.RetCodes[k], 100.*float64(total.RetCodes[k])/totalCount)
+	}
+	return &total, nil
+}
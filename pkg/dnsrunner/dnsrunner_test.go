@@ -0,0 +1,300 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dnsrunner
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"fortio.org/fortio/pkg/fhttp"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// responder is an in-process DNS server answering A 1.2.3.4, except for the names with a
+// nx label (NXDOMAIN), fail label (SERVFAIL), big label (truncated over udp) or drop label
+// (no reply).
+type responder struct {
+	mu    sync.Mutex
+	names map[string]int
+}
+
+func (d *responder) reply(req []byte, udp bool) []byte {
+	var p dnsmessage.Parser
+	h, err := p.Start(req)
+	if err != nil {
+		return nil
+	}
+	q, err := p.Question()
+	if err != nil {
+		return nil
+	}
+	name := q.Name.String()
+	d.mu.Lock()
+	d.names[name]++
+	d.mu.Unlock()
+	resp := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: h.ID, Response: true, RecursionDesired: h.RecursionDesired},
+		Questions: []dnsmessage.Question{q},
+	}
+	labels := strings.Split(name, ".")
+	switch {
+	case slices.Contains(labels, "drop"):
+		return nil
+	case slices.Contains(labels, "nx"):
+		resp.Header.RCode = dnsmessage.RCodeNameError
+	case slices.Contains(labels, "fail"):
+		resp.Header.RCode = dnsmessage.RCodeServerFailure
+	case slices.Contains(labels, "big") && udp:
+		resp.Header.Truncated = true
+	default:
+		resp.Answers = []dnsmessage.Resource{{
+			Header: dnsmessage.ResourceHeader{Name: q.Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: 60},
+			Body:   &dnsmessage.AResource{A: [4]byte{1, 2, 3, 4}},
+		}}
+	}
+	out, err := resp.Pack()
+	if err != nil {
+		return nil
+	}
+	return out
+}
+
+func (d *responder) serveUDP(t *testing.T) int {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if out := d.reply(buf[:n], true); out != nil {
+				_, _ = conn.WriteTo(out, addr)
+			}
+		}
+	}()
+	return conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+func (d *responder) serveTCP(t *testing.T, cfg *tls.Config) int {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	port := listener.Addr().(*net.TCPAddr).Port
+	if cfg != nil {
+		listener = tls.NewListener(listener, cfg)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				buf := make([]byte, 64*1024)
+				for {
+					if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+						return
+					}
+					n := int(binary.BigEndian.Uint16(buf))
+					if _, err := io.ReadFull(conn, buf[:n]); err != nil {
+						return
+					}
+					out := d.reply(buf[:n], false)
+					if out == nil {
+						continue
+					}
+					if _, err := conn.Write(binary.BigEndian.AppendUint16(nil, uint16(len(out)))); err != nil {
+						return
+					}
+					if _, err := conn.Write(out); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+	return port
+}
+
+func TestParseType(t *testing.T) {
+	for s, expected := range map[string]dnsmessage.Type{
+		"": dnsmessage.TypeA, "aaaa": dnsmessage.TypeAAAA, "MX": dnsmessage.TypeMX, "any": dnsmessage.TypeALL,
+		"TYPE65": dnsmessage.TypeHTTPS, "99": dnsmessage.Type(99),
+	} {
+		if qtype, err := ParseType(s); err != nil || qtype != expected {
+			t.Errorf("ParseType(%q) = %v, %v, expected %v", s, qtype, err, expected)
+		}
+	}
+	for _, bad := range []string{"x", "TYPE", "70000"} {
+		if _, err := ParseType(bad); err == nil {
+			t.Errorf("Expected error for %q", bad)
+		}
+	}
+	if RCodeName(dnsmessage.RCodeNameError) != RCodeNXDomain || RCodeName(9) != "RCODE9" {
+		t.Errorf("Unexpected rcode names %s %s", RCodeName(dnsmessage.RCodeNameError), RCodeName(9))
+	}
+}
+
+func TestNewDNSClient(t *testing.T) {
+	c, err := NewDNSClient(&DNSOptions{Destination: "dns://localhost/example.com?proto=tls&type=AAAA"}, 0, 0.001)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.server != "localhost:853" || c.proto != ProtoTLS || c.qtype != dnsmessage.TypeAAAA || c.name != "example.com." ||
+		c.tlsConfig.ServerName != "localhost" {
+		t.Errorf("Unexpected client %+v", c)
+	}
+	c, err = NewDNSClient(&DNSOptions{Destination: "dns://[::1]:5353/?proto=TCP", Names: []string{" a.com ", "", "b.org."}}, 0, 0.001)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.server != "[::1]:5353" || c.proto != ProtoTCP || !slices.Equal(c.names, []string{"a.com.", "b.org."}) {
+		t.Errorf("Unexpected client %+v", c)
+	}
+	c.connID = 1
+	for _, expected := range []string{"b.org.", "a.com.", "b.org."} {
+		if name := c.nextName(); name != expected {
+			t.Errorf("Expected %s, got %s", expected, name)
+		}
+		c.queryCount++
+	}
+	c.randomSubdomain = true
+	if name := c.nextName(); len(name) != 13+len("a.com.") || !strings.HasSuffix(name, ".a.com.") {
+		t.Errorf("Unexpected random subdomain %q", name)
+	}
+	for _, bad := range []string{
+		"udp://localhost/example.com", "dns:///example.com", "dns://localhost/", "dns://localhost/x?proto=quic",
+		"dns://localhost/x?type=foo", "dns://localhost/" + strings.Repeat("a", 300),
+	} {
+		if _, err = NewDNSClient(&DNSOptions{Destination: bad}, 0, 0.001); err == nil {
+			t.Errorf("Expected error for %q", bad)
+		}
+	}
+}
+
+func TestDNSRunner(t *testing.T) {
+	d := &responder{names: make(map[string]int)}
+	udpPort := d.serveUDP(t)
+	tcpPort := d.serveTCP(t, nil)
+	for _, proto := range []string{ProtoUDP, ProtoTCP} {
+		port := udpPort
+		if proto == ProtoTCP {
+			port = tcpPort
+		}
+		opts := RunnerOptions{}
+		opts.QPS = -1
+		opts.Exactly = 8
+		opts.NumThreads = 2
+		opts.Destination = fmt.Sprintf("dns://127.0.0.1:%d/?proto=%s", port, proto)
+		opts.Names = []string{"www.example.com", "nx.example.com", "fail.example.com", "big.example.com"}
+		res, err := RunDNSTest(&opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		truncated := int64(0)
+		if proto == ProtoUDP {
+			truncated = 2
+		}
+		if res.RetCodes[RCodeNoError] != 4 || res.RetCodes[RCodeNXDomain] != 2 || res.RetCodes[RCodeServFail] != 2 ||
+			res.ErrorsDurationHistogram.Count != 2 || res.Truncated != truncated || res.TruncatedPercent != 12.5*float64(truncated) {
+			t.Errorf("%s: unexpected results %v truncated %d", proto, res.RetCodes, res.Truncated)
+		}
+		if res.SocketCount != 2 || res.Protocol != proto || res.QueryType != "A" || res.BytesSent == 0 || res.BytesReceived == 0 {
+			t.Errorf("%s: unexpected sockets %d proto %s type %s bytes %d %d",
+				proto, res.SocketCount, res.Protocol, res.QueryType, res.BytesSent, res.BytesReceived)
+		}
+		if len(res.RCodeLatency) != 3 || res.RCodeLatency[RCodeNoError].Count != 4 || res.RCodeLatency[RCodeServFail].Count != 2 {
+			t.Errorf("%s: unexpected latency histograms %v", proto, res.RCodeLatency)
+		}
+		// Timeouts.
+		opts.Names = []string{"drop.example.com"}
+		opts.Exactly = 2
+		opts.NumThreads = 1
+		opts.ReqTimeout = 50 * time.Millisecond
+		if res, err = RunDNSTest(&opts); err != nil || res.RetCodes[errTimeout.Error()] != 2 {
+			t.Errorf("%s: expected timeouts, got %v %v", proto, res.RetCodes, err)
+		}
+	}
+}
+
+func TestDNSRunnerRandomSubdomain(t *testing.T) {
+	d := &responder{names: make(map[string]int)}
+	port := d.serveUDP(t)
+	opts := RunnerOptions{}
+	opts.QPS = 1000
+	opts.Duration = 200 * time.Millisecond
+	opts.NumThreads = 2
+	opts.Destination = fmt.Sprintf("dns://127.0.0.1:%d/nx.example.com?type=aaaa", port)
+	opts.RandomSubdomain = true
+	res, err := RunDNSTest(&opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	// 2 more for the warmup queries
+	if count := res.RetCodes[RCodeNXDomain]; count < 10 || len(d.names) != int(count)+2 || res.QueryType != "AAAA" {
+		t.Errorf("Expected all distinct names, got %v for %d queried names", res.RetCodes, len(d.names))
+	}
+	for name, n := range d.names {
+		if n != 1 || !strings.HasSuffix(name, ".nx.example.com.") {
+			t.Errorf("Unexpected name %q queried %d times", name, n)
+		}
+	}
+}
+
+func TestDNSRunnerTLS(t *testing.T) {
+	serverTLS := fhttp.TLSOptions{Cert: "../cert-tmp/server.crt", Key: "../cert-tmp/server.key"}
+	cfg, err := serverTLS.TLSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &responder{names: make(map[string]int)}
+	port := d.serveTCP(t, cfg)
+	opts := RunnerOptions{}
+	opts.QPS = -1
+	opts.Exactly = 6
+	opts.NumThreads = 2
+	opts.Destination = fmt.Sprintf("dns://localhost:%d/www.example.com?proto=tls", port)
+	opts.TLSOptions = fhttp.TLSOptions{CACert: "../cert-tmp/ca.crt"}
+	res, err := RunDNSTest(&opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.RetCodes[RCodeNoError] != 6 || res.SocketCount != 2 || res.Protocol != ProtoTLS {
+		t.Errorf("Unexpected DoT results %v sockets %d", res.RetCodes, res.SocketCount)
+	}
+	opts.TLSOptions = fhttp.TLSOptions{}
+	if res, err = RunDNSTest(&opts); err != nil || res.RetCodes[RCodeNoError] != 0 {
+		t.Errorf("Expected certificate errors without the CA, got %v %v", res.RetCodes, err)
+	}
+}
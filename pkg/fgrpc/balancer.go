@@ -0,0 +1,263 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package fgrpc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"fortio.org/fortio/pkg/log"
+	"fortio.org/fortio/pkg/stats"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/resolver/manual"
+	grpcstats "google.golang.org/grpc/stats"
+)
+
+// Client side load balancing policies (GRPCRunnerOptions.LoadBalancing).
+const (
+	LBPickFirst  = "pick_first"
+	LBRoundRobin = "round_robin"
+	// staticScheme is the resolver scheme used for comma separated lists of destinations.
+	staticScheme = "fortio-static"
+)
+
+// ValidLoadBalancing returns an error if lb isn't one of the supported policies (or empty for the default).
+func ValidLoadBalancing(lb string) error {
+	switch lb {
+	case "", LBPickFirst, LBRoundRobin:
+		return nil
+	default:
+		return fmt.Errorf("invalid gRPC load balancing policy %q, should be %q or %q", lb, LBRoundRobin, LBPickFirst)
+	}
+}
+
+// lbDialOptions returns the target and the dial options for the destination and load balancing policy:
+// a comma separated list of addresses uses a static resolver, otherwise the destination is used
+// as is (so dns:///host:port uses the dns resolver and gets all the addresses of a headless service).
+// The authority (and so the TLS server name) of a list is its first address unless overridden by the
+// "host" metadata (-grpc-authority) or, for the server name, CertOverride.
+func lbDialOptions(destination, lb string) (string, []grpc.DialOption) {
+	var opts []grpc.DialOption
+	target := destination
+	if !strings.Contains(destination, ":///") { // not already a resolver target like dns:///host:port
+		target = grpcDestination(destination)
+	}
+	if list := SplitList(destination); len(list) > 1 {
+		addrs := make([]resolver.Address, 0, len(list))
+		for _, a := range list {
+			addrs = append(addrs, resolver.Address{Addr: grpcDestination(a)})
+		}
+		r := manual.NewBuilderWithScheme(staticScheme)
+		r.InitialState(resolver.State{Addresses: addrs})
+		opts = append(opts, grpc.WithResolvers(r))
+		target = staticScheme + ":///" + strings.Join(list, ",")
+		opts = append(opts, grpc.WithAuthority(addrs[0].Addr))
+		log.LogVf("Using static resolver for %v", addrs)
+	}
+	if lb != "" {
+		opts = append(opts, grpc.WithDefaultServiceConfig(fmt.Sprintf(`{"loadBalancingConfig": [{%q: {}}]}`, lb)))
+	}
+	return target, opts
+}
+
+// GRPCBackendResults are the stats of the calls served by one backend (peer address).
+type GRPCBackendResults struct {
+	Calls  int64
+	Errors int64
+	// Transport connections established to this backend (more than one per client connection are reconnects).
+	Connections int64
+	Disconnects int64
+	// Duration of all the calls to this backend and of the ones that failed.
+	DurationHistogram       *stats.HistogramData
+	ErrorsDurationHistogram *stats.HistogramData
+}
+
+// backendState is the per thread accumulator for one backend.
+type backendState struct {
+	calls   int64
+	errors  int64
+	latency *stats.Histogram
+	errLat  *stats.Histogram
+}
+
+// recordBackend records the duration (in seconds) of a call served by addr.
+func (grpcstate *GRPCRunnerResults) recordBackend(addr string, duration float64, isErr bool) {
+	b := grpcstate.backends[addr]
+	if b == nil {
+		b = &backendState{
+			latency: stats.NewHistogram(grpcstate.histOffset, grpcstate.histResolution),
+			errLat:  stats.NewHistogram(grpcstate.histOffset, grpcstate.histResolution),
+		}
+		grpcstate.backends[addr] = b
+	}
+	b.calls++
+	b.latency.Record(duration)
+	if isErr {
+		b.errors++
+		b.errLat.Record(duration)
+	}
+}
+
+// transferBackends aggregates (and resets) the per backend stats of src into grpcstate.
+func (grpcstate *GRPCRunnerResults) transferBackends(src *GRPCRunnerResults) {
+	for addr, sb := range src.backends {
+		b := grpcstate.backends[addr]
+		if b == nil {
+			grpcstate.backends[addr] = sb
+			continue
+		}
+		b.calls += sb.calls
+		b.errors += sb.errors
+		b.latency.Transfer(sb.latency)
+		b.errLat.Transfer(sb.errLat)
+	}
+	src.backends = nil
+}
+
+// connMonitor tracks the connectivity state transitions of one client connection and, as its stats
+// handler, the transport connections (and thus reconnects) to each backend.
+type connMonitor struct {
+	id          int
+	mu          sync.Mutex
+	transitions HealthResultMap // "FROM->TO" state transitions counts
+	connects    HealthResultMap // per backend address
+	disconnects HealthResultMap
+}
+
+type connAddrKey struct{}
+
+func newConnMonitor(id int) *connMonitor {
+	return &connMonitor{
+		id:          id,
+		transitions: make(HealthResultMap),
+		connects:    make(HealthResultMap),
+		disconnects: make(HealthResultMap),
+	}
+}
+
+// watch records the state transitions of conn until ctx is done.
+func (m *connMonitor) watch(ctx context.Context, conn *grpc.ClientConn) {
+	state := conn.GetState()
+	for conn.WaitForStateChange(ctx, state) {
+		newState := conn.GetState()
+		m.transition(state, newState)
+		state = newState
+	}
+}
+
+func (m *connMonitor) transition(from, to connectivity.State) {
+	log.LogVf("gRPC connection %d state %v -> %v", m.id, from, to)
+	if to == connectivity.TransientFailure {
+		log.Warnf("gRPC connection %d is in transient failure", m.id)
+	}
+	m.mu.Lock()
+	m.transitions[from.String()+"->"+to.String()]++
+	m.mu.Unlock()
+}
+
+func (m *connMonitor) TagRPC(ctx context.Context, _ *grpcstats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+func (m *connMonitor) HandleRPC(context.Context, grpcstats.RPCStats) {}
+
+func (m *connMonitor) TagConn(ctx context.Context, info *grpcstats.ConnTagInfo) context.Context {
+	return context.WithValue(ctx, connAddrKey{}, info.RemoteAddr.String())
+}
+
+func (m *connMonitor) HandleConn(ctx context.Context, s grpcstats.ConnStats) {
+	addr, _ := ctx.Value(connAddrKey{}).(string)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch s.(type) {
+	case *grpcstats.ConnBegin:
+		m.connects[addr]++
+		if m.connects[addr] > 1 {
+			log.Infof("gRPC connection %d reconnected to %s (%d times)", m.id, addr, m.connects[addr]-1)
+		} else {
+			log.LogVf("gRPC connection %d connected to %s", m.id, addr)
+		}
+	case *grpcstats.ConnEnd:
+		m.disconnects[addr]++
+		log.Infof("gRPC connection %d disconnected from %s", m.id, addr)
+	}
+}
+
+// backendResults exports the (aggregated) per backend stats, including the connections from the
+// monitors, and prints them.
+func (grpcstate *GRPCRunnerResults) backendResults(monitors []*connMonitor, percentiles []float64, out io.Writer) {
+	grpcstate.Backends = make(map[string]*GRPCBackendResults)
+	get := func(addr string) *GRPCBackendResults {
+		b := grpcstate.Backends[addr]
+		if b == nil {
+			b = &GRPCBackendResults{}
+			grpcstate.Backends[addr] = b
+		}
+		return b
+	}
+	for addr, b := range grpcstate.backends {
+		r := get(addr)
+		r.Calls = b.calls
+		r.Errors = b.errors
+		r.DurationHistogram = b.latency.Export().CalcPercentiles(percentiles)
+		r.ErrorsDurationHistogram = b.errLat.Export().CalcPercentiles(percentiles)
+	}
+	grpcstate.ConnectionStates = make(HealthResultMap)
+	for _, m := range monitors {
+		m.mu.Lock()
+		for k, v := range m.transitions {
+			grpcstate.ConnectionStates[k] += v
+		}
+		for addr, n := range m.connects {
+			get(addr).Connections += n
+			grpcstate.Reconnects += n - 1
+		}
+		for addr, n := range m.disconnects {
+			get(addr).Disconnects += n
+		}
+		m.mu.Unlock()
+	}
+	addrs := make([]string, 0, len(grpcstate.Backends))
+	for k := range grpcstate.Backends {
+		addrs = append(addrs, k)
+	}
+	sort.Strings(addrs)
+	_, _ = fmt.Fprintf(out, "Backends distribution:\n")
+	for _, addr := range addrs {
+		b := grpcstate.Backends[addr]
+		_, _ = fmt.Fprintf(out, "%s: %d calls, %d errors, %d connections", addr, b.Calls, b.Errors, b.Connections)
+		if h := b.DurationHistogram; h != nil && h.Count > 0 {
+			_, _ = fmt.Fprintf(out, ", avg %.6g s", h.Avg)
+			for _, p := range h.Percentiles {
+				_, _ = fmt.Fprintf(out, ", p%g %.6g s", p.Percentile, p.Value)
+			}
+		}
+		_, _ = fmt.Fprintln(out)
+	}
+	states := sortedKeys(grpcstate.ConnectionStates)
+	transitions := make([]string, 0, len(states))
+	for _, k := range states {
+		transitions = append(transitions, fmt.Sprintf("%s: %d", k, grpcstate.ConnectionStates[k]))
+	}
+	_, _ = fmt.Fprintf(out, "Connection state transitions: %s, reconnects: %d\n",
+		strings.Join(transitions, ", "), grpcstate.Reconnects)
+}
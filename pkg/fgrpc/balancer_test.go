@@ -0,0 +1,163 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package fgrpc
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"testing"
+
+	"fortio.org/fortio/pkg/fhttp"
+	"fortio.org/fortio/pkg/log"
+	"fortio.org/fortio/pkg/periodic"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	grpcstats "google.golang.org/grpc/stats"
+)
+
+func TestValidLoadBalancing(t *testing.T) {
+	for _, lb := range []string{"", LBPickFirst, LBRoundRobin} {
+		if err := ValidLoadBalancing(lb); err != nil {
+			t.Errorf("Unexpected error for %q: %v", lb, err)
+		}
+	}
+	if err := ValidLoadBalancing("random"); err == nil {
+		t.Errorf("Expected error for invalid policy")
+	}
+	o := &GRPCRunnerOptions{Destination: "localhost:1", LoadBalancing: "random"}
+	if _, err := RunGRPCTest(o); err == nil {
+		t.Errorf("Expected RunGRPCTest error for invalid policy")
+	}
+}
+
+func TestGRPCRunnerLoadBalancing(t *testing.T) {
+	log.SetLogLevel(log.Info)
+	port1 := PingServerTCP("0", "lb-test-1", 0, noTLSO)
+	port2 := PingServerTCP("0", "lb-test-2", 0, noTLSO)
+	dest := fmt.Sprintf("127.0.0.1:%d, 127.0.0.1:%d", port1, port2)
+	tests := []struct {
+		lb       string
+		backends int
+	}{
+		{LBRoundRobin, 2},
+		{LBPickFirst, 1},
+	}
+	for _, tt := range tests {
+		o := &GRPCRunnerOptions{
+			RunnerOptions: periodic.RunnerOptions{
+				QPS:        -1,
+				Exactly:    20,
+				NumThreads: 1,
+				Out:        os.Stderr,
+			},
+			Destination:   dest,
+			UsePing:       true,
+			LoadBalancing: tt.lb,
+		}
+		res, err := RunGRPCTest(o)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.lb, err)
+		}
+		if len(res.Backends) != tt.backends {
+			t.Fatalf("%s: expected %d backends, got %+v", tt.lb, tt.backends, res.Backends)
+		}
+		var calls int64
+		for addr, b := range res.Backends {
+			calls += b.Calls
+			if b.DurationHistogram.Count != b.Calls || b.Errors != 0 || b.Connections != 1 {
+				t.Errorf("%s: unexpected backend %s stats %+v", tt.lb, addr, b)
+			}
+			if tt.backends > 1 && (b.Calls < 5 || b.Calls > 15) {
+				// the first calls can happen before the connection to the second backend is ready.
+				t.Errorf("%s: expected ~even distribution, %s got %d calls", tt.lb, addr, b.Calls)
+			}
+		}
+		if calls != 20 {
+			t.Errorf("%s: expected 20 calls in the backends, got %d", tt.lb, calls)
+		}
+		ready := false
+		for k := range res.ConnectionStates {
+			ready = ready || strings.HasSuffix(k, "->READY")
+		}
+		if !ready || res.Reconnects != 0 {
+			t.Errorf("%s: unexpected connection states %+v reconnects %d", tt.lb, res.ConnectionStates, res.Reconnects)
+		}
+	}
+	// static list over TLS: the authority and server name are the first address, not the list.
+	sPort1 := PingServerTCP("0", "lb-test-tls-1", 0, tlsO)
+	sPort2 := PingServerTCP("0", "lb-test-tls-2", 0, tlsO)
+	o := &GRPCRunnerOptions{
+		RunnerOptions: periodic.RunnerOptions{
+			QPS:        -1,
+			Exactly:    10,
+			NumThreads: 1,
+			Out:        os.Stderr,
+		},
+		Destination:   fmt.Sprintf("localhost:%d,localhost:%d", sPort1, sPort2),
+		TLSOptions:    fhttp.TLSOptions{CACert: caCrt},
+		UsePing:       true,
+		LoadBalancing: LBRoundRobin,
+	}
+	res, err := RunGRPCTest(o)
+	if err != nil {
+		t.Fatalf("TLS static list: %v", err)
+	}
+	if res.RetCodes[grpc_health_v1.HealthCheckResponse_SERVING.String()] != 10 || len(res.Backends) != 2 {
+		t.Errorf("TLS static list: unexpected results %+v backends %+v", res.RetCodes, res.Backends)
+	}
+	// dns resolver.
+	o = &GRPCRunnerOptions{
+		RunnerOptions: periodic.RunnerOptions{
+			QPS:        -1,
+			Exactly:    4,
+			NumThreads: 2,
+			Out:        os.Stderr,
+		},
+		Destination:   fmt.Sprintf("dns:///127.0.0.1:%d", port1),
+		LoadBalancing: LBRoundRobin,
+		GrpcMethod:    "fgrpc.PingServer/PingServerStream",
+		Payload:       `{"count": 2}`,
+	}
+	res, err = RunGRPCTest(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := res.Backends[fmt.Sprintf("127.0.0.1:%d", port1)]; b == nil || b.Calls != 4 {
+		t.Errorf("Unexpected dns backends %+v", res.Backends)
+	}
+}
+
+func TestConnMonitor(t *testing.T) {
+	m := newConnMonitor(0)
+	addr := &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 8079}
+	ctx := m.TagConn(context.Background(), &grpcstats.ConnTagInfo{RemoteAddr: addr})
+	m.HandleConn(ctx, &grpcstats.ConnBegin{})
+	m.HandleConn(ctx, &grpcstats.ConnEnd{})
+	m.HandleConn(ctx, &grpcstats.ConnBegin{})
+	m.transition(connectivity.Ready, connectivity.Idle)
+	total := GRPCRunnerResults{}
+	total.backendResults([]*connMonitor{m}, nil, os.Stderr)
+	b := total.Backends["10.0.0.1:8079"]
+	if b == nil || b.Connections != 2 || b.Disconnects != 1 || total.Reconnects != 1 {
+		t.Errorf("Unexpected monitor results %+v %d", b, total.Reconnects)
+	}
+	if total.ConnectionStates["READY->IDLE"] != 1 {
+		t.Errorf("Unexpected connection states %+v", total.ConnectionStates)
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package fgrpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// callStatus records the gRPC status of one call (or stream): the status code, whether an error came
+// from the server or from the client side (deadline or otherwise) and the captured response metadata.
+// ctx is the context of the call (with the CallTimeout deadline if any), header and trailer are the
+// received response metadata (empty when the server never answered).
+func (grpcstate *GRPCRunnerResults) callStatus(ctx context.Context, err error, header, trailer metadata.MD) codes.Code {
+	code := status.Code(err)
+	if errors.Is(err, ErrResponseMismatch) {
+		code = codes.OK // the call itself succeeded.
+	}
+	grpcstate.StatusCodes[code.String()]++
+	if code != codes.OK {
+		switch {
+		case code == codes.DeadlineExceeded && errors.Is(ctx.Err(), context.DeadlineExceeded):
+			grpcstate.ClientDeadlineExceeded++
+		case len(header) > 0 || len(trailer) > 0:
+			// the server always sends at least the content-type, in the headers or in a trailers only response.
+			grpcstate.ServerErrors++
+		default:
+			grpcstate.ClientErrors++
+		}
+	}
+	for _, k := range grpcstate.captureMetadata {
+		for _, v := range append(header.Get(k), trailer.Get(k)...) {
+			key := k + "=" + v
+			counts := grpcstate.MetadataCountMap[key]
+			if counts == nil {
+				counts = make(HealthResultMap)
+				grpcstate.MetadataCountMap[key] = counts
+			}
+			counts[code.String()]++
+		}
+	}
+	return code
+}
+
+// transferStatus aggregates the status accounting of src into grpcstate.
+func (grpcstate *GRPCRunnerResults) transferStatus(src *GRPCRunnerResults) {
+	for k, v := range src.StatusCodes {
+		grpcstate.StatusCodes[k] += v
+	}
+	grpcstate.ClientDeadlineExceeded += src.ClientDeadlineExceeded
+	grpcstate.ClientErrors += src.ClientErrors
+	grpcstate.ServerErrors += src.ServerErrors
+	for key, counts := range src.MetadataCountMap {
+		total := grpcstate.MetadataCountMap[key]
+		if total == nil {
+			total = make(HealthResultMap)
+			grpcstate.MetadataCountMap[key] = total
+		}
+		for k, v := range counts {
+			total[k] += v
+		}
+	}
+}
+
+func sortedKeys(m HealthResultMap) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sum(m HealthResultMap) int64 {
+	var res int64
+	for _, v := range m {
+		res += v
+	}
+	return res
+}
+
+// printStatus prints the status codes, error origins and captured metadata distribution
+// (most frequent values first).
+func (grpcstate *GRPCRunnerResults) printStatus(out io.Writer) {
+	for _, k := range sortedKeys(grpcstate.StatusCodes) {
+		_, _ = fmt.Fprintf(out, "gRPC status %s : %d\n", k, grpcstate.StatusCodes[k])
+	}
+	_, _ = fmt.Fprintf(out, "Client deadline exceeded: %d, other client errors: %d, server errors: %d\n",
+		grpcstate.ClientDeadlineExceeded, grpcstate.ClientErrors, grpcstate.ServerErrors)
+	if len(grpcstate.MetadataCountMap) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(grpcstate.MetadataCountMap))
+	for k := range grpcstate.MetadataCountMap {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		si, sj := sum(grpcstate.MetadataCountMap[keys[i]]), sum(grpcstate.MetadataCountMap[keys[j]])
+		if si != sj {
+			return si > sj
+		}
+		return keys[i] < keys[j]
+	})
+	_, _ = fmt.Fprintf(out, "Response metadata distribution:\n")
+	for _, k := range keys {
+		counts := grpcstate.MetadataCountMap[k]
+		codesStr := make([]string, 0, len(counts))
+		for _, c := range sortedKeys(counts) {
+			codesStr = append(codesStr, fmt.Sprintf("%s: %d", c, counts[c]))
+		}
+		_, _ = fmt.Fprintf(out, "%s: %d (%s)\n", k, sum(counts), strings.Join(codesStr, ", "))
+	}
+}
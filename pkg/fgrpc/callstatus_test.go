@@ -0,0 +1,135 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package fgrpc
+
+import (
+	"context"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"fortio.org/fortio/pkg/log"
+	"fortio.org/fortio/pkg/periodic"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// statusTestServer pretends to be 2 backends: odd sequence numbers are answered by pod-a,
+// even ones by pod-b which fails them when the payload is "unavailable".
+type statusTestServer struct {
+	pingSrv
+}
+
+func (s *statusTestServer) Ping(ctx context.Context, in *PingMessage) (*PingMessage, error) {
+	if in.GetSeq()%2 == 1 {
+		_ = grpc.SetHeader(ctx, metadata.Pairs("x-server-id", "pod-a"))
+		return s.pingSrv.Ping(ctx, in)
+	}
+	_ = grpc.SetTrailer(ctx, metadata.Pairs("x-server-id", "pod-b"))
+	if in.GetPayload() == "unavailable" {
+		return nil, status.Error(codes.Unavailable, "pod-b is down")
+	}
+	return s.pingSrv.Ping(ctx, in)
+}
+
+func TestGRPCRunnerStatusAccounting(t *testing.T) {
+	log.SetLogLevel(log.Info)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	RegisterPingServerServer(server, &statusTestServer{})
+	go func() {
+		_ = server.Serve(lis)
+	}()
+	t.Cleanup(server.Stop)
+	o := &GRPCRunnerOptions{
+		RunnerOptions: periodic.RunnerOptions{
+			QPS:        -1,
+			Exactly:    6,
+			NumThreads: 2,
+			Out:        os.Stderr,
+		},
+		Destination:     lis.Addr().String(),
+		GrpcMethod:      "fgrpc.PingServer/Ping",
+		ProtoFiles:      []string{"ping.proto"},
+		Payload:         `{"seq": {seq}, "payload": "unavailable"}`,
+		CaptureMetadata: []string{"X-Server-Id"},
+	}
+	res, err := RunGRPCTest(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCodes["OK"] != 3 || res.StatusCodes["Unavailable"] != 3 || res.ServerErrors != 3 ||
+		res.ClientErrors != 0 || res.ClientDeadlineExceeded != 0 {
+		t.Errorf("Unexpected status accounting %+v server %d client %d deadline %d",
+			res.StatusCodes, res.ServerErrors, res.ClientErrors, res.ClientDeadlineExceeded)
+	}
+	if res.RetCodes["SERVING"] != 3 || res.RetCodes["Unavailable"] != 3 {
+		t.Errorf("Unexpected ret codes %+v", res.RetCodes)
+	}
+	if len(res.MetadataCountMap) != 2 || res.MetadataCountMap["x-server-id=pod-a"]["OK"] != 3 ||
+		res.MetadataCountMap["x-server-id=pod-b"]["Unavailable"] != 3 {
+		t.Errorf("Unexpected metadata counts %+v", res.MetadataCountMap)
+	}
+	// Client side deadline, server being slow.
+	o = &GRPCRunnerOptions{
+		RunnerOptions: periodic.RunnerOptions{
+			QPS:        -1,
+			Exactly:    2,
+			NumThreads: 1,
+			Out:        os.Stderr,
+		},
+		Destination:     lis.Addr().String(),
+		UsePing:         true,
+		Delay:           200 * time.Millisecond,
+		CallTimeout:     20 * time.Millisecond,
+		CaptureMetadata: []string{"x-server-id"},
+	}
+	res, err = RunGRPCTest(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCodes["DeadlineExceeded"] != 2 || res.ClientDeadlineExceeded != 2 || res.ServerErrors != 0 ||
+		res.RetCodes[Error] != 2 || len(res.MetadataCountMap) != 0 {
+		t.Errorf("Unexpected client deadline accounting %+v %+v deadline %d server %d",
+			res.StatusCodes, res.RetCodes, res.ClientDeadlineExceeded, res.ServerErrors)
+	}
+	// Connection errors are client side.
+	o = &GRPCRunnerOptions{
+		RunnerOptions: periodic.RunnerOptions{
+			QPS:        -1,
+			Exactly:    2,
+			NumThreads: 1,
+			Out:        os.Stderr,
+		},
+		Destination:        "localhost:1",
+		UsePing:            true,
+		AllowInitialErrors: true,
+	}
+	res, err = RunGRPCTest(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCodes["Unavailable"] != 2 || res.ClientErrors != 2 || res.ServerErrors != 0 {
+		t.Errorf("Unexpected connection error accounting %+v client %d server %d",
+			res.StatusCodes, res.ClientErrors, res.ServerErrors)
+	}
+}
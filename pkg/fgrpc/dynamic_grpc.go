@@ -5,14 +5,18 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"os"
 	"strings"
 
 	"fortio.org/fortio/pkg/log"
-	"github.com/jhump/protoreflect/desc"    //nolint:staticcheck // TODO: migrate to v2 API
-	"github.com/jhump/protoreflect/dynamic" //nolint:staticcheck // TODO: migrate to v2 API
+	"github.com/jhump/protoreflect/desc"            //nolint:staticcheck // TODO: migrate to v2 API
+	"github.com/jhump/protoreflect/desc/protoparse" //nolint:staticcheck // TODO: migrate to v2 API
+	"github.com/jhump/protoreflect/dynamic"         //nolint:staticcheck // TODO: migrate to v2 API
 	"github.com/jhump/protoreflect/dynamic/grpcdynamic"
 	"github.com/jhump/protoreflect/grpcreflect"
 	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
 )
 
 // DynamicGrpcCall represents a prepared dynamic gRPC call with all necessary components.
@@ -22,6 +26,16 @@ type DynamicGrpcCall struct {
 
 	conn             *grpc.ClientConn       // gRPC connection to use for the call
 	methodDescriptor *desc.MethodDescriptor // Method descriptor for the gRPC method
+	template         *payloadTemplate       // per call payload template, nil when RequestMsg is reused as is
+	checks           []*responseCheck       // response assertions
+}
+
+// request returns the message to send: RequestMsg or a new one rendered from the payload template.
+func (call *DynamicGrpcCall) request() (*dynamic.Message, error) {
+	if call.template == nil {
+		return call.RequestMsg, nil
+	}
+	return getRequestMessage(call.methodDescriptor, call.template.render())
 }
 
 // parseFullMethod splits "Service/Method" or "/Service/Method" into service and method.
@@ -34,21 +48,25 @@ func parseFullMethod(full string) (string, string, error) {
 	return parts[0], parts[1], nil
 }
 
-// dynamicGrpcCall performs a dynamic unary gRPC call.
-func dynamicGrpcCall(ctx context.Context, call *DynamicGrpcCall) (string, error) {
-	log.Debugf("Invoking gRPC method %s with input: %s", call.MethodPath, call.RequestMsg)
-
+// dynamicGrpcCall performs a dynamic unary gRPC call. The returned error wraps ErrResponseMismatch
+// when the response doesn't pass the checks.
+func dynamicGrpcCall(ctx context.Context, call *DynamicGrpcCall, opts ...grpc.CallOption) (string, error) {
 	if call.methodDescriptor == nil {
 		return "", errors.New("method descriptor is nil")
 	}
+	req, err := call.request()
+	if err != nil {
+		return "", err
+	}
+	log.Debugf("Invoking gRPC method %s with input: %s", call.MethodPath, req)
 
 	stub := grpcdynamic.NewStub(call.conn)
-	response, err := stub.InvokeRpc(ctx, call.methodDescriptor, call.RequestMsg)
+	response, err := stub.InvokeRpc(ctx, call.methodDescriptor, req, opts...)
 	if err != nil {
 		return "", fmt.Errorf("gRPC invoke error: %w", err)
 	}
 	log.Debugf("gRpc response: %v", response)
-	return response.String(), nil
+	return response.String(), checkResponse(call.checks, response)
 }
 
 // getMethodDescriptor retrieves the method descriptor for a given full method name.
@@ -74,6 +92,86 @@ func getMethodDescriptor(ctx context.Context, conn *grpc.ClientConn, fullMethod
 	return md, nil
 }
 
+// SplitList splits a comma separated list of files or paths (ie for ProtoFiles and ProtoImportPaths),
+// empty input returns nil.
+func SplitList(list string) []string {
+	var res []string
+	for _, e := range strings.Split(list, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			res = append(res, e)
+		}
+	}
+	return res
+}
+
+// resolveMethodDescriptor finds the method descriptor for o.GrpcMethod from the local .proto files
+// or descriptor set when provided, or using server reflection otherwise.
+func resolveMethodDescriptor(ctx context.Context, conn *grpc.ClientConn, o *GRPCRunnerOptions) (*desc.MethodDescriptor, error) {
+	if o.ProtoSet == "" && len(o.ProtoFiles) == 0 {
+		return getMethodDescriptor(ctx, conn, o.GrpcMethod)
+	}
+	fds, err := loadFileDescriptors(o.ProtoSet, o.ProtoFiles, o.ProtoImportPaths)
+	if err != nil {
+		return nil, err
+	}
+	return findMethodDescriptor(fds, o.GrpcMethod)
+}
+
+// loadFileDescriptors parses the .proto files (using the import paths) and/or reads the
+// compiled FileDescriptorSet (ie from protoc --descriptor_set_out --include_imports).
+func loadFileDescriptors(protoSet string, protoFiles, importPaths []string) ([]*desc.FileDescriptor, error) {
+	var fds []*desc.FileDescriptor
+	if protoSet != "" {
+		data, err := os.ReadFile(protoSet)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read descriptor set: %w", err)
+		}
+		var set descriptorpb.FileDescriptorSet
+		if err = proto.Unmarshal(data, &set); err != nil {
+			return nil, fmt.Errorf("invalid descriptor set %s: %w", protoSet, err)
+		}
+		files, err := desc.CreateFileDescriptorsFromSet(&set)
+		if err != nil {
+			return nil, fmt.Errorf("invalid descriptor set %s: %w", protoSet, err)
+		}
+		for _, fd := range files {
+			fds = append(fds, fd)
+		}
+		log.Infof("Loaded %d file descriptors from %s", len(files), protoSet)
+	}
+	if len(protoFiles) > 0 {
+		p := protoparse.Parser{ImportPaths: importPaths}
+		parsed, err := p.ParseFiles(protoFiles...)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse proto files: %w", err)
+		}
+		fds = append(fds, parsed...)
+		log.Infof("Parsed proto files %v (import paths %v)", protoFiles, importPaths)
+	}
+	return fds, nil
+}
+
+// findMethodDescriptor looks up the Service/Method in the file descriptors (and their dependencies).
+func findMethodDescriptor(fds []*desc.FileDescriptor, fullMethod string) (*desc.MethodDescriptor, error) {
+	serviceName, methodName, err := parseFullMethod(fullMethod)
+	if err != nil {
+		return nil, err
+	}
+	for _, fd := range fds {
+		sd := fd.FindService(serviceName)
+		if sd == nil {
+			continue
+		}
+		md := sd.FindMethodByName(methodName)
+		if md == nil {
+			return nil, fmt.Errorf("method %s not found in service %s", methodName, serviceName)
+		}
+		log.Debugf("Resolved method descriptor for %s from local descriptors: %s", fullMethod, md.GetFullyQualifiedName())
+		return md, nil
+	}
+	return nil, fmt.Errorf("service %s not found in the proto files or descriptor set", serviceName)
+}
+
 // getRequestMessage creates a protobuf message from the JSON payload.
 func getRequestMessage(md *desc.MethodDescriptor, jsonPayload string) (*dynamic.Message, error) {
 	inputType := md.GetInputType()
@@ -18,12 +18,18 @@ package fgrpc
 import (
 	"context"
 	"fmt"
+	"net"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"fortio.org/fortio/pkg/log"
+	"fortio.org/fortio/pkg/periodic"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
 )
 
 func init() {
@@ -357,3 +363,87 @@ func TestDynamicGrpcCallWithInvalidConnection(t *testing.T) {
 		t.Errorf("getMethodDescriptor expected error with invalid connection but got none")
 	}
 }
+
+// noReflectionPingServer starts a ping server without the reflection service.
+func noReflectionPingServer(t *testing.T) string {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	RegisterPingServerServer(server, &pingSrv{})
+	go func() {
+		_ = server.Serve(lis)
+	}()
+	t.Cleanup(server.Stop)
+	return lis.Addr().String()
+}
+
+func TestGRPCRunnerLocalProtos(t *testing.T) {
+	log.SetLogLevel(log.Info)
+	addr := noReflectionPingServer(t)
+	// Write a descriptor set, as protoc --descriptor_set_out would.
+	fds, err := loadFileDescriptors("", []string{"ping.proto"}, []string{"."})
+	if err != nil {
+		t.Fatalf("Error parsing ping.proto: %v", err)
+	}
+	set := &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{fds[0].AsFileDescriptorProto()}}
+	data, err := proto.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setFile := filepath.Join(t.TempDir(), "ping.protoset")
+	if err = os.WriteFile(setFile, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name        string
+		method      string
+		protoFiles  []string
+		importPaths []string
+		protoSet    string
+		expectError bool
+	}{
+		{"reflection disabled", "fgrpc.PingServer/Ping", nil, nil, "", true},
+		{"proto file", "fgrpc.PingServer/Ping", []string{"ping.proto"}, []string{"."}, "", false},
+		{"proto file streaming", "fgrpc.PingServer/PingStream", []string{"ping.proto"}, nil, "", false},
+		{"descriptor set", "fgrpc.PingServer/Ping", nil, nil, setFile, false},
+		{"missing proto file", "fgrpc.PingServer/Ping", []string{"missing.proto"}, []string{"."}, "", true},
+		{"missing descriptor set", "fgrpc.PingServer/Ping", nil, nil, "missing.protoset", true},
+		{"invalid descriptor set", "fgrpc.PingServer/Ping", nil, nil, "ping.proto", true},
+		{"unknown service", "foo.Bar/Ping", nil, nil, setFile, true},
+		{"unknown method", "fgrpc.PingServer/Pong", []string{"ping.proto"}, nil, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := &GRPCRunnerOptions{
+				RunnerOptions: periodic.RunnerOptions{
+					QPS:        -1,
+					Exactly:    4,
+					NumThreads: 2,
+					Out:        os.Stderr,
+				},
+				Destination:      addr,
+				GrpcMethod:       tt.method,
+				Payload:          `{"payload": "local"}`,
+				ProtoFiles:       tt.protoFiles,
+				ProtoImportPaths: tt.importPaths,
+				ProtoSet:         tt.protoSet,
+			}
+			res, err := RunGRPCTest(o)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if res.RetCodes["SERVING"]+res.RetCodes["OK"] != 4 {
+				t.Errorf("Expected 4 successful calls, got %+v", res.RetCodes)
+			}
+		})
+	}
+}
@@ -0,0 +1,312 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package fgrpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"fortio.org/fortio/pkg/log"
+	"fortio.org/fortio/pkg/periodic"
+	"fortio.org/fortio/pkg/stats"
+	"github.com/jhump/protoreflect/desc" //nolint:staticcheck // TODO: migrate to v2 API
+	"github.com/jhump/protoreflect/dynamic/grpcdynamic"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// DefaultStreamMessages is the number of messages sent per stream when neither
+// StreamMessages nor StreamDuration are set.
+const DefaultStreamMessages = 10
+
+// Streaming RPC types.
+const (
+	StreamTypeBidi   = "bidi"
+	StreamTypeClient = "client"
+	StreamTypeServer = "server"
+)
+
+// StreamType returns the streaming type of the method or "" for unary methods.
+func StreamType(md *desc.MethodDescriptor) string {
+	switch {
+	case md.IsClientStreaming() && md.IsServerStreaming():
+		return StreamTypeBidi
+	case md.IsClientStreaming():
+		return StreamTypeClient
+	case md.IsServerStreaming():
+		return StreamTypeServer
+	default:
+		return ""
+	}
+}
+
+// GRPCStreamResults are the stats of streaming custom methods (-grpc-method of a streaming rpc).
+// The overall call duration histogram is the stream lifetime and RetCodes are the final statuses.
+type GRPCStreamResults struct {
+	Type             string // bidi, client or server
+	Streams          int64
+	MessagesSent     int64
+	MessagesReceived int64
+	// Time to create the stream (includes waiting for a stream slot on the connection).
+	StreamSetup *stats.HistogramData
+	// Per message latency: from send to the matching reply for bidi streams, from the previous
+	// message (or the request) for server streams and the send time plus the final reply for client streams.
+	MessageLatency *stats.HistogramData
+}
+
+// grpcStreamState is the per thread state of the streaming mode.
+type grpcStreamState struct {
+	messages int
+	qps      float64
+	lifetime time.Duration
+	mu       sync.Mutex // only needed for bidi streams where replies are read in a separate goroutine.
+	setup    *stats.Histogram
+	latency  *stats.Histogram
+	streams  int64
+	sent     int64
+	received int64
+}
+
+// newGrpcStreamState creates the stream state, ro being the normalized runner options (for the histograms).
+func newGrpcStreamState(o *GRPCRunnerOptions, ro *periodic.RunnerOptions) *grpcStreamState {
+	return &grpcStreamState{
+		messages: o.StreamMessages,
+		qps:      o.StreamQPS,
+		lifetime: o.StreamDuration,
+		setup:    stats.NewHistogram(ro.Offset.Seconds(), ro.Resolution),
+		latency:  stats.NewHistogram(ro.Offset.Seconds(), ro.Resolution),
+	}
+}
+
+// transfer aggregates (and resets) src into s.
+func (s *grpcStreamState) transfer(src *grpcStreamState) {
+	s.setup.Transfer(src.setup)
+	s.latency.Transfer(src.latency)
+	s.streams += src.streams
+	s.sent += src.sent
+	s.received += src.received
+}
+
+// sendLoop calls send for each message, paced at the stream qps, until the number of messages
+// or the lifetime of the stream is reached.
+func (s *grpcStreamState) sendLoop(ctx context.Context, start time.Time, send func() error) error {
+	var interval time.Duration
+	if s.qps > 0 {
+		interval = time.Duration(float64(time.Second) / s.qps)
+	}
+	for i := 0; s.messages <= 0 || i < s.messages; i++ {
+		if s.lifetime > 0 && time.Since(start) >= s.lifetime {
+			break
+		}
+		if interval > 0 && i > 0 {
+			wait := time.Until(start.Add(time.Duration(i) * interval))
+			if s.lifetime > 0 {
+				wait = min(wait, time.Until(start.Add(s.lifetime)))
+			}
+			if wait > 0 {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(wait):
+				}
+			}
+			if s.lifetime > 0 && time.Since(start) >= s.lifetime {
+				break
+			}
+		}
+		if err := send(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// streamEnd is the response metadata and peer of a finished stream.
+type streamEnd struct {
+	header, trailer metadata.MD
+	peer            *peer.Peer
+}
+
+// endedStream is the part of the grpcdynamic streams giving their response metadata and peer.
+type endedStream interface {
+	Header() (metadata.MD, error)
+	Trailer() metadata.MD
+	Context() context.Context
+}
+
+// newStreamEnd gets the response metadata and peer of the stream, which must be finished (its last
+// receive returned an error or io.EOF) as grpc updates them asynchronously until then.
+func newStreamEnd(stream endedStream) streamEnd {
+	header, _ := stream.Header()
+	p, _ := peer.FromContext(stream.Context())
+	return streamEnd{header: header, trailer: stream.Trailer(), peer: p}
+}
+
+// dynamicStreamCall performs one dynamic streaming gRPC call (one stream) and returns its final error (nil for OK)
+// along with the response metadata and peer of the stream.
+// When the stream is otherwise successful but one of the received messages fails the response checks, the
+// returned error wraps ErrResponseMismatch.
+func dynamicStreamCall(ctx context.Context, call *DynamicGrpcCall, s *grpcStreamState) (streamEnd, error) {
+	md := call.methodDescriptor
+	stub := grpcdynamic.NewStub(call.conn)
+	start := time.Now()
+	s.streams++
+	switch StreamType(md) {
+	case StreamTypeBidi:
+		stream, err := stub.InvokeRpcBidiStream(ctx, md)
+		if err != nil {
+			return streamEnd{}, fmt.Errorf("gRPC stream error: %w", err)
+		}
+		s.setup.Record(time.Since(start).Seconds())
+		var pending []time.Time // send times of the messages not replied to yet.
+		var mismatch error      // only accessed by the receiving goroutine until recvDone.
+		recvDone := make(chan error, 1)
+		go func() {
+			for {
+				msg, err := stream.RecvMsg()
+				now := time.Now()
+				if err != nil {
+					if errors.Is(err, io.EOF) {
+						err = nil
+					}
+					recvDone <- err
+					return
+				}
+				s.mu.Lock()
+				if len(pending) > 0 {
+					s.latency.Record(now.Sub(pending[0]).Seconds())
+					pending = pending[1:]
+				}
+				s.received++
+				s.mu.Unlock()
+				if mismatch == nil {
+					mismatch = checkResponse(call.checks, msg)
+				}
+			}
+		}()
+		sendErr := s.sendLoop(ctx, start, func() error {
+			req, err := call.request()
+			if err != nil {
+				return err
+			}
+			s.mu.Lock()
+			pending = append(pending, time.Now())
+			s.sent++
+			s.mu.Unlock()
+			return stream.SendMsg(req)
+		})
+		_ = stream.CloseSend()
+		// the actual status, when the stream broke while sending, comes from the receive side.
+		recvErr := <-recvDone
+		end := newStreamEnd(stream)
+		if recvErr != nil {
+			return end, recvErr
+		}
+		if sendErr != nil && !errors.Is(sendErr, io.EOF) {
+			return end, sendErr
+		}
+		return end, mismatch
+	case StreamTypeClient:
+		cctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		stream, err := stub.InvokeRpcClientStream(cctx, md)
+		if err != nil {
+			return streamEnd{}, fmt.Errorf("gRPC stream error: %w", err)
+		}
+		s.setup.Record(time.Since(start).Seconds())
+		sendErr := s.sendLoop(ctx, start, func() error {
+			req, err := call.request()
+			if err != nil {
+				return err
+			}
+			t := time.Now()
+			err = stream.SendMsg(req)
+			if err == nil {
+				s.sent++
+				s.latency.Record(time.Since(t).Seconds())
+			}
+			return err
+		})
+		if sendErr != nil && !errors.Is(sendErr, io.EOF) {
+			cancel()
+			_, _ = stream.CloseAndReceive() // to finish the stream before getting its metadata.
+			return newStreamEnd(stream), sendErr
+		}
+		t := time.Now()
+		res, err := stream.CloseAndReceive()
+		end := newStreamEnd(stream)
+		if err != nil {
+			return end, err
+		}
+		s.latency.Record(time.Since(t).Seconds())
+		s.received++
+		log.Debugf("gRpc client stream response: %v", res)
+		return end, checkResponse(call.checks, res)
+	default: // server streaming
+		var sctx context.Context
+		var cancel context.CancelFunc
+		if s.lifetime > 0 {
+			sctx, cancel = context.WithTimeout(ctx, s.lifetime)
+		} else {
+			sctx, cancel = context.WithCancel(ctx)
+		}
+		defer cancel()
+		req, err := call.request()
+		if err != nil {
+			return streamEnd{}, err
+		}
+		stream, err := stub.InvokeRpcServerStream(sctx, md, req)
+		if err != nil {
+			return streamEnd{}, fmt.Errorf("gRPC stream error: %w", err)
+		}
+		last := time.Now()
+		s.setup.Record(last.Sub(start).Seconds())
+		s.sent++
+		var mismatch error
+		for n := 0; s.messages <= 0 || n < s.messages; n++ {
+			msg, err := stream.RecvMsg()
+			now := time.Now()
+			if errors.Is(err, io.EOF) {
+				return newStreamEnd(stream), mismatch
+			}
+			if err != nil {
+				end := newStreamEnd(stream)
+				if s.lifetime > 0 && ctx.Err() == nil && errors.Is(sctx.Err(), context.DeadlineExceeded) {
+					return end, mismatch // we ended the stream at the end of its lifetime, not an error.
+				}
+				return end, err
+			}
+			s.latency.Record(now.Sub(last).Seconds())
+			last = now
+			s.received++
+			if mismatch == nil {
+				mismatch = checkResponse(call.checks, msg)
+			}
+		}
+		// Cancel the stream after the requested number of messages and wait for it to finish.
+		cancel()
+		for {
+			if _, err := stream.RecvMsg(); err != nil {
+				break
+			}
+		}
+		return newStreamEnd(stream), mismatch
+	}
+}
@@ -0,0 +1,290 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package fgrpc
+
+import (
+	"context"
+	"maps"
+	"math/rand/v2"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"fortio.org/dflag"
+	"fortio.org/fortio/pkg/fhttp"
+	"fortio.org/fortio/pkg/log"
+	"fortio.org/fortio/pkg/stats"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/tap"
+)
+
+// Fault injection request metadata keys of the ping and health servers, also the parameter
+// names of DefaultPingServerFaults. Same probabilistic syntax as the echo server query args.
+const (
+	// FaultStatus returns a gRPC error code, ie "UNAVAILABLE" or "UNAVAILABLE:10,RESOURCE_EXHAUSTED:5"
+	// for 10% unavailable and 5% resource exhausted (names or numeric codes).
+	FaultStatus = "status"
+	// FaultDelay delays the reply, ie "10ms:50,1s:1" (capped by the max-echo-delay dynamic flag).
+	FaultDelay = "delay"
+	// FaultReset resets the whole connection (TCP RST) the call is on, ie "true" or "5" for 5% of the calls.
+	// All the calls multiplexed on that connection fail, use FaultAbort to fail only the drawn call.
+	FaultReset = "reset"
+	// FaultAbort aborts the stream of the call (RST_STREAM) before its handler runs, leaving the
+	// connection and its other calls up, ie "true" or "5" for 5% of the calls.
+	FaultAbort = "abort"
+	// FaultNotServing makes the health check reply NOT_SERVING, ie "20" for 20% of the checks.
+	FaultNotServing = "not-serving"
+)
+
+// DefaultPingServerFaults are the fault injection parameters used when the request metadata doesn't set them.
+// Its delay may use empirical(file) distributions, unlike the request metadata.
+var DefaultPingServerFaults = dflag.New("",
+	"Default fault injection parameters for the gRPC ping and health servers. E.g \"status=UNAVAILABLE:10&delay=50ms:20\"").
+	WithValidator(pingDefaultFaults.Validate)
+
+// pingDefaultFaults caches the parsed DefaultPingServerFaults.
+var pingDefaultFaults fhttp.ServerParams
+
+var (
+	// PingChaos is the gRPC ping and health servers schedule, its phases params override the defaults faults.
+	PingChaos = fhttp.NewChaosSchedule(PingServerName)
+	// PingChaosSchedule starts the PingChaos schedule when set.
+	PingChaosSchedule = PingChaos.Flag("gRPC ping and health servers")
+)
+
+var codeByName = func() map[string]codes.Code {
+	m := map[string]codes.Code{"CANCELLED": codes.Canceled}
+	for c := codes.OK; c <= codes.Unauthenticated; c++ {
+		m[strings.ToUpper(c.String())] = c
+	}
+	return m
+}()
+
+// parseCode parses a gRPC code name (UNAVAILABLE, Unavailable, DEADLINE_EXCEEDED...) or number.
+func parseCode(s string) (codes.Code, bool) {
+	if n, err := strconv.ParseUint(s, 10, 32); err == nil {
+		return codes.Code(n), true
+	}
+	c, found := codeByName[strings.ToUpper(strings.ReplaceAll(s, "_", ""))]
+	return c, found
+}
+
+// generateCode from string, format: status="UNAVAILABLE" for 100% unavailable,
+// status="UNAVAILABLE:20,14:10,INTERNAL:0.5" for 30% unavailable, 0.5% internal and 69.5% OK.
+// Invalid input is logged and returns OK (no fault).
+func generateCode(spec string) codes.Code {
+	lst := strings.Split(spec, ",")
+	if len(lst) == 1 && !strings.ContainsRune(spec, ':') {
+		c, ok := parseCode(spec)
+		if !ok {
+			log.Warnf("Bad gRPC status fault %q, not a code nor comma and colon separated %% list", spec)
+			return codes.OK
+		}
+		return c
+	}
+	res := 100. * rand.Float64() //nolint:gosec // we want fast not crypto
+	lastPercent := 0.
+	for _, entry := range lst {
+		name, percStr, found := strings.Cut(entry, ":")
+		c, ok := parseCode(name)
+		p, err := strconv.ParseFloat(strings.TrimSuffix(percStr, "%"), 64)
+		if !found || !ok || err != nil || p < 0 || p > 100 {
+			log.Warnf("Bad gRPC status fault entry %q in %q", entry, spec)
+			return codes.OK
+		}
+		lastPercent += p
+		if res < lastPercent {
+			return c
+		}
+	}
+	return codes.OK
+}
+
+// faultInjector applies the fault injection parameters to the calls of a server.
+type faultInjector struct {
+	server string   // for the fhttp.ServerFaults metric.
+	conns  sync.Map // remote address -> net.Conn, for resets
+	// defaults returns the fault injection parameters of the full method name, for aborts.
+	defaults func(method string) url.Values
+}
+
+// count records an injected fault in the fhttp.ServerFaults metric.
+func (f *faultInjector) count(fault string) {
+	server := PingServerName
+	if f != nil {
+		server = f.server
+	}
+	fhttp.ServerFaults.Inc(server, fault)
+}
+
+// trackedListener registers the accepted connections so they can be reset.
+type trackedListener struct {
+	net.Listener
+	f *faultInjector
+}
+
+type trackedConn struct {
+	net.Conn
+	f *faultInjector
+}
+
+func (l *trackedListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return c, err
+	}
+	l.f.conns.Store(c.RemoteAddr().String(), c)
+	return &trackedConn{Conn: c, f: l.f}, nil
+}
+
+func (c *trackedConn) Close() error {
+	c.f.conns.Delete(c.RemoteAddr().String())
+	return c.Conn.Close()
+}
+
+// param returns the value of key from the request metadata or else from the DefaultPingServerFaults.
+func param(md metadata.MD, defaults url.Values, key string) string {
+	if v := md.Get(key); len(v) > 0 {
+		return v[0]
+	}
+	return defaults.Get(key)
+}
+
+// pingServerFaults returns the current DefaultPingServerFaults and PingChaos phase params, and the
+// parsed default delays (nil when there is none or the phase sets the delay).
+func pingServerFaults() (url.Values, *stats.Delays) {
+	defaults, delays := pingDefaultFaults.Get(DefaultPingServerFaults.Get())
+	// The current chaos phase, if any, overrides the defaults (Get always returns a map).
+	chaos := PingChaos.Params()
+	if _, found := chaos[FaultDelay]; found {
+		delays = nil
+	}
+	maps.Copy(defaults, chaos)
+	return defaults, delays
+}
+
+// pingDefaults returns the pingServerFaults for the fault injected ping and health check methods.
+func pingDefaults(method string) url.Values {
+	if method != "/fgrpc.PingServer/Ping" && method != grpc_health_v1.Health_Check_FullMethodName {
+		return nil
+	}
+	defaults, _ := pingServerFaults()
+	return defaults
+}
+
+// abort is the grpc.InTapHandle applying FaultAbort: the error aborts the new stream early
+// (trailers only status and RST_STREAM) without closing the connection.
+func (f *faultInjector) abort(ctx context.Context, info *tap.Info) (context.Context, error) {
+	var defaults url.Values
+	if f.defaults != nil {
+		defaults = f.defaults(info.FullMethodName)
+	}
+	if fhttp.GenerateSingleProbability(param(info.Header, defaults, FaultAbort), FaultAbort) {
+		f.count(FaultAbort)
+		log.LogVf("gRPC fault: aborting stream of %s", info.FullMethodName)
+		return ctx, status.Error(codes.Unavailable, "fortio injected stream abort")
+	}
+	return ctx, nil
+}
+
+// inject applies the delay, reset and status faults to the call, from the request metadata or else
+// the defaults (with their delay already parsed as defaultDelays when not nil). Returns the error to
+// return (if any).
+func (f *faultInjector) inject(ctx context.Context, defaults url.Values, defaultDelays *stats.Delays) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	var d time.Duration
+	if defaultDelays != nil && len(md.Get(FaultDelay)) == 0 {
+		d = fhttp.SampleDelay(defaultDelays)
+	} else {
+		d = fhttp.GenerateDelay(param(md, defaults, FaultDelay))
+	}
+	if d > 0 {
+		f.count(FaultDelay)
+		log.LogVf("gRPC fault: sleeping for %v", d)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(d):
+		}
+	}
+	if fhttp.GenerateSingleProbability(param(md, defaults, FaultReset), FaultReset) {
+		f.count(FaultReset)
+		if f.reset(ctx) {
+			return status.Error(codes.Unavailable, "fortio injected connection reset")
+		}
+	}
+	if statusStr := param(md, defaults, FaultStatus); statusStr != "" {
+		if c := generateCode(statusStr); c != codes.OK {
+			f.count(FaultStatus)
+			log.LogVf("gRPC fault: returning %v", c)
+			return status.Errorf(c, "fortio injected %v", c)
+		}
+	}
+	return nil
+}
+
+// reset closes the whole connection of the call with a TCP RST, failing all its calls. Returns false if the connection isn't known
+// (ie server not started through PingServer) in which case the call fails with UNAVAILABLE instead.
+func (f *faultInjector) reset(ctx context.Context) bool {
+	p, ok := peer.FromContext(ctx)
+	if f == nil || !ok || p.Addr == nil {
+		return false
+	}
+	v, found := f.conns.Load(p.Addr.String())
+	if !found {
+		return false
+	}
+	conn := v.(net.Conn)
+	if tcp, isTCP := conn.(*net.TCPConn); isTCP {
+		_ = tcp.SetLinger(0)
+	}
+	log.Infof("gRPC fault: resetting connection from %v", p.Addr)
+	_ = conn.Close()
+	return true
+}
+
+// faultHealthServer is the standard health server with fault injection.
+type faultHealthServer struct {
+	*health.Server
+	f *faultInjector
+}
+
+func (h *faultHealthServer) Check(ctx context.Context, in *grpc_health_v1.HealthCheckRequest,
+) (*grpc_health_v1.HealthCheckResponse, error) {
+	defaults, delays := pingServerFaults()
+	if err := h.f.inject(ctx, defaults, delays); err != nil {
+		return nil, err
+	}
+	res, err := h.Server.Check(ctx, in)
+	if err != nil {
+		return res, err
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	if fhttp.GenerateSingleProbability(param(md, defaults, FaultNotServing), FaultNotServing) {
+		h.f.count(FaultNotServing)
+		log.LogVf("gRPC fault: flipping health of %q to NOT_SERVING", in.GetService())
+		return &grpc_health_v1.HealthCheckResponse{Status: grpc_health_v1.HealthCheckResponse_NOT_SERVING}, nil
+	}
+	return res, nil
+}
@@ -0,0 +1,194 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package fgrpc
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"fortio.org/fortio/pkg/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestGenerateCode(t *testing.T) {
+	tests := []struct {
+		spec     string
+		expected codes.Code
+	}{
+		{"UNAVAILABLE", codes.Unavailable},
+		{"Unavailable", codes.Unavailable},
+		{"resource_exhausted", codes.ResourceExhausted},
+		{"DEADLINE_EXCEEDED", codes.DeadlineExceeded},
+		{"CANCELLED", codes.Canceled},
+		{"14", codes.Unavailable},
+		{"UNAVAILABLE:100", codes.Unavailable},
+		{"INTERNAL:0,13:100", codes.Internal},
+		{"UNAVAILABLE:0", codes.OK},
+		{"NOPE", codes.OK},
+		{"UNAVAILABLE:x", codes.OK},
+		{"UNAVAILABLE:101", codes.OK},
+		{"NOPE:50", codes.OK},
+	}
+	for _, tt := range tests {
+		if c := generateCode(tt.spec); c != tt.expected {
+			t.Errorf("generateCode(%q) got %v expected %v", tt.spec, c, tt.expected)
+		}
+	}
+	// Statistical check of the probabilistic form.
+	n := 0
+	for range 1000 {
+		if generateCode("UNAVAILABLE:30") == codes.Unavailable {
+			n++
+		}
+	}
+	if n < 200 || n > 400 {
+		t.Errorf("Expected ~300 unavailable out of 1000, got %d", n)
+	}
+}
+
+func TestPingServerFaults(t *testing.T) {
+	log.SetLogLevel(log.Info)
+	port := PingServerTCP("0", "faults", 0, noTLSO)
+	conn, err := grpc.NewClient(fmt.Sprintf("127.0.0.1:%d", port),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	cli := NewPingServerClient(conn)
+	health := grpc_health_v1.NewHealthClient(conn)
+	withMD := func(kv ...string) context.Context {
+		return metadata.NewOutgoingContext(context.Background(), metadata.Pairs(kv...))
+	}
+	// No faults.
+	if _, err = cli.Ping(context.Background(), &PingMessage{}); err != nil {
+		t.Fatalf("Unexpected error without faults: %v", err)
+	}
+	_, err = cli.Ping(withMD(FaultStatus, "RESOURCE_EXHAUSTED"), &PingMessage{})
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("Expected resource exhausted, got %v", err)
+	}
+	start := time.Now()
+	if _, err = cli.Ping(withMD(FaultDelay, "100ms"), &PingMessage{}); err != nil {
+		t.Errorf("Unexpected error for delay: %v", err)
+	}
+	if d := time.Since(start); d < 100*time.Millisecond {
+		t.Errorf("Expected at least 100ms delay, got %v", d)
+	}
+	// Streams fail on the first message.
+	stream, err := cli.PingServerStream(withMD(FaultStatus, "ABORTED"), &PingMessage{Count: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = stream.Recv(); status.Code(err) != codes.Aborted {
+		t.Errorf("Expected aborted stream, got %v", err)
+	}
+	// Health.
+	res, err := health.Check(withMD(FaultNotServing, "100"), &grpc_health_v1.HealthCheckRequest{Service: "faults"})
+	if err != nil || res.GetStatus() != grpc_health_v1.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("Expected not serving, got %v %v", res, err)
+	}
+	res, err = health.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{Service: "faults"})
+	if err != nil || res.GetStatus() != grpc_health_v1.HealthCheckResponse_SERVING {
+		t.Errorf("Expected serving, got %v %v", res, err)
+	}
+	// Server wide defaults, overridden by the metadata.
+	DefaultPingServerFaults.Set("status=UNAVAILABLE")
+	defer DefaultPingServerFaults.Set("")
+	_, err = health.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{Service: "faults"})
+	if status.Code(err) != codes.Unavailable {
+		t.Errorf("Expected default unavailable, got %v", err)
+	}
+	if _, err = cli.Ping(withMD(FaultStatus, "OK"), &PingMessage{}); err != nil {
+		t.Errorf("Expected metadata to override default, got %v", err)
+	}
+	// Default delays may be empirical(file), not the metadata ones.
+	fileName := filepath.Join(t.TempDir(), "result.json")
+	err = os.WriteFile(fileName, []byte(`{"DurationHistogram": {"Count": 1, "Data": [
+		{"Start": 0.1, "End": 0.12, "Percent": 100, "Count": 1}]}}`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = DefaultPingServerFaults.Set("delay=empirical(" + fileName + ")"); err != nil {
+		t.Fatal(err)
+	}
+	start = time.Now()
+	if _, err = cli.Ping(context.Background(), &PingMessage{}); err != nil || time.Since(start) < 100*time.Millisecond {
+		t.Errorf("Expected empirical default delay, got %v after %v", err, time.Since(start))
+	}
+	start = time.Now()
+	if _, err = cli.Ping(withMD(FaultDelay, "empirical("+fileName+")"), &PingMessage{}); err != nil ||
+		time.Since(start) >= 100*time.Millisecond {
+		t.Errorf("Expected empirical metadata delay to be refused, got %v after %v", err, time.Since(start))
+	}
+	DefaultPingServerFaults.Set("status=UNAVAILABLE")
+	// Chaos schedule phases override the defaults, not the metadata.
+	if err = PingChaosSchedule.Set("1m?status=ABORTED"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = cli.Ping(context.Background(), &PingMessage{}); status.Code(err) != codes.Aborted {
+		t.Errorf("Expected chaos phase aborted, got %v", err)
+	}
+	if _, err = cli.Ping(withMD(FaultStatus, "OK"), &PingMessage{}); err != nil {
+		t.Errorf("Expected metadata to override chaos phase, got %v", err)
+	}
+	PingChaosSchedule.Set("")
+	DefaultPingServerFaults.Set("")
+	if _, err = cli.Ping(context.Background(), &PingMessage{}); err != nil {
+		t.Errorf("Unexpected error after chaos: %v", err)
+	}
+	// Abort: only the drawn call fails, a stream open on the same connection keeps working.
+	bidi, err := cli.PingStream(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cli.Ping(withMD(FaultAbort, "true"), &PingMessage{})
+	if status.Code(err) != codes.Unavailable {
+		t.Errorf("Expected unavailable after abort, got %v", err)
+	}
+	if err = bidi.Send(&PingMessage{Seq: 1}); err != nil {
+		t.Errorf("Unexpected send error after abort: %v", err)
+	}
+	if res, rerr := bidi.Recv(); rerr != nil || res.GetSeq() != 1 {
+		t.Errorf("Unexpected stream reply after abort: %v %v", res, rerr)
+	}
+	if err = bidi.CloseSend(); err != nil {
+		t.Error(err)
+	}
+	DefaultPingServerFaults.Set("abort=100")
+	_, err = health.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{Service: "faults"})
+	if status.Code(err) != codes.Unavailable {
+		t.Errorf("Expected default abort of the health check, got %v", err)
+	}
+	DefaultPingServerFaults.Set("")
+	// Reset: the call fails and the client reconnects for the next one.
+	_, err = cli.Ping(withMD(FaultReset, "true"), &PingMessage{})
+	if status.Code(err) != codes.Unavailable {
+		t.Errorf("Expected unavailable after reset, got %v", err)
+	}
+	if _, err = cli.Ping(context.Background(), &PingMessage{}, grpc.WaitForReady(true)); err != nil {
+		t.Errorf("Unexpected error after reset: %v", err)
+	}
+}
@@ -16,6 +16,7 @@ package fgrpc // import "fortio.org/fortio/pkg/fgrpc"
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"os"
@@ -31,11 +32,13 @@ import (
 	"github.com/jhump/protoreflect/desc"    //nolint:staticcheck // TODO: migrate to v2 API
 	"github.com/jhump/protoreflect/dynamic" //nolint:staticcheck // TODO: migrate to v2 API
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/encoding/gzip"
 	"google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 )
 
 // Dial dials gRPC using insecure or TLS transport security when serverAddr
@@ -53,7 +56,11 @@ func Dial(o *GRPCRunnerOptions) (*grpc.ClientConn, error) {
 	} else {
 		opts = append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))
 	}
-	serverAddr := grpcDestination(o.Destination)
+	serverAddr, lbOpts := lbDialOptions(o.Destination, o.LoadBalancing)
+	opts = append(opts, lbOpts...)
+	if o.monitor != nil {
+		opts = append(opts, grpc.WithStatsHandler(o.monitor))
+	}
 	if o.UnixDomainSocket != "" {
 		log.Warnf("Using domain socket %v instead of %v for grpc connection", o.UnixDomainSocket, serverAddr)
 		opts = append(opts, grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
@@ -85,47 +92,111 @@ type GRPCRunnerResults struct {
 	Ping        bool
 	Metadata    metadata.MD
 	dynamicCall *DynamicGrpcCall
+	// Streaming custom method stats, when GrpcMethod is a streaming rpc.
+	StreamStats *GRPCStreamResults `json:",omitempty"`
+	streamState *grpcStreamState
+	// Every call (or stream) classified by its gRPC status code (OK, Unavailable, DeadlineExceeded...).
+	StatusCodes HealthResultMap
+	// Errors by origin: the client side CallTimeout deadline, other client side errors (ie connection
+	// failures) and errors returned by the server.
+	ClientDeadlineExceeded int64
+	ClientErrors           int64
+	ServerErrors           int64
+	// Status codes counts for each "key=value" of the CaptureMetadata response headers and trailers.
+	MetadataCountMap map[string]HealthResultMap `json:",omitempty"`
+	callTimeout      time.Duration
+	captureMetadata  []string
+	// Per backend (peer address) stats.
+	Backends map[string]*GRPCBackendResults `json:",omitempty"`
+	// Client connections state transitions ("CONNECTING->READY"...) and number of transport reconnects.
+	ConnectionStates HealthResultMap
+	Reconnects       int64
+	backends         map[string]*backendState
+	histOffset       float64
+	histResolution   float64
 }
 
 // Run exercises GRPC health check or ping at the target QPS.
 // To be set as the Function in RunnerOptions.
-func (grpcstate *GRPCRunnerResults) Run(outCtx context.Context, t periodic.ThreadID) (bool, string) {
+func (grpcstate *GRPCRunnerResults) Run(outCtx context.Context, t periodic.ThreadID) (ok bool, _ string) {
 	log.Debugf("Calling in %d", t)
+	start := time.Now()
+	var p peer.Peer
+	defer func() {
+		if p.Addr != nil {
+			grpcstate.recordBackend(p.Addr.String(), time.Since(start).Seconds(), !ok)
+		}
+	}()
 	var err error
 	var res any
-	status := grpc_health_v1.HealthCheckResponse_SERVING
+	hstatus := grpc_health_v1.HealthCheckResponse_SERVING
 	if len(grpcstate.Metadata) != 0 { // filtered one
 		outCtx = metadata.NewOutgoingContext(outCtx, grpcstate.Metadata)
 	}
+	if grpcstate.callTimeout > 0 {
+		var cancel context.CancelFunc
+		outCtx, cancel = context.WithTimeout(outCtx, grpcstate.callTimeout)
+		defer cancel()
+	}
+	// Only for unary calls: grpc sets these asynchronously for streams, see streamEnd.
+	var header, trailer metadata.MD
+	callOpts := []grpc.CallOption{grpc.Header(&header), grpc.Trailer(&trailer), grpc.Peer(&p)}
 	switch {
 	case grpcstate.Ping:
-		res, err = grpcstate.clientP.Ping(outCtx, &grpcstate.reqP)
+		res, err = grpcstate.clientP.Ping(outCtx, &grpcstate.reqP, callOpts...)
+	case grpcstate.streamState != nil:
+		var end streamEnd
+		end, err = dynamicStreamCall(outCtx, grpcstate.dynamicCall, grpcstate.streamState)
+		if end.peer != nil {
+			p = *end.peer
+		}
+		code := grpcstate.callStatus(outCtx, err, end.header, end.trailer)
+		if errors.Is(err, ErrResponseMismatch) {
+			log.Warnf("Dynamic gRPC stream response check failed: %v", err)
+			grpcstate.RetCodes[Mismatch]++
+			return false, Mismatch
+		}
+		grpcstate.RetCodes[code.String()]++
+		if err != nil {
+			log.Warnf("Error in dynamic gRPC stream: %v", err)
+		}
+		return code == codes.OK, code.String()
 	case grpcstate.dynamicCall != nil:
-		res, err = dynamicGrpcCall(outCtx, grpcstate.dynamicCall)
+		res, err = dynamicGrpcCall(outCtx, grpcstate.dynamicCall, callOpts...)
+		log.Debugf("Dynamic gRPC call response: %s, error: %v", res, err)
+		code := grpcstate.callStatus(outCtx, err, header, trailer)
+		if errors.Is(err, ErrResponseMismatch) {
+			log.Warnf("Dynamic gRPC call response check failed: %v", err)
+			grpcstate.RetCodes[Mismatch]++
+			return false, Mismatch
+		}
 		if err != nil {
 			log.Warnf("Error making dynamic gRPC call: %v", err)
-			grpcstate.RetCodes[Error]++
+			grpcstate.RetCodes[code.String()]++
+			return false, code.String()
 		}
-		log.Debugf("Dynamic gRPC call response: %s, error: %v", res, err)
 	default:
 		var r *grpc_health_v1.HealthCheckResponse
-		r, err = grpcstate.clientH.Check(outCtx, &grpcstate.reqH)
+		r, err = grpcstate.clientH.Check(outCtx, &grpcstate.reqH, callOpts...)
 		if r != nil {
-			status = r.GetStatus()
+			hstatus = r.GetStatus()
 			res = r
 		}
 	}
 	log.Debugf("For %d (ping=%v) got %v %v", t, grpcstate.Ping, err, res)
+	if grpcstate.dynamicCall == nil {
+		grpcstate.callStatus(outCtx, err, header, trailer)
+	}
 	if err != nil {
 		log.Warnf("Error making grpc call: %v", err)
 		grpcstate.RetCodes[Error]++
 		return false, err.Error()
 	}
-	grpcstate.RetCodes[status.String()]++
-	if status == grpc_health_v1.HealthCheckResponse_SERVING {
+	grpcstate.RetCodes[hstatus.String()]++
+	if hstatus == grpc_health_v1.HealthCheckResponse_SERVING {
 		return true, "SERVING"
 	}
-	return false, status.String()
+	return false, hstatus.String()
 }
 
 // GRPCRunnerOptions includes the base RunnerOptions plus gRPC specific
@@ -136,7 +207,7 @@ type GRPCRunnerOptions struct {
 	Destination        string
 	Service            string            // Service to be checked when using gRPC health check
 	Profiler           string            // file to save profiles to. defaults to no profiling
-	Payload            string            // Payload to be sent for gRPC ping service
+	Payload            string            // Payload to be sent for gRPC ping service, JSON (template) for GrpcMethod
 	Streams            int               // number of streams. total go routines and data streams will be streams*numthreads.
 	Delay              time.Duration     // Delay to be sent when using gRPC ping service
 	CertOverride       string            // Override the cert virtual host of authority for testing
@@ -147,6 +218,20 @@ type GRPCRunnerOptions struct {
 	filteredMetadata   metadata.MD       // filtered version of Metadata metadata (without authority and user-agent)
 	GrpcCompression    bool              // enable gRPC compression
 	GrpcMethod         string            // gRPC method to call (Service/Method)
+	ProtoFiles         []string          // .proto files defining GrpcMethod, to use instead of server reflection
+	ProtoImportPaths   []string          // import paths for ProtoFiles
+	ProtoSet           string            // compiled FileDescriptorSet file defining GrpcMethod, instead of reflection
+	PayloadFeeder      string            // JSONL file providing the {feed.field} values of the Payload template
+	ResponseChecks     []string          // GrpcMethod response assertions: path=value, path!=value, path~regexp or path
+	CallTimeout        time.Duration     // deadline of each call (or stream), 0 = no deadline
+	CaptureMetadata    []string          // response header/trailer keys whose values are tallied in MetadataCountMap
+	LoadBalancing      string            // client side load balancing policy: round_robin or pick_first (default)
+	monitor            *connMonitor      // connection monitor of the next Dial
+	// For streaming GrpcMethod: number of messages sent per stream (client and bidi streams) or
+	// received before ending the stream (server streams, 0 = until the server ends it).
+	StreamMessages int
+	StreamQPS      float64       // Rate of messages sent within a stream, 0 = as fast as possible
+	StreamDuration time.Duration // Maximum lifetime of each stream, 0 = no limit (ends after StreamMessages)
 }
 
 // RunGRPCTest runs an HTTP test and returns the aggregated stats.
@@ -177,6 +262,9 @@ func RunGRPCTest(o *GRPCRunnerOptions) (*GRPCRunnerResults, error) {
 	}
 	log.Infof("Starting %s test for %s with %d*%d threads at %.1f qps, compression: %v",
 		o.RunType, o.Destination, o.Streams, o.NumThreads, o.QPS, o.GrpcCompression)
+	if err := ValidLoadBalancing(o.LoadBalancing); err != nil {
+		return nil, err
+	}
 	o.NumThreads *= o.Streams
 	r := periodic.NewPeriodicRunner(&o.RunnerOptions)
 	defer r.Options().Abort()
@@ -189,11 +277,21 @@ func RunGRPCTest(o *GRPCRunnerOptions) (*GRPCRunnerResults, error) {
 	}
 
 	total := GRPCRunnerResults{
-		RetCodes:    make(HealthResultMap),
-		Destination: o.Destination,
-		Streams:     o.Streams,
-		Ping:        o.UsePing,
-		Metadata:    o.Metadata, // the original one
+		RetCodes:         make(HealthResultMap),
+		Destination:      o.Destination,
+		Streams:          o.Streams,
+		Ping:             o.UsePing,
+		Metadata:         o.Metadata, // the original one
+		StatusCodes:      make(HealthResultMap),
+		MetadataCountMap: make(map[string]HealthResultMap),
+		backends:         make(map[string]*backendState),
+	}
+	watchCtx, stopWatching := context.WithCancel(context.Background())
+	defer stopWatching()
+	var monitors []*connMonitor
+	captureMetadata := make([]string, len(o.CaptureMetadata))
+	for i, k := range o.CaptureMetadata {
+		captureMetadata[i] = strings.ToLower(k) // metadata keys are lowercase
 	}
 	grpcstate := make([]GRPCRunnerResults, numThreads)
 	out := r.Options().Out // Important as the default value is set from nil to stdout inside NewPeriodicRunner
@@ -201,16 +299,22 @@ func RunGRPCTest(o *GRPCRunnerOptions) (*GRPCRunnerResults, error) {
 	var err error
 	var methodDescriptor *desc.MethodDescriptor
 	var reqMsg *dynamic.Message
+	var template *payloadTemplate
+	var checks []*responseCheck
 	ts := time.Now().UnixNano()
 	for i := range numThreads {
 		r.Options().Runners[i] = &grpcstate[i]
 		newConn := i%o.Streams == 0
 		if newConn {
+			o.monitor = newConnMonitor(len(monitors))
 			conn, err = Dial(o)
 			if err != nil {
 				log.Errf("Error in grpc dial for %s %v", o.Destination, err)
 				return nil, err
 			}
+			monitors = append(monitors, o.monitor)
+			go o.monitor.watch(watchCtx, conn)
+			o.monitor = nil
 		} else {
 			log.Debugf("Reusing previous client connection for %d", i)
 		}
@@ -233,25 +337,57 @@ func RunGRPCTest(o *GRPCRunnerOptions) (*GRPCRunnerResults, error) {
 				_, err = grpcstate[i].clientP.Ping(outCtx, &grpcstate[i].reqP, callOptions...)
 			}
 		case o.GrpcMethod != "":
-			// Use reflection to get method descriptor and create request message, if not already done.
-			// these can be reused across threads
+			// Use the local proto files or reflection to get method descriptor and create request message,
+			// if not already done. these can be reused across threads
 			if methodDescriptor == nil {
-				methodDescriptor, err = getMethodDescriptor(outCtx, conn, o.GrpcMethod)
+				methodDescriptor, err = resolveMethodDescriptor(outCtx, conn, o)
 				if err != nil {
 					return nil, fmt.Errorf("failed to get method descriptor for %s: %w", o.GrpcMethod, err)
 				}
 			}
 			if reqMsg == nil {
-				reqMsg, err = getRequestMessage(methodDescriptor, o.Payload)
+				template, err = newPayloadTemplate(o.Payload, o.PayloadFeeder)
+				if err != nil {
+					return nil, fmt.Errorf("failed to get request message for %s: %w", o.GrpcMethod, err)
+				}
+				payload := o.Payload
+				if template != nil {
+					// validate the template with the first feeder line, doesn't use a sequence number.
+					var line map[string]any
+					if len(template.lines) > 0 {
+						line = template.lines[0]
+					}
+					payload = template.renderWith(0, line)
+				}
+				reqMsg, err = getRequestMessage(methodDescriptor, payload)
 				if err != nil {
 					return nil, fmt.Errorf("failed to get request message for %s: %w", o.GrpcMethod, err)
 				}
+				checks, err = parseResponseChecks(o.ResponseChecks)
+				if err != nil {
+					return nil, err
+				}
 			}
 			grpcstate[i].dynamicCall = &DynamicGrpcCall{
 				methodDescriptor: methodDescriptor,
 				conn:             conn,
 				MethodPath:       o.GrpcMethod,
 				RequestMsg:       reqMsg,
+				template:         template,
+				checks:           checks,
+			}
+			if streamType := StreamType(methodDescriptor); streamType != "" {
+				if i == 0 {
+					if streamType != StreamTypeServer && o.StreamMessages <= 0 && o.StreamDuration <= 0 {
+						o.StreamMessages = DefaultStreamMessages
+					}
+					log.S(log.Info, "Streaming gRPC method", log.Str("method", o.GrpcMethod), log.Str("type", streamType),
+						log.Attr("messages", o.StreamMessages), log.Attr("stream_qps", o.StreamQPS),
+						log.Str("stream_duration", o.StreamDuration.String()))
+					total.StreamStats = &GRPCStreamResults{Type: streamType}
+					total.streamState = newGrpcStreamState(o, r.Options())
+				}
+				grpcstate[i].streamState = newGrpcStreamState(o, r.Options())
 			}
 		default:
 			grpcstate[i].clientH = grpc_health_v1.NewHealthClient(conn)
@@ -269,6 +405,13 @@ func RunGRPCTest(o *GRPCRunnerOptions) (*GRPCRunnerResults, error) {
 		}
 		// Setup the stats for each 'thread'
 		grpcstate[i].RetCodes = make(HealthResultMap)
+		grpcstate[i].StatusCodes = make(HealthResultMap)
+		grpcstate[i].MetadataCountMap = make(map[string]HealthResultMap)
+		grpcstate[i].callTimeout = o.CallTimeout
+		grpcstate[i].captureMetadata = captureMetadata
+		grpcstate[i].backends = make(map[string]*backendState)
+		grpcstate[i].histOffset = r.Options().Offset.Seconds()
+		grpcstate[i].histResolution = r.Options().Resolution
 	}
 
 	if o.Profiler != "" {
@@ -307,6 +450,11 @@ func RunGRPCTest(o *GRPCRunnerOptions) (*GRPCRunnerResults, error) {
 			}
 			total.RetCodes[k] += grpcstate[i].RetCodes[k]
 		}
+		total.transferStatus(&grpcstate[i])
+		total.transferBackends(&grpcstate[i])
+		if total.streamState != nil {
+			total.streamState.transfer(grpcstate[i].streamState)
+		}
 		// TODO: if gRPC client needs 'cleanup'/Close like HTTP one, do it on original NumThreads
 	}
 	// Cleanup state:
@@ -317,10 +465,26 @@ func RunGRPCTest(o *GRPCRunnerOptions) (*GRPCRunnerResults, error) {
 	} else if o.GrpcMethod != "" {
 		which = "Custom gRPC Method"
 	}
+	if st := total.streamState; st != nil {
+		total.StreamStats.Streams = st.streams
+		total.StreamStats.MessagesSent = st.sent
+		total.StreamStats.MessagesReceived = st.received
+		total.StreamStats.StreamSetup = st.setup.Export().CalcPercentiles(o.Percentiles)
+		total.StreamStats.MessageLatency = st.latency.Export().CalcPercentiles(o.Percentiles)
+		if log.Log(log.Info) {
+			total.StreamStats.StreamSetup.Print(out, "Stream setup time histogram (s)")
+			total.StreamStats.MessageLatency.Print(out, "Stream message latency histogram (s)")
+		}
+		_, _ = fmt.Fprintf(out, "%s streams: %d, messages sent: %d, received: %d\n",
+			total.StreamStats.Type, st.streams, st.sent, st.received)
+	}
 	_, _ = fmt.Fprintf(out, "Jitter: %t\n", total.Jitter)
 	for _, k := range keys {
 		_, _ = fmt.Fprintf(out, "%s %s : %d\n", which, k, total.RetCodes[k])
 	}
+	total.printStatus(out)
+	stopWatching()
+	total.backendResults(monitors, o.Percentiles, out)
 	return &total, nil
 }
 
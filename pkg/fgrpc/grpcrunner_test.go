@@ -410,6 +410,7 @@ type mdTestServer struct {
 	mdKey   string
 	mdValue string
 	health.Server
+	pingSrv // for the streaming methods
 }
 
 func (m *mdTestServer) Ping(ctx context.Context, _ *PingMessage) (*PingMessage, error) {
@@ -816,3 +817,104 @@ func TestDynamicGrpcCallErrors(t *testing.T) {
 		}
 	})
 }
+
+func TestGRPCRunnerStreaming(t *testing.T) {
+	log.SetLogLevel(log.Info)
+	port := PingServerTCP("0", "streaming-test", 0, noTLSO)
+	addr := fmt.Sprintf("localhost:%d", port)
+	tests := []struct {
+		method       string
+		payload      string
+		messages     int
+		duration     time.Duration
+		streamType   string
+		wantSent     int64
+		wantReceived int64
+	}{
+		{"fgrpc.PingServer/PingStream", `{"payload": "bidi"}`, 5, 0, StreamTypeBidi, 5, 5},
+		{"fgrpc.PingServer/PingClientStream", `{"payload": "client"}`, 4, 0, StreamTypeClient, 4, 1},
+		{"fgrpc.PingServer/PingServerStream", `{"count": 3}`, 0, 0, StreamTypeServer, 1, 3},
+		{"fgrpc.PingServer/PingServerStream", `{"count": 30}`, 2, 0, StreamTypeServer, 1, 2},
+		{"fgrpc.PingServer/PingStream", "", 0, 0, StreamTypeBidi, DefaultStreamMessages, DefaultStreamMessages},
+	}
+	for _, tt := range tests {
+		o := &GRPCRunnerOptions{
+			RunnerOptions: periodic.RunnerOptions{
+				QPS:        -1,
+				Exactly:    6,
+				NumThreads: 2,
+				Out:        os.Stderr,
+			},
+			Destination:    addr,
+			GrpcMethod:     tt.method,
+			Payload:        tt.payload,
+			StreamMessages: tt.messages,
+			StreamDuration: tt.duration,
+		}
+		res, err := RunGRPCTest(o)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", tt.method, err)
+		}
+		if res.RetCodes["OK"] != 6 {
+			t.Errorf("%s: expected 6 OK streams, got %+v", tt.method, res.RetCodes)
+		}
+		s := res.StreamStats
+		if s == nil {
+			t.Fatalf("%s: missing stream stats", tt.method)
+		}
+		if s.Type != tt.streamType || s.Streams != 6 || s.StreamSetup.Count != 6 {
+			t.Errorf("%s: unexpected stream stats %+v", tt.method, s)
+		}
+		if s.MessagesSent != 6*tt.wantSent || s.MessagesReceived != 6*tt.wantReceived {
+			t.Errorf("%s: expected %d sent %d received per stream, got %d %d", tt.method,
+				tt.wantSent, tt.wantReceived, s.MessagesSent, s.MessagesReceived)
+		}
+		if s.MessageLatency.Count == 0 {
+			t.Errorf("%s: no message latency recorded", tt.method)
+		}
+	}
+}
+
+func TestGRPCRunnerStreamingRateAndLifetime(t *testing.T) {
+	log.SetLogLevel(log.Info)
+	port := PingServerTCP("0", "streaming-test", 0, noTLSO)
+	o := &GRPCRunnerOptions{
+		RunnerOptions: periodic.RunnerOptions{
+			QPS:        -1,
+			Exactly:    2,
+			NumThreads: 1,
+			Out:        os.Stderr,
+		},
+		Destination:    fmt.Sprintf("localhost:%d", port),
+		GrpcMethod:     "fgrpc.PingServer/PingStream",
+		StreamQPS:      50,
+		StreamDuration: 150 * time.Millisecond,
+	}
+	res, err := RunGRPCTest(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := res.StreamStats
+	// 150ms at 50 msg/s is 8 messages (first one at 0) per stream, allow some slack.
+	if s.MessagesSent < 2*6 || s.MessagesSent > 2*9 {
+		t.Errorf("Unexpected number of messages sent with rate and lifetime: %+v", s)
+	}
+	if s.MessagesReceived != s.MessagesSent {
+		t.Errorf("Expected all bidi messages to be replied to: %+v", s)
+	}
+	if res.DurationHistogram.Min < 0.14 {
+		t.Errorf("Stream lifetime %g shorter than expected", res.DurationHistogram.Min)
+	}
+	// Server stream ended by the lifetime: the server replies with a delay so only a few messages fit.
+	o.GrpcMethod = "fgrpc.PingServer/PingServerStream"
+	o.Payload = `{"count": 100, "delayNanos": 20000000}`
+	o.StreamQPS = 0
+	o.StreamDuration = 100 * time.Millisecond
+	res, err = RunGRPCTest(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.RetCodes["OK"] != 2 || res.StreamStats.MessagesReceived < 4 || res.StreamStats.MessagesReceived > 12 {
+		t.Errorf("Unexpected server stream ended by lifetime results %+v %+v", res.RetCodes, res.StreamStats)
+	}
+}
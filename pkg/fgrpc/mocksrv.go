@@ -0,0 +1,387 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package fgrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+
+	"fortio.org/fortio/pkg/fhttp"
+	"fortio.org/fortio/pkg/fnet"
+	"fortio.org/fortio/pkg/log"
+	"fortio.org/fortio/pkg/stats"
+	"github.com/jhump/protoreflect/desc"    //nolint:staticcheck // TODO: migrate to v2 API
+	"github.com/jhump/protoreflect/dynamic" //nolint:staticcheck // TODO: migrate to v2 API
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// MockAnyMethod is the MockConfig key for the methods not otherwise configured.
+const MockAnyMethod = "*"
+
+// MockServerOptions are the options of MockServer.
+type MockServerOptions struct {
+	// Descriptors of the services to mock: .proto files (and their import paths) and/or a
+	// compiled FileDescriptorSet, like for GRPCRunnerOptions.
+	ProtoFiles       []string
+	ProtoImportPaths []string
+	ProtoSet         string
+	// Config is the JSON file of the MockConfig, when empty all the methods reply an empty message.
+	Config               string
+	MaxConcurrentStreams uint32
+	TLSOptions           *fhttp.TLSOptions
+}
+
+// MockMethod is the mocked behavior of a method.
+type MockMethod struct {
+	// Response is the JSON reply, either an object or a string template using the payload template
+	// tokens ({seq}, {uuid}, {random}, {random:N}) and {request.field} (field of the JSON request).
+	// Empty replies an empty message.
+	Response json.RawMessage `json:"response,omitempty"`
+	// Count is the number of replies of server streaming methods (default 1).
+	Count int64 `json:"count,omitempty"`
+	// Delay, Status, Reset and Abort are the fault injection parameters (see FaultDelay etc...), ie
+	// "10ms:90,200ms:10" and "UNAVAILABLE:5". The request metadata overrides them like for the ping server.
+	Delay  string `json:"delay,omitempty"`
+	Status string `json:"status,omitempty"`
+	Reset  string `json:"reset,omitempty"`
+	Abort  string `json:"abort,omitempty"`
+}
+
+// MockConfig maps "package.Service/Method", "package.Service" (all its methods) or MockAnyMethod
+// to the mocked behavior, the most specific match is used.
+type MockConfig map[string]*MockMethod
+
+// mockMethod is a resolved MockMethod.
+type mockMethod struct {
+	md       *desc.MethodDescriptor
+	response string
+	template *payloadTemplate // nil when the response has no token.
+	count    int64
+	faults   url.Values
+	delays   *stats.Delays // parsed faults delay, which may be empirical(file).
+}
+
+type mockServer struct {
+	faults  *faultInjector
+	methods map[string]url.Values // "/package.Service/Method" -> faults, for aborts.
+}
+
+// ReadMockConfig reads the JSON MockConfig file.
+func ReadMockConfig(fileName string) (MockConfig, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read mock config: %w", err)
+	}
+	cfg := MockConfig{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err = dec.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("invalid mock config %s: %w", fileName, err)
+	}
+	return cfg, nil
+}
+
+// newMockMethod resolves the config of md and validates its response.
+func newMockMethod(md *desc.MethodDescriptor, cfg MockConfig) (*mockMethod, error) {
+	name := md.GetService().GetFullyQualifiedName() + "/" + md.GetName()
+	mm := cfg[name]
+	if mm == nil {
+		mm = cfg[md.GetService().GetFullyQualifiedName()]
+	}
+	if mm == nil {
+		mm = cfg[MockAnyMethod]
+	}
+	if mm == nil {
+		mm = &MockMethod{}
+	}
+	m := &mockMethod{md: md, response: "{}", count: max(mm.Count, 1), faults: url.Values{}}
+	if resp := bytes.TrimSpace(mm.Response); len(resp) > 0 {
+		m.response = string(resp)
+		if resp[0] == '"' {
+			if err := json.Unmarshal(resp, &m.response); err != nil {
+				return nil, fmt.Errorf("%s: invalid response template: %w", name, err)
+			}
+		}
+	}
+	var err error
+	if m.template, err = newPayloadTemplate(m.response, ""); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	// Validate with an empty request.
+	if _, err = m.render(0, nil); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	if mm.Delay != "" {
+		if m.delays, err = stats.ParseDelays(mm.Delay, true); err != nil {
+			return nil, fmt.Errorf("%s: invalid delay %q: %w", name, mm.Delay, err)
+		}
+	}
+	for k, v := range map[string]string{FaultDelay: mm.Delay, FaultStatus: mm.Status, FaultReset: mm.Reset, FaultAbort: mm.Abort} {
+		if v != "" {
+			m.faults.Set(k, v)
+		}
+	}
+	log.LogVf("Mocking %s (%s) with %s faults %v", name, StreamType(md), m.response, m.faults)
+	return m, nil
+}
+
+// reply renders the next response for the request.
+func (m *mockMethod) reply(in *dynamic.Message) (*dynamic.Message, error) {
+	var seq int64
+	if m.template != nil {
+		seq = m.template.seq.Add(1)
+	}
+	return m.render(seq, in)
+}
+
+// render renders the response for the request (nil for an empty one).
+func (m *mockMethod) render(seq int64, in *dynamic.Message) (*dynamic.Message, error) {
+	response := m.response
+	if m.template != nil {
+		var request map[string]any
+		if in != nil {
+			data, err := in.MarshalJSON()
+			if err != nil {
+				return nil, err
+			}
+			if err = json.Unmarshal(data, &request); err != nil {
+				return nil, err
+			}
+		}
+		response = m.template.renderWith(seq, request)
+	}
+	out := dynamic.NewMessage(m.md.GetOutputType())
+	if err := json.Unmarshal([]byte(response), out); err != nil {
+		return nil, fmt.Errorf("invalid response %q for %s: %w", response, m.md.GetOutputType().GetFullyQualifiedName(), err)
+	}
+	return out, nil
+}
+
+// handle applies the faults and replies to one request.
+func (s *mockServer) handle(ctx context.Context, m *mockMethod, in *dynamic.Message) (*dynamic.Message, error) {
+	log.LogVf("Mock %s called %v", m.md.GetFullyQualifiedName(), in)
+	if err := s.faults.inject(ctx, m.faults, m.delays); err != nil {
+		return nil, err
+	}
+	return m.reply(in)
+}
+
+func (s *mockServer) unaryHandler(m *mockMethod) grpc.MethodHandler {
+	return func(_ any, ctx context.Context, dec func(any) error, _ grpc.UnaryServerInterceptor) (any, error) {
+		in := dynamic.NewMessage(m.md.GetInputType())
+		if err := dec(in); err != nil {
+			return nil, err
+		}
+		return s.handle(ctx, m, in)
+	}
+}
+
+// streamHandler replies like the ping server: to each message for bidi streams, once to the last
+// message for client streams and Count times for server streams.
+func (s *mockServer) streamHandler(m *mockMethod) grpc.StreamHandler {
+	return func(_ any, stream grpc.ServerStream) error {
+		ctx := stream.Context()
+		var last *dynamic.Message
+		for {
+			in := dynamic.NewMessage(m.md.GetInputType())
+			err := stream.RecvMsg(in)
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			last = in
+			if !m.md.IsClientStreaming() {
+				break
+			}
+			if m.md.IsServerStreaming() { // bidi
+				out, err := s.handle(ctx, m, in)
+				if err != nil {
+					return err
+				}
+				if err = stream.SendMsg(out); err != nil {
+					return err
+				}
+			}
+		}
+		if m.md.IsClientStreaming() && m.md.IsServerStreaming() {
+			return nil
+		}
+		count := int64(1)
+		if !m.md.IsClientStreaming() {
+			count = m.count
+		}
+		for range count {
+			out, err := s.handle(ctx, m, last)
+			if err != nil {
+				return err
+			}
+			if err = stream.SendMsg(out); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// serviceDesc is the gRPC service description for the dynamic (mocked) service sd.
+func (s *mockServer) serviceDesc(sd *desc.ServiceDescriptor, cfg MockConfig) (*grpc.ServiceDesc, error) {
+	gsd := &grpc.ServiceDesc{
+		ServiceName: sd.GetFullyQualifiedName(),
+		HandlerType: (*any)(nil),
+		Metadata:    sd.GetFile().GetName(),
+	}
+	for _, md := range sd.GetMethods() {
+		m, err := newMockMethod(md, cfg)
+		if err != nil {
+			return nil, err
+		}
+		s.methods["/"+gsd.ServiceName+"/"+md.GetName()] = m.faults
+		if !md.IsClientStreaming() && !md.IsServerStreaming() {
+			gsd.Methods = append(gsd.Methods, grpc.MethodDesc{MethodName: md.GetName(), Handler: s.unaryHandler(m)})
+			continue
+		}
+		gsd.Streams = append(gsd.Streams, grpc.StreamDesc{
+			StreamName:    md.GetName(),
+			Handler:       s.streamHandler(m),
+			ServerStreams: md.IsServerStreaming(),
+			ClientStreams: md.IsClientStreaming(),
+		})
+	}
+	return gsd, nil
+}
+
+// mockResolver resolves the descriptors of the mocked services for the reflection service,
+// falling back to the ones compiled in (ie of the reflection service itself).
+type mockResolver struct {
+	files *protoregistry.Files
+}
+
+func (r mockResolver) FindFileByPath(path string) (protoreflect.FileDescriptor, error) {
+	if fd, err := r.files.FindFileByPath(path); err == nil {
+		return fd, nil
+	}
+	return protoregistry.GlobalFiles.FindFileByPath(path)
+}
+
+func (r mockResolver) FindDescriptorByName(name protoreflect.FullName) (protoreflect.Descriptor, error) {
+	if d, err := r.files.FindDescriptorByName(name); err == nil {
+		return d, nil
+	}
+	return protoregistry.GlobalFiles.FindDescriptorByName(name)
+}
+
+// register adds fd and its dependencies to the resolver.
+func (r mockResolver) register(fd *desc.FileDescriptor) {
+	if _, err := r.files.FindFileByPath(fd.GetName()); err == nil {
+		return
+	}
+	for _, dep := range fd.GetDependencies() {
+		r.register(dep)
+	}
+	if err := r.files.RegisterFile(fd.UnwrapFile()); err != nil {
+		log.Warnf("Unable to register %s for reflection: %v", fd.GetName(), err)
+	}
+}
+
+// MockServer starts a gRPC server mocking all the services of the proto files or descriptor set,
+// replying per the MockConfig (and the standard health service, SERVING for all of them).
+// The reflection service is enabled so fortio's -grpc-method (or grpcurl) can call it without
+// the descriptors. Returns the address being bound (useful when passing "0" as the port).
+func MockServer(port string, o *MockServerOptions) (net.Addr, error) {
+	if o.ProtoSet == "" && len(o.ProtoFiles) == 0 {
+		return nil, errors.New("gRPC mock server needs proto files or a descriptor set")
+	}
+	fds, err := loadFileDescriptors(o.ProtoSet, o.ProtoFiles, o.ProtoImportPaths)
+	if err != nil {
+		return nil, err
+	}
+	cfg := MockConfig{}
+	if o.Config != "" {
+		if cfg, err = ReadMockConfig(o.Config); err != nil {
+			return nil, err
+		}
+	}
+	tlsOptions := o.TLSOptions
+	if tlsOptions == nil {
+		tlsOptions = &fhttp.TLSOptions{}
+	}
+	s := &mockServer{methods: make(map[string]url.Values)}
+	s.faults = &faultInjector{server: MockServerName, defaults: func(method string) url.Values { return s.methods[method] }}
+	grpcServer := grpc.NewServer(append(serverOptions(MockServerName, o.MaxConcurrentStreams, tlsOptions),
+		grpc.InTapHandle(s.faults.abort))...)
+	resolver := mockResolver{files: &protoregistry.Files{}}
+	healthServer := health.NewServer()
+	services := make(map[string]bool) // service and service/method names.
+	for _, fd := range fds {
+		resolver.register(fd)
+		for _, sd := range fd.GetServices() {
+			name := sd.GetFullyQualifiedName()
+			if services[name] {
+				continue
+			}
+			gsd, err := s.serviceDesc(sd, cfg)
+			if err != nil {
+				return nil, err
+			}
+			grpcServer.RegisterService(gsd, s)
+			healthServer.SetServingStatus(name, grpc_health_v1.HealthCheckResponse_SERVING)
+			services[name] = true
+			for _, md := range sd.GetMethods() {
+				services[name+"/"+md.GetName()] = true
+			}
+			log.Infof("gRPC mock server serving %s (%d methods)", name, len(sd.GetMethods()))
+		}
+	}
+	if len(services) == 0 {
+		return nil, errors.New("no service found in the gRPC mock server proto files or descriptor set")
+	}
+	for k := range cfg {
+		if k != MockAnyMethod && !services[k] {
+			log.Warnf("gRPC mock config entry %q doesn't match any service", k)
+		}
+	}
+	grpc_health_v1.RegisterHealthServer(grpcServer, healthServer)
+	reflectionServer := reflection.NewServerV1(reflection.ServerOptions{Services: grpcServer, DescriptorResolver: resolver})
+	grpc_reflection_v1.RegisterServerReflectionServer(grpcServer, reflectionServer)
+	grpc_reflection_v1alpha.RegisterServerReflectionServer(grpcServer,
+		reflection.NewServer(reflection.ServerOptions{Services: grpcServer, DescriptorResolver: resolver}))
+	socket, addr := fnet.Listen("grpc mock", port)
+	if addr == nil {
+		return nil, fmt.Errorf("unable to listen on %q for the gRPC mock server", port)
+	}
+	go func() {
+		if err := grpcServer.Serve(&trackedListener{Listener: socket, f: s.faults}); err != nil {
+			log.Fatalf("failed to start grpc mock server: %v", err)
+		}
+	}()
+	return addr, nil
+}
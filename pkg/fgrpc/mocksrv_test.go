@@ -0,0 +1,160 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package fgrpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"fortio.org/fortio/pkg/log"
+	"fortio.org/fortio/pkg/periodic"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const mockTestConfig = `{
+  "fgrpc.PingServer/Ping": {"response": "{\"payload\": \"hello {request.payload}\", \"seq\": {seq}}"},
+  "fgrpc.PingServer/PingServerStream": {"response": {"payload": "tick"}, "count": 3},
+  "fgrpc.PingServer/PingClientStream": {"status": "FAILED_PRECONDITION", "abort": "100"}
+}`
+
+func TestMockServer(t *testing.T) {
+	log.SetLogLevel(log.Info)
+	cfgFile := filepath.Join(t.TempDir(), "mock.json")
+	if err := os.WriteFile(cfgFile, []byte(mockTestConfig), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	addr, err := MockServer("0", &MockServerOptions{ProtoFiles: []string{"ping.proto"}, Config: cfgFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := grpc.NewClient(addr.String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	cli := NewPingServerClient(conn)
+	ctx := context.Background()
+	for i := int64(1); i <= 2; i++ {
+		res, err := cli.Ping(ctx, &PingMessage{Payload: "world"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.GetPayload() != "hello world" || res.GetSeq() != i {
+			t.Errorf("Unexpected templated response %+v", res)
+		}
+	}
+	stream, err := cli.PingServerStream(ctx, &PingMessage{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for {
+		res, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.GetPayload() != "tick" {
+			t.Errorf("Unexpected stream response %+v", res)
+		}
+		n++
+	}
+	if n != 3 {
+		t.Errorf("Expected 3 server stream responses, got %d", n)
+	}
+	cstream, err := cli.PingClientStream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = cstream.CloseAndRecv(); status.Code(err) != codes.Unavailable {
+		t.Errorf("Expected aborted stream, got %v", err)
+	}
+	cstream, err = cli.PingClientStream(metadata.NewOutgoingContext(ctx, metadata.Pairs(FaultAbort, "0")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = cstream.Send(&PingMessage{})
+	if _, err = cstream.CloseAndRecv(); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("Expected failed precondition, got %v", err)
+	}
+	// Unconfigured bidi method: empty replies.
+	bidi, err := cli.PingStream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = bidi.Send(&PingMessage{Payload: "x"})
+	if res, err := bidi.Recv(); err != nil || res.GetPayload() != "" {
+		t.Errorf("Unexpected bidi reply %+v %v", res, err)
+	}
+	_ = bidi.CloseSend()
+	health := grpc_health_v1.NewHealthClient(conn)
+	hres, err := health.Check(ctx, &grpc_health_v1.HealthCheckRequest{Service: "fgrpc.PingServer"})
+	if err != nil || hres.GetStatus() != grpc_health_v1.HealthCheckResponse_SERVING {
+		t.Errorf("Unexpected health %v %v", hres, err)
+	}
+	// Load through reflection.
+	o := &GRPCRunnerOptions{
+		RunnerOptions: periodic.RunnerOptions{
+			QPS:        -1,
+			Exactly:    4,
+			NumThreads: 1,
+			Out:        os.Stderr,
+		},
+		Destination:    addr.String(),
+		GrpcMethod:     "fgrpc.PingServer/Ping",
+		Payload:        `{"payload": "fortio"}`,
+		ResponseChecks: []string{"payload=hello fortio"},
+	}
+	res, err := RunGRPCTest(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.RetCodes["SERVING"] != 4 {
+		t.Errorf("Unexpected mock load results %+v", res.RetCodes)
+	}
+}
+
+func TestMockServerErrors(t *testing.T) {
+	if _, err := MockServer("0", &MockServerOptions{}); err == nil {
+		t.Errorf("Expected error without descriptors")
+	}
+	dir := t.TempDir()
+	for _, cfg := range []string{
+		`{"fgrpc.PingServer/Ping": {"response": {"nope": 1}}}`,
+		`{"fgrpc.PingServer/Ping": {"respons": {}}}`,
+		`{"*": {"response": "{feed.x}"}}`,
+		`not json`,
+	} {
+		cfgFile := filepath.Join(dir, "bad.json")
+		if err := os.WriteFile(cfgFile, []byte(cfg), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := MockServer("0", &MockServerOptions{ProtoFiles: []string{"ping.proto"}, Config: cfgFile}); err == nil {
+			t.Errorf("Expected error for config %s", cfg)
+		}
+	}
+}
@@ -0,0 +1,304 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package fgrpc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"fortio.org/fortio/pkg/log"
+	"github.com/google/uuid"
+)
+
+// Mismatch is the RetCodes key for calls whose response failed the ResponseChecks.
+const Mismatch = "MISMATCH"
+
+// ErrResponseMismatch is returned (wrapped) when a response doesn't pass the ResponseChecks.
+var ErrResponseMismatch = errors.New("response mismatch")
+
+// Payload template tokens: {seq} (run wide sequence number starting at 1), {uuid}, {random}
+// (non negative int63), {random:N} (in [0, N)) and {feed.field} (field of the current line of the
+// PayloadFeeder JSONL file, one line per call, looping). Strings from the feeder are inserted
+// JSON escaped without quotes, other values as JSON. The mock server response templates use
+// {request.field} (top level field of the JSON request) the same way.
+var templateTokenRegexp = regexp.MustCompile(`\{(seq|uuid|random(?::[0-9]+)?|(?:feed|request)\.[^{}"\s]+)\}`)
+
+// payloadTemplate renders a JSON payload with tokens, shared by all the threads of a run.
+type payloadTemplate struct {
+	tmpl  string
+	seq   atomic.Int64
+	lines []map[string]any
+	next  atomic.Int64
+}
+
+// newPayloadTemplate returns nil when the payload has no token (and no feeder), ie it can be reused as is.
+func newPayloadTemplate(payload, feedFile string) (*payloadTemplate, error) {
+	hasTokens := templateTokenRegexp.MatchString(payload)
+	if !hasTokens {
+		if feedFile != "" {
+			log.Warnf("Payload feeder %s set but the payload has no {feed.field} token", feedFile)
+		}
+		return nil, nil //nolint:nilnil // nil template means static payload.
+	}
+	p := &payloadTemplate{tmpl: payload}
+	if feedFile != "" {
+		var err error
+		if p.lines, err = readJSONLines(feedFile); err != nil {
+			return nil, err
+		}
+	} else if strings.Contains(payload, "{feed.") {
+		return nil, errors.New("payload uses {feed.field} tokens but no payload feeder file is set")
+	}
+	return p, nil
+}
+
+func readJSONLines(fileName string) ([]map[string]any, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open payload feeder: %w", err)
+	}
+	defer f.Close()
+	var lines []map[string]any
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var m map[string]any
+		if err = json.Unmarshal(line, &m); err != nil {
+			return nil, fmt.Errorf("payload feeder %s line %d: %w", fileName, n, err)
+		}
+		lines = append(lines, m)
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading payload feeder %s: %w", fileName, err)
+	}
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("payload feeder %s has no data", fileName)
+	}
+	log.Infof("Loaded %d lines from payload feeder %s", len(lines), fileName)
+	return lines, nil
+}
+
+// render returns the next payload.
+func (p *payloadTemplate) render() string {
+	var line map[string]any
+	if len(p.lines) > 0 {
+		line = p.lines[(p.next.Add(1)-1)%int64(len(p.lines))]
+	}
+	return p.renderWith(p.seq.Add(1), line)
+}
+
+func (p *payloadTemplate) renderWith(seq int64, line map[string]any) string {
+	return templateTokenRegexp.ReplaceAllStringFunc(p.tmpl, func(token string) string {
+		name := token[1 : len(token)-1]
+		switch {
+		case name == "seq":
+			return strconv.FormatInt(seq, 10)
+		case name == "uuid":
+			return uuid.New().String()
+		case name == "random":
+			return strconv.FormatInt(rand.Int64(), 10) //nolint:gosec // not security sensitive
+		case strings.HasPrefix(name, "random:"):
+			n, _ := strconv.ParseInt(name[len("random:"):], 10, 64)
+			if n <= 0 {
+				return "0"
+			}
+			return strconv.FormatInt(rand.Int64N(n), 10) //nolint:gosec // not security sensitive
+		default: // feed.field or request.field
+			_, field, _ := strings.Cut(name, ".")
+			v, found := line[field]
+			if !found {
+				return "null"
+			}
+			b, _ := json.Marshal(v)
+			if _, isString := v.(string); isString {
+				return string(b[1 : len(b)-1]) // escaped, quotes are in the template.
+			}
+			return string(b)
+		}
+	})
+}
+
+// responseCheck is one assertion on a response field: path=value, path!=value, path~regexp
+// or just path (field present and not empty/zero in the JSON rendering).
+type responseCheck struct {
+	spec  string
+	path  []any // string keys and int indexes
+	op    string
+	value string
+	re    *regexp.Regexp
+}
+
+var pathIndexRegexp = regexp.MustCompile(`^([^\[\]]*)((?:\[[0-9]+\])*)$`)
+
+// parseResponseCheck parses a check like `message.items[0].name=foo`, a leading `$.` is optional.
+func parseResponseCheck(spec string) (*responseCheck, error) {
+	c := &responseCheck{spec: spec}
+	pathStr := spec
+	if i := strings.IndexAny(spec, "=!~"); i >= 0 {
+		pathStr = spec[:i]
+		switch {
+		case spec[i] == '=':
+			c.op, c.value = "=", spec[i+1:]
+		case spec[i] == '~':
+			c.op, c.value = "~", spec[i+1:]
+			var err error
+			if c.re, err = regexp.Compile(c.value); err != nil {
+				return nil, fmt.Errorf("invalid regexp in response check %q: %w", spec, err)
+			}
+		case strings.HasPrefix(spec[i:], "!="):
+			c.op, c.value = "!=", spec[i+2:]
+		default:
+			return nil, fmt.Errorf("invalid operator in response check %q", spec)
+		}
+	}
+	pathStr = strings.TrimPrefix(strings.TrimPrefix(pathStr, "$"), ".")
+	if pathStr == "" {
+		return nil, fmt.Errorf("empty path in response check %q", spec)
+	}
+	for _, elem := range strings.Split(pathStr, ".") {
+		m := pathIndexRegexp.FindStringSubmatch(elem)
+		if m == nil || (m[1] == "" && m[2] == "") {
+			return nil, fmt.Errorf("invalid path element %q in response check %q", elem, spec)
+		}
+		if m[1] != "" {
+			c.path = append(c.path, m[1])
+		}
+		for _, idx := range strings.Split(strings.Trim(m[2], "[]"), "][") {
+			if idx == "" {
+				continue
+			}
+			n, _ := strconv.Atoi(idx)
+			c.path = append(c.path, n)
+		}
+	}
+	return c, nil
+}
+
+func parseResponseChecks(specs []string) ([]*responseCheck, error) {
+	res := make([]*responseCheck, 0, len(specs))
+	for _, s := range specs {
+		c, err := parseResponseCheck(s)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, c)
+	}
+	return res, nil
+}
+
+// lookup returns the value at the check's path in the decoded JSON.
+func (c *responseCheck) lookup(v any) (any, bool) {
+	for _, p := range c.path {
+		switch k := p.(type) {
+		case string:
+			m, ok := v.(map[string]any)
+			if !ok {
+				return nil, false
+			}
+			if v, ok = m[k]; !ok {
+				return nil, false
+			}
+		case int:
+			a, ok := v.([]any)
+			if !ok || k >= len(a) {
+				return nil, false
+			}
+			v = a[k]
+		}
+	}
+	return v, true
+}
+
+func jsonValueString(v any) string {
+	switch x := v.(type) {
+	case string:
+		return x
+	case json.Number:
+		return x.String()
+	case nil:
+		return "null"
+	default:
+		b, _ := json.Marshal(x)
+		return string(b)
+	}
+}
+
+func (c *responseCheck) check(doc any) error {
+	v, found := c.lookup(doc)
+	actual := jsonValueString(v)
+	switch c.op {
+	case "":
+		// proto3 JSON omits zero values so present means set.
+		if !found {
+			return fmt.Errorf("%w: %q field not set", ErrResponseMismatch, c.spec)
+		}
+		return nil
+	case "=":
+		if found && actual == c.value {
+			return nil
+		}
+	case "!=":
+		if !found || actual != c.value {
+			return nil
+		}
+	case "~":
+		if found && c.re.MatchString(actual) {
+			return nil
+		}
+	}
+	if !found {
+		actual = "<missing>"
+	}
+	return fmt.Errorf("%w: %q got %q", ErrResponseMismatch, c.spec, actual)
+}
+
+// checkResponse runs all the checks against the protobuf JSON rendering of the response
+// (dynamic messages marshal to JSON following the proto3 JSON mapping, ie lowerCamelCase field names).
+func checkResponse(checks []*responseCheck, response any) error {
+	if len(checks) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(response)
+	if err != nil {
+		return fmt.Errorf("%w: unable to render response as JSON: %w", ErrResponseMismatch, err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var doc any
+	if err = dec.Decode(&doc); err != nil {
+		return fmt.Errorf("%w: unable to decode response JSON: %w", ErrResponseMismatch, err)
+	}
+	for _, c := range checks {
+		if err = c.check(doc); err != nil {
+			log.LogVf("Response check failed: %v - response %s", err, data)
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package fgrpc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"fortio.org/fortio/pkg/log"
+	"fortio.org/fortio/pkg/periodic"
+)
+
+func writeFeeder(t *testing.T, content string) string {
+	t.Helper()
+	fname := filepath.Join(t.TempDir(), "feed.jsonl")
+	if err := os.WriteFile(fname, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return fname
+}
+
+func TestPayloadTemplate(t *testing.T) {
+	p, err := newPayloadTemplate(`{"payload": "static"}`, "")
+	if err != nil || p != nil {
+		t.Errorf("Expected nil template for static payload, got %v %v", p, err)
+	}
+	_, err = newPayloadTemplate(`{"payload": "{feed.name}"}`, "")
+	if err == nil {
+		t.Errorf("Expected error for feed token without feeder")
+	}
+	_, err = newPayloadTemplate(`{"payload": "{feed.name}"}`, writeFeeder(t, "{bad json\n"))
+	if err == nil {
+		t.Errorf("Expected error for invalid feeder line")
+	}
+	_, err = newPayloadTemplate(`{"payload": "{feed.name}"}`, writeFeeder(t, "\n\n"))
+	if err == nil {
+		t.Errorf("Expected error for empty feeder")
+	}
+	feeder := writeFeeder(t, `{"name": "a\"b", "n": 42}`+"\n\n"+`{"name": "c", "n": [1,2]}`+"\n")
+	p, err = newPayloadTemplate(`{"seq": {seq}, "payload": "{feed.name} {uuid} {random:10}", "n": {feed.n}, "x": {feed.x}}`,
+		feeder)
+	if err != nil {
+		t.Fatalf("Unexpected template error: %v", err)
+	}
+	re := regexp.MustCompile(`^{"seq": (\d+), "payload": "(.*) [0-9a-f-]{36} \d", "n": (.*), "x": null}$`)
+	expected := []struct {
+		name string
+		n    string
+	}{{`a\"b`, "42"}, {"c", "[1,2]"}, {`a\"b`, "42"}}
+	for i, e := range expected {
+		s := p.render()
+		m := re.FindStringSubmatch(s)
+		if m == nil {
+			t.Fatalf("Rendered %q doesn't match %v", s, re)
+		}
+		if m[1] != strconv.Itoa(i+1) || m[2] != e.name || m[3] != e.n {
+			t.Errorf("Rendered %d: %q, expected seq %d name %s n %s", i, s, i+1, e.name, e.n)
+		}
+		var v map[string]any
+		if err = json.Unmarshal([]byte(s), &v); err != nil {
+			t.Errorf("Rendered %q isn't valid JSON: %v", s, err)
+		}
+	}
+}
+
+func TestResponseChecks(t *testing.T) {
+	var doc any
+	if err := json.Unmarshal([]byte(`{"payload": "abc", "seq": "12", "items": [{"name": "x"}, {"name": "y", "ok": true}],
+		"matrix": [[1, 2], [3]]}`), &doc); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		check string
+		ok    bool
+	}{
+		{"payload", true},
+		{"$.payload=abc", true},
+		{"payload=abd", false},
+		{"payload!=abd", true},
+		{"payload!=abc", false},
+		{"missing!=abc", true},
+		{"missing", false},
+		{"seq~^1[0-9]$", true},
+		{"seq~^2", false},
+		{"items[1].name=y", true},
+		{"items[1].ok=true", true},
+		{"items[2].name", false},
+		{"items[0]", true},
+		{"items[0].ok", false},
+		{"matrix[0][1]=2", true},
+		{"matrix[1]=[3]", true},
+		{"payload.sub", false},
+		{"payload[0]", false},
+	}
+	for _, tt := range tests {
+		c, err := parseResponseCheck(tt.check)
+		if err != nil {
+			t.Errorf("Unexpected parse error for %q: %v", tt.check, err)
+			continue
+		}
+		err = c.check(doc)
+		if (err == nil) != tt.ok {
+			t.Errorf("Check %q: got %v, expected ok %v", tt.check, err, tt.ok)
+		}
+		if err != nil && !errors.Is(err, ErrResponseMismatch) {
+			t.Errorf("Check %q error %v isn't a mismatch", tt.check, err)
+		}
+	}
+	for _, bad := range []string{"", "=abc", "$.", "a!b", "a~[", "a..b", "a[x]"} {
+		if _, err := parseResponseCheck(bad); err == nil {
+			t.Errorf("Expected parse error for %q", bad)
+		}
+	}
+}
+
+func TestGRPCRunnerPayloadTemplateAndChecks(t *testing.T) {
+	log.SetLogLevel(log.Info)
+	port := PingServerTCP("0", "template-test", 0, noTLSO)
+	feeder := writeFeeder(t, `{"name": "a"}`+"\n"+`{"name": "b"}`+"\n")
+	tests := []struct {
+		name     string
+		method   string
+		payload  string
+		checks   []string
+		ok       int64
+		mismatch int64
+	}{
+		{"unary all pass", "fgrpc.PingServer/Ping", `{"seq": {seq}, "payload": "{feed.name}"}`,
+			[]string{"payload~^[ab]$", "seq!=0"}, 4, 0},
+		{"unary half mismatch", "fgrpc.PingServer/Ping", `{"seq": {seq}, "payload": "{feed.name}"}`,
+			[]string{"payload=a"}, 2, 2},
+		{"server stream pass", "fgrpc.PingServer/PingServerStream", `{"count": 3, "payload": "{uuid}"}`,
+			[]string{"payload~^[0-9a-f-]{36}$"}, 4, 0},
+		{"server stream mismatch", "fgrpc.PingServer/PingServerStream", `{"count": 3, "seq": {seq}}`,
+			[]string{"seq=1000"}, 0, 4},
+		{"bidi stream pass", "fgrpc.PingServer/PingStream", `{"seq": {seq}}`,
+			[]string{"seq"}, 4, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := &GRPCRunnerOptions{
+				RunnerOptions: periodic.RunnerOptions{
+					QPS:        -1,
+					Exactly:    4,
+					NumThreads: 2,
+					Out:        os.Stderr,
+				},
+				Destination:    fmt.Sprintf("localhost:%d", port),
+				GrpcMethod:     tt.method,
+				Payload:        tt.payload,
+				PayloadFeeder:  feeder,
+				ResponseChecks: tt.checks,
+				StreamMessages: 3,
+			}
+			res, err := RunGRPCTest(o)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if res.RetCodes["SERVING"]+res.RetCodes["OK"] != tt.ok || res.RetCodes[Mismatch] != tt.mismatch {
+				t.Errorf("Expected %d ok and %d mismatches, got %+v", tt.ok, tt.mismatch, res.RetCodes)
+			}
+		})
+	}
+	// invalid checks and templates are caught before the run.
+	o := &GRPCRunnerOptions{
+		RunnerOptions:  periodic.RunnerOptions{QPS: -1, Exactly: 1, Out: os.Stderr},
+		Destination:    fmt.Sprintf("localhost:%d", port),
+		GrpcMethod:     "fgrpc.PingServer/Ping",
+		Payload:        `{"seq": "{feed.name}"}`,
+		PayloadFeeder:  feeder,
+		ResponseChecks: []string{"seq"},
+	}
+	if _, err := RunGRPCTest(o); err == nil {
+		t.Errorf("Expected error for template rendering an invalid int64")
+	}
+	o.Payload = `{"seq": {seq}}`
+	o.ResponseChecks = []string{"seq~("}
+	if _, err := RunGRPCTest(o); err == nil {
+		t.Errorf("Expected error for invalid response check")
+	}
+}
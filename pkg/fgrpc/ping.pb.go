@@ -42,6 +42,7 @@ type PingMessage struct {
 	Ts         int64  `protobuf:"varint,2,opt,name=ts" json:"ts,omitempty"`
 	Payload    string `protobuf:"bytes,3,opt,name=payload" json:"payload,omitempty"`
 	DelayNanos int64  `protobuf:"varint,4,opt,name=delayNanos" json:"delayNanos,omitempty"`
+	Count      int64  `protobuf:"varint,5,opt,name=count" json:"count,omitempty"`
 }
 
 func (m *PingMessage) Reset()                    { *m = PingMessage{} }
@@ -77,6 +78,13 @@ func (m *PingMessage) GetDelayNanos() int64 {
 	return 0
 }
 
+func (m *PingMessage) GetCount() int64 {
+	if m != nil {
+		return m.Count
+	}
+	return 0
+}
+
 func init() {
 	proto.RegisterType((*PingMessage)(nil), "fgrpc.PingMessage")
 }
@@ -95,6 +103,12 @@ const _ = grpc.SupportPackageIsVersion4
 
 type PingServerClient interface {
 	Ping(ctx context.Context, in *PingMessage, opts ...grpc.CallOption) (*PingMessage, error)
+	// Replies to each message (bidirectional streaming).
+	PingStream(ctx context.Context, opts ...grpc.CallOption) (PingServer_PingStreamClient, error)
+	// Replies once, with the last message and seq set to the number of messages received.
+	PingClientStream(ctx context.Context, opts ...grpc.CallOption) (PingServer_PingClientStreamClient, error)
+	// Replies count times (1 if not set) to the single message, seq incremented for each reply.
+	PingServerStream(ctx context.Context, in *PingMessage, opts ...grpc.CallOption) (PingServer_PingServerStreamClient, error)
 }
 
 type pingServerClient struct {
@@ -114,10 +128,113 @@ func (c *pingServerClient) Ping(ctx context.Context, in *PingMessage, opts ...gr
 	return out, nil
 }
 
+func (c *pingServerClient) PingStream(ctx context.Context, opts ...grpc.CallOption) (PingServer_PingStreamClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_PingServer_serviceDesc.Streams[0], c.cc, "/fgrpc.PingServer/PingStream", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &pingServerPingStreamClient{stream}
+	return x, nil
+}
+
+type PingServer_PingStreamClient interface {
+	Send(*PingMessage) error
+	Recv() (*PingMessage, error)
+	grpc.ClientStream
+}
+
+type pingServerPingStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *pingServerPingStreamClient) Send(m *PingMessage) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *pingServerPingStreamClient) Recv() (*PingMessage, error) {
+	m := new(PingMessage)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *pingServerClient) PingClientStream(ctx context.Context, opts ...grpc.CallOption) (PingServer_PingClientStreamClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_PingServer_serviceDesc.Streams[1], c.cc, "/fgrpc.PingServer/PingClientStream", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &pingServerPingClientStreamClient{stream}
+	return x, nil
+}
+
+type PingServer_PingClientStreamClient interface {
+	Send(*PingMessage) error
+	CloseAndRecv() (*PingMessage, error)
+	grpc.ClientStream
+}
+
+type pingServerPingClientStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *pingServerPingClientStreamClient) Send(m *PingMessage) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *pingServerPingClientStreamClient) CloseAndRecv() (*PingMessage, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(PingMessage)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *pingServerClient) PingServerStream(ctx context.Context, in *PingMessage, opts ...grpc.CallOption) (PingServer_PingServerStreamClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_PingServer_serviceDesc.Streams[2], c.cc, "/fgrpc.PingServer/PingServerStream", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &pingServerPingServerStreamClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type PingServer_PingServerStreamClient interface {
+	Recv() (*PingMessage, error)
+	grpc.ClientStream
+}
+
+type pingServerPingServerStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *pingServerPingServerStreamClient) Recv() (*PingMessage, error) {
+	m := new(PingMessage)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // Server API for PingServer service
 
 type PingServerServer interface {
 	Ping(context.Context, *PingMessage) (*PingMessage, error)
+	// Replies to each message (bidirectional streaming).
+	PingStream(PingServer_PingStreamServer) error
+	// Replies once, with the last message and seq set to the number of messages received.
+	PingClientStream(PingServer_PingClientStreamServer) error
+	// Replies count times (1 if not set) to the single message, seq incremented for each reply.
+	PingServerStream(*PingMessage, PingServer_PingServerStreamServer) error
 }
 
 func RegisterPingServerServer(s *grpc.Server, srv PingServerServer) {
@@ -142,6 +259,79 @@ func _PingServer_Ping_Handler(srv interface{}, ctx context.Context, dec func(int
 	return interceptor(ctx, in, info, handler)
 }
 
+func _PingServer_PingStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(PingServerServer).PingStream(&pingServerPingStreamServer{stream})
+}
+
+type PingServer_PingStreamServer interface {
+	Send(*PingMessage) error
+	Recv() (*PingMessage, error)
+	grpc.ServerStream
+}
+
+type pingServerPingStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *pingServerPingStreamServer) Send(m *PingMessage) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *pingServerPingStreamServer) Recv() (*PingMessage, error) {
+	m := new(PingMessage)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _PingServer_PingClientStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(PingServerServer).PingClientStream(&pingServerPingClientStreamServer{stream})
+}
+
+type PingServer_PingClientStreamServer interface {
+	SendAndClose(*PingMessage) error
+	Recv() (*PingMessage, error)
+	grpc.ServerStream
+}
+
+type pingServerPingClientStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *pingServerPingClientStreamServer) SendAndClose(m *PingMessage) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *pingServerPingClientStreamServer) Recv() (*PingMessage, error) {
+	m := new(PingMessage)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _PingServer_PingServerStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(PingMessage)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(PingServerServer).PingServerStream(m, &pingServerPingServerStreamServer{stream})
+}
+
+type PingServer_PingServerStreamServer interface {
+	Send(*PingMessage) error
+	grpc.ServerStream
+}
+
+type pingServerPingServerStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *pingServerPingServerStreamServer) Send(m *PingMessage) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 var _PingServer_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "fgrpc.PingServer",
 	HandlerType: (*PingServerServer)(nil),
@@ -151,23 +341,43 @@ var _PingServer_serviceDesc = grpc.ServiceDesc{
 			Handler:    _PingServer_Ping_Handler,
 		},
 	},
-	Streams:  []grpc.StreamDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "PingStream",
+			Handler:       _PingServer_PingStream_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "PingClientStream",
+			Handler:       _PingServer_PingClientStream_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "PingServerStream",
+			Handler:       _PingServer_PingServerStream_Handler,
+			ServerStreams: true,
+		},
+	},
 	Metadata: "ping.proto",
 }
 
 func init() { proto.RegisterFile("ping.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 163 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xe2, 0xe2, 0x2a, 0xc8, 0xcc, 0x4b,
-	0xd7, 0x2b, 0x28, 0xca, 0x2f, 0xc9, 0x17, 0x62, 0x4d, 0x4b, 0x2f, 0x2a, 0x48, 0x56, 0xca, 0xe4,
-	0xe2, 0x0e, 0xc8, 0xcc, 0x4b, 0xf7, 0x4d, 0x2d, 0x2e, 0x4e, 0x4c, 0x4f, 0x15, 0x12, 0xe0, 0x62,
-	0x2e, 0x4e, 0x2d, 0x94, 0x60, 0x54, 0x60, 0xd4, 0x60, 0x0e, 0x02, 0x31, 0x85, 0xf8, 0xb8, 0x98,
-	0x4a, 0x8a, 0x25, 0x98, 0xc0, 0x02, 0x4c, 0x25, 0xc5, 0x42, 0x12, 0x5c, 0xec, 0x05, 0x89, 0x95,
-	0x39, 0xf9, 0x89, 0x29, 0x12, 0xcc, 0x0a, 0x8c, 0x1a, 0x9c, 0x41, 0x30, 0xae, 0x90, 0x1c, 0x17,
-	0x57, 0x4a, 0x6a, 0x4e, 0x62, 0xa5, 0x5f, 0x62, 0x5e, 0x7e, 0xb1, 0x04, 0x0b, 0x58, 0x07, 0x92,
-	0x88, 0x91, 0x1d, 0x17, 0x17, 0xc8, 0xaa, 0xe0, 0xd4, 0xa2, 0xb2, 0xd4, 0x22, 0x21, 0x03, 0x2e,
-	0x16, 0x10, 0x4f, 0x48, 0x48, 0x0f, 0xec, 0x10, 0x3d, 0x24, 0x57, 0x48, 0x61, 0x11, 0x53, 0x62,
-	0x48, 0x62, 0x03, 0x3b, 0xdc, 0x18, 0x10, 0x00, 0x00, 0xff, 0xff, 0x54, 0x22, 0xa0, 0xfe, 0xc6,
-	0x00, 0x00, 0x00,
+	// 213 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x94, 0x91, 0xbf, 0x4a, 0xc6, 0x30,
+	0x14, 0x47, 0x4d, 0xff, 0x28, 0x5e, 0x41, 0xca, 0xc5, 0x21, 0x38, 0x48, 0xe9, 0xd4, 0xa9, 0x14,
+	0xdd, 0x1c, 0x5c, 0x9c, 0x15, 0xa9, 0x4f, 0x10, 0xdb, 0x6b, 0x28, 0xd4, 0x24, 0x26, 0x51, 0xe8,
+	0xe4, 0x7b, 0x3b, 0x49, 0x52, 0x0b, 0x1d, 0xbe, 0xe1, 0xeb, 0x96, 0xdf, 0x09, 0x27, 0x1c, 0x08,
+	0x80, 0x19, 0x95, 0x6c, 0x8c, 0xd5, 0x5e, 0x63, 0xfe, 0x2e, 0xad, 0xe9, 0xab, 0x1f, 0xb8, 0x78,
+	0x19, 0x95, 0x7c, 0x22, 0xe7, 0x84, 0x24, 0x2c, 0x20, 0x75, 0xf4, 0xc9, 0x59, 0xc9, 0xea, 0xb4,
+	0x0b, 0x47, 0xbc, 0x84, 0xc4, 0x3b, 0x9e, 0x44, 0x90, 0x78, 0x87, 0x1c, 0xce, 0x8c, 0x98, 0x27,
+	0x2d, 0x06, 0x9e, 0x96, 0xac, 0x3e, 0xef, 0xd6, 0x89, 0x37, 0x00, 0x03, 0x4d, 0x62, 0x7e, 0x16,
+	0x4a, 0x3b, 0x9e, 0x45, 0x63, 0x43, 0xf0, 0x0a, 0xf2, 0x5e, 0x7f, 0x29, 0xcf, 0xf3, 0x78, 0xb5,
+	0x8c, 0xdb, 0x5f, 0x06, 0x10, 0x0a, 0x5e, 0xc9, 0x7e, 0x93, 0xc5, 0x16, 0xb2, 0xb0, 0x10, 0x9b,
+	0xd8, 0xd7, 0x6c, 0xe2, 0xae, 0x0f, 0xb0, 0xea, 0x04, 0xef, 0xff, 0x7d, 0x6f, 0x49, 0x7c, 0x1c,
+	0xef, 0xd5, 0xac, 0x65, 0xf8, 0x00, 0x45, 0x80, 0x8f, 0xd3, 0x48, 0xca, 0xef, 0x7f, 0x61, 0xf5,
+	0x97, 0xf6, 0xbd, 0x7e, 0xcb, 0xde, 0x4e, 0xe3, 0x5f, 0xdc, 0xfd, 0x0d, 0x00, 0x52, 0x91, 0xae,
+	0x0c, 0x99, 0x01, 0x00, 0x00,
 }
@@ -16,7 +16,9 @@
 package fgrpc
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"net"
 	"os"
 	"time"
@@ -42,11 +44,17 @@ const (
 	Error = "ERROR"
 )
 
-type pingSrv struct{}
+type pingSrv struct {
+	faults *faultInjector // nil when not started through PingServer, faults other than reset still apply.
+}
 
 func (s *pingSrv) Ping(c context.Context, in *PingMessage) (*PingMessage, error) {
 	md, _ := metadata.FromIncomingContext(c)
 	log.LogVf("Ping called %+v (meta %+v)", *in, md)
+	defaults, delays := pingServerFaults()
+	if err := s.faults.inject(c, defaults, delays); err != nil {
+		return nil, err
+	}
 	out := *in // copy the input including the payload etc
 	out.Ts = time.Now().UnixNano()
 	if in.GetDelayNanos() > 0 {
@@ -57,11 +65,73 @@ func (s *pingSrv) Ping(c context.Context, in *PingMessage) (*PingMessage, error)
 	return &out, nil
 }
 
+// PingStream replies to each message like Ping, until the client closes its side.
+func (s *pingSrv) PingStream(stream PingServer_PingStreamServer) error {
+	for {
+		in, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		out, err := s.Ping(stream.Context(), in)
+		if err != nil {
+			return err
+		}
+		if err = stream.Send(out); err != nil {
+			return err
+		}
+	}
+}
+
+// PingClientStream replies once all the messages are received, with the last one and
+// seq set to the number of messages received.
+func (s *pingSrv) PingClientStream(stream PingServer_PingClientStreamServer) error {
+	last := &PingMessage{}
+	var n int64
+	for {
+		in, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		n++
+		last = in
+	}
+	out, err := s.Ping(stream.Context(), last)
+	if err != nil {
+		return err
+	}
+	out.Seq = n
+	return stream.SendAndClose(out)
+}
+
+// PingServerStream replies count times (at least once) to the message, incrementing seq.
+func (s *pingSrv) PingServerStream(in *PingMessage, stream PingServer_PingServerStreamServer) error {
+	count := max(in.GetCount(), 1)
+	for i := range count {
+		out, err := s.Ping(stream.Context(), in)
+		if err != nil {
+			return err
+		}
+		out.Seq = in.GetSeq() + i
+		if err := stream.Send(out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // PingServer starts a gRPC ping (and health) echo server.
 // returns the port being bound (useful when passing "0" as the port to
 // get a dynamic server). Pass the healthServiceName to use for the
 // gRPC service name health check (or pass DefaultHealthServiceName)
 // to be marked as SERVING. Pass maxConcurrentStreams > 0 to set that option.
+// Both the ping and health services support fault injection through request
+// metadata (see FaultStatus etc...) and DefaultPingServerFaults.
 func PingServer(port, healthServiceName string, maxConcurrentStreams uint32, tlsOptions *fhttp.TLSOptions) net.Addr {
 	if healthServiceName == "" {
 		healthServiceName = DefaultHealthServiceName
@@ -70,7 +140,28 @@ func PingServer(port, healthServiceName string, maxConcurrentStreams uint32, tls
 	if addr == nil {
 		return nil
 	}
-	var grpcOptions []grpc.ServerOption
+	faults := &faultInjector{server: PingServerName, defaults: pingDefaults}
+	socket = &trackedListener{Listener: socket, f: faults}
+	grpcServer := grpc.NewServer(append(serverOptions(PingServerName, maxConcurrentStreams, tlsOptions),
+		grpc.InTapHandle(faults.abort))...)
+	reflection.Register(grpcServer)
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus(healthServiceName, grpc_health_v1.HealthCheckResponse_SERVING)
+	healthServer.SetServingStatus(healthServiceName+"_down", grpc_health_v1.HealthCheckResponse_NOT_SERVING)
+	grpc_health_v1.RegisterHealthServer(grpcServer, &faultHealthServer{Server: healthServer, f: faults})
+	RegisterPingServerServer(grpcServer, &pingSrv{faults: faults})
+	go func() {
+		if err := grpcServer.Serve(socket); err != nil {
+			log.Fatalf("failed to start grpc server: %v", err)
+		}
+	}()
+	return addr
+}
+
+// serverOptions returns the metrics stats handler (labeled with name), MaxConcurrentStreams (when > 0)
+// and TLS credentials (when the cert and key are set) gRPC server options.
+func serverOptions(name string, maxConcurrentStreams uint32, tlsOptions *fhttp.TLSOptions) []grpc.ServerOption {
+	grpcOptions := []grpc.ServerOption{grpc.StatsHandler(serverStats{server: name})}
 	if maxConcurrentStreams > 0 {
 		log.Infof("Setting grpc.MaxConcurrentStreams server to %d", maxConcurrentStreams)
 		grpcOptions = append(grpcOptions, grpc.MaxConcurrentStreams(maxConcurrentStreams))
@@ -88,19 +179,7 @@ func PingServer(port, healthServiceName string, maxConcurrentStreams uint32, tls
 		log.Printf("Using server cert and key from %v and %v to construct %sTLS credentials", tlsOptions.Cert, tlsOptions.Key, mtls)
 		grpcOptions = append(grpcOptions, grpc.Creds(creds))
 	}
-	grpcServer := grpc.NewServer(grpcOptions...)
-	reflection.Register(grpcServer)
-	healthServer := health.NewServer()
-	healthServer.SetServingStatus(healthServiceName, grpc_health_v1.HealthCheckResponse_SERVING)
-	healthServer.SetServingStatus(healthServiceName+"_down", grpc_health_v1.HealthCheckResponse_NOT_SERVING)
-	grpc_health_v1.RegisterHealthServer(grpcServer, healthServer)
-	RegisterPingServerServer(grpcServer, &pingSrv{})
-	go func() {
-		if err := grpcServer.Serve(socket); err != nil {
-			log.Fatalf("failed to start grpc server: %v", err)
-		}
-	}()
-	return addr
+	return grpcOptions
 }
 
 // PingServerTCP is PingServer() assuming TCP instead of possible Unix domain socket port, returns
@@ -16,7 +16,10 @@
 package fgrpc
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"strconv"
 	"testing"
 	"time"
@@ -180,3 +183,64 @@ func TestSettingMetadata(t *testing.T) {
 		}
 	}
 }
+
+func TestPingStreams(t *testing.T) {
+	port := PingServerTCP("0", "", 0, noTLSO)
+	o := GRPCRunnerOptions{Destination: fmt.Sprintf("localhost:%d", port)}
+	conn, err := Dial(&o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	cli := NewPingServerClient(conn)
+	ctx := context.Background()
+	bidi, err := cli.PingStream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range int64(3) {
+		if err = bidi.Send(&PingMessage{Seq: i, Payload: "bidi"}); err != nil {
+			t.Fatal(err)
+		}
+		res, err := bidi.Recv()
+		if err != nil || res.GetSeq() != i || res.GetPayload() != "bidi" {
+			t.Errorf("Unexpected bidi reply %d: %v %v", i, res, err)
+		}
+	}
+	_ = bidi.CloseSend()
+	if _, err = bidi.Recv(); !errors.Is(err, io.EOF) {
+		t.Errorf("Expected EOF at end of bidi stream, got %v", err)
+	}
+	cs, err := cli.PingClientStream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range int64(4) {
+		_ = cs.Send(&PingMessage{Seq: 100 + i, Payload: "client"})
+	}
+	res, err := cs.CloseAndRecv()
+	if err != nil || res.GetSeq() != 4 || res.GetPayload() != "client" {
+		t.Errorf("Unexpected client stream reply: %v %v", res, err)
+	}
+	ss, err := cli.PingServerStream(ctx, &PingMessage{Seq: 10, Count: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := int64(0)
+	for {
+		res, err := ss.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.GetSeq() != 10+n {
+			t.Errorf("Unexpected seq %d for server stream reply %d", res.GetSeq(), n)
+		}
+		n++
+	}
+	if n != 5 {
+		t.Errorf("Expected 5 server stream replies, got %d", n)
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package fgrpc
+
+import (
+	"context"
+
+	"fortio.org/fortio/pkg/metrics"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/grpc/status"
+)
+
+// Server label values of the gRPC servers metrics (and of the fhttp.ServerFaults).
+const (
+	PingServerName = "grpc-ping"
+	MockServerName = "grpc-mock"
+)
+
+var (
+	grpcRequests = metrics.NewCounterVec("fortio_grpc_server_requests_total",
+		"gRPC calls served, by server, method and status code", "server", "method", "code")
+	grpcReceivedBytes = metrics.NewCounterVec("fortio_grpc_server_received_bytes_total",
+		"Bytes (on the wire) of the gRPC messages received", "server")
+	grpcSentBytes = metrics.NewCounterVec("fortio_grpc_server_sent_bytes_total",
+		"Bytes (on the wire) of the gRPC messages sent", "server")
+	grpcConnections = metrics.NewGaugeVec("fortio_grpc_server_connections",
+		"Currently open gRPC connections", "server")
+	grpcLatency = metrics.NewHistogramVec("fortio_grpc_server_request_duration_seconds",
+		"Time spent serving gRPC calls (whole stream for streaming calls)", metrics.DefaultLatencyBuckets,
+		"server", "method")
+)
+
+// serverStats is the stats.Handler recording the gRPC server metrics.
+type serverStats struct {
+	server string
+}
+
+type methodKey struct{}
+
+func (s serverStats) TagRPC(ctx context.Context, info *stats.RPCTagInfo) context.Context {
+	return context.WithValue(ctx, methodKey{}, info.FullMethodName)
+}
+
+func (s serverStats) HandleRPC(ctx context.Context, rs stats.RPCStats) {
+	switch st := rs.(type) {
+	case *stats.InPayload:
+		grpcReceivedBytes.Add(int64(st.WireLength), s.server)
+	case *stats.OutPayload:
+		grpcSentBytes.Add(int64(st.WireLength), s.server)
+	case *stats.End:
+		method, _ := ctx.Value(methodKey{}).(string)
+		grpcRequests.Inc(s.server, method, status.Code(st.Error).String())
+		grpcLatency.Observe(st.EndTime.Sub(st.BeginTime).Seconds(), s.server, method)
+	}
+}
+
+func (s serverStats) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (s serverStats) HandleConn(_ context.Context, cs stats.ConnStats) {
+	switch cs.(type) {
+	case *stats.ConnBegin:
+		grpcConnections.Inc(s.server)
+	case *stats.ConnEnd:
+		grpcConnections.Add(-1, s.server)
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package fgrpc
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"fortio.org/fortio/pkg/fhttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestServerMetrics(t *testing.T) {
+	const method = "/fgrpc.PingServer/Ping"
+	okCalls := grpcRequests.Value(PingServerName, method, "OK")
+	abortedCalls := grpcRequests.Value(PingServerName, method, "Aborted")
+	latencies := grpcLatency.Count(PingServerName, method)
+	received := grpcReceivedBytes.Value(PingServerName)
+	statusFaults := fhttp.ServerFaults.Value(PingServerName, FaultStatus)
+	port := PingServerTCP("0", "metrics", 0, noTLSO)
+	conn, err := grpc.NewClient(fmt.Sprintf("127.0.0.1:%d", port),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	cli := NewPingServerClient(conn)
+	for range 3 {
+		if _, err = cli.Ping(context.Background(), &PingMessage{Payload: "hello"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx := metadata.NewOutgoingContext(context.Background(), metadata.Pairs(FaultStatus, "ABORTED"))
+	if _, err = cli.Ping(ctx, &PingMessage{}); err == nil {
+		t.Fatal("Expected aborted error")
+	}
+	if v := grpcRequests.Value(PingServerName, method, "OK") - okCalls; v != 3 {
+		t.Errorf("Expected 3 OK calls, got %d", v)
+	}
+	if v := grpcRequests.Value(PingServerName, method, "Aborted") - abortedCalls; v != 1 {
+		t.Errorf("Expected 1 aborted call, got %d", v)
+	}
+	if v := grpcLatency.Count(PingServerName, method) - latencies; v != 4 {
+		t.Errorf("Expected 4 latency observations, got %d", v)
+	}
+	if v := grpcReceivedBytes.Value(PingServerName) - received; v < 15 {
+		t.Errorf("Expected at least 15 bytes received, got %d", v)
+	}
+	if v := fhttp.ServerFaults.Value(PingServerName, FaultStatus) - statusFaults; v != 1 {
+		t.Errorf("Expected 1 status fault, got %d", v)
+	}
+	if grpcConnections.Value(PingServerName) < 1 {
+		t.Errorf("Expected at least 1 open connection, got %d", grpcConnections.Value(PingServerName))
+	}
+}
@@ -0,0 +1,295 @@
+// Copyright 2026 Fortio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fhttp
+
+import (
+	"bufio"
+	"crypto/tls"
+	_ "embed"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"fortio.org/dflag"
+	"fortio.org/fortio/internal/jrpc"
+	"fortio.org/fortio/pkg/log"
+)
+
+// CaptureBodyPrefix is how many bytes of the request bodies are kept in the captured requests.
+const CaptureBodyPrefix = 1024
+
+// CapturedTLS is the TLS information of a captured request.
+type CapturedTLS struct {
+	Version     string `json:"version"`
+	CipherSuite string `json:"cipher_suite"`
+	ServerName  string `json:"server_name,omitempty"`
+	ALPN        string `json:"alpn,omitempty"`
+	PeerSubject string `json:"peer_subject,omitempty"`
+}
+
+// CapturedRequest is one of the recent echo requests kept when RequestCapture is on.
+type CapturedRequest struct {
+	ID         int64         `json:"id"`
+	Time       time.Time     `json:"time"`
+	Duration   time.Duration `json:"duration"`
+	RemoteAddr string        `json:"remote_addr"`
+	Method     string        `json:"method"`
+	URL        string        `json:"url"`
+	Proto      string        `json:"proto"`
+	Host       string        `json:"host"`
+	Header     http.Header   `json:"header"`
+	TLS        *CapturedTLS  `json:"tls,omitempty"`
+	// Body is the beginning (up to CaptureBodyPrefix bytes) of what the handler read of the request body.
+	Body     string `json:"body,omitempty"`
+	BodySize int64  `json:"body_size"`
+	// Status is the reply's, 0 if none was written (ie hang or hijacked connection).
+	Status    int   `json:"status"`
+	ReplySize int64 `json:"reply_size"`
+	path      string
+}
+
+// CapturedRequests is the reply of the CaptureHandler.
+type CapturedRequests struct {
+	Capacity int               `json:"capacity"`
+	Total    int64             `json:"total"` // number of requests captured since the start (or last clear).
+	Requests []CapturedRequest `json:"requests"`
+}
+
+// requestRing is the ring buffer of captured requests.
+type requestRing struct {
+	mu      sync.Mutex
+	entries []CapturedRequest
+	total   int64
+}
+
+var (
+	captureRing atomic.Pointer[requestRing]
+	// RequestCapture is the number of recent echo requests kept for the capture endpoints, 0 (default) to disable.
+	RequestCapture = dflag.New(int64(0),
+		"Number of recent echo requests to keep for the debug requests capture endpoints, 0 to disable").
+		WithValidator(dflag.ValidateRange[int64](0, 100000)).WithSyncNotifier(resizeCapture)
+	//go:embed capture.html
+	captureHTML []byte
+)
+
+// resizeCapture is the RequestCapture notifier, it clears the captured requests.
+func resizeCapture(_, n int64) {
+	if n == 0 {
+		captureRing.Store(nil)
+		log.Infof("Echo requests capture disabled")
+		return
+	}
+	captureRing.Store(&requestRing{entries: make([]CapturedRequest, 0, n)})
+	log.Infof("Capturing the last %d echo requests", n)
+}
+
+func (rr *requestRing) add(c *CapturedRequest) {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	rr.total++
+	c.ID = rr.total
+	if len(rr.entries) < cap(rr.entries) {
+		rr.entries = append(rr.entries, *c)
+		return
+	}
+	rr.entries[(rr.total-1)%int64(cap(rr.entries))] = *c
+}
+
+// list returns the captured requests with an ID greater than since, matching the filter, most recent first.
+func (rr *requestRing) list(since int64, match func(*CapturedRequest) bool, limit int) []CapturedRequest {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	res := []CapturedRequest{}
+	n := len(rr.entries)
+	for i := range n {
+		id := rr.total - int64(i)
+		if id <= since || (limit > 0 && len(res) >= limit) {
+			break
+		}
+		c := &rr.entries[(id-1)%int64(cap(rr.entries))]
+		if match(c) {
+			res = append(res, *c)
+		}
+	}
+	return res
+}
+
+// captureBody counts and keeps the beginning (up to keep bytes) of what is read of the request body.
+type captureBody struct {
+	io.ReadCloser
+	keep   int
+	prefix []byte
+	size   int64
+}
+
+func (cb *captureBody) Read(p []byte) (int, error) {
+	n, err := cb.ReadCloser.Read(p)
+	if room := cb.keep - len(cb.prefix); room > 0 {
+		cb.prefix = append(cb.prefix, p[:min(n, room)]...)
+	}
+	cb.size += int64(n)
+	return n, err
+}
+
+// captureWriter records the status and size of the reply.
+type captureWriter struct {
+	http.ResponseWriter
+	status int
+	size   int64
+}
+
+func (cw *captureWriter) WriteHeader(status int) {
+	if cw.status == 0 {
+		cw.status = status
+	}
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+func (cw *captureWriter) Write(p []byte) (int, error) {
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+	n, err := cw.ResponseWriter.Write(p)
+	cw.size += int64(n)
+	return n, err
+}
+
+func (cw *captureWriter) Flush() {
+	Flush(cw.ResponseWriter)
+}
+
+// Hijack is for the websocket echo (which checks for http.Hijacker).
+func (cw *captureWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(cw.ResponseWriter).Hijack()
+}
+
+// Unwrap is for http.ResponseController (ie to hijack the connection for the reset fault).
+func (cw *captureWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// capturedTLS returns the TLS information of the request, nil if not TLS.
+func capturedTLS(cs *tls.ConnectionState) *CapturedTLS {
+	if cs == nil {
+		return nil
+	}
+	res := &CapturedTLS{
+		Version:     tls.VersionName(cs.Version),
+		CipherSuite: tls.CipherSuiteName(cs.CipherSuite),
+		ServerName:  cs.ServerName,
+		ALPN:        cs.NegotiatedProtocol,
+	}
+	if len(cs.PeerCertificates) > 0 {
+		res.PeerSubject = cs.PeerCertificates[0].Subject.String()
+	}
+	return res
+}
+
+// captureRequest calls the handler and, when RequestCapture is on, records the request.
+func captureRequest(w http.ResponseWriter, r *http.Request, handler http.HandlerFunc) {
+	rr := captureRing.Load()
+	if rr == nil {
+		handler(w, r)
+		return
+	}
+	c := &CapturedRequest{
+		Time:       time.Now(),
+		RemoteAddr: r.RemoteAddr,
+		Method:     r.Method,
+		URL:        r.URL.String(),
+		Proto:      r.Proto,
+		Host:       r.Host,
+		Header:     r.Header.Clone(),
+		TLS:        capturedTLS(r.TLS),
+		path:       r.URL.Path,
+	}
+	cb := &captureBody{ReadCloser: r.Body, keep: CaptureBodyPrefix}
+	r.Body = cb
+	cw := &captureWriter{ResponseWriter: w}
+	defer func() {
+		// Also recorded when the handler aborts (ie reset faults).
+		c.Duration = time.Since(c.Time)
+		c.Body = string(cb.prefix)
+		c.BodySize = cb.size
+		c.Status = cw.status
+		c.ReplySize = cw.size
+		rr.add(c)
+	}()
+	handler(cw, r)
+}
+
+// captureFilter returns the filter for the path (substring) and header ("Name" for present or
+// "Name:value" for containing value) query args.
+func captureFilter(r *http.Request) func(*CapturedRequest) bool {
+	path := QueryArg(r, "path")
+	hName, hValue, hasValue := strings.Cut(QueryArg(r, "header"), ":")
+	hName = strings.TrimSpace(hName)
+	hValue = strings.TrimSpace(hValue)
+	return func(c *CapturedRequest) bool {
+		if path != "" && !strings.Contains(c.path, path) {
+			return false
+		}
+		if hName == "" {
+			return true
+		}
+		values := c.Header.Values(hName)
+		if !hasValue {
+			return len(values) > 0
+		}
+		for _, v := range values {
+			if strings.Contains(v, hValue) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// CaptureHandler returns the captured echo requests as JSON, most recent first, optionally filtered
+// by path and header, only the ones after the since id and at most limit of them. DELETE clears them.
+func CaptureHandler(w http.ResponseWriter, r *http.Request) {
+	res := CapturedRequests{Requests: []CapturedRequest{}}
+	if r.Method == http.MethodDelete {
+		resizeCapture(0, RequestCapture.Get())
+	}
+	if rr := captureRing.Load(); rr != nil {
+		since, _ := strconv.ParseInt(QueryArg(r, "since"), 10, 64)
+		limit, _ := strconv.Atoi(QueryArg(r, "limit"))
+		res.Requests = rr.list(since, captureFilter(r), limit)
+		res.Capacity = cap(rr.entries)
+		rr.mu.Lock()
+		res.Total = rr.total
+		rr.mu.Unlock()
+	}
+	_ = jrpc.ReplyOk(w, &res)
+}
+
+// CaptureLiveHandler serves the live HTML view of the captured requests (polling the CaptureHandler).
+func CaptureLiveHandler(w http.ResponseWriter, r *http.Request) {
+	log.LogRequest(r, "capture live view")
+	w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+	_, _ = w.Write(captureHTML)
+}
+
+// CapturePath returns the captured requests endpoint path behind debugPath (ie /debug -> /debug/requests),
+// the live HTML view is under it at /live.
+func CapturePath(debugPath string) string {
+	return strings.TrimSuffix(debugPath, "/") + "/requests"
+}
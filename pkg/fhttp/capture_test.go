@@ -0,0 +1,122 @@
+// Copyright 2026 Fortio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fhttp
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRequestRing(t *testing.T) {
+	rr := &requestRing{entries: make([]CapturedRequest, 0, 3)}
+	for i := range 5 {
+		rr.add(&CapturedRequest{path: fmt.Sprintf("/p%d", i+1)})
+	}
+	all := func(*CapturedRequest) bool { return true }
+	res := rr.list(0, all, 0)
+	if len(res) != 3 || res[0].ID != 5 || res[0].path != "/p5" || res[2].ID != 3 || res[2].path != "/p3" {
+		t.Errorf("Unexpected ring content %+v", res)
+	}
+	if res = rr.list(4, all, 0); len(res) != 1 || res[0].ID != 5 {
+		t.Errorf("Unexpected since result %+v", res)
+	}
+	if res = rr.list(0, all, 2); len(res) != 2 || res[1].ID != 4 {
+		t.Errorf("Unexpected limit result %+v", res)
+	}
+	if res = rr.list(0, func(c *CapturedRequest) bool { return c.path == "/p4" }, 0); len(res) != 1 || res[0].ID != 4 {
+		t.Errorf("Unexpected filtered result %+v", res)
+	}
+}
+
+func TestRequestCapture(t *testing.T) {
+	mux, addr := ServeTCP("0", "/debug")
+	if mux == nil {
+		t.Fatal("Unable to start server")
+	}
+	base := fmt.Sprintf("http://localhost:%d", addr.Port)
+	do := func(method, path, body string, hdr ...string) (int, string) {
+		req, _ := http.NewRequest(method, base+path, strings.NewReader(body))
+		for i := 0; i < len(hdr); i += 2 {
+			req.Header.Set(hdr[i], hdr[i+1])
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(data)
+	}
+	list := func(query string) CapturedRequests {
+		var res CapturedRequests
+		_, body := do(http.MethodGet, "/debug/requests"+query, "")
+		if err := json.Unmarshal([]byte(body), &res); err != nil {
+			t.Fatalf("Invalid captured requests %q: %v", body, err)
+		}
+		return res
+	}
+	// Off by default.
+	do(http.MethodGet, "/not-captured", "")
+	if res := list(""); res.Capacity != 0 || len(res.Requests) != 0 {
+		t.Errorf("Expected no capture by default, got %+v", res)
+	}
+	if err := RequestCapture.Set("2"); err != nil {
+		t.Fatal(err)
+	}
+	defer RequestCapture.Set("0")
+	do(http.MethodPost, "/a?status=201", "hello", "X-Test", "one")
+	do(http.MethodGet, "/b?size=10", "", "X-Test", "two")
+	do(http.MethodPut, "/c/d", strings.Repeat("x", 2*CaptureBodyPrefix))
+	res := list("")
+	if res.Capacity != 2 || res.Total != 3 || len(res.Requests) != 2 {
+		t.Fatalf("Unexpected captured requests %+v", res)
+	}
+	c := res.Requests[0]
+	if c.ID != 3 || c.Method != http.MethodPut || c.URL != "/c/d" || c.BodySize != 2*CaptureBodyPrefix ||
+		len(c.Body) != CaptureBodyPrefix || c.Status != http.StatusOK || c.ReplySize != 2*CaptureBodyPrefix {
+		t.Errorf("Unexpected last captured request %+v", c)
+	}
+	c = res.Requests[1]
+	if c.ID != 2 || c.Header.Get("X-Test") != "two" || c.ReplySize != 10 || c.RemoteAddr == "" || c.TLS != nil {
+		t.Errorf("Unexpected captured request %+v", c)
+	}
+	if res = list("?header=X-Test"); len(res.Requests) != 1 || res.Requests[0].ID != 2 {
+		t.Errorf("Unexpected header filtered requests %+v", res.Requests)
+	}
+	if res = list("?header=X-Test:nope"); len(res.Requests) != 0 {
+		t.Errorf("Unexpected header value filtered requests %+v", res.Requests)
+	}
+	if res = list("?path=/c/"); len(res.Requests) != 1 || res.Requests[0].ID != 3 {
+		t.Errorf("Unexpected path filtered requests %+v", res.Requests)
+	}
+	if res = list("?since=2"); len(res.Requests) != 1 || res.Requests[0].ID != 3 {
+		t.Errorf("Unexpected since requests %+v", res.Requests)
+	}
+	code, body := do(http.MethodGet, "/debug/requests/live", "")
+	if code != http.StatusOK || !strings.Contains(body, "captured echo requests") {
+		t.Errorf("Unexpected live view %d %q", code, body)
+	}
+	do(http.MethodDelete, "/debug/requests", "")
+	if res = list(""); res.Capacity != 2 || res.Total != 0 || len(res.Requests) != 0 {
+		t.Errorf("Expected cleared capture, got %+v", res)
+	}
+	if err := RequestCapture.Set("-1"); err == nil {
+		t.Errorf("Expected error for negative capture size")
+	}
+}
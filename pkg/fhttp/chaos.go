@@ -0,0 +1,306 @@
+// Copyright 2026 Fortio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fhttp
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"fortio.org/dflag"
+	"fortio.org/fortio/internal/jrpc"
+	"fortio.org/fortio/pkg/log"
+)
+
+// ChaosLoop as the last element of a schedule restarts it from the first phase once done.
+const ChaosLoop = "loop"
+
+// ChaosPhase is one phase of a ChaosSchedule: for its Duration the server behaves as if the requests
+// had the Params (unless they set the same ones).
+type ChaosPhase struct {
+	Duration time.Duration `json:"duration"`
+	Params   string        `json:"params,omitempty"`
+	params   url.Values
+}
+
+// ChaosSchedule changes the behavior of a server over time, through phases of (fault) parameters.
+type ChaosSchedule struct {
+	name      string
+	mu        sync.Mutex
+	spec      string
+	phases    []ChaosPhase
+	loop      bool
+	start     time.Time
+	lastPhase int
+	active    atomic.Bool // fast path for the (common) no schedule case.
+}
+
+// ChaosStatus is the current state of a ChaosSchedule, Phase is 0 when not running or after the
+// last phase, the 1 based index of the current phase otherwise.
+type ChaosStatus struct {
+	Name      string        `json:"name"`
+	Schedule  string        `json:"schedule"`
+	Running   bool          `json:"running"`
+	Phase     int           `json:"phase"`
+	Params    string        `json:"params,omitempty"`
+	Elapsed   time.Duration `json:"elapsed"`
+	Remaining time.Duration `json:"remaining"` // in the current phase.
+	Loop      bool          `json:"loop,omitempty"`
+	Phases    []ChaosPhase  `json:"phases,omitempty"`
+}
+
+var (
+	chaosSchedulesMu sync.Mutex
+	chaosSchedules   []*ChaosSchedule
+	// EchoChaos is the echo server's schedule, its Params are added to the echo requests.
+	EchoChaos = NewChaosSchedule("echo")
+	// EchoChaosSchedule starts the EchoChaos schedule when set.
+	EchoChaosSchedule = EchoChaos.Flag("echo server")
+)
+
+// NewChaosSchedule returns a new (not running) named schedule, listed by ChaosSchedules.
+func NewChaosSchedule(name string) *ChaosSchedule {
+	c := &ChaosSchedule{name: name}
+	chaosSchedulesMu.Lock()
+	chaosSchedules = append(chaosSchedules, c)
+	chaosSchedulesMu.Unlock()
+	return c
+}
+
+// ChaosSchedules returns all the schedules.
+func ChaosSchedules() []*ChaosSchedule {
+	chaosSchedulesMu.Lock()
+	defer chaosSchedulesMu.Unlock()
+	return slices.Clone(chaosSchedules)
+}
+
+// Flag returns a dynamic flag (to register) that starts the schedule when set, empty to stop it.
+func (c *ChaosSchedule) Flag(what string) *dflag.DynValue[string] {
+	return dflag.New("", "Chaos schedule of the "+what+": `phases` separated by ; of duration?params, ie "+
+		"\"60s;30s?status=503:30;30s?delay=2s\" and optionally a last \"loop\" element to repeat it").
+		WithValidator(validateChaosSchedule).WithSyncNotifier(c.changed)
+}
+
+// validateChaosSchedule is the validator of the schedules flags.
+func validateChaosSchedule(spec string) error {
+	_, _, err := ParseChaosSchedule(spec)
+	return err
+}
+
+// changed is the notifier of the schedule's flag.
+func (c *ChaosSchedule) changed(_, spec string) {
+	_ = c.Start(spec)
+}
+
+// Name returns the name of the schedule.
+func (c *ChaosSchedule) Name() string {
+	return c.name
+}
+
+// ParseChaosSchedule parses "60s;30s?status=503:30;30s?delay=2s;loop": phases of duration and optional
+// parameters (query string syntax, without ? for a normal phase) and an optional last "loop".
+func ParseChaosSchedule(spec string) ([]ChaosPhase, bool, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, false, nil
+	}
+	elements := strings.Split(spec, ";")
+	loop := strings.TrimSpace(elements[len(elements)-1]) == ChaosLoop
+	if loop {
+		elements = elements[:len(elements)-1]
+	}
+	phases := make([]ChaosPhase, 0, len(elements))
+	var total time.Duration
+	for _, e := range elements {
+		dStr, params, _ := strings.Cut(strings.TrimSpace(e), "?")
+		d, err := time.ParseDuration(dStr)
+		if err != nil {
+			return nil, false, fmt.Errorf("invalid chaos phase %q: %w", e, err)
+		}
+		if d <= 0 {
+			return nil, false, fmt.Errorf("chaos phase %q duration should be positive", e)
+		}
+		p, err := url.ParseQuery(params)
+		if err != nil {
+			return nil, false, fmt.Errorf("invalid chaos phase %q params: %w", e, err)
+		}
+		total += d
+		phases = append(phases, ChaosPhase{Duration: d, Params: params, params: p})
+	}
+	if len(phases) == 0 {
+		return nil, false, errors.New("chaos schedule without phases")
+	}
+	log.Debugf("Parsed chaos schedule %q: %d phases for %v, loop %t", spec, len(phases), total, loop)
+	return phases, loop, nil
+}
+
+// Start (re)starts the schedule, an empty spec stops it.
+func (c *ChaosSchedule) Start(spec string) error {
+	phases, loop, err := ParseChaosSchedule(spec)
+	if err != nil {
+		log.Errf("Not starting %s chaos schedule: %v", c.name, err)
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.spec = strings.TrimSpace(spec)
+	c.phases = phases
+	c.loop = loop
+	c.start = time.Now()
+	c.lastPhase = 0
+	c.active.Store(len(phases) > 0)
+	if len(phases) == 0 {
+		log.Infof("Stopped %s chaos schedule", c.name)
+	} else {
+		log.Infof("Started %s chaos schedule of %d phases: %s", c.name, len(phases), c.spec)
+	}
+	return nil
+}
+
+// Restart restarts the current schedule from its first phase.
+func (c *ChaosSchedule) Restart() error {
+	c.mu.Lock()
+	spec := c.spec
+	c.mu.Unlock()
+	return c.Start(spec)
+}
+
+// current returns the 1 based index of the current phase (0 for none) and the time remaining in it.
+// Must be called with the lock held.
+func (c *ChaosSchedule) current(now time.Time) (int, time.Duration) {
+	if len(c.phases) == 0 {
+		return 0, 0
+	}
+	elapsed := now.Sub(c.start)
+	if c.loop {
+		var total time.Duration
+		for _, p := range c.phases {
+			total += p.Duration
+		}
+		elapsed %= total
+	}
+	for i, p := range c.phases {
+		if elapsed < p.Duration {
+			return i + 1, p.Duration - elapsed
+		}
+		elapsed -= p.Duration
+	}
+	return 0, 0
+}
+
+// Params returns the parameters of the current phase, nil if none.
+func (c *ChaosSchedule) Params() url.Values {
+	if !c.active.Load() {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	phase, _ := c.current(time.Now())
+	if phase != c.lastPhase {
+		c.lastPhase = phase
+		if phase == 0 {
+			log.Infof("Chaos %s schedule done, back to normal", c.name)
+			c.active.Store(false)
+		} else {
+			log.Infof("Chaos %s entering phase %d/%d for %v: %q", c.name, phase, len(c.phases),
+				c.phases[phase-1].Duration, c.phases[phase-1].Params)
+		}
+	}
+	if phase == 0 {
+		return nil
+	}
+	return c.phases[phase-1].params
+}
+
+// Status returns the current state of the schedule.
+func (c *ChaosSchedule) Status() ChaosStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	res := ChaosStatus{Name: c.name, Schedule: c.spec, Loop: c.loop, Phases: c.phases}
+	res.Phase, res.Remaining = c.current(now)
+	res.Running = res.Phase > 0
+	if res.Running {
+		res.Params = c.phases[res.Phase-1].Params
+		res.Elapsed = now.Sub(c.start)
+	}
+	return res
+}
+
+// String is the one line summary of the status (for the debug handler).
+func (s ChaosStatus) String() string {
+	if !s.Running {
+		return fmt.Sprintf("chaos %s: not running", s.Name)
+	}
+	return fmt.Sprintf("chaos %s: phase %d/%d %q for %v more", s.Name, s.Phase, len(s.Phases), s.Params,
+		RoundDuration(s.Remaining))
+}
+
+// WithChaosParams returns the params with the ones of the current phase not already set (none if nil).
+func WithChaosParams(c *ChaosSchedule, params url.Values) url.Values {
+	chaos := c.Params()
+	if len(chaos) == 0 {
+		return params
+	}
+	res := maps.Clone(chaos)
+	maps.Copy(res, params)
+	return res
+}
+
+// ChaosHandler returns the status of all the schedules as JSON (GET), starts one (POST with target and
+// schedule args, restarts it without schedule) or stops it (DELETE with target arg).
+func ChaosHandler(w http.ResponseWriter, r *http.Request) {
+	log.LogRequest(r, "chaos")
+	if r.Method == http.MethodPost || r.Method == http.MethodDelete {
+		target := QueryArg(r, "target")
+		schedules := ChaosSchedules()
+		idx := slices.IndexFunc(schedules, func(c *ChaosSchedule) bool { return c.name == target })
+		if idx < 0 {
+			_ = jrpc.ReplyError(w, "unknown chaos target "+target, nil)
+			return
+		}
+		c := schedules[idx]
+		var err error
+		switch {
+		case r.Method == http.MethodDelete:
+			err = c.Start("")
+		case QueryArg(r, "schedule") != "":
+			err = c.Start(QueryArg(r, "schedule"))
+		default:
+			err = c.Restart()
+		}
+		if err != nil {
+			_ = jrpc.ReplyError(w, "chaos schedule", err)
+			return
+		}
+	}
+	res := []ChaosStatus{}
+	for _, c := range ChaosSchedules() {
+		res = append(res, c.Status())
+	}
+	_ = jrpc.ReplyOk(w, &res)
+}
+
+// ChaosPath returns the chaos endpoint path behind debugPath (ie /debug -> /debug/chaos).
+func ChaosPath(debugPath string) string {
+	return strings.TrimSuffix(debugPath, "/") + "/chaos"
+}
@@ -0,0 +1,149 @@
+// Copyright 2026 Fortio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fhttp
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseChaosSchedule(t *testing.T) {
+	phases, loop, err := ParseChaosSchedule(" 60s; 30s?status=503:30&delay=10ms ;1m?delay=2s;loop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !loop || len(phases) != 3 || phases[0].Duration != time.Minute || phases[0].Params != "" ||
+		phases[1].params.Get("status") != "503:30" || phases[1].params.Get("delay") != "10ms" ||
+		phases[2].Duration != time.Minute || phases[2].Params != "delay=2s" {
+		t.Errorf("Unexpected parsed schedule %+v %v", phases, loop)
+	}
+	if phases, loop, err = ParseChaosSchedule(""); err != nil || phases != nil || loop {
+		t.Errorf("Empty schedule should parse to nothing: %v %v %v", phases, loop, err)
+	}
+	for _, bad := range []string{"loop", "nope?status=503", "0s", "-1s?status=503", "1s?status=%zz", "1s;;loop"} {
+		if _, _, err = ParseChaosSchedule(bad); err == nil {
+			t.Errorf("Expected error for %q", bad)
+		}
+	}
+}
+
+func TestChaosSchedulePhases(t *testing.T) {
+	c := &ChaosSchedule{name: "test"}
+	if c.Params() != nil || c.Status().Running {
+		t.Errorf("Expected no params nor running without schedule")
+	}
+	if err := c.Start("1s?a=1;2s?b=2;loop"); err != nil {
+		t.Fatal(err)
+	}
+	c.start = time.Now().Add(-1500 * time.Millisecond) // half way in the second phase
+	if p := c.Params(); p.Get("b") != "2" {
+		t.Errorf("Expected second phase, got %v", p)
+	}
+	st := c.Status()
+	if !st.Running || st.Phase != 2 || st.Params != "b=2" || st.Remaining > 1500*time.Millisecond {
+		t.Errorf("Unexpected status %+v", st)
+	}
+	c.start = time.Now().Add(-3500 * time.Millisecond) // looped back to the first phase
+	if p := c.Params(); p.Get("a") != "1" {
+		t.Errorf("Expected looping back to the first phase, got %v", p)
+	}
+	if err := c.Start("1s?a=1"); err != nil {
+		t.Fatal(err)
+	}
+	c.start = time.Now().Add(-2 * time.Second) // done
+	if p := c.Params(); p != nil || c.Status().Running || c.Status().Phase != 0 {
+		t.Errorf("Expected done schedule, got %v %+v", p, c.Status())
+	}
+	if err := c.Start("bad"); err == nil {
+		t.Errorf("Expected error starting a bad schedule")
+	}
+	if w := WithChaosParams(c, url.Values{"x": {"y"}}); len(w) != 1 || w.Get("x") != "y" {
+		t.Errorf("Unexpected params without chaos %v", w)
+	}
+}
+
+func TestEchoChaos(t *testing.T) {
+	mux, addr := ServeTCP("0", "/debug")
+	if mux == nil {
+		t.Fatal("Unable to start server")
+	}
+	base := fmt.Sprintf("http://localhost:%d", addr.Port)
+	do := func(method, path string) (int, string) {
+		req, _ := http.NewRequest(method, base+path, nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(data)
+	}
+	if err := EchoChaosSchedule.Set("200ms?status=503;10s?status=429"); err != nil {
+		t.Fatal(err)
+	}
+	defer EchoChaosSchedule.Set("")
+	if code, _ := do(http.MethodGet, "/foo"); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected first phase 503, got %d", code)
+	}
+	if code, _ := do(http.MethodGet, "/foo?status=202"); code != http.StatusAccepted {
+		t.Errorf("Expected request args to take precedence, got %d", code)
+	}
+	if _, body := do(http.MethodGet, "/debug"); !strings.Contains(body, `chaos echo: phase 1/2 "status=503"`) {
+		t.Errorf("Expected chaos phase in debug output, got %s", body)
+	}
+	time.Sleep(250 * time.Millisecond)
+	if code, _ := do(http.MethodGet, "/foo"); code != http.StatusTooManyRequests {
+		t.Errorf("Expected second phase 429, got %d", code)
+	}
+	var status []ChaosStatus
+	code, body := do(http.MethodGet, "/debug/chaos")
+	if err := json.Unmarshal([]byte(body), &status); err != nil || code != http.StatusOK {
+		t.Fatalf("Invalid chaos status %d %q: %v", code, body, err)
+	}
+	if len(status) == 0 || status[0].Name != "echo" || status[0].Phase != 2 || len(status[0].Phases) != 2 {
+		t.Errorf("Unexpected chaos status %+v", status)
+	}
+	// Restart through the REST api.
+	if code, _ = do(http.MethodPost, "/debug/chaos?target=echo"); code != http.StatusOK {
+		t.Errorf("Unexpected restart reply %d", code)
+	}
+	if code, _ = do(http.MethodGet, "/foo"); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected first phase 503 after restart, got %d", code)
+	}
+	if code, _ = do(http.MethodPost, "/debug/chaos?target=echo&schedule="+url.QueryEscape("1m?status=418")); code != http.StatusOK {
+		t.Errorf("Unexpected start reply %d", code)
+	}
+	if code, _ = do(http.MethodGet, "/foo"); code != http.StatusTeapot {
+		t.Errorf("Expected new schedule 418, got %d", code)
+	}
+	if code, _ = do(http.MethodPost, "/debug/chaos?target=echo&schedule=bad"); code != http.StatusBadRequest {
+		t.Errorf("Expected bad schedule error, got %d", code)
+	}
+	if code, _ = do(http.MethodDelete, "/debug/chaos?target=nope"); code != http.StatusBadRequest {
+		t.Errorf("Expected unknown target error, got %d", code)
+	}
+	if code, _ = do(http.MethodDelete, "/debug/chaos?target=echo"); code != http.StatusOK {
+		t.Errorf("Unexpected stop reply %d", code)
+	}
+	if code, _ = do(http.MethodGet, "/foo"); code != http.StatusOK {
+		t.Errorf("Expected 200 once stopped, got %d", code)
+	}
+}
@@ -0,0 +1,319 @@
+// Copyright 2026 Fortio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fhttp
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"fortio.org/fortio/pkg/log"
+	"golang.org/x/net/http2"
+)
+
+// H2ConnStats are the per connection stats of the fast client in h2/h2c mode.
+type H2ConnStats struct {
+	Streams   int64 // number of streams (requests) sent on that connection
+	MaxActive int64 // maximum number of concurrently active streams observed
+	Connects  int64 // number of times the connection was (re)established
+	GoAway    int64 // number of GOAWAY frames received
+	RstStream int64 // number of RST_STREAM frames received
+}
+
+// h2ConnPool holds the connections shared by the threads of a run: each connection
+// is used by up to maxStreams threads concurrently (one stream each).
+type h2ConnPool struct {
+	maxStreams int
+	conns      []*h2Conn
+	tr         *http2.Transport
+}
+
+func newH2ConnPool(o *HTTPOptions, numThreads int) *h2ConnPool {
+	maxStreams := max(o.H2MaxStreams, 1)
+	numConns := max((numThreads+maxStreams-1)/maxStreams, 1)
+	p := &h2ConnPool{
+		maxStreams: maxStreams,
+		conns:      make([]*h2Conn, numConns),
+		tr: &http2.Transport{
+			AllowHTTP:          true,
+			DisableCompression: !o.Compression,
+		},
+	}
+	for i := range p.conns {
+		p.conns[i] = &h2Conn{id: i}
+	}
+	log.S(log.Info, "h2 fast client connections", log.Attr("connections", numConns), log.Attr("streams_per_conn", maxStreams),
+		log.Attr("run", o.UniqueID))
+	return p
+}
+
+// forThread returns the connection slot to use for the given thread id.
+func (p *h2ConnPool) forThread(id int) *h2Conn {
+	return p.conns[min(id/p.maxStreams, len(p.conns)-1)]
+}
+
+// Stats returns a snapshot of the per connection stats.
+func (p *h2ConnPool) Stats() []H2ConnStats {
+	res := make([]H2ConnStats, len(p.conns))
+	for i, c := range p.conns {
+		res[i] = c.Stats()
+	}
+	return res
+}
+
+// Close closes all the underlying connections.
+func (p *h2ConnPool) Close() {
+	for _, c := range p.conns {
+		c.close()
+	}
+}
+
+// h2Conn is one (re)connectable h2 connection slot.
+type h2Conn struct {
+	id        int
+	mu        sync.Mutex
+	cc        *http2.ClientConn
+	active    atomic.Int64
+	streams   atomic.Int64
+	maxActive atomic.Int64
+	connects  atomic.Int64
+	goAway    atomic.Int64
+	rstStream atomic.Int64
+}
+
+func (c *h2Conn) Stats() H2ConnStats {
+	return H2ConnStats{
+		Streams:   c.streams.Load(),
+		MaxActive: c.maxActive.Load(),
+		Connects:  c.connects.Load(),
+		GoAway:    c.goAway.Load(),
+		RstStream: c.rstStream.Load(),
+	}
+}
+
+func (c *h2Conn) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cc != nil {
+		_ = c.cc.Close()
+		c.cc = nil
+	}
+}
+
+// get returns a client conn able to take a new stream, (re)connecting using the
+// transport's dialer when needed (first use, after GOAWAY or a broken connection).
+func (c *h2Conn) get(ctx context.Context, t *h2StreamTransport, req *http.Request) (*http2.ClientConn, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cc != nil && c.cc.CanTakeNewRequest() {
+		return c.cc, nil
+	}
+	if old := c.cc; old != nil {
+		log.S(log.Info, "h2 connection can't take new streams, reconnecting", log.Attr("conn", c.id),
+			log.Attr("thread", t.client.id), log.Attr("run", t.client.runID))
+		// Let in flight streams finish.
+		go func() { _ = old.Shutdown(context.Background()) }()
+		c.cc = nil
+	}
+	conn, err := t.dial(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	cc, err := t.pool.tr.NewClientConn(&h2FrameCounter{Conn: conn, goAway: &c.goAway, rstStream: &c.rstStream})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	c.connects.Add(1)
+	c.cc = cc
+	return cc, nil
+}
+
+func (c *h2Conn) streamStart() {
+	active := c.active.Add(1)
+	c.streams.Add(1)
+	for {
+		m := c.maxActive.Load()
+		if active <= m || c.maxActive.CompareAndSwap(m, active) {
+			return
+		}
+	}
+}
+
+func (c *h2Conn) streamDone() {
+	c.active.Add(-1)
+}
+
+// h2StreamTransport is the http.RoundTripper of the fast client h2 mode: one stream on
+// the (shared) connection slot assigned to the thread.
+type h2StreamTransport struct {
+	client *Client
+	pool   *h2ConnPool
+	conn   *h2Conn
+	https  bool
+	tls    *tls.Config
+	owned  bool // pool is private to this client (single client use, ie curl mode) and closed with it.
+}
+
+func (t *h2StreamTransport) dial(ctx context.Context, req *http.Request) (net.Conn, error) {
+	port := req.URL.Port()
+	if port == "" {
+		port = "80"
+		if t.https {
+			port = "443"
+		}
+	}
+	conn, err := t.client.dialer(ctx, "tcp", net.JoinHostPort(req.URL.Hostname(), port))
+	if err != nil {
+		return nil, err
+	}
+	if !t.https {
+		return conn, nil
+	}
+	cfg := t.tls.Clone()
+	if cfg.ServerName == "" {
+		cfg.ServerName = req.URL.Hostname()
+	}
+	cfg.NextProtos = []string{http2.NextProtoTLS}
+	tlsConn, err := t.client.tlsHandshake(ctx, conn, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if p := tlsConn.ConnectionState().NegotiatedProtocol; p != http2.NextProtoTLS {
+		tlsConn.Close()
+		return nil, fmt.Errorf("server did not negotiate h2 (got %q)", p)
+	}
+	return tlsConn, nil
+}
+
+func (t *h2StreamTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	cc, err := t.conn.get(req.Context(), t, req)
+	if err != nil {
+		return nil, err
+	}
+	t.conn.streamStart()
+	resp, err := cc.RoundTrip(req)
+	if err != nil {
+		t.conn.streamDone()
+		return nil, err
+	}
+	resp.Body = &h2Body{ReadCloser: resp.Body, conn: t.conn}
+	return resp, nil
+}
+
+// CloseIdleConnections only closes the connections of a private pool, shared ones are
+// closed at the end of the run.
+func (t *h2StreamTransport) CloseIdleConnections() {
+	if t.owned {
+		t.pool.Close()
+	}
+}
+
+// h2Body marks the end of the stream for the active streams stats.
+type h2Body struct {
+	io.ReadCloser
+	conn *h2Conn
+	done bool
+}
+
+func (b *h2Body) Close() error {
+	if !b.done {
+		b.done = true
+		b.conn.streamDone()
+	}
+	return b.ReadCloser.Close()
+}
+
+// h2FrameCounter tracks the frame headers read from the server to count
+// GOAWAY and RST_STREAM frames. Only called from the single reader goroutine of the ClientConn.
+type h2FrameCounter struct {
+	net.Conn
+	hdr       [9]byte
+	hdrLen    int
+	skip      int
+	goAway    *atomic.Int64
+	rstStream *atomic.Int64
+}
+
+func (f *h2FrameCounter) Read(p []byte) (int, error) {
+	n, err := f.Conn.Read(p)
+	f.scan(p[:n])
+	return n, err
+}
+
+func (f *h2FrameCounter) scan(b []byte) {
+	for len(b) > 0 {
+		if f.skip > 0 {
+			s := min(len(b), f.skip)
+			f.skip -= s
+			b = b[s:]
+			continue
+		}
+		c := copy(f.hdr[f.hdrLen:], b)
+		f.hdrLen += c
+		b = b[c:]
+		if f.hdrLen < len(f.hdr) {
+			return
+		}
+		f.hdrLen = 0
+		f.skip = int(f.hdr[0])<<16 | int(f.hdr[1])<<8 | int(f.hdr[2])
+		switch http2.FrameType(f.hdr[3]) { //nolint:exhaustive // only counting these 2.
+		case http2.FrameGoAway:
+			f.goAway.Add(1)
+		case http2.FrameRSTStream:
+			f.rstStream.Add(1)
+		}
+	}
+}
+
+// newH2Client creates the fast client h2/h2c variant: stream pooling on the std client's request path,
+// the requests go straight to our own connection management, without the http.Client (no redirects,
+// like the fast client), so we can control how many streams share a connection and get per connection
+// stats. It isn't significantly cheaper than the std client's h2 (see BenchmarkH2Client).
+func newH2Client(o *HTTPOptions) (Fetcher, error) {
+	client, err := NewStdClient(o)
+	if err != nil {
+		return nil, err
+	}
+	t := &h2StreamTransport{client: client, pool: o.h2pool, https: o.https}
+	if t.pool == nil {
+		t.pool = newH2ConnPool(o, 1)
+		t.owned = true
+	}
+	t.conn = t.pool.forThread(o.ID)
+	if o.https {
+		if t.tls, err = o.TLSOptions.TLSConfig(); err != nil {
+			return nil, err
+		}
+	}
+	if o.DisableKeepAlive {
+		log.Warnf("Keepalive disabling is ignored in h2 fast client mode")
+	}
+	if o.FollowRedirects {
+		log.Warnf("Following redirects is ignored in h2 fast client mode")
+	}
+	client.transport = t
+	var rt http.RoundTripper = t
+	if o.Transport != nil {
+		rt = o.Transport(rt)
+	}
+	client.roundTripper = rt
+	return client, nil
+}
@@ -0,0 +1,187 @@
+// Copyright 2026 Fortio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fhttp
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"fortio.org/fortio/pkg/fnet"
+	"fortio.org/fortio/pkg/log"
+	"fortio.org/fortio/pkg/stats"
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// H3Stats are the QUIC level stats of the HTTP/3 (h3) client mode.
+type H3Stats struct {
+	Connections int64  // number of QUIC connections established
+	Used0RTT    int64  // number of connections that used 0-RTT resumption
+	PacketsSent uint64 // QUIC packets sent, including retransmissions
+	PacketsLost uint64 // QUIC packets declared lost by the loss recovery (and thus retransmitted)
+	BytesLost   uint64
+	// Time from the initial packet to the handshake completion.
+	HandshakeTime *stats.HistogramData
+}
+
+// h3ClientStats is the per client (thread) state behind H3Stats.
+type h3ClientStats struct {
+	mu        sync.Mutex
+	conns     []*quic.Conn
+	used0RTT  int64
+	handshake *stats.Histogram
+}
+
+func (h *h3ClientStats) record(conn *quic.Conn, start time.Time) {
+	select {
+	case <-conn.HandshakeComplete():
+	case <-conn.Context().Done():
+		return
+	}
+	h.mu.Lock()
+	h.handshake.Record(time.Since(start).Seconds())
+	if conn.ConnectionState().Used0RTT {
+		h.used0RTT++
+	}
+	h.mu.Unlock()
+}
+
+// addTo aggregates this client's stats into the total (and handshake histogram).
+func (h *h3ClientStats) addTo(total *H3Stats, handshake *stats.Histogram) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	total.Connections += int64(len(h.conns))
+	total.Used0RTT += h.used0RTT
+	for _, c := range h.conns {
+		cs := c.ConnectionStats()
+		total.PacketsSent += cs.PacketsSent
+		total.PacketsLost += cs.PacketsLost
+		total.BytesLost += cs.BytesLost
+	}
+	handshake.Transfer(h.handshake)
+}
+
+// h3Transport closes the QUIC connections (and UDP socket) on CloseIdleConnections()
+// which is only called by Client.Close().
+type h3Transport struct {
+	*http3.Transport
+}
+
+func (t h3Transport) CloseIdleConnections() {
+	_ = t.Close()
+}
+
+// newH3Client creates an HTTP/3 (QUIC) client: the std client request handling on top of
+// quic-go's http3 transport.
+func newH3Client(o *HTTPOptions) (Fetcher, error) {
+	if !o.https {
+		return nil, fmt.Errorf("h3 requires an https:// url, got %q", o.URL)
+	}
+	client, err := NewStdClient(o)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig, err := o.TLSOptions.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	// Session cache so reconnections can use 0-RTT.
+	tlsConfig.ClientSessionCache = tls.NewLRUClientSessionCache(8)
+	h3s := &h3ClientStats{handshake: stats.NewHistogram(o.Offset.Seconds(), o.Resolution)}
+	client.h3 = h3s
+	tr := &http3.Transport{
+		TLSClientConfig:    tlsConfig,
+		DisableCompression: !o.Compression,
+		QUICConfig:         &quic.Config{HandshakeIdleTimeout: o.HTTPReqTimeOut},
+		Dial: func(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (*quic.Conn, error) {
+			if o.Resolve != "" {
+				addr = o.Resolve + addr[strings.LastIndex(addr, ":"):]
+			}
+			now := time.Now()
+			conn, err := quic.DialAddrEarly(ctx, addr, tlsCfg, cfg)
+			if err != nil {
+				return nil, err
+			}
+			h3s.mu.Lock()
+			client.connectStats.Record(time.Since(now).Seconds())
+			client.ipAddrUsage.Record(conn.RemoteAddr().String())
+			h3s.conns = append(h3s.conns, conn)
+			h3s.mu.Unlock()
+			go h3s.record(conn, now)
+			return conn, nil
+		},
+	}
+	client.transport = h3Transport{tr}
+	var rt http.RoundTripper = tr
+	if o.Transport != nil {
+		rt = o.Transport(rt)
+	}
+	client.client.Transport = rt
+	return client, nil
+}
+
+// HTTP3Server creates an HTTP/3 (QUIC) server on the given UDP port, using the same
+// TLSOptions as HTTPSServer (cert and key are required).
+func HTTP3Server(name string, port string, to *TLSOptions) (*http.ServeMux, net.Addr) {
+	if !to.DoTLS() {
+		log.Errf("HTTP/3 server %s requires a cert and key", name)
+		return nil, nil
+	}
+	tlsConfig, err := to.TLSConfig()
+	if err != nil {
+		return nil, nil
+	}
+	udpConn, addr := fnet.UDPListen(name, port)
+	if udpConn == nil {
+		return nil, nil // error already logged
+	}
+	m := http.NewServeMux()
+	s := &http3.Server{
+		Handler:   m,
+		TLSConfig: http3.ConfigureTLSConfig(tlsConfig),
+		QUICConfig: &quic.Config{
+			Allow0RTT:      true,
+			MaxIdleTimeout: ServerIdleTimeout.Get(),
+		},
+	}
+	go func() {
+		err := s.Serve(udpConn)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Unable to HTTP/3 serve %s on %s: %v", name, addr.String(), err)
+		}
+	}()
+	return m, addr
+}
+
+// ServeH3 is ServeTLS for HTTP/3: starts a debug / echo server on the given UDP port.
+func ServeH3(port, debugPath string, to *TLSOptions) (*http.ServeMux, net.Addr) {
+	mux, addr := HTTP3Server("h3-echo", port, to)
+	if addr == nil {
+		return nil, nil // error already logged
+	}
+	if debugPath != "" {
+		mux.Handle(debugPath, Gzip(http.HandlerFunc(DebugHandler)))
+		mux.HandleFunc(EchoDebugPath(debugPath), EchoHandler)
+	}
+	mux.HandleFunc("/", EchoHandler)
+	return mux, addr
+}
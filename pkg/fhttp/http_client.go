@@ -30,6 +30,8 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"fortio.org/fortio/pkg/fnet"
@@ -75,6 +77,7 @@ var (
 	contentLengthHeader   = []byte("\r\ncontent-length:")
 	connectionCloseHeader = []byte("\r\nconnection: close")
 	chunkedHeader         = []byte("\r\nTransfer-Encoding: chunked")
+	retryAfterHeader      = []byte("\r\nretry-after:")
 	rander                = NewSyncReader(rand.New(rand.NewSource(time.Now().UnixNano()))) //nolint:gosec // we want fast not crypto
 )
 
@@ -156,8 +159,8 @@ func (h *HTTPOptions) URLSchemeCheck() {
 		log.Infof("PayloadReader set, switching to H2")
 		h.H2 = true
 	}
-	if h.H2 && !h.DisableFastClient {
-		log.Infof("H2 requested, switching to std client")
+	if h.PayloadReader != nil && !h.DisableFastClient {
+		log.Infof("PayloadReader set, switching to std client")
 		h.DisableFastClient = true
 	}
 	hs := fnet.PrefixHTTPS // longer of the 2 prefixes
@@ -190,7 +193,9 @@ type HTTPOptions struct {
 	Compression       bool // defaults to no compression, only used by std client
 	DisableFastClient bool // defaults to fast client
 	HTTP10            bool // defaults to http1.1
-	H2                bool // defaults to http1.1 (h2 only for stdclient)
+	H2                bool // defaults to http1.1
+	H3                bool // HTTP/3 over QUIC (https:// only), takes precedence over H2 and the fast client
+	H2MaxStreams      int  // fast client h2/h2c: number of threads (concurrent streams) per connection. 0 or 1 = 1.
 	DisableKeepAlive  bool // so default is keep alive
 	AllowHalfClose    bool // if not keepalive, whether to half close after request
 	FollowRedirects   bool // For the Std Client only: follow redirects.
@@ -225,6 +230,10 @@ type HTTPOptions struct {
 	// These following 2 options are only making sense for single operation (curl) mode.
 	PayloadReader io.Reader `json:"-"` // if set, Payload is ignored and this is used instead.
 	DataWriter    io.Writer `json:"-"` // if set, the response body is written to this writer.
+	// Shared h2 connections of the fast client, set by RunHTTPTest for the duration of a run.
+	h2pool *h2ConnPool
+	// Meter of the bytes read and written by the clients of a thread, set by RunHTTPTest with MeasureThroughput.
+	throughput *fnet.ThroughputMeter
 }
 
 // DefaultHTTPOptions is meant to be set by the main() from bincommon.SharedHTTPOptions() and used
@@ -450,8 +459,17 @@ type Client struct {
 	runID                int64
 	ipAddrUsage          *stats.Occurrence
 	connectStats         *stats.Histogram
+	handshakeStats       *stats.Histogram // TLS handshakes (not in h3 mode)
+	closeStats           *stats.Histogram
+	openConns            atomic.Int64
+	connMu               sync.Mutex // connection stats are recorded from the transport's goroutines
 	clientTrace          CreateClientTrace
 	dataWriter           io.Writer
+	dialer               func(ctx context.Context, network, addr string) (net.Conn, error)
+	h3                   *h3ClientStats    // set in h3 mode only
+	roundTripper         http.RoundTripper // set in h2 fast client mode: used directly instead of client
+	lastRetryAfter       string            // Retry-After header of the last response
+	throughput           *fnet.ThroughputMeter
 }
 
 func (c *Client) HasBuffer() bool {
@@ -497,6 +515,12 @@ func (c *Client) Fetch(ctx context.Context) (int, []byte, int) {
 // and only available with the fastclient.
 func (c *Client) StreamFetch(ctx context.Context) (int, int64, uint) {
 	// req can't be null (client itself would be null in that case)
+	if c.roundTripper != nil && c.client.Timeout > 0 {
+		// what the http.Client would do for us.
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.client.Timeout)
+		defer cancel()
+	}
 	var req *http.Request
 	if c.clientTrace != nil {
 		req = c.req.WithContext(httptrace.WithClientTrace(ctx, c.clientTrace(ctx)))
@@ -529,13 +553,24 @@ func (c *Client) StreamFetch(ctx context.Context) (int, int64, uint) {
 	} else if len(c.body) > 0 {
 		req.Body = io.NopCloser(bytes.NewReader(c.body))
 	}
-	resp, err := c.client.Do(req)
+	if c.throughput != nil && req.Body != nil {
+		req.Body = io.NopCloser(meteredReader{req.Body, c.throughput})
+	}
+	c.lastRetryAfter = ""
+	var resp *http.Response
+	var err error
+	if c.roundTripper != nil {
+		resp, err = c.roundTripper.RoundTrip(req)
+	} else {
+		resp, err = c.client.Do(req)
+	}
 	if err != nil {
 		log.S(log.Error, "Unable to send request",
 			log.Attr("method", req.Method), log.Attr("url", c.url), log.Attr("err", err),
 			log.Attr("thread", c.id), log.Attr("run", c.runID))
 		return -1, -1, 0
 	}
+	c.lastRetryAfter = resp.Header.Get("Retry-After")
 	var data []byte
 	if log.LogDebug() {
 		if data, err = httputil.DumpResponse(resp, false); err != nil {
@@ -548,7 +583,11 @@ func (c *Client) StreamFetch(ctx context.Context) (int, int64, uint) {
 		c.dataWriter = io.Discard
 	}
 	var n int64
-	n, err = io.Copy(c.dataWriter, resp.Body)
+	var body io.Reader = resp.Body
+	if c.throughput != nil {
+		body = meteredReader{body, c.throughput}
+	}
+	n, err = io.Copy(c.dataWriter, body)
 	resp.Body.Close()
 	if err != nil {
 		log.S(log.Error, "Unable to read response",
@@ -568,18 +607,100 @@ func (c *Client) StreamFetch(ctx context.Context) (int, int64, uint) {
 	return code, n, 0
 }
 
+// retryAfter returns the Retry-After of the last response, for the runner's retries.
+func (c *Client) retryAfter() time.Duration {
+	return parseRetryAfter(c.lastRetryAfter)
+}
+
 // GetIPAddress get the IP address that DNS resolves to when using stdClient and connection stats.
 func (c *Client) GetIPAddress() (*stats.Occurrence, *stats.Histogram) {
 	return c.ipAddrUsage, c.connectStats
 }
 
+// connTimer is implemented by the clients recording the TLS handshake and close time of their connections.
+type connTimer interface {
+	// openConnections returns the number of connections currently open.
+	openConnections() int
+	// transferConnTimes moves the TLS handshake and close times into the given histograms.
+	transferConnTimes(handshake, closing *stats.Histogram)
+}
+
+func (c *Client) openConnections() int {
+	return int(c.openConns.Load())
+}
+
+func (c *Client) transferConnTimes(handshake, closing *stats.Histogram) {
+	c.connMu.Lock()
+	handshake.Transfer(c.handshakeStats)
+	closing.Transfer(c.closeStats)
+	c.connMu.Unlock()
+}
+
+func (c *Client) recordConnTime(h *stats.Histogram, start time.Time) {
+	c.connMu.Lock()
+	h.Record(time.Since(start).Seconds())
+	c.connMu.Unlock()
+}
+
+// tlsHandshake does the TLS handshake of a connection returned by the dialer, recording its duration.
+func (c *Client) tlsHandshake(ctx context.Context, conn net.Conn, cfg *tls.Config) (*tls.Conn, error) {
+	tlsConn := tls.Client(conn, cfg)
+	start := time.Now()
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	c.recordConnTime(c.handshakeStats, start)
+	return tlsConn, nil
+}
+
+// meteredReader counts the bytes of the request or response body in the throughput meter as they are read.
+type meteredReader struct {
+	io.Reader
+	meter *fnet.ThroughputMeter
+}
+
+func (m meteredReader) Read(p []byte) (int, error) {
+	n, err := m.Reader.Read(p)
+	m.meter.Add(int64(n), time.Now())
+	return n, err
+}
+
+// timedConn is a connection of the std client which records how long closing it takes
+// and keeps the count of open connections.
+type timedConn struct {
+	net.Conn
+	client *Client
+	closed atomic.Bool
+}
+
+func (t *timedConn) Close() error {
+	if t.closed.Swap(true) {
+		return t.Conn.Close() // already closed (and timed), returns the error.
+	}
+	if t.client.throughput != nil {
+		t.client.throughput.AddRetransmits(t.Conn)
+	}
+	start := time.Now()
+	err := t.Conn.Close()
+	t.client.recordConnTime(t.client.closeStats, start)
+	t.client.openConns.Add(-1)
+	return err
+}
+
 // NewClient creates either a standard or fast client (depending on
-// the DisableFastClient flag).
+// the DisableFastClient flag) or an HTTP/3 client when H3 is set.
 func NewClient(o *HTTPOptions) (Fetcher, error) {
 	o.Init(o.URL) // For completely new options
+	if o.H3 {
+		return newH3Client(o)
+	}
 	if o.DisableFastClient {
 		return NewStdClient(o)
 	}
+	if o.H2 {
+		return newH2Client(o)
+	}
 	return NewFastClient(o)
 }
 
@@ -612,10 +733,13 @@ func NewStdClient(o *HTTPOptions) (*Client, error) {
 		logErrors:   o.LogErrors,
 		ipAddrUsage: stats.NewOccurrence(),
 		// Keep track of timing for connection (re)establishment.
-		connectStats: stats.NewHistogram(o.Offset.Seconds(), o.Resolution),
-		clientTrace:  o.ClientTrace,
-		dataWriter:   o.DataWriter,
-		runID:        o.UniqueID,
+		connectStats:   stats.NewHistogram(o.Offset.Seconds(), o.Resolution),
+		handshakeStats: stats.NewHistogram(o.Offset.Seconds(), o.Resolution),
+		closeStats:     stats.NewHistogram(o.Offset.Seconds(), o.Resolution),
+		clientTrace:    o.ClientTrace,
+		dataWriter:     o.DataWriter,
+		runID:          o.UniqueID,
+		throughput:     o.throughput,
 	}
 	dialCtx := func(ctx context.Context, network, addr string) (net.Conn, error) {
 		// redirect all connections to resolved IP, and use Common Name (CN) as Server Name Indication (SNI) host
@@ -627,7 +751,7 @@ func NewStdClient(o *HTTPOptions) (*Client, error) {
 		conn, err = (&net.Dialer{
 			Timeout: o.HTTPReqTimeOut,
 		}).DialContext(ctx, network, addr)
-		client.connectStats.Record(time.Since(now).Seconds())
+		client.recordConnTime(client.connectStats, now)
 		if conn != nil {
 			newRemoteAddress := conn.RemoteAddr().String()
 			// No change when it wasn't set before (first time) and when the value isn't actually changing either.
@@ -637,9 +761,12 @@ func NewStdClient(o *HTTPOptions) (*Client, error) {
 			}
 			req.RemoteAddr = newRemoteAddress
 			client.ipAddrUsage.Record(req.RemoteAddr)
+			client.openConns.Add(1)
+			conn = &timedConn{Conn: conn, client: &client}
 		}
 		return conn, err
 	}
+	client.dialer = dialCtx
 	tr := &http.Transport{
 		MaxIdleConns:        o.NumConnections,
 		MaxIdleConnsPerHost: o.NumConnections,
@@ -656,6 +783,23 @@ func NewStdClient(o *HTTPOptions) (*Client, error) {
 		if err != nil {
 			return nil, err
 		}
+		// Our own TLS dialing to time the handshakes, otherwise done by the transport.
+		tr.DialTLSContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := dialCtx(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			cfg := tr.TLSClientConfig.Clone() // includes the h2 NextProtos setup by the transport.
+			if cfg.ServerName == "" {
+				cfg.ServerName, _, _ = net.SplitHostPort(addr)
+			}
+			if tr.TLSHandshakeTimeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tr.TLSHandshakeTimeout)
+				defer cancel()
+			}
+			return client.tlsHandshake(ctx, conn, cfg)
+		}
 	} else if o.H2 {
 		// Need to do h2c instead of normal transport
 		// Note: this likely means connection multiplexing / not sure how to force unique connections
@@ -761,7 +905,13 @@ type FastClient struct {
 	connReuse      int
 	reuseCount     int
 	connectStats   *stats.Histogram
+	handshakeStats *stats.Histogram // TLS handshakes, https only
+	closeStats     *stats.Histogram
+	throughput     *fnet.ThroughputMeter
 	dataWriter     io.Writer
+	// abort the request in progress when its context is canceled (ie the loser of a hedged request),
+	// off by default as it costs an allocation per request.
+	abortOnCancel bool
 }
 
 // GetIPAddress get ip address that DNS resolved to when using fast client and connection stats.
@@ -769,6 +919,30 @@ func (c *FastClient) GetIPAddress() (*stats.Occurrence, *stats.Histogram) {
 	return c.ipAddrUsage, c.connectStats
 }
 
+func (c *FastClient) openConnections() int {
+	if c.socket != nil {
+		return 1
+	}
+	return 0
+}
+
+func (c *FastClient) transferConnTimes(handshake, closing *stats.Histogram) {
+	handshake.Transfer(c.handshakeStats)
+	closing.Transfer(c.closeStats)
+}
+
+// closeSocket closes the connection, recording how long it took, after adding its TCP retransmits
+// when measuring the throughput.
+func (c *FastClient) closeSocket(socket net.Conn) error {
+	if c.throughput != nil {
+		c.throughput.AddRetransmits(socket)
+	}
+	start := time.Now()
+	err := socket.Close()
+	c.closeStats.Record(time.Since(start).Seconds())
+	return err
+}
+
 func (c *FastClient) HasBuffer() bool {
 	return true
 }
@@ -777,7 +951,7 @@ func (c *FastClient) HasBuffer() bool {
 func (c *FastClient) Close() {
 	log.Debugf("[%d] Closing %p %s socket count %d", c.id, c, c.url, c.socketCount)
 	if c.socket != nil {
-		if err := c.reader.Close(); err != nil {
+		if err := c.closeSocket(c.socket); err != nil {
 			log.S(log.Warning, "Error closing fast client's socket",
 				log.Attr("err", err), log.Attr("thread", c.id), log.Attr("run", c.runID))
 		}
@@ -840,8 +1014,11 @@ func NewFastClient(o *HTTPOptions) (Fetcher, error) { //nolint:funlen // yes it'
 		https: o.https, connReuseRange: o.ConnReuseRange, connReuse: connReuse,
 		resolve: o.Resolve, noResolveEachConn: o.NoResolveEachConn, ipAddrUsage: stats.NewOccurrence(),
 		// Keep track of timing for connection (re)establishment.
-		connectStats: stats.NewHistogram(o.Offset.Seconds(), o.Resolution),
-		dataWriter:   o.DataWriter,
+		connectStats:   stats.NewHistogram(o.Offset.Seconds(), o.Resolution),
+		handshakeStats: stats.NewHistogram(o.Offset.Seconds(), o.Resolution),
+		closeStats:     stats.NewHistogram(o.Offset.Seconds(), o.Resolution),
+		throughput:     o.throughput,
+		dataWriter:     o.DataWriter,
 	}
 	if o.https {
 		bc.tlsConfig, err = o.TLSOptions.TLSConfig()
@@ -942,27 +1119,32 @@ func (c *FastClient) connect(ctx context.Context) (net.Conn, *DelayedErrorReader
 
 	d := &net.Dialer{Timeout: c.reqTimeout}
 	now := time.Now()
+	socket, err = d.DialContext(ctx, c.dest.Network(), c.dest.String())
+	c.connectStats.Record(time.Since(now).Seconds())
+	if err != nil {
+		log.S(log.Error, "Unable to connect", log.Attr("dest", c.dest), log.Attr("err", err),
+			log.Attr("numfd", scli.NumFD()),
+			log.Attr("thread", c.id), log.Attr("run", c.runID))
+		return nil, nil
+	}
 	if c.https {
-		dialer := &tls.Dialer{
-			NetDialer: d,
-			Config:    c.tlsConfig,
+		// Handshake timed separately from the connection (like the tls.Dialer, same timeout for both).
+		now = time.Now()
+		hsCtx := ctx
+		if c.reqTimeout > 0 {
+			var cancel context.CancelFunc
+			hsCtx, cancel = context.WithTimeout(ctx, c.reqTimeout)
+			defer cancel()
 		}
-		socket, err = dialer.DialContext(ctx, c.dest.Network(), c.dest.String())
-		c.connectStats.Record(time.Since(now).Seconds())
-		if err != nil {
+		tlsConn := tls.Client(socket, c.tlsConfig)
+		if err = tlsConn.HandshakeContext(hsCtx); err != nil {
 			log.S(log.Error, "Unable to TLS connect", log.Attr("dest", c.dest), log.Attr("err", err),
 				log.Attr("thread", c.id), log.Attr("run", c.runID))
+			_ = c.closeSocket(socket)
 			return nil, nil
 		}
-	} else {
-		socket, err = d.Dial(c.dest.Network(), c.dest.String())
-		c.connectStats.Record(time.Since(now).Seconds())
-		if err != nil {
-			log.S(log.Error, "Unable to connect", log.Attr("dest", c.dest), log.Attr("err", err),
-				log.Attr("numfd", scli.NumFD()),
-				log.Attr("thread", c.id), log.Attr("run", c.runID))
-			return nil, nil
-		}
+		c.handshakeStats.Record(time.Since(now).Seconds())
+		socket = tlsConn
 	}
 	fnet.SetSocketBuffers(socket, len(c.buffer), len(c.req))
 	return socket, &DelayedErrorReader{r: socket}
@@ -1013,6 +1195,12 @@ func (c *FastClient) StreamFetch(ctx context.Context) (int, int64, uint) {
 	}
 	c.socket = nil // because of error returns and single retry
 	conErr := conn.SetDeadline(time.Now().Add(c.reqTimeout))
+	if c.abortOnCancel {
+		stop := context.AfterFunc(ctx, func() {
+			_ = conn.SetDeadline(time.Unix(1, 0)) // in the past: the pending write or read fails right away.
+		})
+		defer stop()
+	}
 	// Send the request:
 	req := c.req
 	if len(c.uuidMarkers) > 0 {
@@ -1020,21 +1208,29 @@ func (c *FastClient) StreamFetch(ctx context.Context) (int, int64, uint) {
 			req = bytes.Replace(req, uuidMarker, []byte(generateUUID()), 1)
 		}
 	}
-	n, err := conn.Write(req)
+	var n int
+	var err error
+	if c.throughput != nil {
+		n, err = c.throughput.MeteredWrite(conn, req)
+	} else {
+		n, err = conn.Write(req)
+	}
 	if err != nil || conErr != nil {
 		if canReuse {
 			// it's ok for the (idle) socket to die once, auto reconnect:
 			log.S(log.Info, "Closing dead socket", log.Attr("err", err), log.Attr("thread", c.id), log.Attr("run", c.runID))
-			conn.Close()
+			_ = c.closeSocket(conn)
 			c.errorCount++
 			return c.StreamFetch(ctx) // recurse once
 		}
 		log.S(log.Error, "Unable to write", log.Attr("err", err), log.Attr("thread", c.id), log.Attr("run", c.runID))
+		_ = c.closeSocket(conn)
 		return c.returnRes()
 	}
 	if n != len(c.req) {
 		log.S(log.Error, "Short write", log.Attr("err", err), log.Attr("actual", n), log.Attr("expected", len(c.req)),
 			log.Attr("thread", c.id), log.Attr("run", c.runID))
+		_ = c.closeSocket(conn)
 		return c.returnRes()
 	}
 	if !c.keepAlive && c.halfClose { //nolint:nestif // not that bad.
@@ -1042,6 +1238,7 @@ func (c *FastClient) StreamFetch(ctx context.Context) (int, int64, uint) {
 		if ok {
 			if err = tcpConn.CloseWrite(); err != nil {
 				log.S(log.Error, "Unable to close write", log.Attr("err", err), log.Attr("thread", c.id), log.Attr("run", c.runID))
+				_ = c.closeSocket(conn)
 				return c.returnRes()
 			} // else:
 			log.Debugf("[%d] Half closed ok after sending request %v", c.id, c.dest)
@@ -1060,6 +1257,26 @@ func (c *FastClient) StreamFetch(ctx context.Context) (int, int64, uint) {
 	return c.returnRes()
 }
 
+// retryAfter returns the Retry-After of the last response (when it fit in the buffer), for the runner's retries.
+func (c *FastClient) retryAfter() time.Duration {
+	if c.code < 0 || c.size == 0 {
+		return 0
+	}
+	end := c.size
+	if c.headerLen > 0 {
+		end = safecast.MustConv[int64](c.headerLen)
+	}
+	found, offset := FoldFind(c.buffer[:end], retryAfterHeader)
+	if !found {
+		return 0
+	}
+	value := c.buffer[offset+len(retryAfterHeader) : end]
+	if idx := bytes.IndexByte(value, '\r'); idx >= 0 {
+		value = value[:idx]
+	}
+	return parseRetryAfter(string(value))
+}
+
 func codeIsOK(code int) bool {
 	// TODO: make this configurable
 	return (code >= 200 && code <= 299) || code == http.StatusTeapot
@@ -1112,13 +1329,16 @@ func (c *FastClient) readResponse(conn *DelayedErrorReader, socket net.Conn, reu
 		if !skipRead {
 			nI, err := conn.Read(c.buffer[c.size:])
 			n := safecast.MustConv[int64](nI)
+			if c.throughput != nil {
+				c.throughput.Add(n, time.Now())
+			}
 			if err != nil {
 				if reusedSocket && c.size == 0 {
 					// Ok for reused socket to be dead once (close by server)
 					log.S(log.Info, "Closing dead socket (err at first read)",
 						log.Attr("err", err), log.Attr("thread", c.id), log.Attr("run", c.runID))
 					c.errorCount++
-					err = conn.Close() // close the previous one
+					err = c.closeSocket(socket) // close the previous one
 					if err != nil {
 						log.S(log.Warning, "Error closing dead socket", log.Attr("err", err), log.Attr("thread", c.id), log.Attr("run", c.runID))
 					}
@@ -1301,7 +1521,7 @@ func (c *FastClient) readResponse(conn *DelayedErrorReader, socket net.Conn, reu
 		c.socket = socket // keep the open socket
 		c.reader = conn
 	} else {
-		if err := conn.Close(); err != nil {
+		if err := c.closeSocket(socket); err != nil {
 			log.S(log.Error, "Close error", log.Attr("err", err), log.Attr("size", c.size),
 				log.Attr("thread", c.id), log.Attr("run", c.runID))
 		} else {
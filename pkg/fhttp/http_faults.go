@@ -0,0 +1,200 @@
+// Copyright 2026 Fortio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fhttp
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"fortio.org/fortio/pkg/log"
+)
+
+// Echo server fault injection query args (on top of status, delay and close). All but trickle and
+// throttle use the close= probability syntax: "true" or a percentage like "5".
+const (
+	// FaultArgReset resets (TCP RST) the connection after half of the body.
+	FaultArgReset = "reset"
+	// FaultArgTruncate sends only half of the body announced by the Content-Length.
+	FaultArgTruncate = "truncate"
+	// FaultArgChunked sends a malformed chunked encoding body (HTTP/1.1 only, resets on HTTP/2).
+	FaultArgChunked = "chunked"
+	// FaultArgHang never replies (until the client gives up).
+	FaultArgHang = "hang"
+	// FaultArgTrickle sends the body at N bytes/sec, "trickle=100" or "trickle=100:20" for 20% of the requests.
+	FaultArgTrickle = "trickle"
+	// FaultArgThrottle replies with a Retry-After header, same syntax as status, ie "429:10,503:5".
+	FaultArgThrottle = "throttle"
+	// FaultArgRetryAfter is the value of the Retry-After header for throttle (default 1 second).
+	FaultArgRetryAfter = "retry-after"
+)
+
+// bodyFault is the fault, if any, affecting how the body is written.
+type bodyFault int
+
+const (
+	noBodyFault bodyFault = iota
+	resetBodyFault
+	truncateBodyFault
+	chunkedBodyFault
+)
+
+func (f bodyFault) String() string {
+	switch f {
+	case resetBodyFault:
+		return FaultArgReset
+	case truncateBodyFault:
+		return FaultArgTruncate
+	case chunkedBodyFault:
+		return FaultArgChunked
+	default:
+		return "none"
+	}
+}
+
+// generateBodyFault picks the body fault for the request, in reset, truncate, chunked order.
+func generateBodyFault(r *http.Request) bodyFault {
+	switch {
+	case generateSingleProbability(QueryArg(r, FaultArgReset), FaultArgReset):
+		return resetBodyFault
+	case generateSingleProbability(QueryArg(r, FaultArgTruncate), FaultArgTruncate):
+		return truncateBodyFault
+	case generateSingleProbability(QueryArg(r, FaultArgChunked), FaultArgChunked):
+		return chunkedBodyFault
+	default:
+		return noBodyFault
+	}
+}
+
+// generateTrickle from string, format: trickle=100 for 100 bytes/sec always, trickle=100:20 for
+// 100 bytes/sec 20% of the time. Returns 0 for no trickle.
+func generateTrickle(trickle string) int {
+	if trickle == "" {
+		return 0
+	}
+	rateStr, percent, hasPercent := strings.Cut(trickle, ":")
+	rate, err := strconv.Atoi(rateStr)
+	if err != nil || rate <= 0 {
+		log.Warnf("Bad input trickle %q, should be a positive bytes/sec number optionally followed by :percent", trickle)
+		return 0
+	}
+	if hasPercent && !generateSingleProbability(percent, FaultArgTrickle) {
+		return 0
+	}
+	return rate
+}
+
+// handleHangAndThrottle handles the hang and throttle args, returns true if the request got handled.
+func handleHangAndThrottle(w http.ResponseWriter, r *http.Request) bool {
+	if generateSingleProbability(QueryArg(r, FaultArgHang), FaultArgHang) {
+		echoFault(FaultArgHang)
+		log.LogVf("Hanging request from %v", r.RemoteAddr)
+		<-r.Context().Done()
+		return true
+	}
+	throttle := QueryArg(r, FaultArgThrottle)
+	if throttle == "" {
+		return false
+	}
+	status := generateStatus(throttle)
+	if status == http.StatusOK {
+		return false
+	}
+	retryAfter := QueryArg(r, FaultArgRetryAfter)
+	if retryAfter == "" {
+		retryAfter = "1"
+	}
+	echoFault(FaultArgThrottle)
+	log.LogVf("Throttling with %d, Retry-After %s", status, retryAfter)
+	w.Header().Set("Retry-After", retryAfter)
+	http.Error(w, http.StatusText(status), status)
+	return true
+}
+
+// trickleWriter writes (and flushes) the body at rate bytes per second, in 10 writes per second.
+type trickleWriter struct {
+	http.ResponseWriter
+	rate int
+}
+
+func (tw *trickleWriter) Write(p []byte) (int, error) {
+	chunk := max(tw.rate/10, 1)
+	sleep := time.Duration(chunk) * time.Second / time.Duration(tw.rate)
+	total := 0
+	for len(p) > 0 {
+		time.Sleep(sleep)
+		n, err := tw.ResponseWriter.Write(p[:min(chunk, len(p))])
+		total += n
+		if err != nil {
+			return total, err
+		}
+		Flush(tw.ResponseWriter)
+		p = p[n:]
+	}
+	return total, nil
+}
+
+func (tw *trickleWriter) Flush() {
+	Flush(tw.ResponseWriter)
+}
+
+// Unwrap is for http.ResponseController (ie to hijack the connection for the reset fault).
+func (tw *trickleWriter) Unwrap() http.ResponseWriter {
+	return tw.ResponseWriter
+}
+
+// writeFaultyBody writes the status and body of the reply with the (non none) body fault.
+func writeFaultyBody(w http.ResponseWriter, status int, body []byte, fault bodyFault) {
+	echoFault(fault.String())
+	log.LogVf("Injecting %v fault for %d status and %d bytes body", fault, status, len(body))
+	half := len(body) / 2
+	if fault == chunkedBodyFault {
+		conn, bufrw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			log.LogVf("Can't hijack for malformed chunked encoding (%v), resetting the stream instead", err)
+			panic(http.ErrAbortHandler)
+		}
+		defer conn.Close()
+		_, _ = fmt.Fprintf(bufrw, "HTTP/1.1 %d %s\r\nTransfer-Encoding: chunked\r\nConnection: close\r\n\r\n",
+			status, http.StatusText(status))
+		// one valid chunk then a chunk size that isn't hexadecimal and no final chunk.
+		_, _ = fmt.Fprintf(bufrw, "%x\r\n%s\r\nzz-not-a-chunk-size\r\n%s", half, body[:half], body[half:])
+		_ = bufrw.Flush()
+		return
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(status)
+	if _, err := w.Write(body[:half]); err != nil {
+		log.LogVf("Error writing faulty body: %v", err)
+		return
+	}
+	if fault == truncateBodyFault {
+		// the server closes the connection (or stream) when less than the Content-Length is written.
+		return
+	}
+	Flush(w)
+	conn, _, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		log.LogVf("Can't hijack for reset (%v), resetting the stream instead", err)
+		panic(http.ErrAbortHandler)
+	}
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		_ = tcp.SetLinger(0)
+	}
+	_ = conn.Close()
+}
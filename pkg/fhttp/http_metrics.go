@@ -0,0 +1,87 @@
+// Copyright 2026 Fortio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fhttp
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"fortio.org/fortio/pkg/metrics"
+)
+
+// EchoServerName is the server label of the echo server faults in ServerFaults.
+const EchoServerName = "echo"
+
+var (
+	httpRequests = metrics.NewCounterVec("fortio_http_server_requests_total",
+		"HTTP requests served, by server, mux pattern, status code and protocol", "server", "pattern", "code", "proto")
+	httpRequestBytes = metrics.NewCounterVec("fortio_http_server_request_bytes_total",
+		"Bytes of HTTP request bodies read", "server")
+	httpResponseBytes = metrics.NewCounterVec("fortio_http_server_response_bytes_total",
+		"Bytes of HTTP response bodies written", "server")
+	httpConnections = metrics.NewGaugeVec("fortio_http_server_connections",
+		"Currently open HTTP connections (h2c connections are counted until upgraded)", "server")
+	httpLatency = metrics.NewHistogramVec("fortio_http_server_request_duration_seconds",
+		"Time spent serving HTTP requests", metrics.DefaultLatencyBuckets, "server", "pattern")
+	// ServerFaults counts the faults injected by the echo and gRPC ping servers.
+	ServerFaults = metrics.NewCounterVec("fortio_server_faults_total",
+		"Faults injected by the servers, by server and fault", "server", "fault")
+)
+
+// echoFault counts an injected echo server fault.
+func echoFault(fault string) {
+	ServerFaults.Inc(EchoServerName, fault)
+}
+
+// instrumentHandler records the server metrics of the requests served by the handler.
+func instrumentHandler(server string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		var cb *captureBody
+		if r.Body != nil && r.Body != http.NoBody {
+			cb = &captureBody{ReadCloser: r.Body}
+			r.Body = cb
+		}
+		cw := &captureWriter{ResponseWriter: w}
+		defer func() {
+			// The mux sets the Pattern of the request, mock routes set it to theirs.
+			pattern := r.Pattern
+			if pattern == "" {
+				pattern = "none"
+			}
+			httpRequests.Inc(server, pattern, strconv.Itoa(cw.status), r.Proto)
+			httpLatency.Observe(time.Since(start).Seconds(), server, pattern)
+			if cb != nil {
+				httpRequestBytes.Add(cb.size, server)
+			}
+			httpResponseBytes.Add(cw.size, server)
+		}()
+		h.ServeHTTP(cw, r)
+	})
+}
+
+// trackConnections is the http.Server ConnState hook maintaining the connections gauge.
+func trackConnections(server string) func(net.Conn, http.ConnState) {
+	return func(_ net.Conn, state http.ConnState) {
+		switch state { //nolint:exhaustive // only opening and closing matter.
+		case http.StateNew:
+			httpConnections.Inc(server)
+		case http.StateClosed, http.StateHijacked:
+			httpConnections.Add(-1, server)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2026 Fortio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fhttp
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"fortio.org/fortio/pkg/metrics"
+)
+
+func TestServerMetrics(t *testing.T) {
+	mux, addr := HTTPServer("metrics-test", "0")
+	mux.HandleFunc("/", EchoHandler)
+	url := "http://" + addr.String()
+	faults := func(f string) int64 { return ServerFaults.Value(EchoServerName, f) }
+	statusFaults, delayFaults := faults("status"), faults("delay")
+	client := &http.Client{Transport: &http.Transport{}}
+	for _, q := range []string{"/?status=503&delay=1ms", "/?status=503", "/x?size=100"} {
+		resp, err := client.Post(url+q, "text/plain", strings.NewReader("hello"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+	client.CloseIdleConnections()
+	if v := httpRequests.Value("metrics-test", "/", "503", "HTTP/1.1"); v != 2 {
+		t.Errorf("Expected 2 requests with 503, got %d", v)
+	}
+	if v := httpRequests.Value("metrics-test", "/", "200", "HTTP/1.1"); v != 1 {
+		t.Errorf("Expected 1 request with 200, got %d", v)
+	}
+	if v := httpRequestBytes.Value("metrics-test"); v != 15 {
+		t.Errorf("Expected 15 request bytes, got %d", v)
+	}
+	if v := httpResponseBytes.Value("metrics-test"); v < 100 {
+		t.Errorf("Expected at least 100 response bytes, got %d", v)
+	}
+	if v := httpLatency.Count("metrics-test", "/"); v != 3 {
+		t.Errorf("Expected 3 latency observations, got %d", v)
+	}
+	if faults("status") != statusFaults+2 || faults("delay") != delayFaults+1 {
+		t.Errorf("Unexpected fault counts %d %d", faults("status")-statusFaults, faults("delay")-delayFaults)
+	}
+	var buf bytes.Buffer
+	if err := metrics.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `fortio_http_server_requests_total{server="metrics-test",pattern="/",code="503",proto="HTTP/1.1"} 2`) {
+		t.Errorf("Missing requests metric in:\n%s", buf.String())
+	}
+	if !strings.Contains(buf.String(), `fortio_http_server_connections{server="metrics-test"} `) {
+		t.Errorf("Missing connections metric in:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,349 @@
+// Copyright 2026 Fortio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fhttp
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"fortio.org/dflag"
+	"fortio.org/fortio/internal/jrpc"
+	"fortio.org/fortio/pkg/fnet"
+	"fortio.org/fortio/pkg/log"
+	"fortio.org/fortio/pkg/stats"
+	"gopkg.in/yaml.v3"
+)
+
+// MockRoute is one route of the echo server mock configuration. Requests matching the Pattern get the
+// configured reply instead of their echo. Status, Size and Delay use the syntax of the echo query args of
+// the same name (so can be probabilistic, ie "503:10" for 10% errors, and delays can be distributions).
+type MockRoute struct {
+	// Pattern is a http.ServeMux pattern, ie "GET /users/{id}" or "/static/" for a prefix.
+	Pattern string `json:"pattern" yaml:"pattern"`
+	Status  string `json:"status,omitempty" yaml:"status,omitempty"`
+	// Headers are added to the reply.
+	Headers map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
+	// Body is the reply body template, see routeBodyTokens. When empty the request body is echoed back.
+	Body string `json:"body,omitempty" yaml:"body,omitempty"`
+	// Size replies with a generated payload of that size instead of the Body.
+	Size  string `json:"size,omitempty" yaml:"size,omitempty"`
+	Delay string `json:"delay,omitempty" yaml:"delay,omitempty"`
+	// Params are additional echo query args, ie "reset=5&close=10" for the other faults.
+	Params string `json:"params,omitempty" yaml:"params,omitempty"`
+}
+
+// MockRoutesConfig is the content of the echo routes file (JSON or, for .yaml/.yml files, YAML).
+type MockRoutesConfig struct {
+	Routes []MockRoute `json:"routes" yaml:"routes"`
+}
+
+// routeBodyTokens are the tokens replaced in the route Body: {method}, {path}, {host}, {seq} (number of
+// requests the route served), {body} (the request's), and the {path.name} wildcards of the Pattern,
+// {query.name} and {header.name} values.
+var routeBodyTokens = regexp.MustCompile(`\{(method|path|host|seq|body|path\.[^{}]+|query\.[^{}]+|header\.[^{}]+)\}`)
+
+// mockRoute is a parsed MockRoute.
+type mockRoute struct {
+	MockRoute
+	query  url.Values
+	delays *stats.Delays // parsed Delay, which may be empirical(file).
+	hits   atomic.Int64
+}
+
+// mockRoutes is a loaded (active) routes file.
+type mockRoutes struct {
+	file   string
+	loaded time.Time
+	mtime  time.Time
+	size   int64
+	mux    *http.ServeMux
+	routes []*mockRoute
+}
+
+var (
+	// EchoRoutes is the mock routes file of the echo server, reloaded when it changes.
+	EchoRoutes = dflag.New("",
+		"`Path` to a JSON or YAML routes file mapping method and path patterns to echo server replies, empty for none").
+		WithValidator(validateMockRoutes).WithSyncNotifier(echoRoutesChanged)
+	// MockRoutesCheckInterval is how often the routes file is checked for changes.
+	MockRoutesCheckInterval = dflag.New(2*time.Second, "How often the -echo-routes file is checked for changes")
+	activeRoutes            atomic.Pointer[mockRoutes]
+	lastRoutesError         atomic.Pointer[string]
+	routesWatcher           sync.Once
+)
+
+// validateMockRoutes is the EchoRoutes validator.
+func validateMockRoutes(file string) error {
+	if file == "" {
+		return nil
+	}
+	_, err := readMockRoutes(file)
+	return err
+}
+
+// echoRoutesChanged is the EchoRoutes notifier.
+func echoRoutesChanged(_, file string) {
+	if err := LoadMockRoutes(file); err != nil {
+		log.Errf("Unable to load echo routes: %v", err)
+	}
+}
+
+// decodeMockRoutes parses JSON or YAML (based on the file extension) routes.
+func decodeMockRoutes(file string, data []byte) (*MockRoutesConfig, error) {
+	cfg := &MockRoutesConfig{}
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+	default:
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(cfg); err != nil {
+			return nil, err
+		}
+	}
+	return cfg, nil
+}
+
+// readMockRoutes reads and validates a routes file.
+func readMockRoutes(file string) (*mockRoutes, error) {
+	fi, err := os.Stat(file)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := decodeMockRoutes(file, data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid routes file %s: %w", file, err)
+	}
+	res := &mockRoutes{file: file, loaded: time.Now(), mtime: fi.ModTime(), size: fi.Size(), mux: http.NewServeMux()}
+	for i := range cfg.Routes {
+		if err = res.add(&mockRoute{MockRoute: cfg.Routes[i]}); err != nil {
+			return nil, fmt.Errorf("route %d of %s: %w", i, file, err)
+		}
+	}
+	return res, nil
+}
+
+// add validates and registers a route.
+func (m *mockRoutes) add(rt *mockRoute) (err error) {
+	if rt.Pattern == "" {
+		return errors.New("missing pattern")
+	}
+	if rt.query, err = url.ParseQuery(rt.Params); err != nil {
+		return fmt.Errorf("invalid params %q: %w", rt.Params, err)
+	}
+	if rt.Delay != "" {
+		if rt.delays, err = stats.ParseDelays(rt.Delay, true); err != nil {
+			return fmt.Errorf("invalid delay %q: %w", rt.Delay, err)
+		}
+	}
+	for arg, v := range map[string]string{"status": rt.Status, "size": rt.Size, "delay": rt.Delay} {
+		if v != "" {
+			rt.query.Set(arg, v)
+		}
+	}
+	defer func() {
+		// ServeMux panics on invalid or conflicting patterns.
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	m.mux.Handle(rt.Pattern, rt)
+	m.routes = append(m.routes, rt)
+	return nil
+}
+
+// LoadMockRoutes reads and activates the routes file (empty file name to deactivate them). The file is
+// then checked every MockRoutesCheckInterval and reloaded when it changes.
+func LoadMockRoutes(file string) error {
+	if file == "" {
+		activeRoutes.Store(nil)
+		return nil
+	}
+	m, err := readMockRoutes(file)
+	if err != nil {
+		return err
+	}
+	activeRoutes.Store(m)
+	lastRoutesError.Store(nil)
+	log.Infof("Loaded %d echo routes from %s", len(m.routes), file)
+	routesWatcher.Do(func() {
+		go watchMockRoutes()
+	})
+	return nil
+}
+
+// watchMockRoutes reloads the active routes file when its modification time or size changes.
+// A file with errors is reported (in the logs and the routes endpoint) and the previous routes kept.
+func watchMockRoutes() {
+	for {
+		time.Sleep(MockRoutesCheckInterval.Get())
+		m := activeRoutes.Load()
+		if m == nil {
+			continue
+		}
+		fi, err := os.Stat(m.file)
+		if err != nil || (fi.ModTime().Equal(m.mtime) && fi.Size() == m.size) {
+			continue
+		}
+		nm, err := readMockRoutes(m.file)
+		if err != nil {
+			msg := err.Error()
+			if prev := lastRoutesError.Swap(&msg); prev == nil || *prev != msg {
+				log.Errf("Not reloading echo routes: %v", err)
+			}
+			continue
+		}
+		// Only swap if the file wasn't changed (deactivated or replaced) in the meantime.
+		if activeRoutes.CompareAndSwap(m, nm) {
+			lastRoutesError.Store(nil)
+			log.Infof("Reloaded %d echo routes from %s", len(nm.routes), nm.file)
+		}
+	}
+}
+
+// handleMockRoute serves the request if it matches one of the active routes, returns true if it did.
+func handleMockRoute(w http.ResponseWriter, r *http.Request) bool {
+	m := activeRoutes.Load()
+	if m == nil {
+		return false
+	}
+	if _, pattern := m.mux.Handler(r); pattern == "" {
+		return false
+	}
+	m.mux.ServeHTTP(w, r) // calls the route's ServeHTTP with the pattern's wildcards set.
+	return true
+}
+
+// ServeHTTP replies to a request matching the route: the echo handler with the route's args on top of the
+// request's ones, the route's headers and its body rendered as the request's.
+func (rt *mockRoute) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	seq := rt.hits.Add(1)
+	log.LogVf("Echo route %q request #%d for %s %v", rt.Pattern, seq, r.Method, r.URL)
+	q := r.URL.Query()
+	maps.Copy(q, rt.query)
+	nr := r.Clone(r.Context())
+	nr.URL.RawQuery = q.Encode()
+	nr.RequestURI = nr.URL.RequestURI()
+	nr.Form = nil
+	nr = withServerDelay(nr, rt.delays)
+	for k, v := range rt.Headers {
+		w.Header().Set(k, v)
+	}
+	if rt.Body != "" {
+		var in []byte
+		if strings.Contains(rt.Body, "{body}") {
+			in, _ = io.ReadAll(io.LimitReader(r.Body, int64(len(fnet.Payload))))
+		}
+		body := rt.render(seq, r, in)
+		nr.Body = io.NopCloser(strings.NewReader(body))
+		nr.ContentLength = int64(len(body))
+		nr.Header.Set("Content-Length", strconv.Itoa(len(body)))
+		nr.Header.Del("Content-Type")
+		jrpc.SetHeaderIfMissing(w.Header(), "Content-Type", "text/plain; charset=UTF-8")
+	}
+	echoHandler(w, nr)
+}
+
+// render replaces the routeBodyTokens of the route's Body.
+func (rt *mockRoute) render(seq int64, r *http.Request, in []byte) string {
+	return routeBodyTokens.ReplaceAllStringFunc(rt.Body, func(token string) string {
+		token = token[1 : len(token)-1]
+		switch token {
+		case "method":
+			return r.Method
+		case "path":
+			return r.URL.Path
+		case "host":
+			return r.Host
+		case "seq":
+			return strconv.FormatInt(seq, 10)
+		case "body":
+			return string(in)
+		}
+		kind, name, _ := strings.Cut(token, ".")
+		switch kind {
+		case "path":
+			return r.PathValue(name)
+		case "query":
+			return r.URL.Query().Get(name)
+		default:
+			return r.Header.Get(name)
+		}
+	})
+}
+
+// MockRouteStatus is a route and how many requests it served, in MockRoutesStatus.
+type MockRouteStatus struct {
+	MockRoute
+	Hits int64 `json:"hits"`
+}
+
+// MockRoutesStatus is the reply of the MockRoutesHandler.
+type MockRoutesStatus struct {
+	File   string            `json:"file,omitempty"`
+	Loaded time.Time         `json:"loaded,omitzero"`
+	Error  string            `json:"error,omitempty"` // last reload error, if any.
+	Routes []MockRouteStatus `json:"routes"`
+}
+
+// MockRoutesHandler returns the active echo routes and their hit counts as JSON. A POST reloads the
+// routes file first (resetting the counts).
+func MockRoutesHandler(w http.ResponseWriter, r *http.Request) {
+	if m := activeRoutes.Load(); m != nil && r.Method == http.MethodPost {
+		if err := LoadMockRoutes(m.file); err != nil {
+			_ = jrpc.ReplyError(w, "reload failed", err)
+			return
+		}
+	}
+	res := MockRoutesStatus{Routes: []MockRouteStatus{}}
+	if m := activeRoutes.Load(); m != nil {
+		res.File = m.file
+		res.Loaded = m.loaded
+		for _, rt := range m.routes {
+			res.Routes = append(res.Routes, MockRouteStatus{MockRoute: rt.MockRoute, Hits: rt.hits.Load()})
+		}
+	}
+	if e := lastRoutesError.Load(); e != nil {
+		res.Error = *e
+	}
+	_ = jrpc.ReplyOk(w, &res)
+}
+
+// MockRoutesPath returns the echo routes endpoint path behind debugPath (ie /debug -> /debug/routes).
+func MockRoutesPath(debugPath string) string {
+	return strings.TrimSuffix(debugPath, "/") + "/routes"
+}
@@ -0,0 +1,163 @@
+// Copyright 2026 Fortio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fhttp
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"fortio.org/fortio/pkg/log"
+)
+
+const routesTestYAML = `routes:
+  - pattern: GET /users/{id}
+    headers:
+      Content-Type: application/json
+    body: '{"id": "{path.id}", "q": "{query.q}", "seq": {seq}}'
+  - pattern: POST /upload
+    status: "201"
+    body: "got {body}"
+  - pattern: /slow/
+    delay: 50ms
+    size: "10"
+  - pattern: /down
+    status: "503"
+    params: header=X-Test:1
+`
+
+func TestEchoRoutes(t *testing.T) {
+	log.SetLogLevel(log.Info)
+	dir := t.TempDir()
+	file := filepath.Join(dir, "routes.yaml")
+	if err := os.WriteFile(file, []byte(routesTestYAML), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	oldInterval := MockRoutesCheckInterval.Get()
+	_ = MockRoutesCheckInterval.SetV(50 * time.Millisecond)
+	defer func() { _ = MockRoutesCheckInterval.SetV(oldInterval) }()
+	if err := EchoRoutes.Set(file); err != nil {
+		t.Fatal(err)
+	}
+	defer EchoRoutes.Set("")
+	mux, addr := ServeTCP("0", "/debug")
+	if mux == nil {
+		t.Fatal("Unable to start server")
+	}
+	base := fmt.Sprintf("http://localhost:%d", addr.Port)
+	do := func(method, path, body string) (*http.Response, string) {
+		req, _ := http.NewRequest(method, base+path, strings.NewReader(body))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		return resp, string(data)
+	}
+	for i := 1; i <= 2; i++ {
+		resp, body := do(http.MethodGet, "/users/42?q=x", "")
+		expected := fmt.Sprintf(`{"id": "42", "q": "x", "seq": %d}`, i)
+		if resp.StatusCode != http.StatusOK || body != expected || resp.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Unexpected templated reply %d %q %v", resp.StatusCode, body, resp.Header)
+		}
+	}
+	resp, body := do(http.MethodPost, "/upload", "abc")
+	if resp.StatusCode != http.StatusCreated || body != "got abc" {
+		t.Errorf("Unexpected upload reply %d %q", resp.StatusCode, body)
+	}
+	start := time.Now()
+	resp, body = do(http.MethodGet, "/slow/a/b", "")
+	if resp.StatusCode != http.StatusOK || len(body) != 10 || time.Since(start) < 50*time.Millisecond {
+		t.Errorf("Unexpected slow reply %d %d bytes after %v", resp.StatusCode, len(body), time.Since(start))
+	}
+	resp, _ = do(http.MethodGet, "/down", "")
+	if resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get("X-Test") != "1" {
+		t.Errorf("Unexpected down reply %d %v", resp.StatusCode, resp.Header)
+	}
+	// Unmatched (including by method) requests are echoed, query args still apply.
+	resp, body = do(http.MethodPost, "/users/42?status=202", "echo me")
+	if resp.StatusCode != http.StatusAccepted || body != "echo me" {
+		t.Errorf("Unexpected echo reply %d %q", resp.StatusCode, body)
+	}
+	var status MockRoutesStatus
+	_, body = do(http.MethodGet, "/debug/routes", "")
+	if err := json.Unmarshal([]byte(body), &status); err != nil {
+		t.Fatalf("Invalid routes status %q: %v", body, err)
+	}
+	if status.File != file || len(status.Routes) != 4 || status.Routes[0].Hits != 2 || status.Routes[0].Pattern != "GET /users/{id}" {
+		t.Errorf("Unexpected routes status %+v", status)
+	}
+	// Invalid changes are reported and the previous routes kept.
+	if err := os.WriteFile(file, []byte("routes:\n  - pattern: GET /users/{id\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	_, body = do(http.MethodGet, "/debug/routes", "")
+	if !strings.Contains(body, `"error"`) || !strings.Contains(body, `"hits"`) {
+		t.Errorf("Expected reload error with previous routes, got %s", body)
+	}
+	// Hot reload.
+	if err := os.WriteFile(file, []byte(`routes: [{pattern: "/new", body: "new route"}]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if _, body = do(http.MethodGet, "/new", ""); body != "new route" {
+		t.Errorf("Expected reloaded route, got %q", body)
+	}
+	if resp, _ = do(http.MethodGet, "/down", ""); resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected removed route to be echoed, got %d", resp.StatusCode)
+	}
+	// Deactivation.
+	if err := EchoRoutes.Set(""); err != nil {
+		t.Fatal(err)
+	}
+	if _, body = do(http.MethodGet, "/new", ""); body != "" {
+		t.Errorf("Expected echo without routes, got %q", body)
+	}
+}
+
+func TestEchoRoutesErrors(t *testing.T) {
+	dir := t.TempDir()
+	for name, cfg := range map[string]string{
+		"conflict.json": `{"routes": [{"pattern": "/a"}, {"pattern": "/a"}]}`,
+		"unknown.json":  `{"routes": [{"pattern": "/a", "nope": 1}]}`,
+		"nopattern.yml": `routes: [{body: x}]`,
+		"badpat.yaml":   `routes: [{pattern: "GET /{x"}]`,
+		"delay.json":    `{"routes": [{"pattern": "/a", "delay": "nope"}]}`,
+		"params.json":   `{"routes": [{"pattern": "/a", "params": "%zz"}]}`,
+		"bad.json":      `not json`,
+	} {
+		file := filepath.Join(dir, name)
+		if err := os.WriteFile(file, []byte(cfg), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := EchoRoutes.Set(file); err == nil {
+			t.Errorf("Expected error for %s", cfg)
+		}
+	}
+	if err := EchoRoutes.Set(filepath.Join(dir, "missing.json")); err == nil {
+		t.Errorf("Expected error for missing file")
+	}
+	if EchoRoutes.Get() != "" {
+		t.Errorf("Invalid routes files should not be set, got %q", EchoRoutes.Get())
+	}
+}
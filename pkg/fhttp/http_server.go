@@ -18,6 +18,7 @@ package fhttp // import "fortio.org/fortio/pkg/fhttp"
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"net"
@@ -35,6 +36,7 @@ import (
 	"fortio.org/dflag"
 	"fortio.org/fortio/pkg/fnet"
 	"fortio.org/fortio/internal/jrpc"
+	"fortio.org/fortio/pkg/stats"
 	"fortio.org/fortio/pkg/version"
 	"fortio.org/fortio/pkg/log"
 	"golang.org/x/net/http2"
@@ -49,7 +51,10 @@ var (
 	// EchoRequests is the number of request received. Only updated in Debug mode.
 	EchoRequests            int64
 	DefaultEchoServerParams = dflag.New("",
-		"Default parameters/querystring to use if there isn't one provided explicitly. E.g \"status=404&delay=3s\"")
+		"Default parameters/querystring to use if there isn't one provided explicitly. E.g \"status=404&delay=3s\"").
+		WithValidator(echoDefaultParams.Validate)
+	// echoDefaultParams caches the parsed DefaultEchoServerParams (its delay may be empirical).
+	echoDefaultParams     ServerParams
 	Fetch2CopiesAllHeader = dflag.NewBool(true,
 		"Determines if only tracing or all headers (and cookies) are copied from request on the fetch2 ui/server endpoint")
 	ServerIdleTimeout = dflag.New(30*time.Second, "Default IdleTimeout for servers")
@@ -88,12 +93,21 @@ func QueryArg(r *http.Request, key string) string {
 func EchoHandler(w http.ResponseWriter, r *http.Request) {
 	// EchoHandler is an HTTP server handler echoing back the input.
 	if log.LogVerbose() {
-		log.LogAndCall("Echo", func(w http.ResponseWriter, r *http.Request) {
-			echoHandler(w, r)
-		})(w, r)
+		log.LogAndCall("Echo", routedEchoHandler)(w, r)
 		return
 	}
-	echoHandler(w, r)
+	routedEchoHandler(w, r)
+}
+
+// routedEchoHandler serves the request with the matching echo route if any (see EchoRoutes), echoes it otherwise.
+// The request is captured when RequestCapture is on.
+func routedEchoHandler(w http.ResponseWriter, r *http.Request) {
+	captureRequest(w, r, func(w http.ResponseWriter, r *http.Request) {
+		if handleMockRoute(w, r) {
+			return
+		}
+		echoHandler(w, r)
+	})
 }
 
 func echoHandler(w http.ResponseWriter, r *http.Request) {
@@ -109,18 +123,54 @@ func echoHandler(w http.ResponseWriter, r *http.Request) {
 			log.Errf("Unexpected error parsing echo-server-default-params: %v", err)
 		} else {
 			nr.Form = nil
-			r = &nr
+			_, delays := echoDefaultParams.Get(defaultParams)
+			r = withServerDelay(&nr, delays)
 		}
 	}
+	if chaos := EchoChaos.Params(); len(chaos) > 0 {
+		if _, found := chaos["delay"]; found {
+			r = withServerDelay(r, nil) // the phase's delay= overrides the operator set one.
+		}
+		nr := *r
+		u := *r.URL
+		u.RawQuery = WithChaosParams(EchoChaos, r.URL.Query()).Encode()
+		log.LogVf("Chaos phase params %q for %v", u.RawQuery, r.URL)
+		nr.URL = &u
+		nr.Form = nil
+		r = &nr
+	}
+	if handleRateLimit(w, r) {
+		return
+	}
+	if IsWebSocketUpgrade(r) {
+		WebSocketEchoHandler(w, r)
+		return
+	}
+	if QueryArg(r, StreamModeSSE) != "" || QueryArg(r, StreamModeNDJSON) != "" {
+		StreamHandler(w, r)
+		return
+	}
 	reqNum := handleCommonArgs(w, r)
+	if handleHangAndThrottle(w, r) {
+		return
+	}
 	statusStr := QueryArg(r, "status")
 	var status int
 	if statusStr != "" {
 		status = generateStatus(statusStr)
+		if status != http.StatusOK {
+			echoFault("status")
+		}
 	} else {
 		status = http.StatusOK
 	}
-	gzip := strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") && generateGzip(QueryArg(r, "gzip"))
+	fault := generateBodyFault(r)
+	if rate := generateTrickle(QueryArg(r, FaultArgTrickle)); rate > 0 {
+		echoFault(FaultArgTrickle)
+		log.LogVf("Trickling the reply at %d bytes/sec", rate)
+		w = &trickleWriter{ResponseWriter: w, rate: rate}
+	}
+	gzip := fault == noBodyFault && strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") && generateGzip(QueryArg(r, "gzip"))
 	if gzip {
 		gwz := NewGzipHTTPResponseWriter(w)
 		defer gwz.Close()
@@ -130,7 +180,7 @@ func echoHandler(w http.ResponseWriter, r *http.Request) {
 	var data []byte
 	var err error
 	// Also read the whole input if we're supposed to write something unrelated like size=100
-	h2Mode := (r.ProtoMajor == 2) && (!gzip) && (size == -1)
+	h2Mode := (r.ProtoMajor == 2) && (!gzip) && (size == -1) && (fault == noBodyFault)
 	if !h2Mode {
 		data, err = io.ReadAll(r.Body)
 		log.Debugf("H1(.1) read %d", len(data))
@@ -140,6 +190,13 @@ func echoHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 	}
+	if fault != noBodyFault {
+		if size >= 0 {
+			data = fnet.Payload[:size]
+		}
+		writeFaultyBody(w, status, data, fault)
+		return
+	}
 	if size >= 0 {
 		log.LogVf("Writing %d size with %d status", size, status)
 		writePayload(w, status, size)
@@ -172,10 +229,31 @@ func echoHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// serverDelayKey is the request context key of the operator set delay (default params or route).
+type serverDelayKey struct{}
+
+// withServerDelay returns r with the operator set delays, which replace its delay= query arg
+// (nil to go back to the query arg).
+func withServerDelay(r *http.Request, delays *stats.Delays) *http.Request {
+	if delays == nil && r.Context().Value(serverDelayKey{}) == nil {
+		return r
+	}
+	return r.WithContext(context.WithValue(r.Context(), serverDelayKey{}, delays))
+}
+
+// requestDelay returns the operator set delay of the request if any, else the one of its delay= query arg.
+func requestDelay(r *http.Request) time.Duration {
+	if delays, _ := r.Context().Value(serverDelayKey{}).(*stats.Delays); delays != nil {
+		return SampleDelay(delays)
+	}
+	return generateDelay(QueryArg(r, "delay"))
+}
+
 // handleCommonArgs common flags for debug and echo handlers from query string only.
 func handleCommonArgs(w http.ResponseWriter, r *http.Request) (rqNum int64) {
-	dur := generateDelay(QueryArg(r, "delay"))
+	dur := requestDelay(r)
 	if dur > 0 {
+		echoFault("delay")
 		log.LogVf("Sleeping for %v", dur)
 		time.Sleep(dur)
 	}
@@ -185,6 +263,7 @@ func handleCommonArgs(w http.ResponseWriter, r *http.Request) (rqNum int64) {
 		log.Debugf("Request # %v", rqNum)
 	}
 	if generateClose(QueryArg(r, "close")) {
+		echoFault("close")
 		log.Debugf("Adding Connection:close / will close socket")
 		w.Header().Set("Connection", "close")
 	}
@@ -248,7 +327,8 @@ func HTTPServerWithHandler(name string, port string, hdlr http.Handler) net.Addr
 	s := &http.Server{
 		ReadHeaderTimeout: ServerIdleTimeout.Get(),
 		IdleTimeout:       ServerIdleTimeout.Get(),
-		Handler:           h2c.NewHandler(hdlr, h2s),
+		Handler:           h2c.NewHandler(instrumentHandler(name, hdlr), h2s),
+		ConnState:         trackConnections(name),
 		ErrorLog:          log.NewStdLogger("http2c srv "+name, log.Error),
 	}
 	listener, addr := fnet.Listen(name, port)
@@ -277,7 +357,8 @@ func HTTPSServer(name string, port string, to *TLSOptions) (*http.ServeMux, net.
 	s := &http.Server{
 		ReadHeaderTimeout: ServerIdleTimeout.Get(),
 		IdleTimeout:       ServerIdleTimeout.Get(),
-		Handler:           m,
+		Handler:           instrumentHandler(name, m),
+		ConnState:         trackConnections(name),
 		TLSConfig:         tlsConfig,
 		ErrorLog:          log.NewStdLogger("http srv "+name, log.Error),
 	}
@@ -375,6 +456,12 @@ func DebugHandler(w http.ResponseWriter, r *http.Request) {
 	buf.WriteString(" - request from ")
 	buf.WriteString(r.RemoteAddr)
 	buf.WriteString(log.TLSInfo(r))
+	for _, c := range ChaosSchedules() {
+		if st := c.Status(); st.Schedule != "" {
+			buf.WriteByte('\n')
+			buf.WriteString(st.String())
+		}
+	}
 	buf.WriteString("\n\n")
 	buf.WriteString(r.Method)
 	buf.WriteByte(' ')
@@ -475,6 +562,10 @@ func ServeTLS(port, debugPath string, to *TLSOptions) (*http.ServeMux, net.Addr)
 	if debugPath != "" {
 		mux.Handle(debugPath, Gzip(http.HandlerFunc(DebugHandler)))
 		mux.HandleFunc(EchoDebugPath(debugPath), EchoHandler) // Fix #524
+		mux.HandleFunc(MockRoutesPath(debugPath), MockRoutesHandler)
+		mux.HandleFunc(ChaosPath(debugPath), ChaosHandler)
+		mux.HandleFunc(CapturePath(debugPath), CaptureHandler)
+		mux.HandleFunc(CapturePath(debugPath)+"/live", CaptureLiveHandler)
 	}
 	mux.HandleFunc("/", EchoHandler)
 	return mux, addr
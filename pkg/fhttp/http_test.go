@@ -25,6 +25,7 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"path/filepath"
 	"slices"
 	"strings"
 	"testing"
@@ -35,6 +36,7 @@ import (
 	"fortio.org/fortio/pkg/fnet"
 	"fortio.org/fortio/internal/jrpc"
 	"fortio.org/fortio/pkg/log"
+	"fortio.org/fortio/pkg/stats"
 	"github.com/google/uuid"
 )
 
@@ -389,6 +391,20 @@ func TestParseDelay(t *testing.T) {
 		{"100ms:0%", 0},
 		{"10ms:45,10ms:55", 10 * time.Millisecond},
 		{"10ms:45%,10ms:55%", 10 * time.Millisecond},
+		// Distributions
+		{"uniform(20ms,20ms)", 20 * time.Millisecond},
+		{"normal(30ms,0s)", 30 * time.Millisecond},
+		{"normal(30ms, 0s):100", 30 * time.Millisecond},
+		{"uniform(5ms,5ms):40,normal(5ms,0s):60", 5 * time.Millisecond},
+		{"pareto(10s,2)", MaxDelay.Get()},
+		{"exp(0s)", 0},
+		{"normal(1ms)", -1},
+		{"normal(1ms,x)", -1},
+		{"nope(1ms,2ms)", -1},
+		{"uniform(2ms,1ms)", -1},
+		{"pareto(1ms,0)", -1},
+		{"normal(1ms,1ms", -1},
+		{"empirical(/does/not/exist.json)", -1},
 	}
 	for _, tst := range tests {
 		if actual := generateDelay(tst.input); actual != tst.expected {
@@ -397,6 +413,113 @@ func TestParseDelay(t *testing.T) {
 	}
 }
 
+func TestDelayDistributions(t *testing.T) {
+	const n = 2000
+	tests := []struct {
+		spec     string
+		avg      time.Duration
+		min, max time.Duration
+	}{
+		{"normal(50ms,10ms)", 50 * time.Millisecond, 0, time.Second},
+		{"lognormal(50ms,20ms)", 50 * time.Millisecond, 1, time.Second},
+		{"exp(20ms)", 20 * time.Millisecond, 0, time.Second},
+		{"uniform(10ms,30ms)", 20 * time.Millisecond, 10 * time.Millisecond, 30 * time.Millisecond},
+		{"pareto(10ms,3)", 15 * time.Millisecond, 10 * time.Millisecond, MaxDelay.Get()},
+		{"uniform(10ms,30ms):50", 10 * time.Millisecond, 0, 30 * time.Millisecond},
+	}
+	for _, tst := range tests {
+		var sum time.Duration
+		for range n {
+			d := generateDelay(tst.spec)
+			if d < tst.min || d > tst.max {
+				t.Fatalf("%s: %v out of [%v, %v]", tst.spec, d, tst.min, tst.max)
+			}
+			sum += d
+		}
+		avg := sum / n
+		if avg < tst.avg*8/10 || avg > tst.avg*12/10 {
+			t.Errorf("%s: average %v, expected ~%v", tst.spec, avg, tst.avg)
+		}
+	}
+	// Empirical from a saved result: 75% in [10ms, 20ms] and 25% in [100ms, 200ms].
+	result := `{"DurationHistogram": {"Count": 4, "Data": [
+		{"Start": 0.01, "End": 0.02, "Percent": 75, "Count": 3},
+		{"Start": 0.1, "End": 0.2, "Percent": 100, "Count": 1}]}}`
+	fileName := filepath.Join(t.TempDir(), "result.json")
+	if err := os.WriteFile(fileName, []byte(result), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// Reading server files isn't allowed from client supplied delays.
+	if d := generateDelay("empirical(" + fileName + ")"); d != -1 {
+		t.Errorf("Expected empirical() to be refused in delay=, got %v", d)
+	}
+	delays, err := stats.ParseDelays("empirical("+fileName+")", true)
+	if err != nil {
+		t.Fatalf("Unexpected error for empirical delays: %v", err)
+	}
+	slow := 0
+	for range n {
+		d := delays.Sample()
+		switch {
+		case d >= 100*time.Millisecond && d <= 200*time.Millisecond:
+			slow++
+		case d < 10*time.Millisecond || d > 20*time.Millisecond:
+			t.Fatalf("Empirical delay %v out of the histogram buckets", d)
+		}
+	}
+	if slow < n/5 || slow > n*3/10 {
+		t.Errorf("Expected ~25%% slow empirical delays, got %d/%d", slow, n)
+	}
+}
+
+// Operator set delays (echo default params and routes) may read empirical files, client ones can't.
+func TestServerEmpiricalDelays(t *testing.T) {
+	result := `{"DurationHistogram": {"Count": 1, "Data": [{"Start": 0.1, "End": 0.12, "Percent": 100, "Count": 1}]}}`
+	dir := t.TempDir()
+	fileName := filepath.Join(dir, "result.json")
+	if err := os.WriteFile(fileName, []byte(result), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	empirical := "empirical(" + fileName + ")"
+	routes := filepath.Join(dir, "routes.yaml")
+	if err := os.WriteFile(routes, []byte("routes:\n  - pattern: /route/\n    delay: "+empirical+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := EchoRoutes.Set(routes); err != nil {
+		t.Fatal(err)
+	}
+	defer EchoRoutes.Set("")
+	if err := DefaultEchoServerParams.Set("delay=" + empirical); err != nil {
+		t.Fatal(err)
+	}
+	defer DefaultEchoServerParams.Set("")
+	if err := DefaultEchoServerParams.Set("delay=empirical(/does/not/exist.json)"); err == nil {
+		t.Error("Expected a bad empirical default delay to be refused")
+	}
+	_, a := Serve("0", "")
+	base := fmt.Sprintf("http://localhost:%d", a.(*net.TCPAddr).Port)
+	tests := []struct {
+		path string
+		slow bool
+	}{
+		{"/echo", true},
+		{"/route/x", true},
+		{"/echo?delay=" + url.QueryEscape(empirical), false},
+		{"/echo?size=10", false},
+	}
+	for _, tst := range tests {
+		start := time.Now()
+		code, _ := Fetch(&HTTPOptions{URL: base + tst.path})
+		d := time.Since(start)
+		if code != http.StatusOK {
+			t.Errorf("%s: got %d", tst.path, code)
+		}
+		if slow := d >= 100*time.Millisecond; slow != tst.slow {
+			t.Errorf("%s: took %v, expected slow %v", tst.path, d, tst.slow)
+		}
+	}
+}
+
 func TestGenerateStatusBasic(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -563,6 +686,75 @@ func TestGenerateGzip(t *testing.T) {
 	}
 }
 
+func TestGenerateTrickle(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int
+	}{
+		{"", 0},
+		{"100", 100},
+		{"100:100", 100},
+		{"100:0", 0},
+		{"x", 0},
+		{"-5", 0},
+	}
+	for _, tst := range tests {
+		if actual := generateTrickle(tst.input); actual != tst.expected {
+			t.Errorf("Got %v, expected %v for generateTrickle(%q)", actual, tst.expected, tst.input)
+		}
+	}
+}
+
+func TestEchoFaults(t *testing.T) {
+	m, a := DynamicHTTPServer(false)
+	m.HandleFunc("/", EchoHandler)
+	baseURL := fmt.Sprintf("http://localhost:%d/?", a.Port)
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	get := func(query string) (*http.Response, []byte, error) {
+		resp, err := client.Get(baseURL + query)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		return resp, body, err
+	}
+	resp, _, err := get("throttle=429&retry-after=7")
+	if err != nil || resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") != "7" {
+		t.Errorf("Unexpected throttle reply %v %v %v", resp, err, resp.Header)
+	}
+	resp, _, err = get("throttle=503:0")
+	if err != nil || resp.StatusCode != http.StatusOK || resp.Header.Get("Retry-After") != "" {
+		t.Errorf("Unexpected not throttled reply %v %v", resp, err)
+	}
+	var body []byte
+	resp, body, err = get("size=1000&trickle=5000")
+	if err != nil || len(body) != 1000 {
+		t.Errorf("Unexpected trickle reply %v %d %v", resp, len(body), err)
+	}
+	start := time.Now()
+	_, _, err = get("size=200&trickle=1000")
+	if d := time.Since(start); err != nil || d < 150*time.Millisecond {
+		t.Errorf("Trickle of 200 bytes at 1000 bytes/sec should take ~200ms, took %v (%v)", d, err)
+	}
+	for _, fault := range []string{"reset=true", "truncate=100", "chunked=true"} {
+		_, body, err = get("size=1000&" + fault)
+		if err == nil {
+			t.Errorf("Expected error for %s, got %d bytes", fault, len(body))
+		}
+		if len(body) >= 1000 {
+			t.Errorf("Expected partial body for %s, got %d bytes", fault, len(body))
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+"hang=true", nil)
+	if resp, err = client.Do(req); err == nil {
+		resp.Body.Close()
+		t.Errorf("Expected timeout for hang, got %v", resp.Status)
+	}
+}
+
 func TestPayloadWithEchoBack(t *testing.T) {
 	tests := []struct {
 		payload           []byte
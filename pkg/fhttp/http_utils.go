@@ -19,14 +19,18 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/base64"
+	"fmt"
 	"html/template"
 	"io"
 	"math/rand"
+	"maps"
 	"net/http"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 	"unicode/utf8"
 
@@ -385,70 +389,73 @@ var MaxDelay = dflag.New(1500*time.Millisecond,
 
 // generateDelay from string, format: delay="100ms" for 100% 100ms delay
 // delay="10ms:20,20ms:10,1s:0.5" for 20% 10ms, 10% 20ms, 0.5% 1s and 69.5% 0
-// TODO: very similar with generateStatus - refactor?
+// or with distributions (see stats.ParseDistribution) instead of fixed durations,
+// ie delay="normal(50ms,10ms)" or delay="exp(20ms):10,pareto(100ms,1.5):1". Capped at MaxDelay.
+// empirical(file) is refused as the value comes from clients (query args, gRPC metadata), operator set
+// delays are parsed once instead (see ServerParams).
 func generateDelay(delay string) time.Duration {
-	lst := strings.Split(delay, ",")
-	log.Debugf("Parsing delay %s -> %v", delay, lst)
+	log.Debugf("Parsing delay %s", delay)
 	if len(delay) == 0 {
 		return -1
 	}
-	// Simple non probabilistic status case:
-	if len(lst) == 1 && !strings.ContainsRune(delay, ':') {
-		d, err := time.ParseDuration(delay)
-		if err != nil {
-			log.Warnf("Bad input delay %v, not a duration nor comma and colon separated %% list", delay)
-			return -1
-		}
-		log.Debugf("Parsed delay %s -> %d", delay, d)
-		if d > MaxDelay.Get() {
-			d = MaxDelay.Get()
-		}
-		return d
+	delays, err := stats.ParseDelays(delay, false)
+	if err != nil {
+		log.Warnf("Bad input delay %v: %v", delay, err)
+		return -1
 	}
-	weights := make([]float32, len(lst))
-	delays := make([]time.Duration, len(lst))
-	lastPercent := float64(0)
-	i := 0
-	for _, entry := range lst {
-		l2 := strings.Split(entry, ":")
-		if len(l2) != 2 {
-			log.Warnf("Should have exactly 1 : in delay list %s -> %v", delay, entry)
-			return -1
-		}
-		d, err := time.ParseDuration(l2[0])
-		if err != nil {
-			log.Warnf("Bad input delay %v -> %v, not a number before colon", delay, l2[0])
-			return -1
-		}
-		if d > MaxDelay.Get() {
-			d = MaxDelay.Get()
-		}
-		percStr := removeTrailingPercent(l2[1])
-		p, err := strconv.ParseFloat(percStr, 32)
-		if err != nil || p < 0 || p > 100 {
-			log.Warnf("Percentage is not a [0. - 100.] number in %v -> %v : %v %f", delay, percStr, err, p)
-			return -1
-		}
-		lastPercent += p
-		// Round() needed to cover 'exactly' 100% and not more or less because of rounding errors
-		p32 := float32(stats.Round(lastPercent))
-		if p32 > 100. {
-			log.Warnf("Sum of percentage is greater than 100 in %v %f %f %f", delay, lastPercent, p, p32)
-			return -1
-		}
-		weights[i] = p32
-		delays[i] = d
-		i++
+	d := SampleDelay(delays)
+	log.Debugf("Delay %s -> %v", delay, d)
+	return d
+}
+
+// SampleDelay returns a sample of the parsed delays capped at MaxDelay, -1 for nil delays.
+func SampleDelay(delays *stats.Delays) time.Duration {
+	if delays == nil {
+		return -1
 	}
-	res := 100. * rand.Float32() //nolint:gosec // we want fast not crypto
-	for i, v := range weights {
-		if res <= v {
-			log.Debugf("[0.-100.[ for %s roll %f got #%d -> %d", delay, res, i, delays[i])
-			return delays[i]
+	return min(delays.Sample(), MaxDelay.Get())
+}
+
+// ServerParams caches the parsing of an operator set query string of parameters (ie the
+// -echo-server-default-params flag), done once by its Validate dflag validator. Unlike the clients'
+// delay args, its delay param may use empirical(file) distributions.
+type ServerParams struct {
+	parsed atomic.Pointer[parsedServerParams]
+}
+
+type parsedServerParams struct {
+	raw    string
+	query  url.Values
+	delays *stats.Delays
+}
+
+// Validate parses the raw parameters and their delay, and caches them for Get.
+func (p *ServerParams) Validate(raw string) error {
+	query, err := url.ParseQuery(raw)
+	if err != nil {
+		return err
+	}
+	parsed := &parsedServerParams{raw: raw, query: query}
+	if delay := query.Get("delay"); delay != "" {
+		if parsed.delays, err = stats.ParseDelays(delay, true); err != nil {
+			return fmt.Errorf("invalid delay %q: %w", delay, err)
 		}
 	}
-	log.Debugf("[0.-100.[ for %s roll %f no hit, defaulting to 0", delay, res)
-	return 0
+	p.parsed.Store(parsed)
+	return nil
+}
+
+// Get returns a copy of the parsed raw parameters and their delays (nil when there is no delay).
+// raw not validated before (ie the flag's initial value) is parsed without its delay.
+func (p *ServerParams) Get(raw string) (url.Values, *stats.Delays) {
+	if parsed := p.parsed.Load(); parsed != nil && parsed.raw == raw {
+		return maps.Clone(parsed.query), parsed.delays
+	}
+	query, err := url.ParseQuery(raw)
+	if err != nil {
+		log.Errf("Invalid server parameters %q: %v", raw, err)
+	}
+	return query, nil
 }
 
 // generateSingleProbability takes a string value and a name and returns a boolean.
@@ -479,6 +486,18 @@ func generateClose(closeStr string) bool {
 	return generateSingleProbability(closeStr, "close")
 }
 
+// GenerateDelay is the echo server delay= logic for other servers (ie the gRPC ping server fault injection):
+// returns the (random) delay, capped at MaxDelay, 0 for no delay or -1 when delay is empty or invalid.
+func GenerateDelay(delay string) time.Duration {
+	return generateDelay(delay)
+}
+
+// GenerateSingleProbability is the echo server close= logic for other servers: true if value is "true"
+// or, for a number X, X% of the time.
+func GenerateSingleProbability(value string, name string) bool {
+	return generateSingleProbability(value, name)
+}
+
 // generateGzip from string, format: gzip=true or gzip=100 for 100% gzip
 // gzip=42.3 for 42.3% gzip result (if Accept-Encoding is gzip).
 func generateGzip(gzipStr string) bool {
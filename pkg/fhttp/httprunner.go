@@ -16,6 +16,7 @@ package fhttp
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"runtime"
@@ -26,6 +27,7 @@ import (
 	"time"
 
 	"fortio.org/fortio/internal/jrpc"
+	"fortio.org/fortio/pkg/fnet"
 	"fortio.org/fortio/pkg/periodic"
 	"fortio.org/fortio/pkg/stats"
 	"fortio.org/fortio/pkg/log"
@@ -55,13 +57,50 @@ type HTTPRunnerResults struct {
 	// HTTP status code to abort the run on (-1 for connection or other socket error)
 	AbortOn int
 	aborter *periodic.Aborter
+	// Fast client h2/h2c mode per connection stats and totals of GOAWAY and RST_STREAM frames received.
+	H2Connections []H2ConnStats `json:",omitempty"`
+	H2GoAway      int64
+	H2RstStream   int64
+	// HTTP/3 (QUIC) client stats, when H3 is set.
+	H3 *H3Stats `json:",omitempty"`
+	// Streaming mode (sse/ndjson) results, when StreamMode is set.
+	Stream *StreamResults `json:",omitempty"`
+	stream *streamParser
+	// Retry and hedging results, when enabled in the Retry options.
+	Retry   *RetryResults `json:",omitempty"`
+	retrier *retrier
+	// Connection mode of the run and, in churn mode, the rate of new connections and the time to close them,
+	// in hold mode the connections still open at the end.
+	ConnMode          string               `json:",omitempty"`
+	ConnectionsPerSec float64              `json:",omitempty"`
+	CloseTime         *stats.HistogramData `json:",omitempty"`
+	HeldConnections   int                  `json:",omitempty"`
+	// TLS handshake time of the https connections (the HTTP/3 ones are in H3).
+	HandshakeTime *stats.HistogramData `json:",omitempty"`
+	// Throughput of all the connections and of each one (thread), when MeasureThroughput is set.
+	Throughput     *fnet.Throughput  `json:",omitempty"`
+	ConnThroughput []fnet.Throughput `json:",omitempty"`
+	throughput     *fnet.ThroughputMeter
 }
 
 // Run tests HTTP request fetching. Main call being run at the target QPS.
 // To be set as the Function in RunnerOptions.
 func (httpstate *HTTPRunnerResults) Run(ctx context.Context, t periodic.ThreadID) (bool, string) {
 	log.Debugf("Calling in %d", t)
-	code, size, headerSize := httpstate.client.StreamFetch(ctx)
+	if httpstate.stream != nil {
+		httpstate.stream.begin()
+	}
+	var code int
+	var size int64
+	var headerSize uint
+	if httpstate.retrier != nil {
+		code, size, headerSize = httpstate.retrier.fetch(ctx)
+	} else {
+		code, size, headerSize = httpstate.client.StreamFetch(ctx)
+	}
+	if httpstate.stream != nil {
+		httpstate.stream.end(codeIsOK(code))
+	}
 	log.Debugf("Got in %3d hsz %d sz %d - will abort on %d", code, headerSize, size, httpstate.AbortOn)
 	httpstate.RetCodes[code]++
 	httpstate.sizes.Record(float64(size))
@@ -83,6 +122,52 @@ type HTTPRunnerOptions struct {
 	AllowInitialErrors bool   // whether initial errors don't cause an abort
 	// Which status code cause an abort of the run (default 0 = don't abort; reminder -1 is returned for socket errors)
 	AbortOn int
+	// Streaming mode: "sse" or "ndjson" to parse the response body as events as it arrives and
+	// record first byte, first event, inter event and total stream times. Empty for normal requests.
+	StreamMode string
+	// Client side retries and hedging, off by default.
+	Retry RetryOptions
+	// Connection mode: ConnModeChurn or ConnModeHold, empty for the default reuse of the connections.
+	ConnMode string
+	// Report the bandwidth (bytes counted as they are read and written: the whole requests and responses with
+	// the fast client, their bodies with the std and h2 clients) of each connection and in aggregate, over
+	// time per ThroughputInterval (default 1s), ie for large downloads (echo size=) or uploads (payload).
+	MeasureThroughput  bool
+	ThroughputInterval time.Duration
+}
+
+// Connection modes of the HTTP and TCP runners (HTTPRunnerOptions.ConnMode), the default (empty) being
+// to reuse the connections until an error.
+const (
+	// ConnModeChurn opens (and closes) a new connection for each request, to measure connections per second.
+	ConnModeChurn = "churn"
+	// ConnModeHold opens all the connections before the run and holds them, the requests being the keepalives.
+	ConnModeHold = "hold"
+)
+
+// ValidConnMode returns an error if the mode isn't one of the connection modes (or empty).
+func ValidConnMode(mode string) error {
+	switch mode {
+	case "", ConnModeChurn, ConnModeHold:
+		return nil
+	default:
+		return fmt.Errorf("invalid connection mode %q, should be %q or %q", mode, ConnModeChurn, ConnModeHold)
+	}
+}
+
+// validChurnClient returns an error when the client of the (initialized) options would ignore
+// DisableKeepAlive and multiplex the requests on shared connections in churn mode: HTTP/3, the h2
+// fast client and h2c (the std client's h2 over https does use a connection per request).
+func validChurnClient(o *HTTPOptions) error {
+	switch {
+	case o.H3:
+		return errors.New("churn connection mode isn't supported with HTTP/3")
+	case o.H2 && !o.DisableFastClient:
+		return errors.New("churn connection mode isn't supported with the h2 fast client, use the std client")
+	case o.H2 && !o.https:
+		return errors.New("churn connection mode isn't supported with h2c (h2 without TLS)")
+	}
+	return nil
 }
 
 func NewErrorResult(o *HTTPRunnerOptions, message string, err error) *HTTPRunnerResults {
@@ -109,6 +194,21 @@ func NewErrorResult(o *HTTPRunnerOptions, message string, err error) *HTTPRunner
 //nolint:funlen, gocognit, gocyclo, maintidx // yeah it's long and complex, but it does a lot of things.
 func RunHTTPTest(o *HTTPRunnerOptions) (*HTTPRunnerResults, error) {
 	o.RunType = "HTTP"
+	if err := ValidStreamMode(o.StreamMode); err != nil {
+		return NewErrorResult(o, "stream mode error", err), err
+	}
+	if err := o.Retry.Validate(); err != nil {
+		return NewErrorResult(o, "retry options error", err), err
+	}
+	if err := ValidConnMode(o.ConnMode); err != nil {
+		return NewErrorResult(o, "connection mode error", err), err
+	}
+	// In hold mode the connections are established (warmed up) even when running an exact number of calls.
+	warmup := o.Exactly <= 0 || o.ConnMode == ConnModeHold
+	if o.Retry.Enabled() && o.StreamMode != "" {
+		err := errors.New("retries and hedging are not supported in stream mode")
+		return NewErrorResult(o, "retry options error", err), err
+	}
 	warmupMode := "parallel"
 	if o.SequentialWarmup {
 		warmupMode = "sequential"
@@ -132,6 +232,24 @@ func RunHTTPTest(o *HTTPRunnerOptions) (*HTTPRunnerResults, error) {
 	numThreads := r.Options().NumThreads // can change during run for c > 2 n
 	o.HTTPOptions.UniqueID = o.RunnerOptions.RunID
 	o.HTTPOptions.Init(o.URL)
+	if o.StreamMode != "" && !o.H2 && !o.H3 && !o.DisableFastClient {
+		log.Infof("Stream mode %s, switching to std client", o.StreamMode)
+		o.DisableFastClient = true
+	}
+	if o.ConnMode == ConnModeChurn {
+		if err := validChurnClient(&o.HTTPOptions); err != nil {
+			return NewErrorResult(o, "connection mode error", err), err
+		}
+	}
+	var h2pool *h2ConnPool
+	if o.H2 && !o.H3 && !o.DisableFastClient {
+		h2pool = newH2ConnPool(&o.HTTPOptions, numThreads)
+		o.HTTPOptions.h2pool = h2pool
+		defer func() {
+			h2pool.Close()
+			o.HTTPOptions.h2pool = nil
+		}()
+	}
 	out := r.Options().Out // Important as the default value is set from nil to stdout inside NewPeriodicRunner
 	aborter := r.Options().Stop
 	total := HTTPRunnerResults{
@@ -144,22 +262,43 @@ func RunHTTPTest(o *HTTPRunnerOptions) (*HTTPRunnerResults, error) {
 		aborter:     aborter,
 	}
 	httpstate := make([]HTTPRunnerResults, numThreads)
+	var streamTotal *streamParser
+	dataWriter := o.HTTPOptions.DataWriter
+	if o.StreamMode != "" {
+		streamTotal = newStreamParser(o.StreamMode, o.HTTPOptions.Offset.Seconds(), o.HTTPOptions.Resolution)
+	}
+	// The clients get their own copy of the options, in churn mode without keepalive.
+	clientOpts := o.HTTPOptions
+	if o.ConnMode == ConnModeChurn {
+		clientOpts.DisableKeepAlive = true
+	}
 	// First build all the clients sequentially. This ensures we do not have data races when
 	// constructing requests.
 	ctx := context.Background()
 	for i := range numThreads {
 		r.Options().Runners[i] = &httpstate[i]
 		// Temp mutate the option so each client gets a logging id
-		o.HTTPOptions.ID = i
+		clientOpts.ID = i
+		if o.MeasureThroughput {
+			// And the meter of its bytes (shared with the hedged requests' clients), restarted after the warmup.
+			httpstate[i].throughput = fnet.NewThroughputMeter(time.Now(), o.ThroughputInterval)
+			clientOpts.throughput = httpstate[i].throughput
+		}
+		if streamTotal != nil {
+			// Same for the writer getting the body as it arrives
+			httpstate[i].stream = newStreamParser(o.StreamMode, o.HTTPOptions.Offset.Seconds(), o.HTTPOptions.Resolution)
+			clientOpts.DataWriter = httpstate[i].stream
+		}
 		// Create a client (and transport) and connect once for each 'thread'
 		var err error
-		httpstate[i].client, err = NewClient(&o.HTTPOptions)
+		httpstate[i].client, err = NewClient(&clientOpts)
+		clientOpts.DataWriter = dataWriter
 		// nil check on interface doesn't work
 		if err != nil {
 			aborter.RecordStart() // virtual/fake start so when we use the start chan later to wait it doesn't hang
 			return NewErrorResult(o, "init error", err), err
 		}
-		if o.SequentialWarmup && o.Exactly <= 0 {
+		if o.SequentialWarmup && warmup {
 			code, dataLen, headerSize := httpstate[i].client.StreamFetch(ctx)
 			if !o.AllowInitialErrors && !codeIsOK(code) {
 				codeErr := fmt.Errorf("error %d for %s (%d body bytes), thread# %d", code, o.URL, dataLen, i)
@@ -176,11 +315,14 @@ func RunHTTPTest(o *HTTPRunnerOptions) (*HTTPRunnerResults, error) {
 		httpstate[i].RetCodes = make(map[int]int64)
 		httpstate[i].AbortOn = total.AbortOn
 		httpstate[i].aborter = total.aborter
+		if o.Retry.Enabled() {
+			httpstate[i].retrier = newRetrier(&o.Retry, &clientOpts, httpstate[i].client, aborter.StopChan)
+		}
 	}
-	if o.Exactly <= 0 && !o.SequentialWarmup {
-		warmup := errgroup{}
+	if warmup && !o.SequentialWarmup {
+		warmupGroup := errgroup{}
 		for i := range numThreads {
-			warmup.Go(func() error {
+			warmupGroup.Go(func() error {
 				code, dataLen, headerSize := httpstate[i].client.StreamFetch(ctx)
 				if !o.AllowInitialErrors && !codeIsOK(code) {
 					return fmt.Errorf("error %d for %s (%d bytes)", code, o.URL, dataLen)
@@ -191,7 +333,7 @@ func RunHTTPTest(o *HTTPRunnerOptions) (*HTTPRunnerResults, error) {
 				return nil
 			})
 		}
-		if err := warmup.Wait(); err != nil {
+		if err := warmupGroup.Wait(); err != nil {
 			return NewErrorResult(o, "warmup error", err), err
 		}
 	}
@@ -208,7 +350,14 @@ func RunHTTPTest(o *HTTPRunnerOptions) (*HTTPRunnerResults, error) {
 			log.Critf("Unable to start cpu profile: %v", err)
 		}
 	}
+	if o.MeasureThroughput {
+		start := time.Now()
+		for i := range numThreads {
+			httpstate[i].throughput.Restart(start)
+		}
+	}
 	total.RunnerResults = r.Run()
+	end := time.Now()
 	if o.Profiler != "" {
 		pprof.StopCPUProfile()
 		fc.Close()
@@ -226,16 +375,63 @@ func RunHTTPTest(o *HTTPRunnerOptions) (*HTTPRunnerResults, error) {
 	}
 	// Connection stats, aggregated
 	connectionStats := stats.NewHistogram(o.HTTPOptions.Offset.Seconds(), o.HTTPOptions.Resolution)
+	handshakeTime := connectionStats.Clone()
+	closeTime := connectionStats.Clone()
+	openConns := 0
 	// Numthreads may have reduced:
 	numThreads = total.RunnerResults.NumThreads
 	// But we also must cleanup all the created clients.
 	keys := []int{}
+	var h3handshake *stats.Histogram
+	if o.H3 {
+		total.H3 = &H3Stats{}
+		h3handshake = stats.NewHistogram(o.HTTPOptions.Offset.Seconds(), o.HTTPOptions.Resolution)
+	}
+	var attemptsPerRequest, attemptDuration *stats.Histogram
+	if o.Retry.Enabled() {
+		total.Retry = &RetryResults{RetriedCodes: make(map[int]int64)}
+		attemptsPerRequest = stats.NewHistogram(0, 1)
+		attemptDuration = stats.NewHistogram(o.HTTPOptions.Offset.Seconds(), o.HTTPOptions.Resolution)
+	}
+	if h2pool != nil && o.MeasureThroughput {
+		h2pool.Close() // now, for the retransmits of the shared connections.
+	}
 	fmt.Fprintf(out, "# Socket and IP used for each connection:\n")
 	for i := range numThreads {
+		var extraClients []Fetcher
+		if rt := httpstate[i].retrier; rt != nil {
+			extraClients = rt.close()
+			rt.transfer(total.Retry, attemptsPerRequest, attemptDuration)
+		}
+		if c, ok := httpstate[i].client.(*Client); ok && c.h3 != nil {
+			c.h3.addTo(total.H3, h3handshake)
+		}
 		// Get the report on the IP address each thread use to send traffic
 		occurrence, connStats := httpstate[i].client.GetIPAddress()
 		currentSocketUsed := connStats.Count
+		timer, hasTimer := httpstate[i].client.(connTimer)
+		if hasTimer {
+			openConns += timer.openConnections()
+		}
 		httpstate[i].client.Close()
+		if hasTimer {
+			timer.transferConnTimes(handshakeTime, closeTime)
+		}
+		// Plus the clients created for the hedged requests
+		for _, c := range extraClients {
+			extraOccurrence, extraStats := c.GetIPAddress()
+			extraOccurrence.AggregateAndToString(total.IPCountMap)
+			currentSocketUsed += extraStats.Count
+			connectionStats.Transfer(extraStats)
+			c.Close()
+			if t, ok := c.(connTimer); ok {
+				t.transferConnTimes(handshakeTime, closeTime)
+			}
+		}
+		// After closing the connections which adds their retransmits.
+		if tm := httpstate[i].throughput; tm != nil {
+			total.ConnThroughput = append(total.ConnThroughput, tm.Result(end))
+		}
 		// next 2 in 1 (long) line:
 		fmt.Fprintf(out, "[%d] %3d socket used, resolved to %s", i, currentSocketUsed, occurrence.AggregateAndToString(total.IPCountMap))
 		connStats.Counter.Print(out, ", connection timing")
@@ -249,6 +445,9 @@ func RunHTTPTest(o *HTTPRunnerOptions) (*HTTPRunnerResults, error) {
 			total.RetCodes[k] += httpstate[i].RetCodes[k]
 		}
 		total.sizes.Transfer(httpstate[i].sizes)
+		if streamTotal != nil {
+			streamTotal.transfer(httpstate[i].stream)
+		}
 		total.headerSizes.Transfer(httpstate[i].headerSizes)
 		connectionStats.Transfer(connStats)
 	}
@@ -258,6 +457,45 @@ func RunHTTPTest(o *HTTPRunnerOptions) (*HTTPRunnerResults, error) {
 	} else if log.Log(log.Warning) {
 		connectionStats.Counter.Print(out, "Connection time (s)")
 	}
+	if handshakeTime.Count > 0 {
+		total.HandshakeTime = handshakeTime.Export().CalcPercentiles(o.Percentiles)
+		if log.Log(log.Info) {
+			total.HandshakeTime.Print(out, "TLS handshake time histogram (s)")
+		}
+	}
+
+	if total.H3 != nil {
+		total.H3.HandshakeTime = h3handshake.Export().CalcPercentiles(o.Percentiles)
+		if log.Log(log.Info) {
+			total.H3.HandshakeTime.Print(out, "QUIC handshake time histogram (s)")
+		}
+		_, _ = fmt.Fprintf(out, "QUIC connections: %d, 0-RTT used: %d, packets sent: %d, lost/retransmitted: %d (%d bytes)\n",
+			total.H3.Connections, total.H3.Used0RTT, total.H3.PacketsSent, total.H3.PacketsLost, total.H3.BytesLost)
+	}
+	if h2pool != nil {
+		total.H2Connections = h2pool.Stats()
+		fmt.Fprintf(out, "# h2 streams for each connection:\n")
+		for i, cs := range total.H2Connections {
+			fmt.Fprintf(out, "[%d] %d streams, max %d active, %d connects, %d GOAWAY, %d RST_STREAM\n",
+				i, cs.Streams, cs.MaxActive, cs.Connects, cs.GoAway, cs.RstStream)
+			total.H2GoAway += cs.GoAway
+			total.H2RstStream += cs.RstStream
+		}
+		_, _ = fmt.Fprintf(out, "h2 connections: %d, GOAWAY received: %d, RST_STREAM received: %d\n",
+			len(total.H2Connections), total.H2GoAway, total.H2RstStream)
+	}
+
+	if total.Retry != nil {
+		if total.Retry.Requests > 0 {
+			total.Retry.ExtraLoad = 100. * float64(total.Retry.Attempts-total.Retry.Requests) / float64(total.Retry.Requests)
+		}
+		total.Retry.AttemptsPerRequest = attemptsPerRequest.Export().CalcPercentiles(o.Percentiles)
+		total.Retry.AttemptDuration = attemptDuration.Export().CalcPercentiles(o.Percentiles)
+		printRetryResults(out, total.Retry)
+	}
+	if streamTotal != nil {
+		total.Stream = streamTotal.results(o.StreamMode, total.ActualDuration, o.Percentiles, out)
+	}
 
 	// Sort the ip address form largest to smallest based on its usage count
 	ipList := make([]string, 0, len(total.IPCountMap))
@@ -274,6 +512,28 @@ func RunHTTPTest(o *HTTPRunnerOptions) (*HTTPRunnerResults, error) {
 	sort.Ints(keys)
 	totalCount := float64(total.DurationHistogram.Count)
 	_, _ = fmt.Fprintf(out, "Sockets used: %d (for perfect keepalive, would be %d)\n", total.SocketCount, r.Options().NumThreads)
+	total.ConnMode = o.ConnMode
+	if o.MeasureThroughput {
+		for i := range total.ConnThroughput {
+			total.ConnThroughput[i].Print(out, fmt.Sprintf("[%d] throughput", i))
+		}
+		aggregate := fnet.AggregateThroughput(total.ConnThroughput)
+		total.Throughput = &aggregate
+		total.Throughput.Print(out, "Throughput")
+	}
+	switch o.ConnMode {
+	case ConnModeChurn:
+		total.CloseTime = closeTime.Export().CalcPercentiles(o.Percentiles)
+		if log.Log(log.Info) {
+			total.CloseTime.Print(out, "Connection close time histogram (s)")
+		}
+		total.ConnectionsPerSec = float64(total.SocketCount) / total.ActualDuration.Seconds()
+		_, _ = fmt.Fprintf(out, "Connection churn: %.1f new connections per second\n", total.ConnectionsPerSec)
+	case ConnModeHold:
+		total.HeldConnections = openConns
+		_, _ = fmt.Fprintf(out, "Held connections: %d still open at the end out of %d, reconnections: %d\n",
+			total.HeldConnections, r.Options().NumThreads, max(0, total.SocketCount-int64(r.Options().NumThreads)))
+	}
 	_, _ = fmt.Fprintf(out, "Uniform: %t, Jitter: %t, Catchup allowed: %t\n", total.Uniform, total.Jitter, !total.NoCatchUp)
 	_, _ = fmt.Fprintf(out, "IP addresses distribution:\n")
 	for _, v := range ipList {
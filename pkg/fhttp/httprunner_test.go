@@ -549,6 +549,116 @@ func TestConnectionReuseRange(t *testing.T) {
 	}
 }
 
+func TestConnModes(t *testing.T) {
+	mux, addr := DynamicHTTPServer(false)
+	var requests atomic.Int64
+	mux.HandleFunc("/conn/", func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		EchoHandler(w, r)
+	})
+	for _, std := range []bool{false, true} {
+		opts := HTTPRunnerOptions{}
+		opts.URL = fmt.Sprintf("http://localhost:%d/conn/", addr.Port)
+		opts.QPS = -1
+		opts.NumThreads = 2
+		opts.Exactly = 6
+		opts.DisableFastClient = std
+		opts.ConnMode = ConnModeChurn
+		requests.Store(0)
+		res, err := RunHTTPTest(&opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.SocketCount != 6 || res.ConnectionsPerSec <= 0 || requests.Load() != 6 {
+			t.Errorf("std %v: expected a new connection per request in churn mode, got %d sockets, %g/s, %d requests",
+				std, res.SocketCount, res.ConnectionsPerSec, requests.Load())
+		}
+		if res.CloseTime == nil || res.CloseTime.Count == 0 || res.HandshakeTime != nil {
+			t.Errorf("std %v: expected close times and no TLS handshake in churn mode, got %+v %+v", std, res.CloseTime, res.HandshakeTime)
+		}
+		if opts.DisableKeepAlive {
+			t.Errorf("std %v: churn mode shouldn't change the options", std)
+		}
+		opts.ConnMode = ConnModeHold
+		requests.Store(0)
+		if res, err = RunHTTPTest(&opts); err != nil {
+			t.Fatal(err)
+		}
+		// The connections are established (with a warmup request each) before the exact number of calls.
+		if res.SocketCount != 2 || requests.Load() != 8 || res.ConnMode != ConnModeHold || res.HeldConnections != 2 {
+			t.Errorf("std %v: expected held connections, got %d sockets, %d requests, %d held",
+				std, res.SocketCount, requests.Load(), res.HeldConnections)
+		}
+		opts.ConnMode = "bogus"
+		if _, err = RunHTTPTest(&opts); err == nil {
+			t.Errorf("Expected error for invalid connection mode")
+		}
+	}
+}
+
+func TestHTTPRunnerThroughput(t *testing.T) {
+	mux, addr := DynamicHTTPServer(false)
+	mux.HandleFunc("/bulk/", EchoHandler)
+	for _, std := range []bool{false, true} {
+		opts := HTTPRunnerOptions{}
+		opts.URL = fmt.Sprintf("http://localhost:%d/bulk/?size=100000", addr.Port)
+		opts.QPS = -1
+		opts.NumThreads = 2
+		opts.Exactly = 10
+		opts.DisableFastClient = std
+		opts.Payload = make([]byte, 1000)
+		opts.MeasureThroughput = true
+		res, err := RunHTTPTest(&opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tp := res.Throughput
+		// Responses and uploads (the echo size can be capped by other tests changing the max payload size),
+		// plus the requests headers with the fast client.
+		expected := int64(res.Sizes.Sum) + 10*1000
+		if tp == nil || len(res.ConnThroughput) != 2 || (std && tp.Bytes != expected) || tp.Bytes < expected ||
+			tp.Mbps <= 0 || tp.Interval != 1 || len(tp.Intervals) != 1 {
+			t.Errorf("std %v: unexpected throughput %+v", std, tp)
+		}
+	}
+}
+
+func TestHTTPRunnerThroughputIntervals(t *testing.T) {
+	mux, addr := DynamicHTTPServer(false)
+	mux.HandleFunc("/slow/", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Length", "10000") // fits in the fast client buffer even when reduced by other tests.
+		for range 5 {
+			_, _ = w.Write(make([]byte, 2000))
+			w.(http.Flusher).Flush()
+			time.Sleep(100 * time.Millisecond)
+		}
+	})
+	for _, std := range []bool{false, true} {
+		opts := HTTPRunnerOptions{}
+		opts.URL = fmt.Sprintf("http://localhost:%d/slow/", addr.Port)
+		opts.QPS = -1
+		opts.NumThreads = 1
+		opts.Exactly = 1
+		opts.DisableFastClient = std
+		opts.MeasureThroughput = true
+		opts.ThroughputInterval = 100 * time.Millisecond
+		res, err := RunHTTPTest(&opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The bytes are in the intervals they were received in, not all in the one the request completed.
+		nonZero := 0
+		for _, v := range res.Throughput.Intervals {
+			if v > 0 {
+				nonZero++
+			}
+		}
+		if nonZero < 3 {
+			t.Errorf("std %v: expected the response spread over the intervals, got %v", std, res.Throughput.Intervals)
+		}
+	}
+}
+
 func TestValidateConnectionReuse(t *testing.T) {
 	httpOpts := HTTPOptions{}
 
@@ -676,3 +786,187 @@ func TestRunnerErrors(t *testing.T) {
 		t.Error("Expecting an error because of invalid url")
 	}
 }
+
+func TestHTTPRunnerH2FastClient(t *testing.T) {
+	mux, addr := DynamicHTTPServer(false)
+	mux.HandleFunc("/h2/", EchoHandler)
+	opts := HTTPRunnerOptions{}
+	opts.QPS = 200
+	opts.Exactly = 40
+	opts.NumThreads = 4
+	opts.URL = fmt.Sprintf("http://127.0.0.1:%d/h2/?delay=5ms", addr.Port)
+	opts.H2 = true
+	opts.H2MaxStreams = 2
+	opts.Payload = make([]byte, 100)
+	opts.MeasureThroughput = true
+	res, err := RunHTTPTest(&opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.RetCodes[http.StatusOK] != 40 {
+		t.Errorf("Expected 40 ok, got %v", res.RetCodes)
+	}
+	// Request and echoed bodies.
+	if res.Throughput == nil || res.Throughput.Bytes != 40*2*100 {
+		t.Errorf("Unexpected h2 throughput %+v", res.Throughput)
+	}
+	if len(res.H2Connections) != 2 {
+		t.Fatalf("Expected 2 h2 connections for 4 threads with 2 streams each, got %+v", res.H2Connections)
+	}
+	var streams int64
+	for i, cs := range res.H2Connections {
+		if cs.Connects != 1 {
+			t.Errorf("Expected 1 connect for connection %d: %+v", i, cs)
+		}
+		if cs.MaxActive < 1 || cs.MaxActive > 2 {
+			t.Errorf("Unexpected max active streams for connection %d: %+v", i, cs)
+		}
+		streams += cs.Streams
+	}
+	if streams != 40 {
+		t.Errorf("Expected 40 streams total, got %d", streams)
+	}
+	if res.SocketCount != 2 {
+		t.Errorf("Expected 2 sockets used, got %d", res.SocketCount)
+	}
+	if res.H2GoAway != 0 || res.H2RstStream != 0 {
+		t.Errorf("Unexpected GOAWAY/RST_STREAM %d %d", res.H2GoAway, res.H2RstStream)
+	}
+}
+
+// Compares the h2c fast client mode with the std client's (-h2 -stdclient), ie for allocs/op.
+func BenchmarkH2Client(b *testing.B) {
+	log.SetLogLevel(log.Warning)
+	mux, addr := DynamicHTTPServer(false)
+	mux.HandleFunc("/bench-h2/", EchoHandler)
+	for _, std := range []bool{false, true} {
+		name := "fast"
+		if std {
+			name = "std"
+		}
+		b.Run(name, func(b *testing.B) {
+			o := HTTPOptions{URL: fmt.Sprintf("http://localhost:%d/bench-h2/", addr.Port), H2: true, DisableFastClient: std}
+			client, err := NewClient(&o)
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer client.Close()
+			ctx := context.Background()
+			b.ReportAllocs()
+			for b.Loop() {
+				if code, _, _ := client.StreamFetch(ctx); code != http.StatusOK {
+					b.Fatalf("Unexpected code %d", code)
+				}
+			}
+		})
+	}
+}
+
+func TestH2FrameCounter(t *testing.T) {
+	var goAway, rst atomic.Int64
+	f := h2FrameCounter{goAway: &goAway, rstStream: &rst}
+	frames := []byte{
+		0, 0, 0, 4, 0, 0, 0, 0, 0, // empty SETTINGS
+		0, 0, 4, 3, 0, 0, 0, 0, 1, 0, 0, 0, 8, // RST_STREAM CANCEL
+		0, 0, 8, 7, 0, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, // GOAWAY
+	}
+	// byte by byte to exercise split headers and payloads.
+	for i := range frames {
+		f.scan(frames[i : i+1])
+	}
+	f.scan(frames)
+	if goAway.Load() != 2 || rst.Load() != 2 {
+		t.Errorf("Expected 2 GOAWAY and 2 RST_STREAM, got %d %d", goAway.Load(), rst.Load())
+	}
+}
+
+func TestHTTPRunnerStreamSSE(t *testing.T) {
+	mux, addr := DynamicHTTPServer(false)
+	mux.HandleFunc("/sse/", EchoHandler)
+	opts := HTTPRunnerOptions{}
+	opts.QPS = 100
+	opts.Exactly = 6
+	opts.NumThreads = 2
+	opts.URL = fmt.Sprintf("http://127.0.0.1:%d/sse/?sse=5&interval=2ms&size=20", addr.Port)
+	opts.StreamMode = StreamModeSSE
+	res, err := RunHTTPTest(&opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.RetCodes[http.StatusOK] != 6 {
+		t.Errorf("Expected 6 ok, got %v", res.RetCodes)
+	}
+	s := res.Stream
+	if s == nil {
+		t.Fatal("Missing stream results")
+	}
+	if s.Streams != 6 || s.Events != 30 || s.EmptyStreams != 0 {
+		t.Errorf("Expected 6 streams of 5 events, got %+v", s)
+	}
+	if s.FirstByte.Count != 6 || s.FirstEvent.Count != 6 || s.TotalStream.Count != 6 {
+		t.Errorf("Unexpected first byte/event/total counts %d %d %d", s.FirstByte.Count, s.FirstEvent.Count, s.TotalStream.Count)
+	}
+	if s.InterEvent.Count != 24 {
+		t.Errorf("Expected 24 inter event times, got %d", s.InterEvent.Count)
+	}
+	if s.InterEvent.Min < 0.0015 {
+		t.Errorf("Inter event time %g lower than the interval", s.InterEvent.Min)
+	}
+}
+
+func TestHTTPRunnerStreamNDJSON(t *testing.T) {
+	mux, addr := DynamicHTTPServer(false)
+	mux.HandleFunc("/ndjson/", EchoHandler)
+	opts := HTTPRunnerOptions{}
+	opts.QPS = 100
+	opts.Exactly = 3
+	opts.NumThreads = 1
+	opts.URL = fmt.Sprintf("http://127.0.0.1:%d/ndjson/?ndjson=4", addr.Port)
+	opts.StreamMode = StreamModeNDJSON
+	res, err := RunHTTPTest(&opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Stream == nil || res.Stream.Streams != 3 || res.Stream.Events != 12 {
+		t.Errorf("Expected 3 streams of 4 events, got %+v", res.Stream)
+	}
+	opts.StreamMode = "foo"
+	_, err = RunHTTPTest(&opts)
+	if err == nil {
+		t.Error("Expected error for invalid stream mode")
+	}
+}
+
+func TestStreamParser(t *testing.T) {
+	p := newStreamParser(StreamModeSSE, 0, 0.001)
+	_, _ = p.Write([]byte("ignored: before begin\n\n"))
+	p.begin()
+	for _, chunk := range []string{
+		": keep alive comment\n\n",
+		"retry: 100\n\n",
+		"id: 1\ndata: a\n",
+		"\n",
+		"data: multi\r\ndata: line\r\n\r\nev",
+		"ent: x\n\ndata: incomplete at end",
+	} {
+		_, _ = p.Write([]byte(chunk))
+	}
+	p.end(true)
+	if p.total != 3 || p.streams != 1 {
+		t.Errorf("Expected 3 sse events in 1 stream, got %d %d", p.total, p.streams)
+	}
+	n := newStreamParser(StreamModeNDJSON, 0, 0.001)
+	n.begin()
+	_, _ = n.Write([]byte("{\"a\":1}\n\n  \n{\"a\""))
+	_, _ = n.Write([]byte(":2}\n{\"no\":\"newline\"}"))
+	n.end(true)
+	if n.total != 3 {
+		t.Errorf("Expected 3 ndjson events, got %d", n.total)
+	}
+	n.begin()
+	_, _ = n.Write([]byte("{}\n"))
+	n.end(false)
+	if n.total != 3 || n.streams != 1 {
+		t.Errorf("Failed stream shouldn't be recorded, got %d %d", n.total, n.streams)
+	}
+}
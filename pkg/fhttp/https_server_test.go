@@ -48,7 +48,7 @@ func TestHTTPSServer(t *testing.T) {
 		t.Errorf("Failed to create server %v %v", m, a)
 	}
 	url := fmt.Sprintf("https://localhost:%d/debug", a.(*net.TCPAddr).Port)
-	// Triggers the h2->DisableFastClient normalization code too.
+	// Exercises the fast client h2 (over TLS) mode too.
 	o := HTTPOptions{URL: url, TLSOptions: TLSOptions{CACert: caCrt, Cert: cliCrt, Key: cliKey}, H2: true}
 	client, _ := NewClient(&o)
 	code, data, header := client.Fetch(context.Background())
@@ -84,6 +84,56 @@ func TestHTTPSServer(t *testing.T) {
 	}
 }
 
+func TestHTTPSConnChurn(t *testing.T) {
+	_, a := ServeTLS("0", "", &TLSOptions{Cert: svrCrt, Key: svrKey})
+	if a == nil {
+		t.Fatal("Failed to create server")
+	}
+	url := fmt.Sprintf("https://localhost:%d/echo?size=10", a.(*net.TCPAddr).Port)
+	for _, tst := range []struct{ std, h2 bool }{{false, false}, {true, false}, {true, true}} {
+		opts := HTTPRunnerOptions{}
+		opts.URL = url
+		opts.CACert = caCrt
+		opts.QPS = -1
+		opts.NumThreads = 2
+		opts.Exactly = 4
+		opts.DisableFastClient = tst.std
+		opts.H2 = tst.h2
+		opts.ConnMode = ConnModeChurn
+		res, err := RunHTTPTest(&opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.RetCodes[http.StatusOK] != 4 || res.HandshakeTime == nil || res.HandshakeTime.Count != 4 {
+			t.Errorf("%+v: expected a TLS handshake per request, got %v %+v", tst, res.RetCodes, res.HandshakeTime)
+		}
+		if res.CloseTime == nil || res.CloseTime.Count == 0 {
+			t.Errorf("%+v: expected close times, got %+v", tst, res.CloseTime)
+		}
+	}
+	// The clients multiplexing the requests on shared connections are refused.
+	for _, tst := range []struct {
+		url         string
+		std, h2, h3 bool
+	}{
+		{url, false, true, false},
+		{url, false, false, true},
+		{strings.Replace(url, "https://", "http://", 1), true, true, false},
+	} {
+		opts := HTTPRunnerOptions{}
+		opts.URL = tst.url
+		opts.CACert = caCrt
+		opts.Exactly = 4
+		opts.DisableFastClient = tst.std
+		opts.H2 = tst.h2
+		opts.H3 = tst.h3
+		opts.ConnMode = ConnModeChurn
+		if _, err := RunHTTPTest(&opts); err == nil || !strings.Contains(err.Error(), "churn") {
+			t.Errorf("%+v: expected churn mode to be refused, got %v", tst, err)
+		}
+	}
+}
+
 func TestHTTPSServerError(t *testing.T) {
 	_, addr := ServeTLS("0", "", tlsOptions)
 	port := fnet.GetPort(addr)
@@ -267,3 +317,47 @@ func TestGzipStreaming(t *testing.T) {
 		t.Fatalf("Expected first line to be 'line 0', got %q", lines[0])
 	}
 }
+
+func TestHTTP3Server(t *testing.T) {
+	m, a := ServeH3("0", "/debug", &TLSOptions{Cert: svrCrt, Key: svrKey})
+	if m == nil || a == nil {
+		t.Fatalf("Failed to create h3 server %v %v", m, a)
+	}
+	port := a.(*net.UDPAddr).Port
+	o := HTTPOptions{URL: fmt.Sprintf("https://localhost:%d/debug", port), TLSOptions: TLSOptions{CACert: caCrt}, H3: true}
+	client, err := NewClient(&o)
+	if err != nil {
+		t.Fatalf("Error creating h3 client: %v", err)
+	}
+	code, data, _ := client.Fetch(context.Background())
+	client.Close()
+	if code != http.StatusOK {
+		t.Errorf("Got %d instead of 200", code)
+	}
+	if !strings.Contains(string(data), "HTTP/3.0") {
+		t.Errorf("Missing HTTP/3.0 in body: %s", data)
+	}
+	// Runner mode
+	opts := HTTPRunnerOptions{}
+	opts.QPS = 100
+	opts.Exactly = 10
+	opts.NumThreads = 2
+	opts.URL = fmt.Sprintf("https://localhost:%d/echo?status=200", port)
+	opts.CACert = caCrt
+	opts.H3 = true
+	res, err := RunHTTPTest(&opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.RetCodes[http.StatusOK] != 10 {
+		t.Errorf("Expected 10 ok, got %v", res.RetCodes)
+	}
+	if res.H3 == nil || res.H3.Connections != 2 || res.H3.HandshakeTime.Count != 2 {
+		t.Errorf("Unexpected h3 stats %+v", res.H3)
+	}
+	// No h3 on http://
+	o = HTTPOptions{URL: fmt.Sprintf("http://localhost:%d/", port), H3: true}
+	if _, err = NewClient(&o); err == nil {
+		t.Errorf("Expected error for h3 on http:// url")
+	}
+}
@@ -0,0 +1,255 @@
+// Copyright 2026 Fortio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fhttp
+
+import (
+	"container/list"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"fortio.org/dflag"
+	"fortio.org/fortio/pkg/log"
+	"fortio.org/fortio/pkg/metrics"
+)
+
+// FaultArgRateLimit is the echo query arg emulating a rate limited API: "rate[:burst[:key]]" with rate
+// in requests per second, burst (default the rate rounded up) the size of the token bucket and key
+// one of "global" (default), "ip" (per client IP) or "header.Name" (per value of the Name header, ie
+// an API key). Requests over the limit get a 429 with Retry-After and RateLimit-* headers.
+const FaultArgRateLimit = "ratelimit"
+
+// Rate limiting keys.
+const (
+	RateLimitGlobal = "global"
+	RateLimitIP     = "ip"
+	RateLimitHeader = "header." // followed by the header name.
+)
+
+// maxRateLimitBuckets is how many buckets (ie client IPs) a limiter keeps, the least recently used ones are
+// forgotten beyond that (so a client varying its key only ever gets a new, full, bucket).
+const maxRateLimitBuckets = 10000
+
+// maxRateLimiters is how many different specs are kept before forgetting them all.
+const maxRateLimiters = 1000
+
+// RateLimitSpec is a parsed ratelimit value.
+type RateLimitSpec struct {
+	Rate  float64 // requests per second.
+	Burst int
+	Key   string // RateLimitGlobal, RateLimitIP or RateLimitHeader followed by the header name.
+}
+
+func (s *RateLimitSpec) String() string {
+	return strconv.FormatFloat(s.Rate, 'g', -1, 64) + ":" + strconv.Itoa(s.Burst) + ":" + s.Key
+}
+
+// ParseRateLimit parses "rate[:burst[:key]]", ie "10", "0.5:2", "100:200:ip" or "5:5:header.X-Api-Key".
+// Returns nil for an empty spec.
+func ParseRateLimit(spec string) (*RateLimitSpec, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, nil //nolint:nilnil // no rate limit.
+	}
+	parts := strings.SplitN(spec, ":", 3)
+	rate, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil || rate <= 0 || math.IsInf(rate, 0) {
+		return nil, fmt.Errorf("invalid rate limit %q: rate must be a positive number of requests per second", spec)
+	}
+	res := &RateLimitSpec{Rate: rate, Burst: int(math.Ceil(rate)), Key: RateLimitGlobal}
+	if len(parts) > 1 && parts[1] != "" {
+		res.Burst, err = strconv.Atoi(parts[1])
+		if err != nil || res.Burst < 1 {
+			return nil, fmt.Errorf("invalid rate limit %q: burst must be a positive integer", spec)
+		}
+	}
+	if len(parts) > 2 {
+		res.Key = parts[2]
+		switch {
+		case res.Key == RateLimitGlobal, res.Key == RateLimitIP:
+		case strings.HasPrefix(res.Key, RateLimitHeader) && len(res.Key) > len(RateLimitHeader):
+		default:
+			return nil, fmt.Errorf("invalid rate limit %q: key must be %s, %s or %sName", spec,
+				RateLimitGlobal, RateLimitIP, RateLimitHeader)
+		}
+	}
+	return res, nil
+}
+
+// tokenBucket is the state of one rate limited client (or of all of them for the global key).
+type tokenBucket struct {
+	key    string
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter is the token buckets of one spec.
+type rateLimiter struct {
+	spec    RateLimitSpec
+	mu      sync.Mutex
+	buckets map[string]*list.Element // of *tokenBucket in lru.
+	lru     list.List                // most recently used first.
+}
+
+func newRateLimiter(spec *RateLimitSpec) *rateLimiter {
+	return &rateLimiter{spec: *spec, buckets: make(map[string]*list.Element)}
+}
+
+// rateLimitResult is the outcome of taking a token, used for the reply headers.
+type rateLimitResult struct {
+	allowed    bool
+	remaining  int
+	retryAfter time.Duration // time until the next token, when not allowed.
+	reset      time.Duration // time until the bucket is full again.
+}
+
+// refill adds the tokens accumulated since the last update.
+func (rl *rateLimiter) refill(b *tokenBucket, now time.Time) {
+	b.tokens = min(float64(rl.spec.Burst), b.tokens+now.Sub(b.last).Seconds()*rl.spec.Rate)
+	b.last = now
+}
+
+func (rl *rateLimiter) seconds(tokens float64) time.Duration {
+	return time.Duration(tokens / rl.spec.Rate * float64(time.Second))
+}
+
+// take takes a token from the key's bucket, if there is one.
+func (rl *rateLimiter) take(key string, now time.Time) rateLimitResult {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	e := rl.buckets[key]
+	if e == nil {
+		if len(rl.buckets) >= maxRateLimitBuckets {
+			rl.evict()
+		}
+		e = rl.lru.PushFront(&tokenBucket{key: key, tokens: float64(rl.spec.Burst), last: now})
+		rl.buckets[key] = e
+	} else {
+		rl.lru.MoveToFront(e)
+	}
+	b := e.Value.(*tokenBucket)
+	rl.refill(b, now)
+	res := rateLimitResult{}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.allowed = true
+	} else {
+		res.retryAfter = rl.seconds(1 - b.tokens)
+	}
+	res.remaining = int(b.tokens)
+	res.reset = rl.seconds(float64(rl.spec.Burst) - b.tokens)
+	return res
+}
+
+// evict forgets the least recently used bucket.
+func (rl *rateLimiter) evict() {
+	b := rl.lru.Remove(rl.lru.Back()).(*tokenBucket)
+	delete(rl.buckets, b.key)
+	log.Debugf("Rate limiter %s evicted bucket %q", rl.spec.String(), b.key)
+}
+
+var (
+	rateLimitersMu sync.Mutex
+	rateLimiters   = make(map[string]*rateLimiter)
+	// EchoRateLimit is the rate limit applied to the echo requests without a ratelimit query arg.
+	EchoRateLimit = dflag.New("",
+		"Echo server rate limit \"rate[:burst[:key]]\" (key global, ip or header.Name), "+
+			"ie \"10:20:ip\", requests over it get a 429").WithValidator(validateRateLimit)
+	echoRateLimited = metrics.NewCounterVec("fortio_http_server_ratelimit_requests_total",
+		"Echo requests subject to rate limiting, by server and result (allowed or limited)", "server", "result")
+)
+
+func validateRateLimit(spec string) error {
+	_, err := ParseRateLimit(spec)
+	return err
+}
+
+// getRateLimiter returns the (shared) limiter for the spec.
+func getRateLimiter(spec *RateLimitSpec) *rateLimiter {
+	id := spec.String()
+	rateLimitersMu.Lock()
+	defer rateLimitersMu.Unlock()
+	rl := rateLimiters[id]
+	if rl == nil {
+		if len(rateLimiters) >= maxRateLimiters {
+			log.Warnf("Too many (%d) different rate limits, resetting them all", len(rateLimiters))
+			clear(rateLimiters)
+		}
+		rl = newRateLimiter(spec)
+		rateLimiters[id] = rl
+	}
+	return rl
+}
+
+// rateLimitKey returns the bucket key of the request for the spec's key.
+func rateLimitKey(key string, r *http.Request) string {
+	switch {
+	case key == RateLimitIP:
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			return r.RemoteAddr
+		}
+		return host
+	case strings.HasPrefix(key, RateLimitHeader):
+		return r.Header.Get(key[len(RateLimitHeader):])
+	default:
+		return ""
+	}
+}
+
+// ceilSeconds is the header value of a duration, in whole seconds rounded up.
+func ceilSeconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
+
+// handleRateLimit applies the ratelimit query arg (or EchoRateLimit) to the request, sets the RateLimit-*
+// headers and replies 429 when over the limit. Returns true when the request was rejected.
+func handleRateLimit(w http.ResponseWriter, r *http.Request) bool {
+	specStr := QueryArg(r, FaultArgRateLimit)
+	if specStr == "" {
+		specStr = EchoRateLimit.Get()
+		if specStr == "" {
+			return false
+		}
+	}
+	spec, err := ParseRateLimit(specStr)
+	if err != nil {
+		log.Warnf("Ignoring %v", err)
+		return false
+	}
+	rl := getRateLimiter(spec)
+	res := rl.take(rateLimitKey(spec.Key, r), time.Now())
+	h := w.Header()
+	h.Set("RateLimit-Limit", strconv.Itoa(spec.Burst))
+	h.Set("RateLimit-Remaining", strconv.Itoa(res.remaining))
+	h.Set("RateLimit-Reset", ceilSeconds(res.reset))
+	h.Set("RateLimit-Policy", strconv.Itoa(spec.Burst)+";w="+ceilSeconds(rl.seconds(float64(spec.Burst))))
+	if res.allowed {
+		echoRateLimited.Inc(EchoServerName, "allowed")
+		return false
+	}
+	echoRateLimited.Inc(EchoServerName, "limited")
+	echoFault(FaultArgRateLimit)
+	retryAfter := ceilSeconds(res.retryAfter)
+	log.LogVf("Rate limited %v (%s), retry after %ss", r.URL, spec.String(), retryAfter)
+	h.Set("Retry-After", retryAfter)
+	http.Error(w, "Too many requests, retry after "+retryAfter+"s", http.StatusTooManyRequests)
+	return true
+}
@@ -0,0 +1,138 @@
+// Copyright 2026 Fortio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fhttp
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	tests := []struct {
+		spec     string
+		expected string
+	}{
+		{"10", "10:10:global"},
+		{"0.5", "0.5:1:global"},
+		{" 2.5:7 ", "2.5:7:global"},
+		{"100::ip", "100:100:ip"},
+		{"5:5:header.X-Api-Key", "5:5:header.X-Api-Key"},
+	}
+	for _, tst := range tests {
+		s, err := ParseRateLimit(tst.spec)
+		if err != nil || s.String() != tst.expected {
+			t.Errorf("ParseRateLimit(%q) = %v, %v, expected %s", tst.spec, s, err, tst.expected)
+		}
+	}
+	if s, err := ParseRateLimit(""); s != nil || err != nil {
+		t.Errorf("Expected no rate limit for empty spec, got %v %v", s, err)
+	}
+	for _, bad := range []string{"x", "0", "-1", "+Inf", "1:0", "1:x", "1:1:nope", "1:1:header."} {
+		if _, err := ParseRateLimit(bad); err == nil {
+			t.Errorf("Expected error for %q", bad)
+		}
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	rl := newRateLimiter(&RateLimitSpec{Rate: 2, Burst: 3})
+	now := time.Now()
+	for i := range 3 {
+		if res := rl.take("a", now); !res.allowed || res.remaining != 2-i {
+			t.Errorf("Expected burst request %d to be allowed, got %+v", i, res)
+		}
+	}
+	res := rl.take("a", now)
+	if res.allowed || res.retryAfter != 500*time.Millisecond || res.reset != 1500*time.Millisecond {
+		t.Errorf("Expected limited request, got %+v", res)
+	}
+	if res = rl.take("b", now); !res.allowed {
+		t.Errorf("Expected other key to have its own bucket, got %+v", res)
+	}
+	if res = rl.take("a", now.Add(500*time.Millisecond)); !res.allowed || res.remaining != 0 {
+		t.Errorf("Expected refilled token, got %+v", res)
+	}
+	// Varying keys: capped, forgetting the least recently used buckets (even not full ones).
+	for i := range maxRateLimitBuckets + 10 {
+		rl.take(strconv.Itoa(i), now)
+		if i == maxRateLimitBuckets/2 {
+			rl.take("a", now)
+		}
+	}
+	if len(rl.buckets) != maxRateLimitBuckets || rl.lru.Len() != maxRateLimitBuckets {
+		t.Errorf("Expected %d buckets, got %d (%d)", maxRateLimitBuckets, len(rl.buckets), rl.lru.Len())
+	}
+	if rl.buckets["b"] != nil || rl.buckets["0"] != nil || rl.buckets["a"] == nil {
+		t.Errorf("Expected the least recently used buckets to be evicted")
+	}
+}
+
+func TestEchoRateLimit(t *testing.T) {
+	mux, addr := ServeTCP("0", "")
+	if mux == nil {
+		t.Fatal("Unable to start server")
+	}
+	get := func(path, apiKey string) *http.Response {
+		req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("http://localhost:%d%s", addr.Port, path), nil)
+		if apiKey != "" {
+			req.Header.Set("X-Api-Key", apiKey)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+	limited := echoRateLimited.Value(EchoServerName, "limited")
+	path := "/foo?ratelimit=0.1:2:header.X-Api-Key"
+	for i := range 2 {
+		if resp := get(path, "k1"); resp.StatusCode != http.StatusOK || resp.Header.Get("RateLimit-Remaining") != fmt.Sprint(1-i) {
+			t.Errorf("Expected request %d within the burst, got %d %v", i, resp.StatusCode, resp.Header)
+		}
+	}
+	resp := get(path, "k1")
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") != "10" ||
+		resp.Header.Get("RateLimit-Limit") != "2" || resp.Header.Get("RateLimit-Reset") != "20" ||
+		resp.Header.Get("RateLimit-Policy") != "2;w=20" {
+		t.Errorf("Expected 429 with rate limit headers, got %d %v", resp.StatusCode, resp.Header)
+	}
+	if resp = get(path, "k2"); resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected other api key not to be limited, got %d", resp.StatusCode)
+	}
+	if v := echoRateLimited.Value(EchoServerName, "limited"); v != limited+1 {
+		t.Errorf("Expected 1 more limited request in the metrics, got %d", v-limited)
+	}
+	// Server wide limit, per ip.
+	if err := EchoRateLimit.Set("0.1:1:ip"); err != nil {
+		t.Fatal(err)
+	}
+	defer EchoRateLimit.Set("")
+	if resp = get("/bar", ""); resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected first request allowed, got %d", resp.StatusCode)
+	}
+	if resp = get("/bar", ""); resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("Expected second request limited by the flag, got %d", resp.StatusCode)
+	}
+	if resp = get("/bar?status=202", ""); resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("Expected rate limit before the status, got %d", resp.StatusCode)
+	}
+	if err := EchoRateLimit.Set("bad"); err == nil {
+		t.Errorf("Expected error for invalid rate limit flag")
+	}
+}
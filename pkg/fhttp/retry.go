@@ -0,0 +1,385 @@
+// Copyright 2026 Fortio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fhttp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"fortio.org/fortio/pkg/log"
+	"fortio.org/fortio/pkg/stats"
+)
+
+// DefaultRetryOn are the codes retried when RetryOptions.RetryOn is empty: socket errors, 429 and 502 to 504.
+var DefaultRetryOn = []int{SocketError, http.StatusTooManyRequests, http.StatusBadGateway,
+	http.StatusServiceUnavailable, http.StatusGatewayTimeout}
+
+// maxSpareClients is how many idle clients a thread keeps for hedging, extra ones are closed.
+const maxSpareClients = 16
+
+// RetryOptions is the (opt-in) client side retry and hedging policy of the HTTP runner, to measure
+// the user visible effect of such policies and the extra load they generate.
+type RetryOptions struct {
+	// MaxAttempts is the maximum number of attempts per request including the first one, <= 1 for no retries.
+	MaxAttempts int
+	// Backoff before the first retry, doubled for each subsequent one (up to MaxBackoff when set).
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Jitter is the fraction (0 to 1) of each backoff which is randomly removed, 1 being "full jitter".
+	Jitter float64
+	// RetryOn are the status codes (-1 for socket errors) to retry, DefaultRetryOn when empty.
+	RetryOn []int
+	// RespectRetryAfter waits (at least) the Retry-After of the response before retrying.
+	RespectRetryAfter bool
+	// HedgeDelay, when > 0, sends a second (hedged) request if the first one isn't done after that
+	// delay and takes the first success.
+	HedgeDelay time.Duration
+}
+
+// Enabled is true when either retries or hedging are configured.
+func (ro *RetryOptions) Enabled() bool {
+	return ro.MaxAttempts > 1 || ro.HedgeDelay > 0
+}
+
+// Validate checks the options.
+func (ro *RetryOptions) Validate() error {
+	if ro.Jitter < 0 || ro.Jitter > 1 {
+		return fmt.Errorf("retry jitter %g must be between 0 and 1", ro.Jitter)
+	}
+	if ro.Backoff < 0 || ro.MaxBackoff < 0 || ro.HedgeDelay < 0 {
+		return fmt.Errorf("retry backoffs and hedge delay can't be negative")
+	}
+	return nil
+}
+
+// ParseRetryOn parses a comma separated list of status codes, ie "503,429,-1".
+func ParseRetryOn(codes string) ([]int, error) {
+	var res []int
+	for c := range strings.SplitSeq(codes, ",") {
+		c = strings.TrimSpace(c)
+		if c == "" {
+			continue
+		}
+		code, err := strconv.Atoi(c)
+		if err != nil {
+			return nil, fmt.Errorf("invalid retry on code %q: %w", c, err)
+		}
+		res = append(res, code)
+	}
+	return res, nil
+}
+
+// RetryResults are the retry and hedging stats of a run. The DurationHistogram of the run is the
+// final (user visible) latency, including the retries, backoffs and hedging.
+type RetryResults struct {
+	// Requests is the number of logical requests (calls), Attempts the number of requests actually sent
+	// including the retries and the hedged requests.
+	Requests int64
+	Attempts int64
+	Retries  int64
+	Hedges   int64
+	// HedgeWins is how many times the result of the hedged request was the one used.
+	HedgeWins int64
+	// RetriedCodes are the codes (-1 for socket errors) which triggered a retry.
+	RetriedCodes map[int]int64
+	// ExtraLoad is the percentage of extra requests sent to the server, over the logical ones.
+	ExtraLoad          float64
+	AttemptsPerRequest *stats.HistogramData
+	// AttemptDuration is the latency of each individual attempt.
+	AttemptDuration *stats.HistogramData
+}
+
+// retryAfterer is implemented by the clients which can report the Retry-After of their last response.
+type retryAfterer interface {
+	retryAfter() time.Duration
+}
+
+// parseRetryAfter parses a Retry-After header value (seconds or HTTP date), 0 when absent or invalid.
+func parseRetryAfter(v string) time.Duration {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Duration(max(0, secs)) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(0, time.Until(t))
+	}
+	return 0
+}
+
+// attemptResult is the outcome of one attempt (StreamFetch), sent counts the requests sent for it.
+type attemptResult struct {
+	code       int
+	size       int64
+	headerSize uint
+	retryAfter time.Duration
+	hedge      bool
+	sent       int
+}
+
+// retrier applies the RetryOptions for one thread. With hedging, the clients (the thread's one and
+// the ones created as needed for the hedged requests) are used from the spare pool as the loser of a
+// hedge can still be running when the next request starts.
+type retrier struct {
+	RetryOptions
+	opts    HTTPOptions // to create the extra clients
+	stop    chan struct{}
+	client  Fetcher
+	spare   chan Fetcher
+	pending sync.WaitGroup
+	// updated by the attempts goroutines:
+	mu              sync.Mutex
+	extra           []Fetcher
+	attempts        int64
+	attemptDuration *stats.Histogram
+	// only updated by the thread:
+	requests           int64
+	retries            int64
+	hedges             int64
+	hedgeWins          int64
+	retriedCodes       map[int]int64
+	attemptsPerRequest *stats.Histogram
+}
+
+func newRetrier(ro *RetryOptions, o *HTTPOptions, client Fetcher, stop chan struct{}) *retrier {
+	r := &retrier{
+		RetryOptions:       *ro,
+		opts:               *o,
+		stop:               stop,
+		client:             client,
+		retriedCodes:       make(map[int]int64),
+		attemptDuration:    stats.NewHistogram(o.Offset.Seconds(), o.Resolution),
+		attemptsPerRequest: stats.NewHistogram(0, 1),
+	}
+	if len(r.RetryOn) == 0 {
+		r.RetryOn = DefaultRetryOn
+	}
+	r.opts.DataWriter = nil // can't share the writer with concurrent hedged requests.
+	if r.HedgeDelay > 0 {
+		r.spare = make(chan Fetcher, maxSpareClients)
+		r.spare <- abortable(client)
+	}
+	return r
+}
+
+// abortable makes the fast clients stop the request in progress when its context is canceled,
+// the other clients always do.
+func abortable(c Fetcher) Fetcher {
+	if fc, ok := c.(*FastClient); ok {
+		fc.abortOnCancel = true
+	}
+	return c
+}
+
+// get returns an idle client, creating a new one if needed.
+func (r *retrier) get() Fetcher {
+	select {
+	case c := <-r.spare:
+		return c
+	default:
+	}
+	c, err := NewClient(&r.opts)
+	if err != nil {
+		log.S(log.Error, "Unable to create hedging client", log.Attr("err", err), log.Attr("thread", r.opts.ID))
+		return nil
+	}
+	r.mu.Lock()
+	r.extra = append(r.extra, c)
+	r.mu.Unlock()
+	return abortable(c)
+}
+
+// put returns a client to the spare pool, closing it if the pool is full.
+func (r *retrier) put(c Fetcher) {
+	select {
+	case r.spare <- c:
+	default:
+		c.Close()
+	}
+}
+
+// attempt sends one request with the client.
+func (r *retrier) attempt(ctx context.Context, c Fetcher, hedge bool) attemptResult {
+	res := attemptResult{code: SocketError, hedge: hedge, sent: 1}
+	if c == nil {
+		return res
+	}
+	start := time.Now()
+	res.code, res.size, res.headerSize = c.StreamFetch(ctx)
+	d := time.Since(start)
+	if ra, ok := c.(retryAfterer); ok {
+		res.retryAfter = ra.retryAfter()
+	}
+	r.mu.Lock()
+	r.attempts++
+	r.attemptDuration.Record(d.Seconds())
+	r.mu.Unlock()
+	return res
+}
+
+// launch starts an attempt in the background, its result is sent to results.
+func (r *retrier) launch(ctx context.Context, results chan<- attemptResult, hedge bool) {
+	c := r.get()
+	r.pending.Add(1)
+	go func() {
+		defer r.pending.Done()
+		res := r.attempt(ctx, c, hedge)
+		if c != nil {
+			r.put(c)
+		}
+		results <- res
+	}()
+}
+
+// try does one (possibly hedged) attempt. The request still in flight when a result is taken
+// (the loser of the hedge) is canceled.
+func (r *retrier) try(ctx context.Context) attemptResult {
+	if r.HedgeDelay <= 0 {
+		return r.attempt(ctx, r.client, false)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make(chan attemptResult, 2)
+	r.launch(ctx, results, false)
+	timer := time.NewTimer(r.HedgeDelay)
+	defer timer.Stop()
+	inflight, sent := 1, 1
+	for {
+		select {
+		case res := <-results:
+			inflight--
+			if codeIsOK(res.code) || inflight == 0 {
+				if res.hedge && codeIsOK(res.code) {
+					r.hedgeWins++
+				}
+				res.sent = sent
+				return res
+			}
+		case <-timer.C:
+			log.Debugf("[%d] Hedging after %v", r.opts.ID, r.HedgeDelay)
+			r.hedges++
+			inflight++
+			sent++
+			r.launch(ctx, results, true)
+		}
+	}
+}
+
+// backoff returns how long to wait before the retry following the given attempt number (1 based).
+func (r *retrier) backoff(attempt int, retryAfter time.Duration) time.Duration {
+	shift := min(attempt-1, 62)
+	d := r.Backoff << shift
+	if d>>shift != r.Backoff { // overflow
+		d = math.MaxInt64
+	}
+	if r.MaxBackoff > 0 {
+		d = min(d, r.MaxBackoff)
+	}
+	if r.Jitter > 0 {
+		d -= time.Duration(rand.Float64() * r.Jitter * float64(d)) //nolint:gosec // we want fast not crypto
+	}
+	if r.RespectRetryAfter && retryAfter > d {
+		d = retryAfter
+	}
+	return d
+}
+
+// sleep waits for d, returns false if the run was stopped meanwhile.
+func (r *retrier) sleep(d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-r.stop:
+		return false
+	}
+}
+
+// fetch is the StreamFetch with retries and hedging.
+func (r *retrier) fetch(ctx context.Context) (int, int64, uint) {
+	r.requests++
+	var res attemptResult
+	sent := 0
+	for attempt := 1; ; attempt++ {
+		res = r.try(ctx)
+		sent += res.sent
+		if codeIsOK(res.code) || attempt >= r.MaxAttempts || !slices.Contains(r.RetryOn, res.code) {
+			break
+		}
+		r.retries++
+		r.retriedCodes[res.code]++
+		wait := r.backoff(attempt, res.retryAfter)
+		log.Debugf("[%d] Retrying code %d after %v (attempt %d)", r.opts.ID, res.code, wait, attempt)
+		if !r.sleep(wait) {
+			break
+		}
+	}
+	r.attemptsPerRequest.Record(float64(sent))
+	return res.code, res.size, res.headerSize
+}
+
+// close waits for the in flight hedged requests and returns the extra clients created, to be closed
+// by the caller (after getting their stats).
+func (r *retrier) close() []Fetcher {
+	r.pending.Wait()
+	return r.extra
+}
+
+// transfer adds the thread stats to the total.
+func (r *retrier) transfer(total *RetryResults, attemptsPerRequest, attemptDuration *stats.Histogram) {
+	total.Requests += r.requests
+	total.Attempts += r.attempts
+	total.Retries += r.retries
+	total.Hedges += r.hedges
+	total.HedgeWins += r.hedgeWins
+	for k, v := range r.retriedCodes {
+		total.RetriedCodes[k] += v
+	}
+	attemptsPerRequest.Transfer(r.attemptsPerRequest)
+	attemptDuration.Transfer(r.attemptDuration)
+}
+
+// printRetryResults prints the retry and hedging summary.
+func printRetryResults(out io.Writer, rr *RetryResults) {
+	_, _ = fmt.Fprintf(out, "Retries: %d requests, %d attempts (%.1f %% extra load), %d retries, %d hedged (%d won)\n",
+		rr.Requests, rr.Attempts, rr.ExtraLoad, rr.Retries, rr.Hedges, rr.HedgeWins)
+	codes := make([]int, 0, len(rr.RetriedCodes))
+	for k := range rr.RetriedCodes {
+		codes = append(codes, k)
+	}
+	slices.Sort(codes)
+	for _, k := range codes {
+		_, _ = fmt.Fprintf(out, "Retried code %3d : %d\n", k, rr.RetriedCodes[k])
+	}
+	if log.LogVerbose() {
+		rr.AttemptsPerRequest.Print(out, "Attempts per request histogram")
+		rr.AttemptDuration.Print(out, "Individual attempt duration histogram (s)")
+	}
+}
@@ -0,0 +1,195 @@
+// Copyright 2026 Fortio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fhttp
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseRetryOn(t *testing.T) {
+	codes, err := ParseRetryOn(" 503, 429,-1,")
+	if err != nil || !slices.Equal(codes, []int{503, 429, -1}) {
+		t.Errorf("Unexpected codes %v %v", codes, err)
+	}
+	if _, err = ParseRetryOn("503,x"); err == nil {
+		t.Errorf("Expected error for invalid code")
+	}
+	if d := parseRetryAfter(" 3 "); d != 3*time.Second {
+		t.Errorf("Unexpected Retry-After seconds %v", d)
+	}
+	if d := parseRetryAfter(time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)); d < 59*time.Minute || d > time.Hour {
+		t.Errorf("Unexpected Retry-After date %v", d)
+	}
+	if d := parseRetryAfter("soon"); d != 0 {
+		t.Errorf("Unexpected Retry-After for invalid value %v", d)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	r := &retrier{RetryOptions: RetryOptions{Backoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond}}
+	for attempt, expected := range []time.Duration{10, 20, 40, 50, 50} {
+		if d := r.backoff(attempt+1, 0); d != expected*time.Millisecond {
+			t.Errorf("Backoff for attempt %d is %v, expected %v", attempt+1, d, expected*time.Millisecond)
+		}
+	}
+	if d := r.backoff(100, 0); d != 50*time.Millisecond {
+		t.Errorf("Backoff for large attempt %v", d)
+	}
+	if d := r.backoff(1, time.Second); d != 10*time.Millisecond {
+		t.Errorf("Retry-After shouldn't be used unless respected, got %v", d)
+	}
+	r.RespectRetryAfter = true
+	if d := r.backoff(1, time.Second); d != time.Second {
+		t.Errorf("Expected Retry-After to be respected, got %v", d)
+	}
+	r.Jitter = 1
+	for range 20 {
+		if d := r.backoff(2, 0); d < 0 || d > 20*time.Millisecond {
+			t.Errorf("Jittered backoff %v out of range", d)
+		}
+	}
+	// No MaxBackoff: clamped instead of overflowing.
+	r = &retrier{RetryOptions: RetryOptions{Backoff: time.Hour}}
+	for _, attempt := range []int{30, 40, 100} {
+		if d := r.backoff(attempt, 0); d != math.MaxInt64 {
+			t.Errorf("Backoff for attempt %d overflowed: %v", attempt, d)
+		}
+	}
+}
+
+func TestHTTPRunnerRetries(t *testing.T) {
+	mux, addr := DynamicHTTPServer(false)
+	mux.HandleFunc("/retry/", EchoHandler)
+	for _, std := range []bool{false, true} {
+		opts := HTTPRunnerOptions{}
+		opts.QPS = -1
+		opts.Exactly = 4
+		opts.NumThreads = 2
+		opts.DisableFastClient = std
+		opts.URL = fmt.Sprintf("http://127.0.0.1:%d/retry/?status=503", addr.Port)
+		opts.Retry = RetryOptions{MaxAttempts: 3, Backoff: time.Millisecond}
+		res, err := RunHTTPTest(&opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := res.Retry
+		if res.RetCodes[http.StatusServiceUnavailable] != 4 || r == nil || r.Requests != 4 || r.Attempts != 12 ||
+			r.Retries != 8 || r.RetriedCodes[http.StatusServiceUnavailable] != 8 || r.ExtraLoad != 200 {
+			t.Errorf("std %v: unexpected retry results %v %+v", std, res.RetCodes, r)
+		}
+		if r.AttemptsPerRequest.Count != 4 || r.AttemptsPerRequest.Avg != 3 || r.AttemptDuration.Count != 12 {
+			t.Errorf("std %v: unexpected retry histograms %+v %+v", std, r.AttemptsPerRequest, r.AttemptDuration)
+		}
+		// Not retried codes.
+		opts.Retry.RetryOn = []int{http.StatusTooManyRequests}
+		res, err = RunHTTPTest(&opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Retry.Attempts != 4 || res.Retry.Retries != 0 {
+			t.Errorf("std %v: expected no retries for 503 when only retrying 429, got %+v", std, res.Retry)
+		}
+		// Retry-After respected.
+		opts.Exactly = 1
+		opts.NumThreads = 1
+		opts.URL = fmt.Sprintf("http://127.0.0.1:%d/retry/?throttle=429&retry-after=1", addr.Port)
+		opts.Retry = RetryOptions{MaxAttempts: 2, RespectRetryAfter: true}
+		start := time.Now()
+		res, err = RunHTTPTest(&opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d := time.Since(start); d < time.Second || res.Retry.Retries != 1 || res.DurationHistogram.Min < 1 {
+			t.Errorf("std %v: expected Retry-After of 1s to be respected, took %v %+v", std, d, res.Retry)
+		}
+	}
+}
+
+func TestHTTPRunnerHedging(t *testing.T) {
+	mux, addr := DynamicHTTPServer(false)
+	mux.HandleFunc("/hedge/", EchoHandler)
+	opts := HTTPRunnerOptions{}
+	opts.QPS = -1
+	opts.Exactly = 3
+	opts.NumThreads = 1
+	opts.URL = fmt.Sprintf("http://127.0.0.1:%d/hedge/?delay=100ms", addr.Port)
+	opts.Retry = RetryOptions{HedgeDelay: 20 * time.Millisecond}
+	res, err := RunHTTPTest(&opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := res.Retry
+	if res.RetCodes[http.StatusOK] != 3 || r.Requests != 3 || r.Hedges != 3 || r.Attempts != 6 || r.ExtraLoad != 100 {
+		t.Errorf("Expected every slow request to be hedged, got %v %+v", res.RetCodes, r)
+	}
+	if res.SocketCount < 2 {
+		t.Errorf("Expected the hedging clients' sockets to be counted, got %d", res.SocketCount)
+	}
+	if res.DurationHistogram.Max > 0.19 {
+		t.Errorf("Expected requests to take one delay, not wait for the hedge loser: %g", res.DurationHistogram.Max)
+	}
+	// The loser of the hedge is canceled: the first request only returns when canceled.
+	var calls atomic.Int64
+	canceled := make(chan struct{}, 2)
+	mux.HandleFunc("/hedge-loser/", func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1)%2 == 1 {
+			select {
+			case <-r.Context().Done():
+				canceled <- struct{}{}
+			case <-time.After(5 * time.Second):
+			}
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	for _, std := range []bool{false, true} {
+		lopts := opts
+		lopts.Exactly = 1
+		lopts.DisableFastClient = std
+		lopts.URL = fmt.Sprintf("http://127.0.0.1:%d/hedge-loser/", addr.Port)
+		start := time.Now()
+		if res, err = RunHTTPTest(&lopts); err != nil || res.RetCodes[http.StatusOK] != 1 || res.Retry.HedgeWins != 1 {
+			t.Errorf("std %v: expected the hedge to win, got %v %+v %v", std, res.RetCodes, res.Retry, err)
+		}
+		select {
+		case <-canceled:
+		case <-time.After(2 * time.Second):
+			t.Errorf("std %v: hedge loser wasn't canceled", std)
+		}
+		if d := time.Since(start); d > 3*time.Second {
+			t.Errorf("std %v: run waited %v for the hedge loser", std, d)
+		}
+	}
+	opts.URL = fmt.Sprintf("http://127.0.0.1:%d/hedge/", addr.Port)
+	opts.Retry.HedgeDelay = time.Second
+	if res, err = RunHTTPTest(&opts); err != nil || res.Retry.Hedges != 0 || res.Retry.Attempts != 3 {
+		t.Errorf("Expected no hedging for fast requests, got %+v %v", res.Retry, err)
+	}
+	opts.StreamMode = StreamModeSSE
+	if _, err = RunHTTPTest(&opts); err == nil {
+		t.Errorf("Expected error for hedging in stream mode")
+	}
+	opts.StreamMode = ""
+	opts.Retry.Jitter = 2
+	if _, err = RunHTTPTest(&opts); err == nil {
+		t.Errorf("Expected error for invalid jitter")
+	}
+}
@@ -0,0 +1,318 @@
+// Copyright 2026 Fortio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fhttp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"fortio.org/fortio/pkg/log"
+	"fortio.org/fortio/pkg/stats"
+)
+
+// Streaming modes of the HTTP runner (HTTPRunnerOptions.StreamMode).
+const (
+	// StreamModeSSE parses the response as text/event-stream (Server-Sent Events).
+	StreamModeSSE = "sse"
+	// StreamModeNDJSON parses the response as newline delimited JSON (one event per non empty line).
+	StreamModeNDJSON = "ndjson"
+	// MaxStreamEvents is the maximum number of events the echo server will generate for one request.
+	MaxStreamEvents = 100000
+)
+
+// ValidStreamMode returns an error if the mode isn't one of the supported streaming modes (or empty).
+func ValidStreamMode(mode string) error {
+	switch mode {
+	case "", StreamModeSSE, StreamModeNDJSON:
+		return nil
+	default:
+		return fmt.Errorf("invalid stream mode %q, should be %q or %q", mode, StreamModeSSE, StreamModeNDJSON)
+	}
+}
+
+// StreamResults are the streaming mode results of the HTTP runner.
+type StreamResults struct {
+	Mode         string
+	Streams      int64 // number of successful streams (requests) measured
+	EmptyStreams int64 // streams that ended without any event
+	Events       int64 // total number of events (or lines) received
+	EventsPerSec float64
+	// Time from the start of the request to the first body byte.
+	FirstByte *stats.HistogramData
+	// Time from the start of the request to the first complete event.
+	FirstEvent *stats.HistogramData
+	// Time between consecutive events of a stream.
+	InterEvent *stats.HistogramData
+	// Time from the start of the request to the end of the stream.
+	TotalStream *stats.HistogramData
+	// Number of events per stream.
+	EventsPerStream *stats.HistogramData
+}
+
+// streamParser is the DataWriter of the std client in streaming mode: it splits the body
+// into events as it arrives and records the timings. It's per thread so not locked.
+type streamParser struct {
+	sse        bool
+	active     bool // ignore the data outside of begin()/end(), ie during warmup.
+	start      time.Time
+	last       time.Time
+	gotByte    bool
+	events     int64
+	line       []byte // partial line
+	inEvent    bool   // sse: a field was seen for the current event
+	streams    int64
+	empty      int64
+	total      int64
+	firstByte  *stats.Histogram
+	firstEvent *stats.Histogram
+	interEvent *stats.Histogram
+	stream     *stats.Histogram
+	perStream  *stats.Histogram
+}
+
+func newStreamParser(mode string, offset, resolution float64) *streamParser {
+	return &streamParser{
+		sse:        mode == StreamModeSSE,
+		firstByte:  stats.NewHistogram(offset, resolution),
+		firstEvent: stats.NewHistogram(offset, resolution),
+		interEvent: stats.NewHistogram(offset, resolution),
+		stream:     stats.NewHistogram(offset, resolution),
+		perStream:  stats.NewHistogram(0, 1),
+	}
+}
+
+// begin marks the start of a stream (just before sending the request).
+func (p *streamParser) begin() {
+	p.active = true
+	p.start = time.Now()
+	p.gotByte = false
+	p.events = 0
+	p.line = p.line[:0]
+	p.inEvent = false
+}
+
+// end marks the end of the stream, only successful streams are recorded.
+func (p *streamParser) end(ok bool) {
+	p.active = false
+	if !ok {
+		return
+	}
+	now := time.Now()
+	if !p.sse && len(p.line) > 0 {
+		// last line without trailing newline. For SSE an incomplete event is discarded (per spec).
+		p.processLine(now)
+	}
+	p.stream.Record(now.Sub(p.start).Seconds())
+	p.perStream.Record(float64(p.events))
+	p.streams++
+	p.total += p.events
+	if p.events == 0 {
+		p.empty++
+	}
+}
+
+func (p *streamParser) Write(b []byte) (int, error) {
+	n := len(b)
+	if !p.active || n == 0 {
+		return n, nil
+	}
+	now := time.Now()
+	if !p.gotByte {
+		p.gotByte = true
+		p.firstByte.Record(now.Sub(p.start).Seconds())
+	}
+	for len(b) > 0 {
+		i := bytes.IndexByte(b, '\n')
+		if i < 0 {
+			p.line = append(p.line, b...)
+			break
+		}
+		p.line = append(p.line, b[:i]...)
+		p.processLine(now)
+		p.line = p.line[:0]
+		b = b[i+1:]
+	}
+	return n, nil
+}
+
+func (p *streamParser) processLine(now time.Time) {
+	line := bytes.TrimSuffix(p.line, []byte{'\r'})
+	if !p.sse {
+		if len(bytes.TrimSpace(line)) > 0 {
+			p.event(now)
+		}
+		return
+	}
+	if len(line) == 0 {
+		// blank line: dispatch the event if it had any field
+		if p.inEvent {
+			p.event(now)
+		}
+		p.inEvent = false
+		return
+	}
+	field, _, _ := bytes.Cut(line, []byte{':'})
+	switch string(field) {
+	case "": // comment (keep alive)
+	case "data", "event", "id":
+		p.inEvent = true
+	default: // retry and unknown fields don't make an event.
+	}
+}
+
+func (p *streamParser) event(now time.Time) {
+	if p.events == 0 {
+		p.firstEvent.Record(now.Sub(p.start).Seconds())
+	} else {
+		p.interEvent.Record(now.Sub(p.last).Seconds())
+	}
+	p.last = now
+	p.events++
+}
+
+// transfer aggregates (and resets) src into p.
+func (p *streamParser) transfer(src *streamParser) {
+	p.firstByte.Transfer(src.firstByte)
+	p.firstEvent.Transfer(src.firstEvent)
+	p.interEvent.Transfer(src.interEvent)
+	p.stream.Transfer(src.stream)
+	p.perStream.Transfer(src.perStream)
+	p.streams += src.streams
+	p.empty += src.empty
+	p.total += src.total
+}
+
+// results exports the aggregated stats and prints them to out.
+func (p *streamParser) results(mode string, duration time.Duration, percentiles []float64, out io.Writer) *StreamResults {
+	res := &StreamResults{
+		Mode:            mode,
+		Streams:         p.streams,
+		EmptyStreams:    p.empty,
+		Events:          p.total,
+		FirstByte:       p.firstByte.Export().CalcPercentiles(percentiles),
+		FirstEvent:      p.firstEvent.Export().CalcPercentiles(percentiles),
+		InterEvent:      p.interEvent.Export().CalcPercentiles(percentiles),
+		TotalStream:     p.stream.Export().CalcPercentiles(percentiles),
+		EventsPerStream: p.perStream.Export().CalcPercentiles(percentiles),
+	}
+	if duration > 0 {
+		res.EventsPerSec = float64(p.total) / duration.Seconds()
+	}
+	if log.Log(log.Info) {
+		res.FirstByte.Print(out, "Stream first byte time histogram (s)")
+		res.FirstEvent.Print(out, "Stream first event time histogram (s)")
+		res.InterEvent.Print(out, "Stream inter event time histogram (s)")
+		res.TotalStream.Print(out, "Stream total time histogram (s)")
+	} else if log.Log(log.Warning) {
+		p.firstEvent.Counter.Print(out, "Stream first event time (s)")
+		p.interEvent.Counter.Print(out, "Stream inter event time (s)")
+	}
+	if log.LogVerbose() {
+		res.EventsPerStream.Print(out, "Events per stream histogram")
+	}
+	_, _ = fmt.Fprintf(out, "Stream (%s): %d streams, %d events (%.1f events/s), %d streams without events\n",
+		mode, res.Streams, res.Events, res.EventsPerSec, res.EmptyStreams)
+	return res
+}
+
+// textPayload returns size printable bytes (event data can't contain newlines nor be binary).
+func textPayload(size int) []byte {
+	const alphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	res := make([]byte, size)
+	for i := range res {
+		res[i] = alphabet[i%len(alphabet)]
+	}
+	return res
+}
+
+// StreamHandler generates a stream of events: Server-Sent Events (text/event-stream) when
+// sse=count is passed or newline delimited JSON when ndjson=count is, with count events.
+// Takes the same common arguments as the echo handler (delay before the first event, header, close, status)
+// plus interval (probabilistic delay syntax, time between events) and size (of each event's data,
+// also probabilistic).
+func StreamHandler(w http.ResponseWriter, r *http.Request) {
+	sse := true
+	countStr := QueryArg(r, StreamModeSSE)
+	if countStr == "" {
+		sse = false
+		countStr = QueryArg(r, StreamModeNDJSON)
+	}
+	count, err := strconv.Atoi(countStr)
+	if err != nil || count < 0 {
+		log.Warnf("Bad stream event count %q, using 1", countStr)
+		count = 1
+	}
+	if count > MaxStreamEvents {
+		log.Warnf("Stream event count %d capped to %d", count, MaxStreamEvents)
+		count = MaxStreamEvents
+	}
+	handleCommonArgs(w, r)
+	status := http.StatusOK
+	if statusStr := QueryArg(r, "status"); statusStr != "" {
+		status = generateStatus(statusStr)
+	}
+	if sse {
+		w.Header().Set("Content-Type", "text/event-stream")
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(status)
+	flusher, _ := w.(http.Flusher)
+	if flusher != nil {
+		flusher.Flush()
+	}
+	intervalStr := QueryArg(r, "interval")
+	sizeStr := QueryArg(r, "size")
+	var data []byte
+	var buf bytes.Buffer
+	for i := range count {
+		if i > 0 {
+			if dur := generateDelay(intervalStr); dur > 0 {
+				time.Sleep(dur)
+			}
+		}
+		size := generateSize(sizeStr)
+		if size < 0 {
+			size = 0
+		}
+		if size > len(data) {
+			data = textPayload(size)
+		}
+		buf.Reset()
+		if sse {
+			_, _ = fmt.Fprintf(&buf, "id: %d\nevent: message\ndata: %s\n\n", i, data[:size])
+		} else {
+			d, _ := json.Marshal(string(data[:size]))
+			_, _ = fmt.Fprintf(&buf, "{\"seq\":%d,\"data\":%s}\n", i, d)
+		}
+		if _, err = w.Write(buf.Bytes()); err != nil {
+			log.LogVf("Stream to %v ended after %d events: %v", r.RemoteAddr, i, err)
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		if err = r.Context().Err(); err != nil {
+			log.LogVf("Stream to %v canceled after %d events: %v", r.RemoteAddr, i+1, err)
+			return
+		}
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2026 Fortio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fhttp
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"fortio.org/fortio/pkg/fnet"
+	"fortio.org/fortio/pkg/log"
+	"golang.org/x/net/websocket"
+)
+
+// IsWebSocketUpgrade returns true if the request is a WebSocket upgrade request.
+func IsWebSocketUpgrade(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Upgrade"), "websocket") &&
+		strings.Contains(strings.ToLower(r.Header.Get("Connection")), "upgrade")
+}
+
+// wsMessage keeps the frame type so text frames are echoed as text and binary as binary.
+type wsMessage struct {
+	data        []byte
+	payloadType byte
+}
+
+var wsEchoCodec = websocket.Codec{
+	Marshal: func(v any) ([]byte, byte, error) {
+		m := v.(*wsMessage)
+		return m.data, m.payloadType, nil
+	},
+	Unmarshal: func(data []byte, payloadType byte, v any) error {
+		m := v.(*wsMessage)
+		m.data = data
+		m.payloadType = payloadType
+		return nil
+	},
+}
+
+// WebSocketEchoHandler upgrades the request to a WebSocket and echoes back each message.
+// It takes the same style of query arguments as EchoHandler, from the upgrade request:
+// status (refuses the upgrade with that status unless it's 101 or 200), delay (before each echo),
+// size (replies with that many bytes instead of the message) and close (closes the connection after
+// the echo). All are probabilistic the same way as for EchoHandler.
+func WebSocketEchoHandler(w http.ResponseWriter, r *http.Request) {
+	statusStr := QueryArg(r, "status")
+	if statusStr != "" {
+		status := generateStatus(statusStr)
+		if status != http.StatusSwitchingProtocols && status != http.StatusOK {
+			log.LogVf("Refusing websocket upgrade with status %d", status)
+			w.WriteHeader(status)
+			return
+		}
+	}
+	sizeStr := QueryArg(r, "size")
+	closeStr := QueryArg(r, "close")
+	s := websocket.Server{Handler: func(ws *websocket.Conn) {
+		defer ws.Close()
+		var msg wsMessage
+		for {
+			if err := wsEchoCodec.Receive(ws, &msg); err != nil {
+				log.LogVf("Websocket echo receive from %v ended: %v", r.RemoteAddr, err)
+				return
+			}
+			if dur := requestDelay(r); dur > 0 {
+				time.Sleep(dur)
+			}
+			if size := generateSize(sizeStr); size >= 0 {
+				msg.data = fnet.Payload[:size]
+				msg.payloadType = websocket.BinaryFrame
+			}
+			if err := wsEchoCodec.Send(ws, &msg); err != nil {
+				log.Errf("Websocket echo send to %v error: %v", r.RemoteAddr, err)
+				return
+			}
+			if generateClose(closeStr) {
+				log.Debugf("Closing websocket to %v as requested", r.RemoteAddr)
+				return
+			}
+		}
+	}}
+	s.ServeHTTP(w, r)
+}
@@ -16,6 +16,7 @@ package fnet // import "fortio.org/fortio/pkg/fnet"
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
@@ -25,10 +26,13 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"fortio.org/dflag"
 	"fortio.org/fortio/internal/jrpc"
+	"fortio.org/fortio/pkg/metrics"
+	"fortio.org/fortio/pkg/stats"
 	"fortio.org/fortio/pkg/version"
 	"fortio.org/fortio/pkg/log"
 	"fortio.org/safecast"
@@ -75,6 +79,29 @@ var (
 	FlagResolveMethod = dflag.New("cached-rr",
 		"When a name resolves to multiple ip, which `method` to pick: cached-rr for cached round-robin, rnd for random, "+
 			"first for first answer (pre 1.30 behavior), rr for round-robin.").WithValidator(dnsMethodValidator)
+	// TCPEchoDelay is the delay before echoing back each read of the TCP echo server, same syntax
+	// (fixed, probabilistic or distributions) as the HTTP echo server delay= (see stats.ParseDelays).
+	TCPEchoDelay = dflag.New("",
+		"Delay before echoing back each read of the TCP echo server, e.g \"normal(20ms,5ms)\" or \"10ms:90,exp(200ms):10\"").
+		WithValidator(delaysValidator(&tcpEchoDelays))
+	// UDPEchoDelay is the delay before echoing back each datagram of the UDP echo server.
+	UDPEchoDelay = dflag.New("",
+		"Delay before echoing back each datagram of the UDP echo server, same syntax as -tcp-echo-delay").
+		WithValidator(delaysValidator(&udpEchoDelays))
+	// The parsed TCPEchoDelay and UDPEchoDelay, nil for no delay.
+	tcpEchoDelays atomic.Pointer[stats.Delays]
+	udpEchoDelays atomic.Pointer[stats.Delays]
+	// Echo servers metrics.
+	tcpEchoConnections = metrics.NewGaugeVec("fortio_tcp_echo_server_connections",
+		"Currently open TCP echo server connections", "server")
+	tcpEchoConnectionsTotal = metrics.NewCounterVec("fortio_tcp_echo_server_connections_total",
+		"TCP echo server connections accepted", "server")
+	tcpEchoBytes = metrics.NewCounterVec("fortio_tcp_echo_server_bytes_total",
+		"Bytes echoed back by the TCP echo server (counted when the connections close)", "server")
+	udpEchoPackets = metrics.NewCounterVec("fortio_udp_echo_server_packets_total",
+		"Datagrams echoed back by the UDP echo server", "server")
+	udpEchoBytes = metrics.NewCounterVec("fortio_udp_echo_server_bytes_total",
+		"Bytes echoed back by the UDP echo server", "server")
 	// cache for cached-rr mode.
 	dnsMutex sync.Mutex
 	// all below are updated under lock.
@@ -96,6 +123,35 @@ func dnsMethodValidator(inp string) error {
 	return errors.New("invalid value for dns method, should be one of cached-rr, first, rnd or rr")
 }
 
+// delaysValidator returns the validator of an echo delay flag, which stores the parsed delays
+// (nil for none) so they are parsed once and only sampled for each read or datagram.
+func delaysValidator(parsed *atomic.Pointer[stats.Delays]) func(string) error {
+	return func(inp string) error {
+		if inp == "" {
+			parsed.Store(nil)
+			return nil
+		}
+		delays, err := stats.ParseDelays(inp, true)
+		if err != nil {
+			return err
+		}
+		parsed.Store(delays)
+		return nil
+	}
+}
+
+// echoDelay sleeps for a sample of the parsed echo delays (if any).
+func echoDelay(name string, parsed *atomic.Pointer[stats.Delays]) {
+	delays := parsed.Load()
+	if delays == nil {
+		return
+	}
+	if d := delays.Sample(); d > 0 {
+		log.Debugf("%s: sleeping for %v", name, d)
+		time.Sleep(d)
+	}
+}
+
 //nolint:gochecknoinits // needed here (unit change)
 func init() {
 	ChangeMaxPayloadSize(MaxPayloadSize)
@@ -169,18 +225,91 @@ func UDPListen(name string, port string) (*net.UDPConn, net.Addr) {
 }
 
 func handleTCPEchoRequest(name string, conn net.Conn) {
+	tcpEchoConnectionsTotal.Inc(name)
+	tcpEchoConnections.Inc(name)
+	defer tcpEchoConnections.Add(-1, name)
 	SetSocketBuffers(conn, 32*KILOBYTE, 32*KILOBYTE)
-	wb, err := Copy(conn, conn) // io.Copy(conn, conn)
+	var wb int64
+	var err error
+	if tcpEchoDelays.Load() == nil {
+		wb, err = Copy(conn, conn) // io.Copy(conn, conn)
+	} else {
+		wb, err = delayedCopy(name, conn)
+	}
+	tcpEchoBytes.Add(wb, name)
 	log.LogVf("TCP echo server (%v) echoed %d bytes from %v to itself (err=%v)", name, wb, conn.RemoteAddr(), err)
 	_ = conn.Close()
 }
 
+// delayedCopy echoes back each read after the TCPEchoDelay.
+func delayedCopy(name string, conn net.Conn) (written int64, err error) {
+	buf := make([]byte, 32*KILOBYTE)
+	for {
+		nr, er := conn.Read(buf)
+		if nr > 0 {
+			echoDelay(name, &tcpEchoDelays)
+			nw, ew := conn.Write(buf[:nr])
+			written += int64(nw)
+			if ew != nil {
+				return written, ew
+			}
+		}
+		if er != nil {
+			if errors.Is(er, io.EOF) {
+				return written, nil
+			}
+			return written, er
+		}
+	}
+}
+
 // TCPEchoServer starts a TCP Echo Server on given port, name is for logging.
 func TCPEchoServer(name string, port string) net.Addr {
+	listener, addr := Listen(name, port)
+	if listener == nil {
+		return nil // error already logged
+	}
+	serveTCPEcho(name, listener)
+	return addr
+}
+
+// TCPEchoServerTLS starts a TLS wrapped TCP Echo Server on given port, using the given (server side,
+// ie with the certificate) TLS config, name is for logging.
+func TCPEchoServerTLS(name string, port string, cfg *tls.Config) net.Addr {
+	listener, addr := Listen(name, port)
+	if listener == nil {
+		return nil // error already logged
+	}
+	serveTCPEcho(name, tls.NewListener(listener, cfg))
+	return addr
+}
+
+// TCPDiscardServer starts a TCP Discard Server (reads and ignores everything, ie for throughput
+// tests of one direction) on given port, name is for logging.
+func TCPDiscardServer(name string, port string) net.Addr {
 	listener, addr := Listen(name, port)
 	if listener == nil {
 		return nil // error already logged
 	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				log.Critf("TCP discard server (%v) error accepting: %v", name, err)
+				continue
+			}
+			go func() {
+				SetSocketBuffers(conn, 256*KILOBYTE, 32*KILOBYTE)
+				n, err := io.Copy(io.Discard, conn)
+				log.LogVf("TCP discard server (%v) discarded %d bytes from %v (err=%v)", name, n, conn.RemoteAddr(), err)
+				_ = conn.Close()
+			}()
+		}
+	}()
+	return addr
+}
+
+func serveTCPEcho(name string, listener net.Listener) {
 	go func() {
 		for {
 			// TODO limit number of go request, maximum duration/bytes sent, etc...
@@ -194,11 +323,13 @@ func TCPEchoServer(name string, port string) net.Addr {
 			}
 		}
 	}()
-	return addr
 }
 
 func handleUDPEchoRequest(name string, conn *net.UDPConn, addr *net.UDPAddr, buf []byte) {
+	echoDelay(name, &udpEchoDelays)
 	wb, err := conn.WriteToUDP(buf, addr)
+	udpEchoPackets.Inc(name)
+	udpEchoBytes.Add(int64(wb), name)
 	log.LogVf("UDP echo server (%v) echoed %d bytes back to %v (err=%v)", name, wb, addr, err)
 }
 
@@ -477,9 +608,10 @@ func Copy(dst io.Writer, src io.Reader) (written int64, err error) {
 	return written, err
 }
 
-// SetSocketBuffers sets the read and write buffer size of the socket. Also sets TCP SetNoDelay().
+// SetSocketBuffers sets the read and write buffer size of the socket (the underlying one for TLS
+// connections). Also sets TCP SetNoDelay().
 func SetSocketBuffers(socket net.Conn, readBufferSize, writeBufferSize int) {
-	tcpSock, ok := socket.(*net.TCPConn)
+	tcpSock, ok := unwrapTLS(socket).(*net.TCPConn)
 	if !ok {
 		log.LogVf("Not setting socket options on non tcp socket %v", socket.RemoteAddr())
 		return
@@ -496,6 +628,14 @@ func SetSocketBuffers(socket net.Conn, readBufferSize, writeBufferSize int) {
 	}
 }
 
+// unwrapTLS returns the connection under a TLS one, or the connection itself.
+func unwrapTLS(conn net.Conn) net.Conn {
+	if tlsConn, isTLS := conn.(*tls.Conn); isTLS {
+		return tlsConn.NetConn()
+	}
+	return conn
+}
+
 func transfer(wg *sync.WaitGroup, dst net.Conn, src net.Conn) {
 	n, oErr := io.Copy(dst, src) // keep original error for logs below
 	log.LogVf("Proxy: transferred %d bytes from %v to %v (err=%v)", n, src.RemoteAddr(), dst.RemoteAddr(), oErr)
@@ -28,6 +28,7 @@ import (
 	"time"
 
 	"fortio.org/fortio/pkg/fnet"
+	"fortio.org/fortio/pkg/metrics"
 	"fortio.org/fortio/pkg/version"
 	"fortio.org/fortio/pkg/log"
 )
@@ -256,6 +257,49 @@ func TestUdpEcho(t *testing.T) {
 	}
 }
 
+func TestEchoDelays(t *testing.T) {
+	if err := fnet.TCPEchoDelay.Set("normal(1ms)"); err == nil {
+		t.Errorf("Expected validation error for bad tcp echo delay")
+	}
+	if err := fnet.TCPEchoDelay.Set("uniform(50ms,60ms)"); err != nil {
+		t.Fatalf("Unexpected error setting tcp echo delay: %v", err)
+	}
+	defer fnet.TCPEchoDelay.Set("")
+	if err := fnet.UDPEchoDelay.Set("50ms"); err != nil {
+		t.Fatalf("Unexpected error setting udp echo delay: %v", err)
+	}
+	defer fnet.UDPEchoDelay.Set("")
+	addr := fnet.TCPEchoServer("test-tcp-echo-delay", ":0")
+	d, err := net.DialTCP("tcp", nil, &net.TCPAddr{Port: addr.(*net.TCPAddr).Port})
+	if err != nil {
+		t.Fatalf("can't connect to our echo server: %v", err)
+	}
+	defer d.Close()
+	start := time.Now()
+	_, _ = d.Write([]byte("delayed"))
+	_ = d.CloseWrite()
+	res, err := io.ReadAll(d)
+	if err != nil || string(res) != "delayed" {
+		t.Errorf("Unexpected tcp echo %q %v", res, err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("Expected tcp echo delay of at least 50ms, got %v", elapsed)
+	}
+	uaddr := fnet.UDPEchoServer("test-udp-echo-delay", ":0", false)
+	var buf bytes.Buffer
+	out := bufio.NewWriter(&buf)
+	start = time.Now()
+	err = fnet.NetCat(context.Background(), fmt.Sprintf("udp://localhost:%d", uaddr.(*net.UDPAddr).Port),
+		strings.NewReader("udp"), out, true)
+	out.Flush()
+	if err != nil || buf.String() != "udp" {
+		t.Errorf("Unexpected udp echo %q %v", buf.String(), err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("Expected udp echo delay of at least 50ms, got %v", elapsed)
+	}
+}
+
 type ErroringWriter struct{}
 
 func (cbb *ErroringWriter) Close() error {
@@ -798,3 +842,45 @@ func TestResolveNoFilter(t *testing.T) {
 func init() {
 	log.SetLogLevel(log.Debug)
 }
+
+func TestEchoServerMetrics(t *testing.T) {
+	addr := fnet.TCPEchoServer("test-tcp-metrics", ":0")
+	d, err := net.DialTCP("tcp", nil, &net.TCPAddr{Port: addr.(*net.TCPAddr).Port})
+	if err != nil {
+		t.Fatalf("can't connect to our echo server: %v", err)
+	}
+	_, _ = d.Write([]byte("hello"))
+	_ = d.CloseWrite()
+	_, _ = io.ReadAll(d)
+	d.Close()
+	uaddr := fnet.UDPEchoServer("test-udp-metrics", ":0", false)
+	var buf bytes.Buffer
+	out := bufio.NewWriter(&buf)
+	err = fnet.NetCat(context.Background(), fmt.Sprintf("udp://localhost:%d", uaddr.(*net.UDPAddr).Port),
+		strings.NewReader("udp"), out, true)
+	if err != nil {
+		t.Fatalf("udp echo error: %v", err)
+	}
+	expected := []string{
+		`fortio_tcp_echo_server_connections_total{server="test-tcp-metrics"} 1`,
+		`fortio_tcp_echo_server_connections{server="test-tcp-metrics"} 0`,
+		`fortio_tcp_echo_server_bytes_total{server="test-tcp-metrics"} 5`,
+		`fortio_udp_echo_server_packets_total{server="test-udp-metrics"} 1`,
+		`fortio_udp_echo_server_bytes_total{server="test-udp-metrics"} 3`,
+	}
+	var res bytes.Buffer
+	for range 50 { // the server side of the TCP connection is accounted for asynchronously.
+		res.Reset()
+		_ = metrics.Write(&res)
+		if !strings.Contains(res.String(), expected[1]) {
+			time.Sleep(20 * time.Millisecond)
+			continue
+		}
+		break
+	}
+	for _, e := range expected {
+		if !strings.Contains(res.String(), e) {
+			t.Errorf("Missing %q in metrics:\n%s", e, res.String())
+		}
+	}
+}
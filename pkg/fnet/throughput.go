@@ -0,0 +1,187 @@
+// Copyright 2026 Fortio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fnet
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"fortio.org/fortio/pkg/log"
+)
+
+// DefaultThroughputInterval is the default interval of the throughput over time.
+const DefaultThroughputInterval = time.Second
+
+// Throughput is the bandwidth of one connection, or the aggregate of all of them, in megabits
+// (10^6 bits) per second of the bytes sent plus received.
+type Throughput struct {
+	Bytes    int64
+	Duration float64 // seconds
+	Mbps     float64
+	// Mbps for each Interval since the start of the run, the last one being possibly partial.
+	Interval  float64 // seconds
+	Intervals []float64
+	// TCP retransmitted segments, only where the OS exposes them (TCP_INFO on Linux).
+	Retransmits int64 `json:",omitempty"`
+}
+
+// ThroughputWriteChunk is the size of the writes of MeteredWrite.
+const ThroughputWriteChunk = 64 * 1024
+
+// ThroughputMeter accumulates the bytes transferred by a connection (thread) over time, as they are
+// read and written. Safe for concurrent use (ie the reads and writes of the std http client's transport).
+type ThroughputMeter struct {
+	mu          sync.Mutex
+	start       time.Time
+	interval    time.Duration
+	bytes       int64
+	buckets     []int64
+	retransmits int64
+}
+
+// NewThroughputMeter returns a meter of the bytes transferred since start, per interval
+// (DefaultThroughputInterval when 0).
+func NewThroughputMeter(start time.Time, interval time.Duration) *ThroughputMeter {
+	if interval <= 0 {
+		interval = DefaultThroughputInterval
+	}
+	return &ThroughputMeter{start: start, interval: interval}
+}
+
+// Add records n bytes transferred at the given time.
+func (m *ThroughputMeter) Add(n int64, now time.Time) {
+	if n <= 0 {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.bytes += n
+	idx := max(0, int(now.Sub(m.start)/m.interval))
+	for len(m.buckets) <= idx {
+		m.buckets = append(m.buckets, 0)
+	}
+	m.buckets[idx] += n
+}
+
+// AddRetransmits adds the TCP retransmits of the connection, if available, to be called before closing it.
+func (m *ThroughputMeter) AddRetransmits(conn net.Conn) {
+	if r, ok := TCPRetransmits(conn); ok {
+		m.mu.Lock()
+		m.retransmits += r
+		m.mu.Unlock()
+	}
+}
+
+// Restart clears what was recorded so far and restarts the meter at start, ie after a warmup.
+func (m *ThroughputMeter) Restart(start time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.start = start
+	m.bytes = 0
+	m.buckets = m.buckets[:0]
+	m.retransmits = 0
+}
+
+// MeteredWrite writes data to w in ThroughputWriteChunk chunks, each added as it's written so large
+// writes are spread over the intervals they actually took.
+func (m *ThroughputMeter) MeteredWrite(w io.Writer, data []byte) (int, error) {
+	total := 0
+	for total < len(data) {
+		n, err := w.Write(data[total:min(len(data), total+ThroughputWriteChunk)])
+		total += n
+		m.Add(int64(n), time.Now())
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+func mbps(bytes int64, seconds float64) float64 {
+	if seconds <= 0 {
+		return 0
+	}
+	return float64(bytes) * 8 / seconds / 1e6
+}
+
+// Result returns the throughput until end.
+func (m *ThroughputMeter) Result(end time.Time) Throughput {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	res := Throughput{
+		Bytes:       m.bytes,
+		Duration:    end.Sub(m.start).Seconds(),
+		Interval:    m.interval.Seconds(),
+		Intervals:   make([]float64, len(m.buckets)),
+		Retransmits: m.retransmits,
+	}
+	res.Mbps = mbps(res.Bytes, res.Duration)
+	for i, b := range m.buckets {
+		res.Intervals[i] = mbps(b, min(res.Interval, res.Duration-float64(i)*res.Interval))
+	}
+	return res
+}
+
+// AggregateThroughput returns the sum of the throughputs (of meters with the same start and interval).
+func AggregateThroughput(all []Throughput) Throughput {
+	res := Throughput{}
+	for _, t := range all {
+		res.Bytes += t.Bytes
+		res.Duration = max(res.Duration, t.Duration)
+		res.Interval = t.Interval
+		res.Retransmits += t.Retransmits
+		for len(res.Intervals) < len(t.Intervals) {
+			res.Intervals = append(res.Intervals, 0)
+		}
+		for i, v := range t.Intervals {
+			res.Intervals[i] += v
+		}
+	}
+	res.Mbps = mbps(res.Bytes, res.Duration)
+	return res
+}
+
+// Print prints the throughput on one line, with the given prefix.
+func (t *Throughput) Print(out io.Writer, prefix string) {
+	retransmits := ""
+	if t.Retransmits > 0 {
+		retransmits = fmt.Sprintf(", %d retransmits", t.Retransmits)
+	}
+	intervals := make([]string, len(t.Intervals))
+	for i, v := range t.Intervals {
+		intervals[i] = fmt.Sprintf("%.1f", v)
+	}
+	_, _ = fmt.Fprintf(out, "%s %.2f Mbps (%d bytes in %.3fs%s), per %gs: %s\n",
+		prefix, t.Mbps, t.Bytes, t.Duration, retransmits, t.Interval, strings.Join(intervals, " "))
+}
+
+// TCPRetransmits returns the number of retransmitted segments of the TCP connection (or of the one
+// under a TLS connection) and true, or false when not available on this OS or connection type.
+func TCPRetransmits(conn net.Conn) (int64, bool) {
+	tcpConn, ok := unwrapTLS(conn).(*net.TCPConn)
+	if !ok {
+		return 0, false
+	}
+	raw, err := tcpConn.SyscallConn()
+	if err != nil {
+		log.LogVf("Unable to get raw connection of %v: %v", conn.RemoteAddr(), err)
+		return 0, false
+	}
+	return tcpRetransmits(raw)
+}
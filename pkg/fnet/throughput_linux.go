@@ -0,0 +1,38 @@
+// Copyright 2026 Fortio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+
+package fnet
+
+import (
+	"syscall"
+
+	"fortio.org/fortio/pkg/log"
+	"golang.org/x/sys/unix"
+)
+
+// tcpRetransmits reads the total retransmits from the TCP_INFO of the socket.
+func tcpRetransmits(raw syscall.RawConn) (int64, bool) {
+	var info *unix.TCPInfo
+	var err error
+	cErr := raw.Control(func(fd uintptr) {
+		info, err = unix.GetsockoptTCPInfo(int(fd), unix.IPPROTO_TCP, unix.TCP_INFO)
+	})
+	if cErr != nil || err != nil {
+		log.LogVf("Unable to get TCP_INFO: %v %v", cErr, err)
+		return 0, false
+	}
+	return int64(info.Total_retrans), true
+}
@@ -0,0 +1,77 @@
+// Copyright 2026 Fortio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fnet_test
+
+import (
+	"bytes"
+	"net"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"fortio.org/fortio/pkg/fnet"
+)
+
+func TestThroughputMeter(t *testing.T) {
+	start := time.Now()
+	m := fnet.NewThroughputMeter(start, 0)
+	m.Add(125000, start.Add(100*time.Millisecond))
+	m.Add(250000, start.Add(2500*time.Millisecond))
+	m.Add(-1, start)
+	res := m.Result(start.Add(2500 * time.Millisecond))
+	if res.Bytes != 375000 || res.Interval != 1 || res.Mbps != 1.2 || !slices.Equal(res.Intervals, []float64{1, 0, 4}) {
+		t.Errorf("Unexpected throughput %+v", res)
+	}
+	other := fnet.NewThroughputMeter(start, time.Second)
+	other.Add(125000, start.Add(1500*time.Millisecond))
+	total := fnet.AggregateThroughput([]fnet.Throughput{res, other.Result(start.Add(2 * time.Second))})
+	if total.Bytes != 500000 || total.Duration != 2.5 || total.Mbps != 1.6 || !slices.Equal(total.Intervals, []float64{1, 1, 4}) {
+		t.Errorf("Unexpected aggregate throughput %+v", total)
+	}
+	var out bytes.Buffer
+	total.Print(&out, "Throughput")
+	if !strings.Contains(out.String(), "Throughput 1.60 Mbps (500000 bytes in 2.500s), per 1s: 1.0 1.0 4.0") {
+		t.Errorf("Unexpected output %q", out.String())
+	}
+	m.Restart(time.Now())
+	out.Reset()
+	if n, err := m.MeteredWrite(&out, make([]byte, 3*fnet.ThroughputWriteChunk+1)); err != nil || n != out.Len() {
+		t.Errorf("Unexpected metered write %d %v (%d written)", n, err, out.Len())
+	}
+	if res = m.Result(time.Now()); res.Bytes != int64(out.Len()) || len(res.Intervals) != 1 {
+		t.Errorf("Expected only the metered write after restart, got %+v", res)
+	}
+}
+
+func TestTCPDiscardAndRetransmits(t *testing.T) {
+	addr := fnet.TCPDiscardServer("test-tcp-discard", ":0")
+	conn, err := net.Dial("tcp", addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if n, err := conn.Write(make([]byte, 1024*1024)); err != nil || n != 1024*1024 {
+		t.Fatalf("Unable to write to the discard server: %d %v", n, err)
+	}
+	r, ok := fnet.TCPRetransmits(conn)
+	if ok != (runtime.GOOS == "linux") || r < 0 {
+		t.Errorf("Unexpected retransmits %d %v", r, ok)
+	}
+	if _, ok = fnet.TCPRetransmits(&net.UDPConn{}); ok {
+		t.Errorf("Expected no retransmits for udp")
+	}
+}
@@ -0,0 +1,246 @@
+// Copyright 2026 Fortio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package metrics is a minimal (dependency free) registry of Prometheus style counters, gauges and
+// histograms with labels, used for the metrics of the servers fortio starts.
+package metrics // import "fortio.org/fortio/pkg/metrics"
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultLatencyBuckets are the upper bounds, in seconds, of the latency histograms.
+var DefaultLatencyBuckets = []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// metric is what the registry writes.
+type metric interface {
+	write(w *bufio.Writer)
+}
+
+var (
+	registryMu sync.Mutex
+	registry   []metric
+)
+
+func register(m metric) {
+	registryMu.Lock()
+	registry = append(registry, m)
+	registryMu.Unlock()
+}
+
+// Write writes all the metrics in the Prometheus text exposition format.
+func Write(w io.Writer) error {
+	registryMu.Lock()
+	metrics := slices.Clone(registry)
+	registryMu.Unlock()
+	bw := bufio.NewWriter(w)
+	for _, m := range metrics {
+		m.write(bw)
+	}
+	return bw.Flush()
+}
+
+// Handler serves all the metrics (ie for servers without the fortio UI metrics exporter).
+func Handler(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	_ = Write(w)
+}
+
+// vec is the common part of the metrics: name, help and the values per label values.
+type vec[T any] struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+	values sync.Map // joined label values -> *T
+	newT   func() *T
+}
+
+// labelEscaper escapes label values for the text format.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// labelsSep can't be in label values (it's not valid UTF-8).
+const labelsSep = "\xff"
+
+func (v *vec[T]) get(labelValues []string) *T {
+	if len(labelValues) != len(v.labels) {
+		panic("metrics: " + v.name + " expects labels " + strings.Join(v.labels, ","))
+	}
+	key := strings.Join(labelValues, labelsSep)
+	if t, ok := v.values.Load(key); ok {
+		return t.(*T)
+	}
+	t, _ := v.values.LoadOrStore(key, v.newT())
+	return t.(*T)
+}
+
+// each writes the header and calls f for each label values set key, sorted.
+func (v *vec[T]) each(w *bufio.Writer, f func(key string, t *T)) {
+	_, _ = w.WriteString("# HELP " + v.name + " " + v.help + "\n# TYPE " + v.name + " " + v.kind + "\n")
+	var keys []string
+	v.values.Range(func(k, _ any) bool {
+		keys = append(keys, k.(string))
+		return true
+	})
+	slices.Sort(keys)
+	for _, k := range keys {
+		t, _ := v.values.Load(k)
+		f(k, t.(*T))
+	}
+}
+
+// formatLabels returns {l1="v1",l2="v2"} (with extra, ie le="0.1", at the end), empty without labels.
+func (v *vec[T]) formatLabels(key, extra string) string {
+	if len(v.labels) == 0 && extra == "" {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteByte('{')
+	var values []string
+	if len(v.labels) > 0 {
+		values = strings.Split(key, labelsSep)
+	}
+	for i, l := range v.labels {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(l)
+		sb.WriteString("=")
+		sb.WriteByte('"')
+		sb.WriteString(labelEscaper.Replace(values[i]))
+		sb.WriteByte('"')
+	}
+	if extra != "" {
+		if len(v.labels) > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(extra)
+	}
+	sb.WriteByte('}')
+	return sb.String()
+}
+
+// CounterVec is a counter (or a gauge) with labels.
+type CounterVec struct {
+	vec[atomic.Int64]
+}
+
+func newCounterVec(kind, name, help string, labels []string) *CounterVec {
+	c := &CounterVec{vec[atomic.Int64]{name: name, help: help, kind: kind, labels: labels,
+		newT: func() *atomic.Int64 { return &atomic.Int64{} }}}
+	register(c)
+	return c
+}
+
+// NewCounterVec returns a new registered counter with the given label names.
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return newCounterVec("counter", name, help, labels)
+}
+
+// NewGaugeVec returns a new registered gauge with the given label names (use Add with negative values).
+func NewGaugeVec(name, help string, labels ...string) *CounterVec {
+	return newCounterVec("gauge", name, help, labels)
+}
+
+// Add adds n to the value for the label values (in the order of the label names).
+func (c *CounterVec) Add(n int64, labelValues ...string) {
+	c.get(labelValues).Add(n)
+}
+
+// Inc adds 1 to the value for the label values.
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.get(labelValues).Add(1)
+}
+
+// Value returns the current value for the label values.
+func (c *CounterVec) Value(labelValues ...string) int64 {
+	return c.get(labelValues).Load()
+}
+
+func (c *CounterVec) write(w *bufio.Writer) {
+	c.each(w, func(key string, v *atomic.Int64) {
+		_, _ = w.WriteString(c.name + c.formatLabels(key, "") + " " + strconv.FormatInt(v.Load(), 10) + "\n")
+	})
+}
+
+// histogram is the data of one label values set of a HistogramVec.
+type histogram struct {
+	counts []atomic.Int64 // per bucket, the last one for +Inf.
+	sum    atomic.Uint64  // float64 bits.
+}
+
+// HistogramVec is a histogram with labels.
+type HistogramVec struct {
+	vec[histogram]
+	buckets []float64
+}
+
+// NewHistogramVec returns a new registered histogram with the given buckets upper bounds and label names.
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{buckets: buckets}
+	h.vec = vec[histogram]{name: name, help: help, kind: "histogram", labels: labels,
+		newT: func() *histogram { return &histogram{counts: make([]atomic.Int64, len(buckets)+1)} }}
+	register(h)
+	return h
+}
+
+// Observe records the value for the label values.
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	d := h.get(labelValues)
+	idx, _ := slices.BinarySearch(h.buckets, value)
+	d.counts[idx].Add(1)
+	for {
+		old := d.sum.Load()
+		if d.sum.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+value)) {
+			return
+		}
+	}
+}
+
+// Count returns the number of observations for the label values.
+func (h *HistogramVec) Count(labelValues ...string) int64 {
+	var res int64
+	d := h.get(labelValues)
+	for i := range d.counts {
+		res += d.counts[i].Load()
+	}
+	return res
+}
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+	h.each(w, func(key string, d *histogram) {
+		var cumulative int64
+		for i := range d.counts {
+			cumulative += d.counts[i].Load()
+			le := "+Inf"
+			if i < len(h.buckets) {
+				le = strconv.FormatFloat(h.buckets[i], 'g', -1, 64)
+			}
+			_, _ = w.WriteString(h.name + "_bucket" + h.formatLabels(key, `le="`+le+`"`) + " " +
+				strconv.FormatInt(cumulative, 10) + "\n")
+		}
+		labels := h.formatLabels(key, "")
+		_, _ = w.WriteString(h.name + "_sum" + labels + " " +
+			strconv.FormatFloat(math.Float64frombits(d.sum.Load()), 'g', -1, 64) + "\n")
+		_, _ = w.WriteString(h.name + "_count" + labels + " " + strconv.FormatInt(cumulative, 10) + "\n")
+	})
+}
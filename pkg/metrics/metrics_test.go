@@ -0,0 +1,68 @@
+// Copyright 2026 Fortio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	c := NewCounterVec("test_requests_total", "Test requests", "path", "code")
+	g := NewGaugeVec("test_connections", "Test connections")
+	h := NewHistogramVec("test_duration_seconds", "Test durations", []float64{0.1, 1}, "path")
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Go(func() {
+			c.Inc("/a", "200")
+			g.Inc()
+			h.Observe(0.5, "/a")
+		})
+	}
+	wg.Wait()
+	c.Add(3, `/b"\`, "503")
+	g.Add(-4)
+	h.Observe(0.1, "/a")
+	h.Observe(2, "/a")
+	if c.Value("/a", "200") != 10 || g.Value() != 6 || h.Count("/a") != 12 {
+		t.Errorf("Unexpected values %d %d %d", c.Value("/a", "200"), g.Value(), h.Count("/a"))
+	}
+	rec := httptest.NewRecorder()
+	Handler(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	out := rec.Body.String()
+	for _, expected := range []string{
+		"# HELP test_requests_total Test requests\n# TYPE test_requests_total counter\n" +
+			"test_requests_total{path=\"/a\",code=\"200\"} 10\ntest_requests_total{path=\"/b\\\"\\\\\",code=\"503\"} 3\n",
+		"# TYPE test_connections gauge\ntest_connections 6\n",
+		"test_duration_seconds_bucket{path=\"/a\",le=\"0.1\"} 1\n" +
+			"test_duration_seconds_bucket{path=\"/a\",le=\"1\"} 11\n" +
+			"test_duration_seconds_bucket{path=\"/a\",le=\"+Inf\"} 12\n" +
+			"test_duration_seconds_sum{path=\"/a\"} 7.1\n" +
+			"test_duration_seconds_count{path=\"/a\"} 12\n",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("Missing %q in:\n%s", expected, out)
+		}
+	}
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expected panic for wrong number of labels")
+		}
+	}()
+	c.Inc("/a")
+}
@@ -29,6 +29,7 @@ import (
 	"time"
 
 	"fortio.org/fortio/internal/bincommon"
+	"fortio.org/fortio/pkg/dnsrunner"
 	"fortio.org/fortio/pkg/fgrpc"
 	"fortio.org/fortio/pkg/fhttp"
 	"fortio.org/fortio/pkg/fnet"
@@ -38,6 +39,7 @@ import (
 	"fortio.org/fortio/pkg/stats"
 	"fortio.org/fortio/pkg/tcprunner"
 	"fortio.org/fortio/pkg/udprunner"
+	"fortio.org/fortio/pkg/wsrunner"
 	"fortio.org/fortio/pkg/log"
 )
 
@@ -205,6 +207,39 @@ func FormValue(r *http.Request, json map[string]any, key string) string {
 	return res
 }
 
+// grpcChecks returns the gRPC response checks from the (repeatable) grpc-check query arg
+// or the grpc-check JSON string or array of strings.
+func grpcChecks(r *http.Request, jd map[string]any) []string {
+	var res []string
+	for _, c := range r.Form["grpc-check"] {
+		if c != "" {
+			res = append(res, c)
+		}
+	}
+	if len(res) > 0 || jd == nil {
+		return res
+	}
+	switch v := jd["grpc-check"].(type) {
+	case string:
+		if v != "" {
+			res = append(res, v)
+		}
+	case []any:
+		for _, c := range v {
+			cStr, ok := c.(string)
+			if !ok {
+				log.Errf("Json grpc-check must be an array of strings (got %T: %v)", c, c)
+				continue
+			}
+			res = append(res, cStr)
+		}
+	case nil:
+	default:
+		log.Warnf("Json grpc-check is %T %v / not a string or array, can't be used", v, v)
+	}
+	return res
+}
+
 // RESTRunHandler is API version of UI submit handler.
 // TODO: refactor common option/args/flag parsing between uihandler.go and this.
 func RESTRunHandler(w http.ResponseWriter, r *http.Request) { //nolint:funlen // long function, but it does a lot of things.
@@ -250,6 +285,7 @@ func RESTRunHandler(w http.ResponseWriter, r *http.Request) { //nolint:funlen //
 	nocatchup := (FormValue(r, jd, "nocatchup") == "on")
 	stdClient := (FormValue(r, jd, "stdclient") == "on")
 	h2 := (FormValue(r, jd, "h2") == "on")
+	h3 := (FormValue(r, jd, "h3") == "on")
 	sequentialWarmup := (FormValue(r, jd, "sequential-warmup") == "on")
 	httpsInsecure := (FormValue(r, jd, "https-insecure") == "on")
 	resolve := FormValue(r, jd, "resolve")
@@ -312,6 +348,10 @@ func RESTRunHandler(w http.ResponseWriter, r *http.Request) { //nolint:funlen //
 	httpopts.Insecure = httpsInsecure
 	httpopts.Resolve = resolve
 	httpopts.H2 = h2
+	httpopts.H3 = h3
+	if h2Streams, _ := strconv.Atoi(FormValue(r, jd, "h2-streams")); h2Streams > 0 {
+		httpopts.H2MaxStreams = h2Streams
+	}
 	httpopts.LogErrors = logErrors
 	httpopts.MethodOverride = methodOverride
 	// Set the connection reuse range.
@@ -376,6 +416,37 @@ func RESTRunHandler(w http.ResponseWriter, r *http.Request) { //nolint:funlen //
 	Run(w, r, jd, runner, url, &ro, httpopts, false)
 }
 
+// tcpModeOptions sets the tcp runner reply mode options from the tcp-* params.
+func tcpModeOptions(r *http.Request, jd map[string]any, o *tcprunner.TCPOptions) {
+	o.Mode = FormValue(r, jd, "tcp-mode")
+	o.ReadSize, _ = strconv.Atoi(FormValue(r, jd, "tcp-read-size"))
+	o.LengthPrefix, _ = strconv.Atoi(FormValue(r, jd, "tcp-length-prefix"))
+	o.MaxReplySize, _ = strconv.Atoi(FormValue(r, jd, "tcp-max-reply"))
+	o.Expect = FormValue(r, jd, "tcp-expect")
+	var err error
+	if o.Delimiter, err = tcprunner.ParseEscaped(FormValue(r, jd, "tcp-delimiter")); err != nil {
+		log.Warnf("Ignoring tcp-delimiter: %v", err)
+	}
+	if o.ExpectBytes, err = tcprunner.ParseEscaped(FormValue(r, jd, "tcp-expect-bytes")); err != nil {
+		log.Warnf("Ignoring tcp-expect-bytes: %v", err)
+	}
+}
+
+// retryOptions returns the HTTP runner retry and hedging options from the retry* and hedge params.
+func retryOptions(r *http.Request, jd map[string]any) fhttp.RetryOptions {
+	ro := fhttp.RetryOptions{RespectRetryAfter: FormValue(r, jd, "retry-after") == "on"}
+	ro.MaxAttempts, _ = strconv.Atoi(FormValue(r, jd, "retry"))
+	ro.Backoff, _ = time.ParseDuration(FormValue(r, jd, "retry-backoff"))
+	ro.MaxBackoff, _ = time.ParseDuration(FormValue(r, jd, "retry-max-backoff"))
+	ro.Jitter, _ = strconv.ParseFloat(FormValue(r, jd, "retry-jitter"), 64)
+	ro.HedgeDelay, _ = time.ParseDuration(FormValue(r, jd, "hedge"))
+	var err error
+	if ro.RetryOn, err = fhttp.ParseRetryOn(FormValue(r, jd, "retry-on")); err != nil {
+		log.Warnf("Ignoring retry-on: %v", err)
+	}
+	return ro
+}
+
 // Run executes the run (can be called async or not, writer is nil for async mode).
 // API is a bit awkward to be compatible with both this new now main REST code but
 // also the old one in ui/uihandler.go.
@@ -391,21 +462,37 @@ func Run(w http.ResponseWriter, r *http.Request, jd map[string]any,
 		grpcSecure := (FormValue(r, jd, "grpc-secure") == "on")
 		grpcPing := (FormValue(r, jd, "ping") == "on")
 		grpcPingDelay, _ := time.ParseDuration(FormValue(r, jd, "grpc-ping-delay"))
+		streamMessages, _ := strconv.Atoi(FormValue(r, jd, "grpc-stream-messages"))
+		streamQPS, _ := strconv.ParseFloat(FormValue(r, jd, "grpc-stream-qps"), 64)
+		streamDuration, _ := time.ParseDuration(FormValue(r, jd, "grpc-stream-duration"))
+		callTimeout, _ := time.ParseDuration(FormValue(r, jd, "grpc-timeout"))
 		o := fgrpc.GRPCRunnerOptions{
-			RunnerOptions: *ro,
-			Destination:   url,
-			UsePing:       grpcPing,
-			Delay:         grpcPingDelay,
-			Service:       FormValue(r, jd, "healthservice"),
+			RunnerOptions:    *ro,
+			Destination:      url,
+			UsePing:          grpcPing,
+			Delay:            grpcPingDelay,
+			Service:          FormValue(r, jd, "healthservice"),
+			GrpcMethod:       FormValue(r, jd, "grpc-method"),
+			Payload:          httpopts.PayloadUTF8(),
+			StreamMessages:   streamMessages,
+			StreamQPS:        streamQPS,
+			StreamDuration:   streamDuration,
+			ProtoFiles:       fgrpc.SplitList(FormValue(r, jd, "grpc-proto")),
+			ProtoImportPaths: fgrpc.SplitList(FormValue(r, jd, "grpc-import-path")),
+			ProtoSet:         FormValue(r, jd, "grpc-protoset"),
+			PayloadFeeder:    FormValue(r, jd, "grpc-payload-feeder"),
+			ResponseChecks:   grpcChecks(r, jd),
+			CallTimeout:      callTimeout,
+			CaptureMetadata:  fgrpc.SplitList(FormValue(r, jd, "grpc-capture-metadata")),
+			LoadBalancing:    FormValue(r, jd, "grpc-lb"),
 		}
 		o.TLSOptions = httpopts.TLSOptions
 		if grpcSecure {
 			o.Destination = fhttp.AddHTTPS(url)
 		}
 		aborter = UpdateRun(&o.RunnerOptions)
-		// TODO: ReqTimeout: timeout
 		res, err = fgrpc.RunGRPCTest(&o)
-	case strings.HasPrefix(url, tcprunner.TCPURLPrefix):
+	case strings.HasPrefix(url, tcprunner.TCPURLPrefix), strings.HasPrefix(url, tcprunner.TCPSURLPrefix):
 		// TODO: copy pasta from fortio_main
 		o := tcprunner.RunnerOptions{
 			RunnerOptions: *ro,
@@ -413,6 +500,12 @@ func Run(w http.ResponseWriter, r *http.Request, jd map[string]any,
 		o.ReqTimeout = httpopts.HTTPReqTimeOut
 		o.Destination = url
 		o.Payload = httpopts.Payload
+		tcpModeOptions(r, jd, &o.TCPOptions)
+		o.TLSOptions = httpopts.TLSOptions
+		o.SessionResumption = FormValue(r, jd, "tcp-tls-resume") == "on"
+		o.ConnMode = FormValue(r, jd, "conn-mode")
+		o.MeasureThroughput = FormValue(r, jd, "throughput") == "on"
+		o.ThroughputInterval, _ = time.ParseDuration(FormValue(r, jd, "throughput-interval"))
 		aborter = UpdateRun(&o.RunnerOptions)
 		res, err = tcprunner.RunTCPTest(&o)
 	case strings.HasPrefix(url, udprunner.UDPURLPrefix):
@@ -423,8 +516,31 @@ func Run(w http.ResponseWriter, r *http.Request, jd map[string]any,
 		o.ReqTimeout = httpopts.HTTPReqTimeOut
 		o.Destination = url
 		o.Payload = httpopts.Payload
+		o.Stream = FormValue(r, jd, "udp-stream") == "on"
 		aborter = UpdateRun(&o.RunnerOptions)
 		res, err = udprunner.RunUDPTest(&o)
+	case strings.HasPrefix(url, dnsrunner.DNSURLPrefix):
+		o := dnsrunner.RunnerOptions{
+			RunnerOptions: *ro,
+		}
+		o.ReqTimeout = httpopts.HTTPReqTimeOut
+		o.Destination = url
+		o.TLSOptions = httpopts.TLSOptions
+		o.RandomSubdomain = FormValue(r, jd, "dns-random-subdomain") == "on"
+		// comma or whitespace separated list
+		o.Names = strings.Fields(strings.ReplaceAll(FormValue(r, jd, "dns-names"), ",", " "))
+		aborter = UpdateRun(&o.RunnerOptions)
+		res, err = dnsrunner.RunDNSTest(&o)
+	case wsrunner.IsWebSocketURL(url):
+		o := wsrunner.RunnerOptions{
+			RunnerOptions: *ro,
+		}
+		o.TLSOptions = httpopts.TLSOptions
+		o.ReqTimeout = httpopts.HTTPReqTimeOut
+		o.Destination = url
+		o.Payload = httpopts.Payload
+		aborter = UpdateRun(&o.RunnerOptions)
+		res, err = wsrunner.RunWSTest(&o)
 	case runner == "kafka" || strings.HasPrefix(url, kafkarunner.KafkaURLPrefix):
 		// Kafka load test
 		kafkaBootstrap := FormValue(r, jd, "kafka-bootstrap")
@@ -508,7 +624,12 @@ func Run(w http.ResponseWriter, r *http.Request, jd map[string]any,
 			HTTPOptions:        *httpopts,
 			RunnerOptions:      *ro,
 			AllowInitialErrors: true,
+			StreamMode:         FormValue(r, jd, "stream"),
+			ConnMode:           FormValue(r, jd, "conn-mode"),
+			MeasureThroughput:  FormValue(r, jd, "throughput") == "on",
 		}
+		o.ThroughputInterval, _ = time.ParseDuration(FormValue(r, jd, "throughput-interval"))
+		o.Retry = retryOptions(r, jd)
 		aborter = UpdateRun(&(o.RunnerOptions))
 		res, err = fhttp.RunHTTPTest(&o)
 	}
@@ -605,6 +605,13 @@ func TestOtherRunnersRESTApi(t *testing.T) {
 		t.Errorf("Mismatch between grpc requests %d and ok %v (%+v)",
 			totalReq, res.RetCodes, res)
 	}
+	// custom method with response checks, from the JSON body.
+	runURL = fmt.Sprintf("%s?qps=-1&n=4&url=%s&runner=grpc", restURL, iDest)
+	res = FetchResult[fgrpc.GRPCRunnerResults](t, runURL, `{"grpc-method": "fgrpc.PingServer/Ping",
+		"payload": "{\"seq\": {seq}, \"payload\": \"x\"}", "grpc-check": ["payload=x", "seq=1"]}`)
+	if res.RetCodes["SERVING"] != 1 || res.RetCodes[fgrpc.Mismatch] != 3 {
+		t.Errorf("Unexpected grpc response checks results %+v", res.RetCodes)
+	}
 
 	tAddr := fnet.TCPEchoServer("test-echo-runner-tcp", ":0")
 	tDest := fmt.Sprintf("tcp://localhost:%d/", tAddr.(*net.TCPAddr).Port)
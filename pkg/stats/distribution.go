@@ -0,0 +1,308 @@
+package stats
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"fortio.org/fortio/pkg/log"
+)
+
+// Distribution generates random durations.
+// Distribution генерирует случайные длительности.
+type Distribution interface {
+	Sample() time.Duration
+}
+
+type constantDistribution time.Duration
+
+func (c constantDistribution) Sample() time.Duration { return time.Duration(c) }
+
+type normalDistribution struct{ mean, stddev float64 }
+
+func (n normalDistribution) Sample() time.Duration {
+	return time.Duration(max(0, n.mean+n.stddev*rand.NormFloat64())) //nolint:gosec // we want fast not crypto
+}
+
+type lognormalDistribution struct{ mu, sigma float64 }
+
+func (l lognormalDistribution) Sample() time.Duration {
+	return time.Duration(math.Exp(l.mu + l.sigma*rand.NormFloat64())) //nolint:gosec // we want fast not crypto
+}
+
+type expDistribution struct{ mean float64 }
+
+func (e expDistribution) Sample() time.Duration {
+	return time.Duration(e.mean * rand.ExpFloat64()) //nolint:gosec // we want fast not crypto
+}
+
+type uniformDistribution struct{ lo, hi float64 }
+
+func (u uniformDistribution) Sample() time.Duration {
+	return time.Duration(u.lo + (u.hi-u.lo)*rand.Float64()) //nolint:gosec // we want fast not crypto
+}
+
+type paretoDistribution struct{ scale, alpha float64 }
+
+func (p paretoDistribution) Sample() time.Duration {
+	u := 1. - rand.Float64() //nolint:gosec // we want fast not crypto. in ]0, 1]
+	return time.Duration(min(p.scale/math.Pow(u, 1./p.alpha), math.MaxInt64))
+}
+
+// empiricalDistribution samples a histogram: picks a bucket weighted by its count, then uniformly within it.
+type empiricalDistribution struct {
+	buckets []Bucket
+	total   int64
+}
+
+func (e *empiricalDistribution) Sample() time.Duration {
+	n := rand.Int64N(e.total) //nolint:gosec // we want fast not crypto
+	for _, b := range e.buckets {
+		if n < b.Count {
+			return time.Duration((b.Start + (b.End-b.Start)*rand.Float64()) * float64(time.Second)) //nolint:gosec // same
+		}
+		n -= b.Count
+	}
+	return 0 // not reached
+}
+
+// MaxEmpiricalFileSize is the maximum size of the fortio JSON result files read by empirical(file).
+const MaxEmpiricalFileSize = 16 << 20
+
+// empiricalEntry is the result, good or bad, of loading an empirical(file) distribution.
+type empiricalEntry struct {
+	once sync.Once
+	d    *empiricalDistribution
+	err  error
+}
+
+// empiricalCache avoids re-reading the result files on each call, including the ones failing to load.
+var empiricalCache sync.Map
+
+// readEmpirical loads, once, the DurationHistogram (in seconds) of a fortio JSON result file.
+func readEmpirical(fileName string) (*empiricalDistribution, error) {
+	v, _ := empiricalCache.LoadOrStore(fileName, &empiricalEntry{})
+	entry := v.(*empiricalEntry)
+	entry.once.Do(func() {
+		entry.d, entry.err = loadEmpirical(fileName)
+		if entry.err != nil {
+			log.Errf("Unable to load empirical distribution: %v", entry.err)
+		}
+	})
+	return entry.d, entry.err
+}
+
+func loadEmpirical(fileName string) (*empiricalDistribution, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if !fi.Mode().IsRegular() || fi.Size() > MaxEmpiricalFileSize {
+		return nil, fmt.Errorf("%s is not a regular file of at most %d bytes", fileName, MaxEmpiricalFileSize)
+	}
+	data, err := io.ReadAll(io.LimitReader(f, MaxEmpiricalFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxEmpiricalFileSize {
+		return nil, fmt.Errorf("%s is larger than %d bytes", fileName, MaxEmpiricalFileSize)
+	}
+	var res struct {
+		DurationHistogram *HistogramData
+	}
+	if err = json.Unmarshal(data, &res); err != nil {
+		return nil, fmt.Errorf("invalid fortio result %s: %w", fileName, err)
+	}
+	e := &empiricalDistribution{}
+	if res.DurationHistogram != nil {
+		for _, b := range res.DurationHistogram.Data {
+			if b.Count > 0 && b.Start >= 0 {
+				e.buckets = append(e.buckets, b)
+				e.total += b.Count
+			}
+		}
+	}
+	if e.total == 0 {
+		return nil, fmt.Errorf("no DurationHistogram data in %s", fileName)
+	}
+	log.Infof("Loaded empirical distribution of %d samples in %d buckets from %s", e.total, len(e.buckets), fileName)
+	return e, nil
+}
+
+// ParseDistribution parses a duration ("50ms", always that value) or a distribution:
+// normal(mean,stddev), lognormal(mean,stddev), exp(mean), uniform(min,max), pareto(min,alpha)
+// where all but alpha (the shape, a number > 0) are durations, or empirical(file) to follow the
+// DurationHistogram of a saved fortio JSON result. Negative normal samples are 0. empirical() reads a local
+// file so is only accepted when allowFiles is set, ie for operator set flags, never for client supplied values.
+// ParseDistribution разбирает длительность ("50ms", всегда это значение) или распределение:
+// normal(mean,stddev), lognormal(mean,stddev), exp(mean), uniform(min,max), pareto(min,alpha),
+// где все параметры, кроме alpha (форма, число > 0), длительности, или empirical(file) по
+// DurationHistogram сохранённого JSON результата fortio. Отрицательные значения normal дают 0. empirical()
+// читает локальный файл, поэтому принимается только при allowFiles, т.е. для флагов оператора, но не
+// для значений от клиентов.
+func ParseDistribution(spec string, allowFiles bool) (Distribution, error) {
+	spec = strings.TrimSpace(spec)
+	name, args, isFunc := strings.Cut(spec, "(")
+	if !isFunc {
+		d, err := time.ParseDuration(spec)
+		if err != nil {
+			return nil, err
+		}
+		return constantDistribution(d), nil
+	}
+	if !strings.HasSuffix(args, ")") {
+		return nil, fmt.Errorf("missing closing parenthesis in %q", spec)
+	}
+	args = strings.TrimSuffix(args, ")")
+	if name == "empirical" {
+		if !allowFiles {
+			return nil, fmt.Errorf("empirical() is only allowed in server flags, not in %q", spec)
+		}
+		return readEmpirical(strings.TrimSpace(args))
+	}
+	params := strings.Split(args, ",")
+	values := make([]float64, len(params))
+	for i, p := range params {
+		p = strings.TrimSpace(p)
+		if name == "pareto" && i == 1 {
+			v, err := strconv.ParseFloat(p, 64)
+			if err != nil || v <= 0 {
+				return nil, fmt.Errorf("pareto alpha should be a positive number, got %q", p)
+			}
+			values[i] = v
+			continue
+		}
+		d, err := time.ParseDuration(p)
+		if err != nil {
+			return nil, fmt.Errorf("%s parameter: %w", name, err)
+		}
+		if d < 0 {
+			return nil, fmt.Errorf("%s parameter %q should not be negative", name, p)
+		}
+		values[i] = float64(d)
+	}
+	expected := 2
+	if name == "exp" {
+		expected = 1
+	}
+	if len(values) != expected {
+		return nil, fmt.Errorf("%s expects %d parameters, got %d in %q", name, expected, len(values), spec)
+	}
+	switch name {
+	case "normal":
+		return normalDistribution{mean: values[0], stddev: values[1]}, nil
+	case "lognormal":
+		if values[0] <= 0 {
+			return nil, errors.New("lognormal mean should be positive")
+		}
+		sigma2 := math.Log(1 + (values[1]*values[1])/(values[0]*values[0]))
+		return lognormalDistribution{mu: math.Log(values[0]) - sigma2/2, sigma: math.Sqrt(sigma2)}, nil
+	case "exp":
+		return expDistribution{mean: values[0]}, nil
+	case "uniform":
+		if values[1] < values[0] {
+			return nil, fmt.Errorf("uniform max is less than min in %q", spec)
+		}
+		return uniformDistribution{lo: values[0], hi: values[1]}, nil
+	case "pareto":
+		return paretoDistribution{scale: values[0], alpha: values[1]}, nil
+	default:
+		return nil, fmt.Errorf("unknown distribution %q", name)
+	}
+}
+
+// SplitOutsideParens splits s on the sep runes not within parenthesis (ie the commas of a list of distributions).
+// SplitOutsideParens разбивает s по sep вне скобок (например запятые списка распределений).
+func SplitOutsideParens(s string, sep rune) []string {
+	var res []string
+	depth := 0
+	start := 0
+	for i, c := range s {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case sep:
+			if depth == 0 {
+				res = append(res, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(res, s[start:])
+}
+
+// Delays is a probabilistic list of distributions (see ParseDelays).
+// Delays — вероятностный список распределений (см. ParseDelays).
+type Delays struct {
+	distributions []Distribution
+	weights       []float64 // cumulative percentages
+}
+
+// ParseDelays parses the fortio delay syntax: a single distribution (see ParseDistribution), always used, or
+// a comma separated list of distribution:percentage, ie "10ms:20,normal(100ms,20ms):10,1s:0.5" for 20% 10ms,
+// 10% normally distributed around 100ms, 0.5% 1s and 69.5% 0. allowFiles is passed to ParseDistribution.
+// ParseDelays разбирает синтаксис задержек fortio: одно распределение (см. ParseDistribution), используемое
+// всегда, или список distribution:процент через запятую, например "10ms:20,normal(100ms,20ms):10,1s:0.5".
+// allowFiles передаётся в ParseDistribution.
+func ParseDelays(spec string, allowFiles bool) (*Delays, error) {
+	lst := SplitOutsideParens(spec, ',')
+	// Simple non probabilistic case (no :percentage, after the distribution's parameters if any):
+	if len(lst) == 1 && !strings.ContainsRune(spec[strings.LastIndex(spec, ")")+1:], ':') {
+		d, err := ParseDistribution(spec, allowFiles)
+		if err != nil {
+			return nil, err
+		}
+		return &Delays{distributions: []Distribution{d}, weights: []float64{100}}, nil
+	}
+	res := &Delays{}
+	lastPercent := 0.
+	for _, entry := range lst {
+		idx := strings.LastIndex(entry, ":")
+		if idx < 0 {
+			return nil, fmt.Errorf("missing :percentage in delay list entry %q", entry)
+		}
+		d, err := ParseDistribution(entry[:idx], allowFiles)
+		if err != nil {
+			return nil, err
+		}
+		p, err := strconv.ParseFloat(strings.TrimSuffix(entry[idx+1:], "%"), 64)
+		if err != nil || p < 0 || p > 100 {
+			return nil, fmt.Errorf("percentage is not a [0. - 100.] number in %q", entry)
+		}
+		lastPercent += p
+		// Round() needed to cover 'exactly' 100% and not more or less because of rounding errors
+		if Round(lastPercent) > 100. {
+			return nil, fmt.Errorf("sum of percentages is greater than 100 in %q", spec)
+		}
+		res.distributions = append(res.distributions, d)
+		res.weights = append(res.weights, Round(lastPercent))
+	}
+	return res, nil
+}
+
+// Sample rolls the dice and returns a duration from the selected distribution, 0 if none is.
+// Sample бросает кости и возвращает длительность из выбранного распределения, 0 если ни одно не выбрано.
+func (d *Delays) Sample() time.Duration {
+	res := 100. * rand.Float64() //nolint:gosec // we want fast not crypto
+	for i, w := range d.weights {
+		if res < w {
+			return d.distributions[i].Sample()
+		}
+	}
+	return 0
+}
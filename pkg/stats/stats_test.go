@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"math/rand"
 	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 	"time"
@@ -916,6 +917,29 @@ func TestMultipleConnIPOccurrence(t *testing.T) {
 	}
 }
 
+func TestEmpiricalFiles(t *testing.T) {
+	if _, err := ParseDelays("empirical(/dev/null):10", false); err == nil {
+		t.Errorf("Expected empirical() to be refused without allowFiles")
+	}
+	if _, err := ParseDistribution("empirical(/dev/zero)", true); err == nil {
+		t.Errorf("Expected empirical() of a non regular file to fail")
+	}
+	big := filepath.Join(t.TempDir(), "big.json")
+	if err := os.WriteFile(big, bytes.Repeat([]byte(" "), MaxEmpiricalFileSize+1), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseDistribution("empirical("+big+")", true); err == nil {
+		t.Errorf("Expected empirical() of a file larger than %d to fail", MaxEmpiricalFileSize)
+	}
+	// Failures are cached too: fixing the file afterwards doesn't change the outcome.
+	if err := os.WriteFile(big, []byte(`{"DurationHistogram": {"Data": [{"Start": 0.1, "End": 0.2, "Count": 1}]}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseDistribution("empirical("+big+")", true); err == nil {
+		t.Errorf("Expected the empirical() failure to be cached")
+	}
+}
+
 // TODO: add test with data 1.0 1.0001 1.999 2.0 2.5
 // should get 3 buckets 0-1 with count 1
 // 1-2 with count 3
@@ -3,17 +3,22 @@ package tcprunner
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
 	"net"
+	"regexp"
 	"sort"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"fortio.org/fortio/pkg/fhttp"
 	"fortio.org/fortio/pkg/fnet"
 	"fortio.org/fortio/pkg/periodic"
+	"fortio.org/fortio/pkg/stats"
 	"fortio.org/fortio/pkg/log"
 )
 
@@ -30,8 +35,33 @@ type RunnerResults struct {
 	SocketCount   int
 	BytesSent     int64
 	BytesReceived int64
-	client        *TCPClient
-	aborter       *periodic.Aborter
+	// TLS is set for tcps:// destinations.
+	// TLS заполняется для адресатов tcps://.
+	TLS *TLSStats `json:",omitempty"`
+	// Time to establish the TCP connections and, in churn mode, to close them.
+	// Время установления TCP-соединений и, в режиме churn, их закрытия.
+	ConnectTime *stats.HistogramData
+	CloseTime   *stats.HistogramData `json:",omitempty"`
+	// In churn mode the rate of new connections, in hold mode the connections still open at the end.
+	// В режиме churn — частота новых соединений, в режиме hold — соединения, открытые в конце.
+	ConnectionsPerSec float64 `json:",omitempty"`
+	HeldConnections   int     `json:",omitempty"`
+	// Throughput of all the connections and of each one, when MeasureThroughput is set.
+	// Пропускная способность всех соединений и каждого из них, если задан MeasureThroughput.
+	Throughput     *fnet.Throughput  `json:",omitempty"`
+	ConnThroughput []fnet.Throughput `json:",omitempty"`
+	client         *TCPClient
+	aborter        *periodic.Aborter
+}
+
+// TLSStats are the TLS handshakes statistics of a tcps:// run.
+// TLSStats — статистика TLS-рукопожатий запуска tcps://.
+type TLSStats struct {
+	Handshakes int64 // number of successful TLS handshakes
+	Resumed    int64 // number of handshakes that resumed a previous session
+	// Time of the TLS handshakes, after the TCP connection is established.
+	// Время TLS-рукопожатий, после установления TCP-соединения.
+	HandshakeTime *stats.HistogramData
 }
 
 // Run tests TCP request fetching. Main call being run at the target QPS.
@@ -57,8 +87,53 @@ type TCPOptions struct {
 	Payload          []byte // what to send (and check)
 	UnixDomainSocket string // Path of Unix domain socket to use instead of host:port from URL
 	ReqTimeout       time.Duration
+	// Mode is how the replies are read and checked, TCPModeEcho (default) expects the payload back.
+	// Mode — способ чтения и проверки ответов, TCPModeEcho (по умолчанию) ожидает обратно payload.
+	Mode         string
+	Delimiter    []byte // TCPModeDelimiter: end of the reply (included), default "\n"
+	ReadSize     int    // TCPModeFixed: size of the replies
+	LengthPrefix int    // TCPModeLength: size of the big endian length before each reply, 1, 2, 4 (default) or 8
+	// Expect is a regexp and ExpectBytes the exact bytes the replies must match, in all the modes reading
+	// replies but echo. In TCPModeMatch the reply is read until it matches.
+	// Expect — регулярное выражение, а ExpectBytes — точные байты, которым должны соответствовать ответы во всех
+	// режимах чтения ответов, кроме echo. В TCPModeMatch ответ читается до совпадения.
+	Expect       string
+	ExpectBytes  []byte
+	MaxReplySize int // longer replies are errors, default DefaultMaxReplySize
+	// TLSOptions are used for the tcps:// destinations (TLS wrapped TCP).
+	// TLSOptions используются для адресатов tcps:// (TCP, обёрнутый в TLS).
+	TLSOptions fhttp.TLSOptions
+	// SessionResumption reuses the TLS sessions (tickets) when reconnecting instead of full handshakes.
+	// SessionResumption повторно использует TLS-сессии (тикеты) при переподключении вместо полных рукопожатий.
+	SessionResumption bool
+	// ConnMode is fhttp.ConnModeChurn (new connection for each request) or fhttp.ConnModeHold (connections
+	// opened before the run and held, the requests being the keepalives), empty to reuse until an error.
+	// ConnMode — fhttp.ConnModeChurn (новое соединение для каждого запроса) или fhttp.ConnModeHold (соединения
+	// открываются до запуска и удерживаются, запросы служат keepalive), пусто — повторное использование до ошибки.
+	ConnMode string
+	// MeasureThroughput reports the bandwidth (sent plus received) of each connection and in aggregate,
+	// over time per ThroughputInterval (default 1s), ie with a large Payload in send mode to a discard server.
+	// MeasureThroughput выводит пропускную способность (отправлено плюс получено) каждого соединения и общую,
+	// во времени с шагом ThroughputInterval (по умолчанию 1s), например с большим Payload в режиме send на discard-сервер.
+	MeasureThroughput  bool
+	ThroughputInterval time.Duration
 }
 
+// TCP runner modes.
+// Режимы TCP-раннера.
+const (
+	TCPModeEcho      = "echo"      // the reply must be the payload
+	TCPModeSend      = "send"      // fire and forget, replies are not read
+	TCPModeDelimiter = "delimiter" // reply up to and including the Delimiter (ie line based protocols)
+	TCPModeFixed     = "fixed"     // reply of ReadSize bytes
+	TCPModeLength    = "length"    // reply framed with a LengthPrefix bytes length
+	TCPModeMatch     = "match"     // reply read until it matches Expect, or of the size of ExpectBytes
+)
+
+// DefaultMaxReplySize is the default maximum size of the replies in the modes reading them.
+// DefaultMaxReplySize — максимальный размер ответов по умолчанию в режимах, которые их читают.
+const DefaultMaxReplySize = 1024 * 1024
+
 // RunnerOptions includes the base RunnerOptions plus TCP specific
 // options.
 // RunnerOptions включает базовые RunnerOptions плюс специфичные для TCP опции.
@@ -82,18 +157,44 @@ type TCPClient struct {
 	destination   string
 	doGenerate    bool
 	reqTimeout    time.Duration
+	// Reply reading modes state, the buffer holds the unread data in [start, end).
+	// Состояние режимов чтения ответов, буфер содержит непрочитанные данные в [start, end).
+	mode         string
+	delimiter    []byte
+	readSize     int
+	lengthPrefix int
+	expect       *regexp.Regexp
+	expectBytes  []byte
+	maxReplySize int
+	start, end   int
+	// TLS state, tlsConfig is nil for plain TCP.
+	// Состояние TLS, tlsConfig равен nil для обычного TCP.
+	tlsConfig  *tls.Config
+	handshakes *stats.Histogram
+	resumed    int64
+	// Connection mode and timings.
+	// Режим соединений и тайминги.
+	connMode    string
+	connectTime *stats.Histogram
+	closeTime   *stats.Histogram
+	throughput  *fnet.ThroughputMeter
 }
 
 var (
 	// TCPURLPrefix is the URL prefix for triggering TCP load.
 	// TCPURLPrefix — это URL-префикс для запуска TCP-нагрузки.
 	TCPURLPrefix = "tcp://"
+	// TCPSURLPrefix is the URL prefix for triggering TLS wrapped TCP load.
+	// TCPSURLPrefix — это URL-префикс для запуска TCP-нагрузки, обёрнутой в TLS.
+	TCPSURLPrefix = "tcps://"
 	// TCPStatusOK is the map key on success.
 	// TCPStatusOK — это ключ карты при успехе.
 	TCPStatusOK  = "OK"
 	errShortRead = errors.New("short read")
 	errLongRead  = errors.New("bug: long read")
 	errMismatch  = errors.New("read not echoing writes")
+	errNoMatch   = errors.New("reply not matching expected")
+	errTooLong   = errors.New("reply too long")
 )
 
 // GeneratePayload generates a default 24 bytes unique payload for each runner thread and message sent
@@ -112,17 +213,34 @@ func NewTCPClient(o *TCPOptions) (*TCPClient, error) {
 	c := TCPClient{}
 	d := o.Destination
 	c.destination = d
+	var err error
+	if rest, isTLS := strings.CutPrefix(d, TCPSURLPrefix); isTLS {
+		d = TCPURLPrefix + rest
+		if c.tlsConfig, err = newTLSConfig(o, rest); err != nil {
+			return nil, err
+		}
+		c.handshakes = stats.NewHistogram(0, periodic.DefaultRunnerOptions.Resolution)
+	}
 	tAddr, err := fnet.ResolveDestination(context.Background(), d)
 	if tAddr == nil {
 		return nil, err
 	}
 	c.dest = tAddr
+	if err = fhttp.ValidConnMode(o.ConnMode); err != nil {
+		return nil, err
+	}
+	c.connMode = o.ConnMode
+	c.connectTime = stats.NewHistogram(0, periodic.DefaultRunnerOptions.Resolution)
+	c.closeTime = stats.NewHistogram(0, periodic.DefaultRunnerOptions.Resolution)
 	c.req = o.Payload
 	if len(c.req) == 0 { // len(nil) array is also valid and 0
 		c.doGenerate = true
 		c.req = GeneratePayload(0, 0)
 	}
 	c.buffer = make([]byte, len(c.req))
+	if err = c.setMode(o); err != nil {
+		return nil, err
+	}
 	c.reqTimeout = o.ReqTimeout
 	if o.ReqTimeout == 0 {
 		log.Debugf("Request timeout not set, using default %v", fhttp.HTTPReqTimeOutDefaultValue)
@@ -135,18 +253,277 @@ func NewTCPClient(o *TCPOptions) (*TCPClient, error) {
 	return &c, nil
 }
 
+// newTLSConfig returns the client TLS config for the host:port destination.
+// newTLSConfig возвращает клиентскую конфигурацию TLS для адресата host:port.
+func newTLSConfig(o *TCPOptions, dest string) (*tls.Config, error) {
+	cfg, err := o.TLSOptions.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	dest = strings.TrimSuffix(dest, "/")
+	if i := strings.LastIndex(dest, ":"); i >= 0 {
+		dest = dest[:i]
+	}
+	cfg.ServerName = strings.TrimSuffix(strings.TrimPrefix(dest, "["), "]")
+	if o.SessionResumption {
+		cfg.ClientSessionCache = tls.NewLRUClientSessionCache(0)
+	}
+	return cfg, nil
+}
+
+// ParseEscaped returns the bytes of a string with Go escapes, ie "\\r\\n" or "\\x00\\x01".
+// ParseEscaped возвращает байты строки с экранированием Go, например "\\r\\n" или "\\x00\\x01".
+func ParseEscaped(s string) ([]byte, error) {
+	if s == "" {
+		return nil, nil
+	}
+	res, err := strconv.Unquote(`"` + s + `"`)
+	if err != nil {
+		return nil, fmt.Errorf("invalid escaped string %q: %w", s, err)
+	}
+	return []byte(res), nil
+}
+
+// setMode validates and sets the reply reading options.
+// setMode проверяет и устанавливает опции чтения ответов.
+func (c *TCPClient) setMode(o *TCPOptions) error {
+	c.mode = o.Mode
+	if c.mode == "" {
+		c.mode = TCPModeEcho
+	}
+	var err error
+	if o.Expect != "" {
+		if c.expect, err = regexp.Compile(o.Expect); err != nil {
+			return fmt.Errorf("invalid tcp expect regexp: %w", err)
+		}
+	}
+	c.expectBytes = o.ExpectBytes
+	c.maxReplySize = o.MaxReplySize
+	if c.maxReplySize <= 0 {
+		c.maxReplySize = DefaultMaxReplySize
+	}
+	switch c.mode {
+	case TCPModeEcho, TCPModeSend:
+		return nil
+	case TCPModeDelimiter:
+		c.delimiter = o.Delimiter
+		if len(c.delimiter) == 0 {
+			c.delimiter = []byte("\n")
+		}
+	case TCPModeFixed:
+		if o.ReadSize <= 0 || o.ReadSize > c.maxReplySize {
+			return fmt.Errorf("tcp fixed mode needs a read size between 1 and %d, got %d", c.maxReplySize, o.ReadSize)
+		}
+		c.readSize = o.ReadSize
+	case TCPModeLength:
+		c.lengthPrefix = o.LengthPrefix
+		switch c.lengthPrefix {
+		case 0:
+			c.lengthPrefix = 4
+		case 1, 2, 4, 8:
+		default:
+			return fmt.Errorf("tcp length prefix must be 1, 2, 4 or 8 bytes, got %d", c.lengthPrefix)
+		}
+	case TCPModeMatch:
+		if c.expect == nil && len(c.expectBytes) == 0 {
+			return errors.New("tcp match mode needs an expect regexp or bytes")
+		}
+	default:
+		return fmt.Errorf("invalid tcp mode %q, should be one of echo, send, delimiter, fixed, length or match", c.mode)
+	}
+	c.buffer = make([]byte, max(len(c.req), 4096))
+	return nil
+}
+
+// replyLen returns the length of the reply at the start of data, 0 when more data is needed.
+// replyLen возвращает длину ответа в начале data, 0 если нужно больше данных.
+func (c *TCPClient) replyLen(data []byte) (int, error) {
+	switch c.mode {
+	case TCPModeDelimiter:
+		if idx := bytes.Index(data, c.delimiter); idx >= 0 {
+			return idx + len(c.delimiter), nil
+		}
+	case TCPModeFixed:
+		if len(data) >= c.readSize {
+			return c.readSize, nil
+		}
+	case TCPModeLength:
+		if len(data) < c.lengthPrefix {
+			return 0, nil
+		}
+		var l uint64
+		for _, b := range data[:c.lengthPrefix] {
+			l = l<<8 | uint64(b)
+		}
+		if l > uint64(c.maxReplySize) { //nolint:gosec // maxReplySize is positive.
+			return 0, errTooLong
+		}
+		if n := c.lengthPrefix + int(l); len(data) >= n { //nolint:gosec // checked above.
+			return n, nil
+		}
+	case TCPModeMatch:
+		if len(c.expectBytes) > 0 {
+			if len(data) >= len(c.expectBytes) {
+				return len(c.expectBytes), nil
+			}
+			return 0, nil
+		}
+		if loc := c.expect.FindIndex(data); loc != nil && loc[1] > 0 {
+			return loc[1], nil
+		}
+	}
+	return 0, nil
+}
+
+// readReply reads a reply according to the mode, extra data is kept for the next reply.
+// readReply читает ответ в соответствии с режимом, лишние данные сохраняются для следующего ответа.
+func (c *TCPClient) readReply(conn net.Conn) ([]byte, error) {
+	if c.start > 0 {
+		c.end = copy(c.buffer, c.buffer[c.start:c.end])
+		c.start = 0
+	}
+	for {
+		n, err := c.replyLen(c.buffer[:c.end])
+		if err != nil {
+			return c.buffer[:c.end], err
+		}
+		if n > 0 {
+			c.start = n
+			return c.buffer[:n], c.checkReply(c.buffer[:n])
+		}
+		if c.end >= c.maxReplySize {
+			return c.buffer[:c.end], errTooLong
+		}
+		if c.end == len(c.buffer) {
+			c.buffer = append(c.buffer, make([]byte, min(len(c.buffer), c.maxReplySize-c.end))...)
+		}
+		r, err := conn.Read(c.buffer[c.end:])
+		if log.LogDebug() {
+			log.Debugf("[%d] read %d (%s): %v", c.connID, r, fnet.DebugSummary(c.buffer[c.end:c.end+r], 256), err)
+		}
+		c.received(r)
+		c.end += r
+		if err != nil {
+			log.Errf("[%d] Unable to read: %v", c.connID, err)
+			if errors.Is(err, io.EOF) || errors.Is(err, syscall.ECONNRESET) {
+				return c.buffer[:c.end], errShortRead
+			}
+			return c.buffer[:c.end], err
+		}
+	}
+}
+
+// checkReply checks the reply against the expected regexp or bytes, if any.
+// checkReply проверяет ответ на соответствие ожидаемому регулярному выражению или байтам, если они заданы.
+func (c *TCPClient) checkReply(reply []byte) error {
+	if (c.expect != nil && !c.expect.Match(reply)) || (len(c.expectBytes) > 0 && !bytes.Equal(reply, c.expectBytes)) {
+		log.Infof("[%d] Reply %q not matching the expected one", c.connID, reply)
+		return errNoMatch
+	}
+	return nil
+}
+
 func (c *TCPClient) connect() (net.Conn, error) {
 	c.socketCount++
+	start := time.Now()
 	socket, err := net.Dial(c.dest.Network(), c.dest.String()) //nolint:noctx // TODO have contexts and not just abort channel.
 	if err != nil {
 		log.Errf("Unable to connect to %v : %v", c.dest, err)
 		return nil, err
 	}
+	c.connectTime.Record(time.Since(start).Seconds())
 	fnet.SetSocketBuffers(socket, len(c.buffer), len(c.req))
-	return socket, nil
+	if c.tlsConfig == nil {
+		return socket, nil
+	}
+	start = time.Now()
+	tlsConn := tls.Client(socket, c.tlsConfig)
+	_ = tlsConn.SetDeadline(start.Add(c.reqTimeout))
+	if err = tlsConn.Handshake(); err != nil {
+		log.Errf("[%d] TLS handshake with %v failed: %v", c.connID, c.dest, err)
+		c.closeConn(socket)
+		return nil, err
+	}
+	c.handshakes.Record(time.Since(start).Seconds())
+	if tlsConn.ConnectionState().DidResume {
+		c.resumed++
+	}
+	_ = tlsConn.SetDeadline(time.Time{})
+	return tlsConn, nil
 }
 
+// Fetch sends the payload and reads the reply according to the mode, closing the connection after
+// it in churn mode.
+// Fetch отправляет payload и читает ответ в соответствии с режимом, закрывая соединение после
+// него в режиме churn.
 func (c *TCPClient) Fetch() ([]byte, error) {
+	data, err := c.fetch()
+	if c.connMode == fhttp.ConnModeChurn && c.socket != nil {
+		if cErr := c.closeConn(c.socket); cErr != nil {
+			log.Warnf("[%d] Error closing churned socket: %v", c.connID, cErr)
+		}
+		c.socket = nil
+	}
+	return data, err
+}
+
+// closeConn closes the connection, timing it, after adding its TCP retransmits when measuring the throughput.
+// closeConn закрывает соединение, замеряя время, после добавления его TCP-ретрансмиссий при измерении
+// пропускной способности.
+func (c *TCPClient) closeConn(conn net.Conn) error {
+	if c.throughput != nil {
+		c.throughput.AddRetransmits(conn)
+	}
+	start := time.Now()
+	err := conn.Close()
+	c.closeTime.Record(time.Since(start).Seconds())
+	return err
+}
+
+// sent and received count the bytes written and read, also in the throughput meter if any.
+// sent и received подсчитывают записанные и прочитанные байты, также в измерителе пропускной способности, если он есть.
+func (c *TCPClient) sent(n int) {
+	c.bytesSent += int64(n)
+	if c.throughput != nil {
+		c.throughput.Add(int64(n), time.Now())
+	}
+}
+
+func (c *TCPClient) received(n int) {
+	c.bytesReceived += int64(n)
+	if c.throughput != nil {
+		c.throughput.Add(int64(n), time.Now())
+	}
+}
+
+// write sends the request, in chunks counted as they are written when measuring the throughput.
+// write отправляет запрос, частями, учитываемыми по мере записи при измерении пропускной способности.
+func (c *TCPClient) write(conn net.Conn) (int, error) {
+	if c.throughput != nil {
+		n, err := c.throughput.MeteredWrite(conn, c.req)
+		c.bytesSent += int64(n)
+		return n, err
+	}
+	n, err := conn.Write(c.req)
+	c.sent(n)
+	return n, err
+}
+
+// Connect opens the connection ahead of the first request, used to hold it.
+// Connect открывает соединение до первого запроса, используется для его удержания.
+func (c *TCPClient) Connect() error {
+	if c.socket != nil {
+		return nil
+	}
+	conn, err := c.connect()
+	if conn == nil {
+		return err
+	}
+	c.socket = conn
+	return nil
+}
+
+func (c *TCPClient) fetch() ([]byte, error) {
 	// Connect or reuse existing socket:
 	// Подключиться или повторно использовать существующий сокет:
 	conn := c.socket
@@ -169,8 +546,7 @@ func (c *TCPClient) Fetch() ([]byte, error) {
 		c.req = GeneratePayload(c.connID, c.messageCount) // TODO write directly in buffer to avoid generating garbage for GC to clean
 	}
 	expectedLen := len(c.req)
-	n, err := conn.Write(c.req)
-	c.bytesSent += int64(n)
+	n, err := c.write(conn)
 	if log.LogDebug() {
 		log.Debugf("[%d] wrote %d (%s): %v", c.connID, n, fnet.DebugSummary(c.req, 256), err)
 	}
@@ -179,16 +555,33 @@ func (c *TCPClient) Fetch() ([]byte, error) {
 			// it's ok for the (idle) socket to die once, auto reconnect:
 			// это нормально, если (простаивающий) сокет умирает один раз, автоматическое переподключение:
 			log.Infof("Closing dead socket %v (%v)", conn, err)
-			conn.Close()
-			return c.Fetch() // recurse once
+			_ = c.closeConn(conn)
+			return c.fetch() // recurse once
 		}
 		log.Errf("[%d] Unable to write to %v: %v", c.connID, c.dest, err)
+		_ = c.closeConn(conn)
 		return nil, err
 	}
 	if n != len(c.req) {
 		log.Errf("[%d] Short write to %v: %d instead of %d", c.connID, c.dest, n, expectedLen)
+		_ = c.closeConn(conn)
 		return nil, io.ErrShortWrite
 	}
+	switch c.mode {
+	case TCPModeEcho:
+	case TCPModeSend:
+		c.socket = conn // fire and forget
+		return nil, nil
+	default:
+		data, err := c.readReply(conn)
+		if err == nil {
+			c.socket = conn // reuse on success
+		} else {
+			c.start, c.end = 0, 0 // the rest of the stream is lost with the connection
+			_ = c.closeConn(conn)
+		}
+		return data, err
+	}
 	// assert that len(c.buffer) == len(c.req)
 	totalRead := 0
 	for {
@@ -196,13 +589,14 @@ func (c *TCPClient) Fetch() ([]byte, error) {
 		if log.LogDebug() {
 			log.Debugf("[%d] read %d (%s): %v", c.connID, n, fnet.DebugSummary(c.buffer[totalRead:totalRead+n], 256), err)
 		}
-		c.bytesReceived += int64(n)
+		c.received(n)
 		totalRead += n
 		if totalRead == expectedLen { // break first, assuming no err, so we don't test that for EOF case
 			break
 		}
 		if err != nil {
 			log.Errf("[%d] Unable to read: %v", c.connID, err)
+			_ = c.closeConn(conn)
 			if errors.Is(err, io.EOF) || errors.Is(err, syscall.ECONNRESET) {
 				return c.buffer[:totalRead], errShortRead
 			}
@@ -210,11 +604,13 @@ func (c *TCPClient) Fetch() ([]byte, error) {
 		}
 		if totalRead > expectedLen {
 			log.Errf("[%d] BUG: read more than possible +%d to %d vs %d", c.connID, n, totalRead, expectedLen)
+			_ = c.closeConn(conn)
 			return c.buffer[:totalRead], errLongRead
 		}
 	}
 	if !bytes.Equal(c.buffer, c.req) {
 		log.Infof("Mismatch between sent %q and received %q", string(c.req), string(c.buffer))
+		_ = c.closeConn(conn)
 		return c.buffer, errMismatch
 	}
 	c.socket = conn // reuse on success
@@ -226,7 +622,7 @@ func (c *TCPClient) Fetch() ([]byte, error) {
 func (c *TCPClient) Close() int {
 	log.Debugf("Closing %p: %s socket count %d", c, c.destination, c.socketCount)
 	if c.socket != nil {
-		if err := c.socket.Close(); err != nil {
+		if err := c.closeConn(c.socket); err != nil {
 			log.Warnf("Error closing tcp client's socket: %v", err)
 		}
 		c.socket = nil
@@ -251,6 +647,15 @@ func RunTCPTest(o *RunnerOptions) (*RunnerResults, error) {
 		RetCodes: make(TCPResultMap),
 	}
 	total.Destination = o.Destination
+	total.Mode = o.Mode
+	total.ConnMode = o.ConnMode
+	connectTime := stats.NewHistogram(r.Options().Offset.Seconds(), r.Options().Resolution)
+	closeTime := stats.NewHistogram(r.Options().Offset.Seconds(), r.Options().Resolution)
+	var handshakes *stats.Histogram
+	if strings.HasPrefix(o.Destination, TCPSURLPrefix) {
+		total.TLS = &TLSStats{}
+		handshakes = stats.NewHistogram(r.Options().Offset.Seconds(), r.Options().Resolution)
+	}
 	tcpstate := make([]RunnerResults, numThreads)
 	var err error
 	for i := range numThreads {
@@ -262,7 +667,22 @@ func RunTCPTest(o *RunnerOptions) (*RunnerResults, error) {
 			return nil, fmt.Errorf("unable to create client %d for %s: %w", i, o.Destination, err)
 		}
 		tcpstate[i].client.connID = i
-		if o.Exactly <= 0 {
+		if handshakes != nil {
+			tcpstate[i].client.handshakes = handshakes.Clone()
+		}
+		tcpstate[i].client.connectTime = connectTime.Clone()
+		tcpstate[i].client.closeTime = closeTime.Clone()
+		switch {
+		case o.ConnMode == fhttp.ConnModeHold:
+			// Hold: all the connections are established before the run.
+			// Hold: все соединения устанавливаются до запуска.
+			if err = tcpstate[i].client.Connect(); err != nil {
+				log.Warnf("Unable to open held connection %d to %s: %v", i, o.Destination, err)
+			}
+		case o.ConnMode == fhttp.ConnModeChurn:
+			// No warmup, each request opens its own connection.
+			// Без прогрева, каждый запрос открывает своё соединение.
+		case o.Exactly <= 0:
 			data, err := tcpstate[i].client.Fetch()
 			if i == 0 && log.LogVerbose() {
 				log.LogVf("first hit of %s: err %v, received %d: %q", o.Destination, err, len(data), data)
@@ -273,16 +693,36 @@ func RunTCPTest(o *RunnerOptions) (*RunnerResults, error) {
 		tcpstate[i].aborter = total.aborter
 		tcpstate[i].RetCodes = make(TCPResultMap)
 	}
+	if o.MeasureThroughput {
+		start := time.Now()
+		for i := range numThreads {
+			tcpstate[i].client.throughput = fnet.NewThroughputMeter(start, o.ThroughputInterval)
+		}
+	}
 	total.RunnerResults = r.Run()
+	end := time.Now()
 	// Numthreads may have reduced, but it should be ok to accumulate 0s from
 	// unused ones. We also must clean up all the created clients.
 	// Количество потоков могло уменьшиться, но должно быть нормально накапливать 0 от
 	// неиспользуемых. Мы также должны очистить все созданные клиенты.
 	keys := []string{}
 	for i := range numThreads {
+		if o.ConnMode == fhttp.ConnModeHold && tcpstate[i].client.socket != nil {
+			total.HeldConnections++
+		}
+		connectTime.Transfer(tcpstate[i].client.connectTime)
 		total.SocketCount += tcpstate[i].client.Close()
+		closeTime.Transfer(tcpstate[i].client.closeTime)
+		if o.MeasureThroughput {
+			total.ConnThroughput = append(total.ConnThroughput, tcpstate[i].client.throughput.Result(end))
+		}
 		total.BytesReceived += tcpstate[i].client.bytesReceived
 		total.BytesSent += tcpstate[i].client.bytesSent
+		if handshakes != nil {
+			total.TLS.Handshakes += tcpstate[i].client.handshakes.Count
+			total.TLS.Resumed += tcpstate[i].client.resumed
+			handshakes.Transfer(tcpstate[i].client.handshakes)
+		}
 		for k := range tcpstate[i].RetCodes {
 			if _, exists := total.RetCodes[k]; !exists {
 				keys = append(keys, k)
@@ -296,6 +736,37 @@ func RunTCPTest(o *RunnerOptions) (*RunnerResults, error) {
 	totalCount := float64(total.DurationHistogram.Count)
 	_, _ = fmt.Fprintf(out, "Sockets used: %d (for perfect no error run, would be %d)\n", total.SocketCount, r.Options().NumThreads)
 	_, _ = fmt.Fprintf(out, "Total Bytes sent: %d, received: %d\n", total.BytesSent, total.BytesReceived)
+	total.ConnectTime = connectTime.Export().CalcPercentiles(r.Options().Percentiles)
+	if log.Log(log.Info) {
+		total.ConnectTime.Print(out, "Connection time histogram (s)")
+	}
+	switch o.ConnMode {
+	case fhttp.ConnModeChurn:
+		total.CloseTime = closeTime.Export().CalcPercentiles(r.Options().Percentiles)
+		if log.Log(log.Info) {
+			total.CloseTime.Print(out, "Connection close time histogram (s)")
+		}
+		total.ConnectionsPerSec = float64(total.SocketCount) / total.ActualDuration.Seconds()
+		_, _ = fmt.Fprintf(out, "Connection churn: %.1f new connections per second\n", total.ConnectionsPerSec)
+	case fhttp.ConnModeHold:
+		_, _ = fmt.Fprintf(out, "Held connections: %d still open at the end out of %d, reconnections: %d\n",
+			total.HeldConnections, r.Options().NumThreads, max(0, total.SocketCount-r.Options().NumThreads))
+	}
+	if o.MeasureThroughput {
+		for i := range total.ConnThroughput {
+			total.ConnThroughput[i].Print(out, fmt.Sprintf("[%d] throughput", i))
+		}
+		aggregate := fnet.AggregateThroughput(total.ConnThroughput)
+		total.Throughput = &aggregate
+		total.Throughput.Print(out, "Throughput")
+	}
+	if total.TLS != nil {
+		total.TLS.HandshakeTime = handshakes.Export().CalcPercentiles(r.Options().Percentiles)
+		if log.Log(log.Info) {
+			total.TLS.HandshakeTime.Print(out, "TLS handshake time histogram (s)")
+		}
+		_, _ = fmt.Fprintf(out, "TLS handshakes: %d, resumed: %d\n", total.TLS.Handshakes, total.TLS.Resumed)
+	}
 	sort.Strings(keys)
 	for _, k := range keys {
 		_, _ = fmt.Fprintf(out, "tcp %s : %d (%.1f %%)\n", k, total.RetCodes[k], 100.*float64(total.RetCodes[k])/totalCount)
@@ -20,7 +20,9 @@ import (
 	"net"
 	"runtime"
 	"testing"
+	"time"
 
+	"fortio.org/fortio/pkg/fhttp"
 	"fortio.org/fortio/pkg/fnet"
 	"fortio.org/fortio/pkg/log"
 )
@@ -126,3 +128,184 @@ func TestTCPNotLeaking(t *testing.T) {
 		t.Errorf("%d socket used, expected same as thread# %d", res.SocketCount, res.RunnerResults.NumThreads)
 	}
 }
+
+func TestTCPRunnerModes(t *testing.T) {
+	addr := fnet.TCPEchoServer("test-echo-modes", ":0")
+	destination := fmt.Sprintf("tcp://localhost:%d/", addr.(*net.TCPAddr).Port)
+	tests := []struct {
+		name     string
+		opts     TCPOptions
+		expected string
+	}{
+		{"send", TCPOptions{Mode: TCPModeSend, Payload: []byte("hello\n")}, TCPStatusOK},
+		{"delimiter", TCPOptions{Mode: TCPModeDelimiter, Payload: []byte("hello\r\nworld\r\n"), Delimiter: []byte("\r\n")}, TCPStatusOK},
+		{"fixed", TCPOptions{Mode: TCPModeFixed, Payload: []byte("abcdef"), ReadSize: 3}, TCPStatusOK},
+		{"length", TCPOptions{Mode: TCPModeLength, Payload: []byte("\x00\x05hello"), LengthPrefix: 2}, TCPStatusOK},
+		{"match regexp", TCPOptions{Mode: TCPModeMatch, Payload: []byte("PING 42\n"), Expect: `PING \d+\n`}, TCPStatusOK},
+		{"match bytes", TCPOptions{Mode: TCPModeMatch, Payload: []byte("\x01\x02"), ExpectBytes: []byte("\x01\x02")}, TCPStatusOK},
+		{"delimiter expect", TCPOptions{Mode: TCPModeDelimiter, Payload: []byte("hello\n"), Expect: "^bye"}, errNoMatch.Error()},
+		{"fixed expect bytes", TCPOptions{Mode: TCPModeFixed, Payload: []byte("hello"), ReadSize: 5, ExpectBytes: []byte("world")},
+			errNoMatch.Error()},
+		{"too long", TCPOptions{Mode: TCPModeDelimiter, Payload: []byte("hello world"), MaxReplySize: 4}, errTooLong.Error()},
+		{"length too long", TCPOptions{Mode: TCPModeLength, Payload: []byte("\x00\x00\x10\x00..."), MaxReplySize: 100},
+			errTooLong.Error()},
+	}
+	for _, tst := range tests {
+		opts := RunnerOptions{TCPOptions: tst.opts}
+		opts.QPS = -1
+		opts.Exactly = 6
+		opts.NumThreads = 2
+		opts.Destination = destination
+		res, err := RunTCPTest(&opts)
+		if err != nil {
+			t.Errorf("%s: %v", tst.name, err)
+			continue
+		}
+		if res.RetCodes[tst.expected] != 6 {
+			t.Errorf("%s: expected 6 %q, got %v", tst.name, tst.expected, res.RetCodes)
+		}
+		if tst.expected == TCPStatusOK && tst.opts.Mode != TCPModeSend && res.SocketCount != 2 {
+			t.Errorf("%s: expected sockets to be reused, got %d", tst.name, res.SocketCount)
+		}
+	}
+}
+
+func TestTCPRunnerModeErrors(t *testing.T) {
+	for _, o := range []TCPOptions{
+		{Mode: "nope"},
+		{Mode: TCPModeFixed},
+		{Mode: TCPModeLength, LengthPrefix: 3},
+		{Mode: TCPModeMatch},
+		{Mode: TCPModeDelimiter, Expect: "("},
+	} {
+		o.Destination = "localhost:1"
+		if _, err := NewTCPClient(&o); err == nil {
+			t.Errorf("Expected error for %+v", o)
+		}
+	}
+	if b, err := ParseEscaped(`\r\n\x00`); err != nil || string(b) != "\r\n\x00" {
+		t.Errorf("Unexpected escaped parsing %q %v", b, err)
+	}
+	if _, err := ParseEscaped(`\q`); err == nil {
+		t.Errorf("Expected error for invalid escape")
+	}
+}
+
+func TestTCPSRunner(t *testing.T) {
+	serverTLS := fhttp.TLSOptions{Cert: "../cert-tmp/server.crt", Key: "../cert-tmp/server.key"}
+	cfg, err := serverTLS.TLSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := fnet.TCPEchoServerTLS("test-tls-echo-runner", ":0", cfg)
+	opts := RunnerOptions{}
+	opts.QPS = -1
+	opts.Exactly = 6
+	opts.NumThreads = 2
+	opts.Destination = fmt.Sprintf("tcps://localhost:%d/", addr.(*net.TCPAddr).Port)
+	opts.TLSOptions = fhttp.TLSOptions{CACert: "../cert-tmp/ca.crt"}
+	res, err := RunTCPTest(&opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.RetCodes[TCPStatusOK] != 6 || res.SocketCount != 2 || res.BytesReceived != res.BytesSent {
+		t.Errorf("Unexpected tls echo results %v sockets %d", res.RetCodes, res.SocketCount)
+	}
+	if res.TLS == nil || res.TLS.Handshakes != 2 || res.TLS.Resumed != 0 || res.TLS.HandshakeTime.Count != 2 {
+		t.Errorf("Unexpected tls stats %+v", res.TLS)
+	}
+	// Reconnecting for each request (reply mismatch), with and without session resumption.
+	opts.Mode = TCPModeDelimiter
+	opts.Payload = []byte("hello\n")
+	opts.Expect = "^bye"
+	for _, resume := range []bool{false, true} {
+		opts.SessionResumption = resume
+		res, err = RunTCPTest(&opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := int64(0)
+		if resume {
+			expected = 4 // all but the first connection of each thread
+		}
+		if res.RetCodes[errNoMatch.Error()] != 6 || res.TLS.Handshakes != 6 || res.TLS.Resumed != expected {
+			t.Errorf("resume %v: unexpected results %v %+v", resume, res.RetCodes, res.TLS)
+		}
+	}
+	// Unknown CA.
+	opts.TLSOptions = fhttp.TLSOptions{}
+	opts.Mode, opts.Expect, opts.Payload = "", "", nil
+	res, err = RunTCPTest(&opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.RetCodes[TCPStatusOK] != 0 || res.TLS.Handshakes != 0 {
+		t.Errorf("Expected handshake errors without the CA, got %v %+v", res.RetCodes, res.TLS)
+	}
+}
+
+func TestTCPRunnerConnModes(t *testing.T) {
+	addr := fnet.TCPEchoServer("test-echo-conn-modes", ":0")
+	opts := RunnerOptions{}
+	opts.QPS = -1
+	opts.Exactly = 6
+	opts.NumThreads = 2
+	opts.Destination = fmt.Sprintf("tcp://localhost:%d/", addr.(*net.TCPAddr).Port)
+	opts.ConnMode = fhttp.ConnModeChurn
+	res, err := RunTCPTest(&opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.RetCodes[TCPStatusOK] != 6 || res.SocketCount != 6 || res.ConnectTime.Count != 6 ||
+		res.CloseTime == nil || res.CloseTime.Count != 6 || res.ConnectionsPerSec <= 0 || res.HeldConnections != 0 {
+		t.Errorf("Unexpected churn results %v sockets %d connect %+v close %+v cps %g",
+			res.RetCodes, res.SocketCount, res.ConnectTime, res.CloseTime, res.ConnectionsPerSec)
+	}
+	opts.ConnMode = fhttp.ConnModeHold
+	opts.NumThreads = 3
+	res, err = RunTCPTest(&opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.RetCodes[TCPStatusOK] != 6 || res.SocketCount != 3 || res.HeldConnections != 3 ||
+		res.ConnectTime.Count != 3 || res.CloseTime != nil {
+		t.Errorf("Unexpected hold results %v sockets %d held %d connect %+v",
+			res.RetCodes, res.SocketCount, res.HeldConnections, res.ConnectTime)
+	}
+	opts.ConnMode = "bogus"
+	if _, err = RunTCPTest(&opts); err == nil {
+		t.Errorf("Expected error for invalid connection mode")
+	}
+}
+
+func TestTCPRunnerThroughput(t *testing.T) {
+	discard := fnet.TCPDiscardServer("test-discard-throughput", ":0")
+	echo := fnet.TCPEchoServer("test-echo-throughput", ":0")
+	for _, mode := range []string{TCPModeSend, TCPModeEcho} {
+		addr := echo
+		if mode == TCPModeSend {
+			addr = discard
+		}
+		opts := RunnerOptions{}
+		opts.QPS = -1
+		opts.Exactly = 20
+		opts.NumThreads = 2
+		opts.Mode = mode
+		opts.Payload = fnet.GenerateRandomPayload(64 * 1024)
+		opts.MeasureThroughput = true
+		opts.ThroughputInterval = 100 * time.Millisecond
+		opts.Destination = fmt.Sprintf("tcp://localhost:%d/", addr.(*net.TCPAddr).Port)
+		res, err := RunTCPTest(&opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tp := res.Throughput
+		if res.RetCodes[TCPStatusOK] != 20 || tp == nil || len(res.ConnThroughput) != 2 ||
+			tp.Bytes != res.BytesSent+res.BytesReceived || tp.Mbps <= 0 || len(tp.Intervals) == 0 || tp.Interval != 0.1 {
+			t.Errorf("%s: unexpected throughput results %v %+v", mode, res.RetCodes, tp)
+		}
+		if mode == TCPModeSend && tp.Bytes != 20*64*1024 {
+			t.Errorf("Expected only the sent bytes to the discard server, got %d", tp.Bytes)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package udprunner
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"fortio.org/fortio/pkg/log"
+	"fortio.org/fortio/pkg/stats"
+)
+
+// StreamHeaderSize is the size of the header of the stream mode packets: the big endian sequence
+// number and send time (unix nanoseconds), followed by the payload.
+// StreamHeaderSize — размер заголовка пакетов потокового режима: порядковый номер и время отправки
+// (наносекунды unix) в big endian, за которыми следует payload.
+const StreamHeaderSize = 16
+
+// StreamResults are the results of the stream mode (iperf/TWAMP style loss, reordering and jitter).
+// StreamResults — результаты потокового режима (потери, переупорядочивание и джиттер в стиле iperf/TWAMP).
+type StreamResults struct {
+	Sent        int64
+	Received    int64 // unique packets received back
+	Lost        int64
+	LossPercent float64
+	Duplicates  int64
+	OutOfOrder  int64 // packets received after one with a higher sequence number
+	Invalid     int64 // packets too short or with an unknown (not sent yet) sequence number
+	// Jitter is the RFC 3550 interarrival jitter in seconds, averaged over the connections.
+	// Jitter — джиттер между прибытиями по RFC 3550 в секундах, усреднённый по соединениям.
+	Jitter float64
+	// Round trip time of the received packets.
+	// Время приёма-передачи полученных пакетов.
+	RTT *stats.HistogramData
+}
+
+// streamState is the per client stream mode state, the sender side being only written by the runner
+// thread and the receiver side by the receiving goroutine.
+// streamState — состояние потокового режима клиента, сторона отправки изменяется только потоком
+// раннера, а сторона приёма — горутиной приёма.
+type streamState struct {
+	packet []byte
+	sent   atomic.Int64 // also read by the receiver, to validate the sequence numbers.
+	// Receiver side.
+	// Сторона приёма.
+	received    atomic.Int64
+	seen        []uint64 // bitset of the received sequence numbers
+	maxSeq      int64
+	duplicates  int64
+	outOfOrder  int64
+	invalid     int64
+	jitter      float64
+	lastTransit time.Duration
+	rtt         *stats.Histogram
+	done        sync.WaitGroup
+}
+
+// startStream connects and starts receiving the echoed packets.
+// startStream подключается и начинает приём возвращённых пакетов.
+func (c *UDPClient) startStream(rtt *stats.Histogram) error {
+	conn, err := c.connect()
+	if conn == nil {
+		return err
+	}
+	c.socket = conn
+	s := &streamState{packet: make([]byte, StreamHeaderSize+len(c.req)), rtt: rtt}
+	copy(s.packet[StreamHeaderSize:], c.req)
+	c.stream = s
+	s.done.Add(1)
+	go c.receive(conn)
+	return nil
+}
+
+// Send sends the next packet of the stream, without waiting for the echo.
+// Send отправляет следующий пакет потока, не дожидаясь эха.
+func (c *UDPClient) Send() error {
+	s := c.stream
+	seq := s.sent.Add(1)
+	binary.BigEndian.PutUint64(s.packet, uint64(seq))                       //nolint:gosec // positive.
+	binary.BigEndian.PutUint64(s.packet[8:], uint64(time.Now().UnixNano())) //nolint:gosec // after 1970.
+	n, err := c.socket.Write(s.packet)
+	c.bytesSent += int64(n)
+	if err != nil {
+		log.Errf("[%d] Unable to write to %v: %v", c.connID, c.dest, err)
+		return err
+	}
+	if n != len(s.packet) {
+		return io.ErrShortWrite
+	}
+	return nil
+}
+
+// receive reads the echoed packets until the socket is closed.
+// receive читает возвращённые пакеты, пока сокет не будет закрыт.
+func (c *UDPClient) receive(conn net.Conn) {
+	s := c.stream
+	defer s.done.Done()
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := conn.Read(buf)
+		if errors.Is(err, syscall.ECONNREFUSED) {
+			// ICMP port unreachable for an earlier packet, those are just lost.
+			// ICMP port unreachable для более раннего пакета, они просто потеряны.
+			log.LogVf("[%d] Stream receiver: %v", c.connID, err)
+			continue
+		}
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.LogVf("[%d] Stream receiver stopping: %v", c.connID, err)
+			}
+			return
+		}
+		c.bytesReceived += int64(n)
+		s.record(buf[:n], time.Now())
+	}
+}
+
+// record updates the receiver side statistics for one packet.
+// record обновляет статистику стороны приёма для одного пакета.
+func (s *streamState) record(packet []byte, now time.Time) {
+	if len(packet) < StreamHeaderSize {
+		s.invalid++
+		return
+	}
+	seq := int64(binary.BigEndian.Uint64(packet))                      //nolint:gosec // our own sequence.
+	sentAt := time.Unix(0, int64(binary.BigEndian.Uint64(packet[8:]))) //nolint:gosec // our own time.
+	if seq <= 0 || seq > s.sent.Load() {
+		s.invalid++
+		return
+	}
+	idx, bit := seq/64, uint64(1)<<(seq%64)
+	for int64(len(s.seen)) <= idx {
+		s.seen = append(s.seen, 0)
+	}
+	if s.seen[idx]&bit != 0 {
+		s.duplicates++
+		return
+	}
+	s.seen[idx] |= bit
+	if seq < s.maxSeq {
+		s.outOfOrder++
+	} else {
+		s.maxSeq = seq
+	}
+	transit := now.Sub(sentAt)
+	s.rtt.Record(transit.Seconds())
+	// RFC 3550 section 6.4.1: J(i) = J(i-1) + (|D(i-1,i)| - J(i-1))/16
+	if s.received.Load() > 0 {
+		d := math.Abs((transit - s.lastTransit).Seconds())
+		s.jitter += (d - s.jitter) / 16
+	}
+	s.lastTransit = transit
+	s.received.Add(1)
+}
+
+// stopStreams waits up to the timeout for the in flight packets and stops the receivers.
+// stopStreams ждёт пакеты в пути до истечения таймаута и останавливает приём.
+func stopStreams(clients []*UDPClient, timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	for _, c := range clients {
+		for c.stream.received.Load() < c.stream.sent.Load() && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		c.Close()
+		c.stream.done.Wait()
+	}
+}
+
+// addTo aggregates the client stream results into the total.
+// addTo добавляет результаты потока клиента к общему итогу.
+func (s *streamState) addTo(total *StreamResults, rtt *stats.Histogram) {
+	received := s.received.Load()
+	total.Sent += s.sent.Load()
+	total.Received += received
+	total.Duplicates += s.duplicates
+	total.OutOfOrder += s.outOfOrder
+	total.Invalid += s.invalid
+	total.Jitter += s.jitter * float64(received) // weighted, divided in finish
+	rtt.Transfer(s.rtt)
+}
+
+// finish computes the loss and average jitter.
+// finish вычисляет потери и средний джиттер.
+func (total *StreamResults) finish() {
+	total.Lost = max(0, total.Sent-total.Received)
+	if total.Sent > 0 {
+		total.LossPercent = 100. * float64(total.Lost) / float64(total.Sent)
+	}
+	if total.Received > 0 {
+		total.Jitter /= float64(total.Received)
+	}
+}
+
+// Print prints the stream mode summary.
+// Print выводит сводку потокового режима.
+func (total *StreamResults) Print(out io.Writer) {
+	_, _ = fmt.Fprintf(out, "UDP stream: sent %d, received %d, lost %d (%.2f %%), duplicates %d, out of order %d, invalid %d\n",
+		total.Sent, total.Received, total.Lost, total.LossPercent, total.Duplicates, total.OutOfOrder, total.Invalid)
+	_, _ = fmt.Fprintf(out, "UDP stream jitter (RFC 3550): %.3f ms\n", total.Jitter*1000.)
+}
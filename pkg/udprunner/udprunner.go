@@ -13,6 +13,7 @@ import (
 
 	"fortio.org/fortio/pkg/fnet"
 	"fortio.org/fortio/pkg/periodic"
+	"fortio.org/fortio/pkg/stats"
 	"fortio.org/fortio/pkg/tcprunner"
 	"fortio.org/fortio/pkg/log"
 )
@@ -35,8 +36,11 @@ type RunnerResults struct {
 	SocketCount   int
 	BytesSent     int64
 	BytesReceived int64
-	client        *UDPClient
-	aborter       *periodic.Aborter
+	// Stream is set in stream mode.
+	// Stream заполняется в потоковом режиме.
+	Stream  *StreamResults `json:",omitempty"`
+	client  *UDPClient
+	aborter *periodic.Aborter
 }
 
 // Run tests UDP request fetching. Main call being run at the target QPS.
@@ -45,7 +49,12 @@ type RunnerResults struct {
 // Должен быть установлен как Function в RunnerOptions.
 func (udpstate *RunnerResults) Run(_ context.Context, t periodic.ThreadID) (bool, string) {
 	log.Debugf("Calling in %d", t)
-	_, err := udpstate.client.Fetch()
+	var err error
+	if udpstate.client.stream != nil {
+		err = udpstate.client.Send()
+	} else {
+		_, err = udpstate.client.Fetch()
+	}
 	if err != nil {
 		errStr := err.Error()
 		udpstate.RetCodes[errStr]++
@@ -61,6 +70,13 @@ type UDPOptions struct {
 	Destination string
 	Payload     []byte // what to send (and check)
 	ReqTimeout  time.Duration
+	// Stream mode sends sequence numbered and timestamped packets at the target rate without waiting
+	// for each echo, to measure loss, duplicates, reordering and jitter. ReqTimeout is then the time
+	// waited at the end for the packets in flight.
+	// Потоковый режим отправляет пакеты с порядковым номером и временем с целевой частотой, не ожидая
+	// каждого эха, для измерения потерь, дубликатов, переупорядочивания и джиттера. ReqTimeout тогда —
+	// время ожидания пакетов в пути в конце.
+	Stream bool
 }
 
 // RunnerOptions includes the base RunnerOptions plus UDP specific
@@ -86,6 +102,7 @@ type UDPClient struct {
 	destination   string
 	doGenerate    bool
 	reqTimeout    time.Duration
+	stream        *streamState
 }
 
 var (
@@ -238,6 +255,11 @@ func RunUDPTest(o *RunnerOptions) (*RunnerResults, error) {
 		RetCodes: make(UDPResultMap),
 	}
 	total.Destination = o.Destination
+	var rtt *stats.Histogram
+	if o.Stream {
+		total.Stream = &StreamResults{}
+		rtt = stats.NewHistogram(r.Options().Offset.Seconds(), r.Options().Resolution)
+	}
 	udpstate := make([]RunnerResults, numThreads)
 	var err error
 	for i := range numThreads {
@@ -249,7 +271,11 @@ func RunUDPTest(o *RunnerOptions) (*RunnerResults, error) {
 			return nil, fmt.Errorf("unable to create client %d for %s: %w", i, o.Destination, err)
 		}
 		udpstate[i].client.connID = i
-		if o.Exactly <= 0 {
+		if o.Stream {
+			if err = udpstate[i].client.startStream(rtt.Clone()); err != nil {
+				return nil, fmt.Errorf("unable to start stream %d for %s: %w", i, o.Destination, err)
+			}
+		} else if o.Exactly <= 0 {
 			data, err := udpstate[i].client.Fetch()
 			if i == 0 && log.LogVerbose() {
 				log.LogVf("first hit of %s: err %v, received %d: %q", o.Destination, err, len(data), data)
@@ -266,7 +292,17 @@ func RunUDPTest(o *RunnerOptions) (*RunnerResults, error) {
 	// Количество потоков могло уменьшиться, но должно быть нормально накапливать 0 от
 	// неиспользуемых. Мы также должны очистить все созданные клиенты.
 	keys := []string{}
+	if o.Stream {
+		clients := make([]*UDPClient, numThreads)
+		for i := range numThreads {
+			clients[i] = udpstate[i].client
+		}
+		stopStreams(clients, clients[0].reqTimeout)
+	}
 	for i := range numThreads {
+		if o.Stream {
+			udpstate[i].client.stream.addTo(total.Stream, rtt)
+		}
 		total.SocketCount += udpstate[i].client.Close()
 		total.BytesReceived += udpstate[i].client.bytesReceived
 		total.BytesSent += udpstate[i].client.bytesSent
@@ -283,6 +319,12 @@ func RunUDPTest(o *RunnerOptions) (*RunnerResults, error) {
 	totalCount := float64(total.DurationHistogram.Count)
 	_, _ = fmt.Fprintf(out, "Sockets used: %d (for perfect no error run, would be %d)\n", total.SocketCount, r.Options().NumThreads)
 	_, _ = fmt.Fprintf(out, "Total Bytes sent: %d, received: %d\n", total.BytesSent, total.BytesReceived)
+	if total.Stream != nil {
+		total.Stream.finish()
+		total.Stream.RTT = rtt.Export().CalcPercentiles(r.Options().Percentiles)
+		total.Stream.RTT.Print(out, "UDP stream round trip time histogram (s)")
+		total.Stream.Print(out)
+	}
 	sort.Strings(keys)
 	for _, k := range keys {
 		_, _ = fmt.Fprintf(out, "udp %s : %d (%.1f %%)\n", k, total.RetCodes[k], 100.*float64(total.RetCodes[k])/totalCount)
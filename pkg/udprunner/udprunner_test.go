@@ -16,12 +16,16 @@
 package udprunner
 
 import (
+	"encoding/binary"
 	"fmt"
+	"math"
 	"net"
 	"runtime"
 	"testing"
+	"time"
 
 	"fortio.org/fortio/pkg/fnet"
+	"fortio.org/fortio/pkg/stats"
 )
 
 func TestUDPRunnerBadDestination(t *testing.T) {
@@ -95,3 +99,67 @@ func TestUDPNotLeaking(t *testing.T) {
 		t.Errorf("%d socket used, expected same as thread# %d", res.SocketCount, res.RunnerResults.NumThreads)
 	}
 }
+
+func TestUDPRunnerStream(t *testing.T) {
+	addr := fnet.UDPEchoServer("test-echo-stream", ":0", false)
+	opts := RunnerOptions{}
+	opts.QPS = 2000
+	opts.Exactly = 100
+	opts.NumThreads = 2
+	opts.Stream = true
+	opts.Payload = []byte("some padding")
+	opts.Destination = fmt.Sprintf("udp://localhost:%d/", addr.(*net.UDPAddr).Port)
+	res, err := RunUDPTest(&opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := res.Stream
+	if s == nil || s.Sent != 100 || s.Received != 100 || s.Lost != 0 || s.Duplicates != 0 || s.RTT.Count != 100 {
+		t.Fatalf("Unexpected stream results %+v", s)
+	}
+	if res.BytesSent != 100*(StreamHeaderSize+12) || res.BytesReceived != res.BytesSent {
+		t.Errorf("Unexpected bytes sent %d received %d", res.BytesSent, res.BytesReceived)
+	}
+	// Nothing listening: all lost, after the timeout.
+	opts.Destination = "udp://localhost:1/"
+	opts.ReqTimeout = 50 * time.Millisecond
+	opts.Exactly = 10
+	if res, err = RunUDPTest(&opts); err != nil {
+		t.Fatal(err)
+	}
+	if res.Stream.Sent != 10 || res.Stream.Received != 0 || res.Stream.LossPercent != 100 {
+		t.Errorf("Expected all packets lost, got %+v", res.Stream)
+	}
+}
+
+func TestStreamRecord(t *testing.T) {
+	s := &streamState{rtt: stats.NewHistogram(0, 0.001)}
+	start := time.Now()
+	packet := func(seq int64, sent time.Duration) []byte {
+		p := make([]byte, StreamHeaderSize)
+		binary.BigEndian.PutUint64(p, uint64(seq))
+		binary.BigEndian.PutUint64(p[8:], uint64(start.Add(sent).UnixNano()))
+		return p
+	}
+	s.sent.Store(5)
+	// 1 and 3 with 10ms transit, 2 late with 30ms, 3 duplicated, 5 lost, two invalid (short and not sent).
+	s.record(packet(1, 0), start.Add(10*time.Millisecond))
+	s.record(packet(3, 20*time.Millisecond), start.Add(30*time.Millisecond))
+	s.record(packet(2, 10*time.Millisecond), start.Add(40*time.Millisecond))
+	s.record(packet(3, 20*time.Millisecond), start.Add(50*time.Millisecond))
+	s.record(packet(4, 30*time.Millisecond), start.Add(40*time.Millisecond))
+	s.record([]byte("short"), start)
+	s.record(packet(1<<40, 0), start)
+	total := &StreamResults{}
+	rtt := stats.NewHistogram(0, 0.001)
+	s.addTo(total, rtt)
+	total.finish()
+	if total.Received != 4 || total.Lost != 1 || total.LossPercent != 20 || total.Duplicates != 1 ||
+		total.OutOfOrder != 1 || total.Invalid != 2 || rtt.Count != 4 || len(s.seen) != 1 {
+		t.Errorf("Unexpected stream stats %+v", total)
+	}
+	// D: 0, 20ms, 20ms -> J = 1.25ms, then 2.42ms
+	if math.Abs(total.Jitter-0.00242) > 0.0001 {
+		t.Errorf("Unexpected jitter %g", total.Jitter)
+	}
+}
@@ -0,0 +1,345 @@
+// Copyright 2026 Fortio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package wsrunner is the WebSocket echo load runner: N connections sending
+// messages at the target QPS and measuring the echo round trip.
+package wsrunner // import "fortio.org/fortio/pkg/wsrunner"
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"fortio.org/fortio/pkg/fhttp"
+	"fortio.org/fortio/pkg/log"
+	"fortio.org/fortio/pkg/periodic"
+	"fortio.org/fortio/pkg/stats"
+	"golang.org/x/net/websocket"
+)
+
+type WSResultMap map[string]int64
+
+var (
+	// WSURLPrefix is the URL prefix for triggering WebSocket load.
+	WSURLPrefix = "ws://"
+	// WSSURLPrefix is the URL prefix for triggering secure WebSocket load.
+	WSSURLPrefix = "wss://"
+	// WSStatusOK is the map key on success.
+	WSStatusOK  = "OK"
+	errMismatch = errors.New("reply not echoing message")
+)
+
+// Disconnect reasons, keys of RunnerResults.Disconnects.
+const (
+	DisconnectServerClose = "closed by server"
+	DisconnectTimeout     = "timeout"
+	DisconnectReset       = "connection reset"
+	DisconnectError       = "error"
+)
+
+// IsWebSocketURL returns true if the url is a ws:// or wss:// one.
+func IsWebSocketURL(url string) bool {
+	lc := strings.ToLower(url)
+	return strings.HasPrefix(lc, WSURLPrefix) || strings.HasPrefix(lc, WSSURLPrefix)
+}
+
+// WSOptions are options to the WSClient.
+type WSOptions struct {
+	fhttp.TLSOptions
+	Destination string // ws:// or wss:// url
+	Payload     []byte // what to send (and check), generated when empty
+	Origin      string // Origin header, defaults to http(s):// + host of the destination
+	ReqTimeout  time.Duration
+}
+
+// RunnerOptions includes the base RunnerOptions plus WebSocket specific
+// options.
+type RunnerOptions struct {
+	periodic.RunnerOptions
+	WSOptions
+}
+
+// RunnerResults is the aggregated result of a WebSocket run.
+// Also is the internal type used per thread/goroutine.
+type RunnerResults struct {
+	periodic.RunnerResults
+	WSOptions
+	RetCodes      WSResultMap
+	SocketCount   int
+	BytesSent     int64
+	BytesReceived int64
+	// Connection setup (TCP, TLS and upgrade) time stats.
+	ConnectionStats *stats.HistogramData
+	// Why connections got closed/dropped during the run.
+	Disconnects WSResultMap
+	client      *WSClient
+	aborter     *periodic.Aborter
+}
+
+// Run sends one message and waits for its echo. Main call being run at the target QPS.
+// To be set as the Function in RunnerOptions.
+func (wsstate *RunnerResults) Run(ctx context.Context, t periodic.ThreadID) (bool, string) {
+	log.Debugf("Calling in %d", t)
+	_, err := wsstate.client.Fetch(ctx)
+	if err != nil {
+		errStr := err.Error()
+		wsstate.RetCodes[errStr]++
+		return false, errStr
+	}
+	wsstate.RetCodes[WSStatusOK]++
+	return true, WSStatusOK
+}
+
+// WSClient is the client used for WebSocket echo testing.
+type WSClient struct {
+	config        *websocket.Config
+	conn          *websocket.Conn
+	req           []byte
+	buffer        []byte
+	connID        int
+	messageCount  int64
+	bytesSent     int64
+	bytesReceived int64
+	socketCount   int
+	doGenerate    bool
+	reqTimeout    time.Duration
+	connectStats  *stats.Histogram
+	disconnects   WSResultMap
+}
+
+// GeneratePayload generates a default unique payload for each runner thread and message sent
+// when no other payload is set.
+func GeneratePayload(t int, i int64) []byte {
+	return fmt.Appendf(nil, "Fortio\n%04d\n%012d", t, i) // 24 bytes, like the tcp runner
+}
+
+// NewWSClient creates and initialize and returns a client based on the WSOptions.
+func NewWSClient(o *WSOptions, offset time.Duration, resolution float64) (*WSClient, error) {
+	if !IsWebSocketURL(o.Destination) {
+		return nil, fmt.Errorf("invalid websocket url %q", o.Destination)
+	}
+	origin := o.Origin
+	if origin == "" {
+		origin = "http" + strings.TrimPrefix(strings.ToLower(o.Destination), "ws")
+	}
+	config, err := websocket.NewConfig(o.Destination, origin)
+	if err != nil {
+		return nil, err
+	}
+	c := WSClient{
+		config:       config,
+		req:          o.Payload,
+		reqTimeout:   o.ReqTimeout,
+		connectStats: stats.NewHistogram(offset.Seconds(), resolution),
+		disconnects:  make(WSResultMap),
+	}
+	if len(c.req) == 0 {
+		c.doGenerate = true
+		c.req = GeneratePayload(0, 0)
+	}
+	if c.reqTimeout <= 0 {
+		log.Debugf("Request timeout not set, using default %v", fhttp.HTTPReqTimeOutDefaultValue)
+		c.reqTimeout = fhttp.HTTPReqTimeOutDefaultValue
+	}
+	config.Dialer = &net.Dialer{Timeout: c.reqTimeout}
+	if strings.HasPrefix(strings.ToLower(o.Destination), WSSURLPrefix) {
+		if config.TlsConfig, err = o.TLSOptions.TLSConfig(); err != nil {
+			return nil, err
+		}
+	}
+	return &c, nil
+}
+
+func (c *WSClient) connect(ctx context.Context) (*websocket.Conn, error) {
+	c.socketCount++
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(ctx, c.reqTimeout)
+	defer cancel()
+	conn, err := c.config.DialContext(ctx)
+	if err != nil {
+		log.Errf("[%d] Unable to connect to %v : %v", c.connID, c.config.Location, err)
+		return nil, err
+	}
+	c.connectStats.Record(time.Since(start).Seconds())
+	return conn, nil
+}
+
+// disconnectReason classifies errors on an established connection.
+func disconnectReason(err error) string {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, io.EOF):
+		return DisconnectServerClose
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return DisconnectTimeout
+	case errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE):
+		return DisconnectReset
+	default:
+		return DisconnectError
+	}
+}
+
+func (c *WSClient) disconnect(conn *websocket.Conn, err error) {
+	reason := disconnectReason(err)
+	c.disconnects[reason]++
+	log.LogVf("[%d] Closing websocket (%s): %v", c.connID, reason, err)
+	_ = conn.Close()
+}
+
+// Fetch sends the message and reads back the echo reply.
+func (c *WSClient) Fetch(ctx context.Context) ([]byte, error) {
+	conn := c.conn
+	c.messageCount++
+	reuse := (conn != nil)
+	if !reuse {
+		var err error
+		conn, err = c.connect(ctx)
+		if conn == nil {
+			return nil, err
+		}
+	}
+	c.conn = nil // because of error returns and single retry
+	deadlineErr := conn.SetDeadline(time.Now().Add(c.reqTimeout))
+	if c.doGenerate {
+		c.req = GeneratePayload(c.connID, c.messageCount)
+	}
+	err := websocket.Message.Send(conn, c.req)
+	if err != nil || deadlineErr != nil {
+		c.disconnect(conn, errors.Join(err, deadlineErr))
+		if reuse {
+			// it's ok for the (idle) connection to die once, auto reconnect:
+			return c.Fetch(ctx) // recurse once
+		}
+		log.Errf("[%d] Unable to send to %v: %v", c.connID, c.config.Location, err)
+		return nil, err
+	}
+	c.bytesSent += int64(len(c.req))
+	err = websocket.Message.Receive(conn, &c.buffer)
+	if err != nil {
+		c.disconnect(conn, err)
+		if reuse && errors.Is(err, io.EOF) {
+			// server closed the idle connection (before or while we were sending), reconnect once:
+			return c.Fetch(ctx)
+		}
+		log.Errf("[%d] Unable to receive: %v", c.connID, err)
+		return nil, err
+	}
+	c.bytesReceived += int64(len(c.buffer))
+	if log.LogDebug() {
+		log.Debugf("[%d] received %d: %q", c.connID, len(c.buffer), c.buffer)
+	}
+	c.conn = conn // reuse even on mismatch, the connection is fine.
+	if !bytes.Equal(c.buffer, c.req) {
+		log.Infof("Mismatch between sent %q and received %q", string(c.req), string(c.buffer))
+		return c.buffer, errMismatch
+	}
+	return c.buffer, nil
+}
+
+// Close closes the last connection and returns the total number of connections used for the run.
+func (c *WSClient) Close() int {
+	log.Debugf("Closing %p: %s socket count %d", c, c.config.Location, c.socketCount)
+	if c.conn != nil {
+		if err := c.conn.Close(); err != nil {
+			log.Warnf("Error closing websocket client's connection: %v", err)
+		}
+		c.conn = nil
+	}
+	return c.socketCount
+}
+
+// RunWSTest runs a WebSocket test and returns the aggregated stats.
+func RunWSTest(o *RunnerOptions) (*RunnerResults, error) {
+	o.RunType = "WebSocket"
+	log.Infof("Starting websocket test for %s with %d threads at %.1f qps", o.Destination, o.NumThreads, o.QPS)
+	r := periodic.NewPeriodicRunner(&o.RunnerOptions)
+	defer r.Options().Abort()
+	numThreads := r.Options().NumThreads
+	out := r.Options().Out // Important as the default value is set from nil to stdout inside NewPeriodicRunner
+	total := RunnerResults{
+		WSOptions:   o.WSOptions,
+		aborter:     r.Options().Stop,
+		RetCodes:    make(WSResultMap),
+		Disconnects: make(WSResultMap),
+	}
+	wsstate := make([]RunnerResults, numThreads)
+	ctx := context.Background()
+	for i := range numThreads {
+		r.Options().Runners[i] = &wsstate[i]
+		client, err := NewWSClient(&o.WSOptions, r.Options().Offset, r.Options().Resolution)
+		if client == nil {
+			return nil, fmt.Errorf("unable to create client %d for %s: %w", i, o.Destination, err)
+		}
+		client.connID = i
+		wsstate[i].client = client
+		if o.Exactly <= 0 {
+			data, err := client.Fetch(ctx)
+			if i == 0 && log.LogVerbose() {
+				log.LogVf("first hit of %s: err %v, received %d: %q", o.Destination, err, len(data), data)
+			}
+		}
+		wsstate[i].aborter = total.aborter
+		wsstate[i].RetCodes = make(WSResultMap)
+	}
+	total.RunnerResults = r.Run()
+	connectionStats := stats.NewHistogram(r.Options().Offset.Seconds(), r.Options().Resolution)
+	keys := []string{}
+	for i := range numThreads {
+		client := wsstate[i].client
+		total.SocketCount += client.Close()
+		total.BytesReceived += client.bytesReceived
+		total.BytesSent += client.bytesSent
+		connectionStats.Transfer(client.connectStats)
+		for k, v := range client.disconnects {
+			total.Disconnects[k] += v
+		}
+		for k := range wsstate[i].RetCodes {
+			if _, exists := total.RetCodes[k]; !exists {
+				keys = append(keys, k)
+			}
+			total.RetCodes[k] += wsstate[i].RetCodes[k]
+		}
+	}
+	// Cleanup state:
+	r.Options().ReleaseRunners()
+	total.ConnectionStats = connectionStats.Export().CalcPercentiles(o.Percentiles)
+	if log.Log(log.Info) {
+		total.ConnectionStats.Print(out, "Connection time histogram (s)")
+	} else if log.Log(log.Warning) {
+		connectionStats.Counter.Print(out, "Connection time (s)")
+	}
+	totalCount := float64(total.DurationHistogram.Count)
+	_, _ = fmt.Fprintf(out, "Connections used: %d (for perfect no error run, would be %d)\n", total.SocketCount, r.Options().NumThreads)
+	_, _ = fmt.Fprintf(out, "Total Bytes sent: %d, received: %d\n", total.BytesSent, total.BytesReceived)
+	reasons := make([]string, 0, len(total.Disconnects))
+	for k := range total.Disconnects {
+		reasons = append(reasons, k)
+	}
+	sort.Strings(reasons)
+	for _, k := range reasons {
+		_, _ = fmt.Fprintf(out, "Disconnect %s : %d\n", k, total.Disconnects[k])
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		_, _ = fmt.Fprintf(out, "ws %s : %d (%.1f %%)\n", k, total.RetCodes[k], 100.*float64(total.RetCodes[k])/totalCount)
+	}
+	return &total, nil
+}
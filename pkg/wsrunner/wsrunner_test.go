@@ -0,0 +1,106 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package wsrunner
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"fortio.org/fortio/pkg/fhttp"
+)
+
+func TestWSRunner(t *testing.T) {
+	_, addr := fhttp.Serve("0", "")
+	port := addr.(*net.TCPAddr).Port
+
+	opts := RunnerOptions{}
+	opts.QPS = 100
+	opts.Exactly = 50
+	opts.NumThreads = 3
+	opts.Destination = fmt.Sprintf("ws://localhost:%d/?delay=1ms", port)
+	res, err := RunWSTest(&opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.RetCodes[WSStatusOK] != 50 {
+		t.Errorf("Expected 50 ok, got %v", res.RetCodes)
+	}
+	if res.SocketCount != 3 {
+		t.Errorf("%d connections used, expected 3", res.SocketCount)
+	}
+	if res.BytesReceived != res.BytesSent || res.BytesSent != 50*24 {
+		t.Errorf("Unexpected bytes sent %d / received %d", res.BytesSent, res.BytesReceived)
+	}
+	if res.ConnectionStats.Count != 3 {
+		t.Errorf("Expected 3 connection time points, got %d", res.ConnectionStats.Count)
+	}
+	if len(res.Disconnects) != 0 {
+		t.Errorf("Unexpected disconnects %v", res.Disconnects)
+	}
+}
+
+func TestWSRunnerServerClose(t *testing.T) {
+	_, addr := fhttp.Serve("0", "")
+	port := addr.(*net.TCPAddr).Port
+	opts := RunnerOptions{}
+	opts.QPS = 100
+	opts.Exactly = 10
+	opts.NumThreads = 1
+	opts.Destination = fmt.Sprintf("ws://localhost:%d/?close=true", port)
+	res, err := RunWSTest(&opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every message gets echoed then the connection is closed, reconnect on the next one after noticing.
+	if res.RetCodes[WSStatusOK] != 10 {
+		t.Errorf("Expected 10 ok, got %v", res.RetCodes)
+	}
+	if res.SocketCount != 10 {
+		t.Errorf("%d connections used, expected 10", res.SocketCount)
+	}
+	if res.Disconnects[DisconnectServerClose] != 9 {
+		t.Errorf("Expected 9 server closes, got %v", res.Disconnects)
+	}
+}
+
+func TestWSClientErrors(t *testing.T) {
+	_, addr := fhttp.Serve("0", "")
+	port := addr.(*net.TCPAddr).Port
+	o := WSOptions{Destination: fmt.Sprintf("ws://localhost:%d/?status=503", port)}
+	c, err := NewWSClient(&o, 0, 0.001)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.Fetch(context.Background()); err == nil {
+		t.Errorf("Expected error on refused upgrade")
+	}
+	o = WSOptions{Destination: fmt.Sprintf("ws://localhost:%d/?size=3", port), ReqTimeout: time.Second}
+	c, _ = NewWSClient(&o, 0, 0.001)
+	data, err := c.Fetch(context.Background())
+	if err != errMismatch || len(data) != 3 {
+		t.Errorf("Expected mismatch with 3 bytes, got %v %d", err, len(data))
+	}
+	if c.Close() != 1 {
+		t.Errorf("Expected 1 connection")
+	}
+	o = WSOptions{Destination: "http://localhost/"}
+	if _, err = NewWSClient(&o, 0, 0.001); err == nil {
+		t.Errorf("Expected error for non ws url")
+	}
+}